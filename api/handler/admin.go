@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type AdminHandler struct {
+	loginGuard service.LoginGuard
+}
+
+func NewAdminHandler(loginGuard service.LoginGuard) *AdminHandler {
+	return &AdminHandler{loginGuard: loginGuard}
+}
+
+func (h *AdminHandler) ListLockouts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.loginGuard.Lockouts())
+}
+
+func (h *AdminHandler) Unlock(w http.ResponseWriter, r *http.Request) {
+	account := entity.NormalizeEmail(chi.URLParam(r, "account"))
+	if !h.loginGuard.Unlock(account) {
+		http.Error(w, "Lockout not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
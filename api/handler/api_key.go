@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+	"github.com/biswasurmi/book-cli/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type APIKeyHandler struct {
+	keys service.APIKeyService
+}
+
+func NewAPIKeyHandler(keys service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{keys: keys}
+}
+
+// createdAPIKey is the response to Create, the only one that includes the
+// full key.
+type createdAPIKey struct {
+	entity.APIKey
+	Key string `json:"key"`
+}
+
+// Create issues a key for the current user.
+func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name      string    `json:"name"`
+		Scopes    []string  `json:"scopes"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	key, raw, err := h.keys.Create(userID, strings.TrimSpace(req.Name), req.Scopes, req.ExpiresAt)
+	switch {
+	case errors.Is(err, service.ErrInvalidScope), errors.Is(err, service.ErrInvalidKeyExpiry):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, service.ErrScopeNotAllowed):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, "Error creating API key", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createdAPIKey{APIKey: key.WithoutHash(), Key: raw})
+}
+
+func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	keys, err := h.keys.List(userID)
+	if err != nil {
+		http.Error(w, "Error listing API keys", http.StatusInternalServerError)
+		return
+	}
+	out := make([]entity.APIKey, 0, len(keys))
+	for _, key := range keys {
+		out = append(out, key.WithoutHash())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func (h *APIKeyHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	err := h.keys.Revoke(userID, chi.URLParam(r, "id"))
+	switch {
+	case errors.Is(err, repository.ErrAPIKeyNotFound):
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, "Error revoking API key", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
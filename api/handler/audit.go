@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/service"
+)
+
+// ndjsonContentType is the media type of newline-delimited JSON, one
+// event per line.
+const ndjsonContentType = "application/x-ndjson"
+
+type AuditHandler struct {
+	audit service.AuditService
+}
+
+func NewAuditHandler(audit service.AuditService) *AuditHandler {
+	return &AuditHandler{audit: audit}
+}
+
+// List returns audit events, oldest first, filtered by the actor, action,
+// target_type, target_id, since and until query parameters. Times are
+// RFC 3339; since is inclusive and until exclusive. With ?format=ndjson or
+// an Accept header of application/x-ndjson the events are written one per
+// line for export.
+func (h *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := entity.AuditFilter{
+		Action:     query.Get("action"),
+		TargetType: query.Get("target_type"),
+		TargetID:   query.Get("target_id"),
+	}
+	if actor := query.Get("actor"); actor != "" {
+		id, err := strconv.ParseInt(actor, 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid actor", http.StatusBadRequest)
+			return
+		}
+		filter.ActorID = id
+	}
+	for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				http.Error(w, "Invalid "+name+", expected an RFC 3339 time", http.StatusBadRequest)
+				return
+			}
+			*t = parsed
+		}
+	}
+
+	events, err := h.audit.List(filter)
+	if err != nil {
+		http.Error(w, "Error fetching audit log", http.StatusInternalServerError)
+		return
+	}
+
+	if query.Get("format") == "ndjson" || strings.Contains(r.Header.Get("Accept"), ndjsonContentType) {
+		w.Header().Set("Content-Type", ndjsonContentType)
+		// Encode writes a newline after every value
+		enc := json.NewEncoder(w)
+		for _, event := range events {
+			if err := enc.Encode(event); err != nil {
+				return
+			}
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/biswasurmi/book-cli/domain/repository"
+	"github.com/biswasurmi/book-cli/service"
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *BookHandler) ListRevisions(w http.ResponseWriter, r *http.Request) {
+	revisions, err := h.BookService.ListRevisions(chi.URLParam(r, "uuid"))
+	if err != nil {
+		writeRevisionError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+func (h *BookHandler) GetRevision(w http.ResponseWriter, r *http.Request) {
+	number, ok := revisionNumber(w, chi.URLParam(r, "n"))
+	if !ok {
+		return
+	}
+	revision, err := h.BookService.GetRevision(chi.URLParam(r, "uuid"), number)
+	if err != nil {
+		writeRevisionError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revision)
+}
+
+// DiffRevisions compares the revisions given by the from and to query
+// parameters.
+func (h *BookHandler) DiffRevisions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, ok := revisionNumber(w, query.Get("from"))
+	if !ok {
+		return
+	}
+	to, ok := revisionNumber(w, query.Get("to"))
+	if !ok {
+		return
+	}
+	diff, err := h.BookService.DiffRevisions(chi.URLParam(r, "uuid"), from, to)
+	if err != nil {
+		writeRevisionError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diff)
+}
+
+func (h *BookHandler) RestoreRevision(w http.ResponseWriter, r *http.Request) {
+	number, ok := revisionNumber(w, chi.URLParam(r, "n"))
+	if !ok {
+		return
+	}
+	book, err := h.BookService.RestoreRevision(requestActor(r), chi.URLParam(r, "uuid"), number)
+	if err != nil {
+		writeRevisionError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(book)
+}
+
+// revisionNumber parses a revision number, answering 400 if it is not a
+// positive integer.
+func revisionNumber(w http.ResponseWriter, value string) (int, bool) {
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 1 {
+		http.Error(w, "Invalid revision number", http.StatusBadRequest)
+		return 0, false
+	}
+	return number, true
+}
+
+func writeRevisionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrBookNotFound):
+		http.Error(w, "Book not found", http.StatusNotFound)
+	case errors.Is(err, repository.ErrBookRevisionNotFound):
+		http.Error(w, "Revision not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidRevision):
+		http.Error(w, "Invalid revision number", http.StatusBadRequest)
+	case errors.Is(err, service.ErrNotOwner):
+		http.Error(w, "Only the book's owner or an admin can change it", http.StatusForbidden)
+	default:
+		http.Error(w, "Error fetching revisions", http.StatusInternalServerError)
+	}
+}
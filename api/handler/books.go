@@ -2,11 +2,12 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"github.com/biswasurmi/book-cli/api/middleware"
 	"github.com/biswasurmi/book-cli/domain/entity"
 	"github.com/biswasurmi/book-cli/service"
 	"github.com/go-chi/chi/v5"
-	"github.com/google/uuid"
 )
 
 type BookHandler struct {
@@ -18,7 +19,38 @@ func NewBookHandler(service service.BookService) *BookHandler {
 }
 
 func (h *BookHandler) ListBooks(w http.ResponseWriter, r *http.Request) {
-	books, err := h.BookService.ListBooks()
+	query := r.URL.Query()
+	filter := entity.BookFilter{
+		Name:   query.Get("name"),
+		Author: query.Get("author"),
+		ISBN:   query.Get("isbn"),
+	}
+
+	books, err := h.BookService.ListBooks(filter)
+	if err != nil {
+		http.Error(w, "Error fetching books", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(books)
+}
+
+// ListMyBooks lists the books the current user created, with the same
+// filters as ListBooks.
+func (h *BookHandler) ListMyBooks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	filter := entity.BookFilter{
+		Name:      query.Get("name"),
+		Author:    query.Get("author"),
+		ISBN:      query.Get("isbn"),
+		CreatedBy: userID,
+	}
+
+	books, err := h.BookService.ListBooks(filter)
 	if err != nil {
 		http.Error(w, "Error fetching books", http.StatusInternalServerError)
 		return
@@ -35,8 +67,7 @@ func (h *BookHandler) CreateBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	book.UUID = uuid.NewString()
-	createdBook, err := h.BookService.CreateBook(book)
+	createdBook, err := h.BookService.CreateBook(requestActor(r), book)
 	if err != nil {
 		http.Error(w, "Error creating book", http.StatusInternalServerError)
 		return
@@ -83,9 +114,11 @@ func (h *BookHandler) UpdateBook(w http.ResponseWriter, r *http.Request) {
 	}
 
 	book.UUID = uuid // Ensure UUID from URL is used
-	updatedBook, err := h.BookService.UpdateBook(book)
+	updatedBook, err := h.BookService.UpdateBook(requestActor(r), book)
 	if err != nil {
-		if err.Error() == "book not found" {
+		if errors.Is(err, service.ErrNotOwner) {
+			http.Error(w, "Only the book's owner or an admin can change it", http.StatusForbidden)
+		} else if err.Error() == "book not found" {
 			http.Error(w, "Book not found", http.StatusNotFound)
 		} else {
 			http.Error(w, "Error updating book", http.StatusInternalServerError)
@@ -104,9 +137,11 @@ func (h *BookHandler) DeleteBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.BookService.DeleteBook(uuid)
+	err := h.BookService.DeleteBook(requestActor(r), uuid)
 	if err != nil {
-		if err.Error() == "book not found" {
+		if errors.Is(err, service.ErrNotOwner) {
+			http.Error(w, "Only the book's owner or an admin can delete it", http.StatusForbidden)
+		} else if err.Error() == "book not found" {
 			http.Error(w, "Book not found", http.StatusNotFound)
 		} else {
 			http.Error(w, "Error deleting book", http.StatusInternalServerError)
@@ -115,4 +150,14 @@ func (h *BookHandler) DeleteBook(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.WriteHeader(http.StatusNoContent)
+}
+
+// requestActor returns the actor stored by middleware.ResolveActor. Without
+// authentication there is none, and every caller may change every book.
+func requestActor(r *http.Request) service.Actor {
+	actor := middleware.RequestActor(r)
+	if _, ok := r.Context().Value("actor").(service.Actor); !ok {
+		actor.Role = entity.RoleAdmin
+	}
+	return actor
 }
\ No newline at end of file
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/service"
+)
+
+// eventResync is sent instead of the missed events when a stream cannot be
+// resumed, telling the client to reload what it shows.
+const eventResync = "resync"
+
+type EventsHandler struct {
+	events service.EventBus
+}
+
+func NewEventsHandler(events service.EventBus) *EventsHandler {
+	return &EventsHandler{events: events}
+}
+
+// Stream returns a handler that streams change events as Server-Sent
+// Events, sending a comment every keepAlive while idle. A client resumes
+// after the ID in its Last-Event-ID header (or ?last_event_id=); if that
+// event is no longer kept it gets a resync event followed by every kept
+// event. ?types= limits the stream to a comma-separated list of event
+// types. User events are only sent to admins.
+//
+// A client that cannot keep up is disconnected and is expected to
+// reconnect with its Last-Event-ID.
+func (h *EventsHandler) Stream(keepAlive time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lastID, err := lastEventID(r)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		types, err := eventTypes(r.URL.Query().Get("types"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		admin := requestActor(r).Elevated()
+		visible := func(event entity.Event) bool {
+			if event.IsUserEvent() && !admin {
+				return false
+			}
+			return types == nil || types[event.Type]
+		}
+
+		sub := h.events.Subscribe(lastID)
+		defer h.events.Unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		// Keep proxies such as nginx from buffering the stream
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher := http.NewResponseController(w)
+
+		if sub.Missed {
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: {}\n\n", eventResync); err != nil {
+				return
+			}
+		}
+		for _, event := range sub.Backlog {
+			if visible(event) {
+				if err := writeEvent(w, event); err != nil {
+					return
+				}
+			}
+		}
+		if err := flusher.Flush(); err != nil {
+			return
+		}
+
+		ticker := time.NewTicker(keepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			case event, ok := <-sub.Events:
+				if !ok {
+					// Dropped for falling behind, or shutting down
+					return
+				}
+				if !visible(event) {
+					continue
+				}
+				if err := writeEvent(w, event); err != nil {
+					return
+				}
+			}
+			if err := flusher.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event entity.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// lastEventID reads the ID to resume after, 0 if there is none.
+func lastEventID(r *http.Request) (int64, error) {
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("last_event_id")
+	}
+	if raw == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid event ID %q", raw)
+	}
+	return id, nil
+}
+
+// eventTypes parses a comma-separated list of event types, nil for an
+// empty list.
+func eventTypes(list string) (map[string]bool, error) {
+	if list == "" {
+		return nil, nil
+	}
+	types := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if !isEventType(name) {
+			return nil, fmt.Errorf("Unknown event type %q", name)
+		}
+		types[name] = true
+	}
+	return types, nil
+}
+
+func isEventType(name string) bool {
+	for _, t := range entity.EventTypes {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
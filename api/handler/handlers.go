@@ -3,13 +3,37 @@ package handler
 import "github.com/biswasurmi/book-cli/service"
 
 type Handler struct {
-	BookHandler *BookHandler
-	UserHandler *UserHandler
+	BookHandler      *BookHandler
+	UserHandler      *UserHandler
+	AdminHandler     *AdminHandler
+	PasswordHandler  *PasswordHandler
+	TwoFactorHandler *TwoFactorHandler
+	APIKeyHandler    *APIKeyHandler
+	OAuthHandler     *OAuthHandler
+	AuditHandler     *AuditHandler
+	TrashHandler     *TrashHandler
+	EventsHandler    *EventsHandler
+	WebhookHandler   *WebhookHandler
+	// OIDCHandler is nil unless OIDC login is enabled.
+	OIDCHandler *OIDCHandler
 }
 
 func GetHandlers(services *service.Services) *Handler {
-	return &Handler{
-		BookHandler: NewBookHandler(services.BookService),
-		UserHandler: NewUserHandler(services.UserService), // Removed nil argument
+	h := &Handler{
+		BookHandler:      NewBookHandler(services.BookService),
+		UserHandler:      NewUserHandler(services.UserService, services.TokenService, services.Verification, services.TwoFactor, services.Passwords), // Removed nil argument
+		AdminHandler:     NewAdminHandler(services.LoginGuard),
+		PasswordHandler:  NewPasswordHandler(services.PasswordReset),
+		TwoFactorHandler: NewTwoFactorHandler(services.TwoFactor, services.TokenService),
+		APIKeyHandler:    NewAPIKeyHandler(services.APIKeys),
+		OAuthHandler:     NewOAuthHandler(services.OAuth, services.UserService, services.TwoFactor),
+		AuditHandler:     NewAuditHandler(services.Audit),
+		TrashHandler:     NewTrashHandler(services.Trash),
+		EventsHandler:    NewEventsHandler(services.Events),
+		WebhookHandler:   NewWebhookHandler(services.Webhooks),
 	}
-}
\ No newline at end of file
+	if services.OIDC != nil {
+		h.OIDCHandler = NewOIDCHandler(services.OIDC, services.TokenService, services.TwoFactor)
+	}
+	return h
+}
@@ -0,0 +1,399 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/biswasurmi/book-cli/api/middleware"
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+	"github.com/biswasurmi/book-cli/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type OAuthHandler struct {
+	oauth       service.OAuthService
+	userService service.UserService
+	twoFactor   service.TwoFactorService
+}
+
+func NewOAuthHandler(oauth service.OAuthService, userService service.UserService, twoFactor service.TwoFactorService) *OAuthHandler {
+	return &OAuthHandler{oauth: oauth, userService: userService, twoFactor: twoFactor}
+}
+
+// registeredClient is the response to RegisterClient, the only one that
+// includes the client secret.
+type registeredClient struct {
+	entity.OAuthClient
+	Secret string `json:"client_secret,omitempty"`
+}
+
+// RegisterClient registers an OAuth2 client owned by the current user.
+func (h *OAuthHandler) RegisterClient(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	var reg service.OAuthClientRegistration
+	if err := json.NewDecoder(r.Body).Decode(&reg); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	client, secret, err := h.oauth.RegisterClient(userID, reg)
+	var oauthErr *service.OAuthError
+	switch {
+	case errors.As(err, &oauthErr):
+		writeOAuthError(w, err, false)
+		return
+	case errors.Is(err, service.ErrScopeNotAllowed):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, "Error registering client", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(registeredClient{OAuthClient: client.WithoutSecret(), Secret: secret})
+}
+
+func (h *OAuthHandler) ListClients(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	clients, err := h.oauth.ListClients(userID)
+	if err != nil {
+		http.Error(w, "Error listing clients", http.StatusInternalServerError)
+		return
+	}
+	out := make([]entity.OAuthClient, 0, len(clients))
+	for _, client := range clients {
+		out = append(out, client.WithoutSecret())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func (h *OAuthHandler) DeleteClient(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	err := h.oauth.DeleteClient(userID, chi.URLParam(r, "id"))
+	switch {
+	case errors.Is(err, repository.ErrOAuthClientNotFound):
+		http.Error(w, "Client not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, "Error deleting client", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Token is the token endpoint (RFC 6749 section 3.2). It supports the
+// client_credentials and authorization_code grants.
+func (h *OAuthHandler) Token(w http.ResponseWriter, r *http.Request) {
+	client, basic, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	var (
+		token service.TokenResponse
+		err   error
+	)
+	switch r.PostForm.Get("grant_type") {
+	case entity.GrantClientCredentials:
+		token, err = h.oauth.ClientCredentials(client, r.PostForm.Get("scope"))
+	case entity.GrantAuthorizationCode:
+		token, err = h.oauth.ExchangeCode(client, r.PostForm.Get("code"), r.PostForm.Get("redirect_uri"), r.PostForm.Get("code_verifier"))
+	case "":
+		err = &service.OAuthError{Code: "invalid_request", Description: "grant_type is required"}
+	default:
+		err = &service.OAuthError{Code: "unsupported_grant_type"}
+	}
+	if err != nil {
+		writeOAuthError(w, err, basic)
+		return
+	}
+
+	noStore(w)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(token)
+}
+
+// Introspect is the introspection endpoint (RFC 7662). Only confidential
+// clients may use it.
+func (h *OAuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	client, basic, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+	if client.Public() {
+		writeOAuthError(w, &service.OAuthError{Code: "invalid_client", Description: "public clients cannot introspect tokens"}, basic)
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, &service.OAuthError{Code: "invalid_request", Description: "token is required"}, basic)
+		return
+	}
+
+	noStore(w)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.oauth.Introspect(token))
+}
+
+// Revoke is the revocation endpoint (RFC 7009).
+func (h *OAuthHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	client, basic, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, &service.OAuthError{Code: "invalid_request", Description: "token is required"}, basic)
+		return
+	}
+	if err := h.oauth.Revoke(client, token); err != nil {
+		writeOAuthError(w, err, basic)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// authenticateClient parses the form and checks the client credentials,
+// sent with HTTP Basic authentication or as client_id and client_secret
+// form fields. It reports whether Basic authentication was used.
+func (h *OAuthHandler) authenticateClient(w http.ResponseWriter, r *http.Request) (entity.OAuthClient, bool, bool) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, &service.OAuthError{Code: "invalid_request", Description: "malformed form body"}, false)
+		return entity.OAuthClient{}, false, false
+	}
+
+	id, secret, basic := r.BasicAuth()
+	if basic {
+		if r.PostForm.Get("client_secret") != "" {
+			writeOAuthError(w, &service.OAuthError{Code: "invalid_request", Description: "use only one client authentication method"}, basic)
+			return entity.OAuthClient{}, basic, false
+		}
+		// Basic credentials are form-encoded first (RFC 6749 section 2.3.1)
+		var err1, err2 error
+		id, err1 = url.QueryUnescape(id)
+		secret, err2 = url.QueryUnescape(secret)
+		if err1 != nil || err2 != nil {
+			writeOAuthError(w, &service.OAuthError{Code: "invalid_client"}, basic)
+			return entity.OAuthClient{}, basic, false
+		}
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id == "" {
+		writeOAuthError(w, &service.OAuthError{Code: "invalid_client", Description: "client authentication is required"}, basic)
+		return entity.OAuthClient{}, basic, false
+	}
+
+	client, err := h.oauth.AuthenticateClient(id, secret)
+	if err != nil {
+		writeOAuthError(w, err, basic)
+		return entity.OAuthClient{}, basic, false
+	}
+	return client, basic, true
+}
+
+// writeOAuthError writes an error response as in RFC 6749 section 5.2.
+func writeOAuthError(w http.ResponseWriter, err error, basic bool) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		oauthErr = &service.OAuthError{Code: "server_error"}
+	}
+	status := http.StatusBadRequest
+	switch oauthErr.Code {
+	case "invalid_client":
+		status = http.StatusUnauthorized
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+	case "server_error":
+		status = http.StatusInternalServerError
+	}
+
+	body := map[string]string{"error": oauthErr.Code}
+	if oauthErr.Description != "" {
+		body["error_description"] = oauthErr.Description
+	}
+	noStore(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func noStore(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+}
+
+var authorizeForm = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in to {{.Client.Name}}</title></head>
+<body>
+<h1>Sign in</h1>
+<p><strong>{{.Client.Name}}</strong> wants access to: {{range .Scopes}}<code>{{.}}</code> {{end}}</p>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth/authorize">
+<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+<label>Email <input type="email" name="email" value="{{.Email}}" required></label>
+<label>Password <input type="password" name="password" required></label>
+<label>Two-factor code, if enabled <input type="text" name="code" autocomplete="one-time-code"></label>
+<button type="submit">Allow</button>
+<button type="submit" name="deny" value="1" formnovalidate>Deny</button>
+</form>
+</body>
+</html>
+`))
+
+type authorizePage struct {
+	Client  entity.OAuthClient
+	Scopes  []string
+	Request service.AuthorizationRequest
+	Email   string
+	Error   string
+}
+
+// Authorize is the authorization endpoint (RFC 6749 section 3.1). GET shows
+// a login form; POST checks the user's credentials with the same rules as
+// /api/v1/login and redirects back to the client with a code.
+func (h *OAuthHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Malformed request", http.StatusBadRequest)
+		return
+	}
+	params := r.Form
+	if r.Method == http.MethodPost {
+		params = r.PostForm
+	}
+	req := service.AuthorizationRequest{
+		ResponseType:        params.Get("response_type"),
+		ClientID:            params.Get("client_id"),
+		RedirectURI:         params.Get("redirect_uri"),
+		Scope:               params.Get("scope"),
+		State:               params.Get("state"),
+		CodeChallenge:       params.Get("code_challenge"),
+		CodeChallengeMethod: params.Get("code_challenge_method"),
+	}
+
+	// Without a valid redirect URI the user must not be sent anywhere
+	client, redirectURI, err := h.oauth.CheckRedirect(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.oauth.CheckAuthorization(req); err != nil {
+		redirectWithError(w, r, redirectURI, req.State, err)
+		return
+	}
+
+	page := authorizePage{Client: client, Scopes: client.Scopes, Request: req, Email: params.Get("email")}
+	if scopes := strings.Fields(req.Scope); len(scopes) > 0 {
+		page.Scopes = scopes
+	}
+	if r.Method != http.MethodPost {
+		renderAuthorize(w, http.StatusOK, page)
+		return
+	}
+	if params.Get("deny") != "" {
+		redirectWithError(w, r, redirectURI, req.State, &service.OAuthError{Code: "access_denied"})
+		return
+	}
+
+	user, err := h.userService.Authenticate(middleware.RequestActor(r), params.Get("email"), params.Get("password"))
+	var locked *service.LockedError
+	switch {
+	case errors.As(err, &locked):
+		page.Error = "Too many failed attempts, try again later"
+		renderAuthorize(w, http.StatusTooManyRequests, page)
+		return
+	case errors.Is(err, service.ErrAccountDisabled), errors.Is(err, service.ErrEmailNotVerified):
+		page.Error = "This account cannot sign in"
+		renderAuthorize(w, http.StatusForbidden, page)
+		return
+	case err != nil:
+		page.Error = "Invalid email or password"
+		renderAuthorize(w, http.StatusUnauthorized, page)
+		return
+	}
+
+	methods := []string{service.AuthMethodPassword}
+	if user.TOTPEnabled {
+		code := params.Get("code")
+		if code == "" {
+			page.Error = "Enter the code from your authenticator app"
+			renderAuthorize(w, http.StatusUnauthorized, page)
+			return
+		}
+		if err := h.twoFactor.Check(middleware.RequestActor(r), user, code); err != nil {
+			page.Error = "Invalid two-factor code"
+			renderAuthorize(w, http.StatusUnauthorized, page)
+			return
+		}
+		methods = append(methods, service.AuthMethodOTP)
+	}
+
+	code, err := h.oauth.Authorize(req, user, methods)
+	if err != nil {
+		redirectWithError(w, r, redirectURI, req.State, err)
+		return
+	}
+	redirectTo(w, r, redirectURI, url.Values{"code": {code}, "state": {req.State}})
+}
+
+func renderAuthorize(w http.ResponseWriter, status int, page authorizePage) {
+	noStore(w)
+	// The form must not be framed by another site
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	authorizeForm.Execute(w, page)
+}
+
+func redirectWithError(w http.ResponseWriter, r *http.Request, redirectURI, state string, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		oauthErr = &service.OAuthError{Code: "server_error"}
+	}
+	params := url.Values{"error": {oauthErr.Code}, "state": {state}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+	redirectTo(w, r, redirectURI, params)
+}
+
+// redirectTo redirects to redirectURI with params added to its query.
+// Empty parameters are left out.
+func redirectTo(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	u, _ := url.Parse(redirectURI)
+	query := u.Query()
+	for name, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query.Set(name, values[0])
+		}
+	}
+	u.RawQuery = query.Encode()
+	noStore(w)
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
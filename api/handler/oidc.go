@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/biswasurmi/book-cli/api/middleware"
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/infrastructure/oidc"
+	"github.com/biswasurmi/book-cli/service"
+)
+
+type OIDCHandler struct {
+	oidc      service.OIDCService
+	tokens    service.TokenService
+	twoFactor service.TwoFactorService
+}
+
+func NewOIDCHandler(oidc service.OIDCService, tokens service.TokenService, twoFactor service.TwoFactorService) *OIDCHandler {
+	return &OIDCHandler{oidc: oidc, tokens: tokens, twoFactor: twoFactor}
+}
+
+// Login sends the user to the OpenID Connect provider.
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	authURL, err := h.oidc.AuthURL(r.Context())
+	if err != nil {
+		log.Printf("Starting OIDC login: %v", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback completes the login when the provider sends the user back and
+// answers with a token like POST /api/v1/login. Users with two-factor
+// authentication get a challenge for POST /api/v1/login/2fa, unless the
+// provider reports that it checked a second factor itself.
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		http.Error(w, "Login at identity provider failed: "+errCode, http.StatusUnauthorized)
+		return
+	}
+
+	user, methods, err := h.oidc.Callback(r.Context(), middleware.RequestActor(r), query.Get("code"), query.Get("state"))
+	if middleware.AuthenticationRefused(w, err) {
+		return
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, service.ErrInvalidOIDCState):
+		http.Error(w, "Invalid or expired login, please start again", http.StatusBadRequest)
+		return
+	case errors.Is(err, oidc.ErrInvalidIDToken):
+		http.Error(w, "Invalid ID token", http.StatusUnauthorized)
+		return
+	case errors.Is(err, service.ErrOIDCDomainNotAllowed):
+		http.Error(w, "Email domain not allowed", http.StatusForbidden)
+		return
+	case errors.Is(err, service.ErrOIDCNoAccount):
+		http.Error(w, "No account for this identity", http.StatusForbidden)
+		return
+	case errors.Is(err, service.ErrOIDCPendingAccount):
+		http.Error(w, "Account awaits email verification", http.StatusForbidden)
+		return
+	default:
+		log.Printf("Completing OIDC login: %v", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	if user.TOTPEnabled {
+		checked := false
+		for _, method := range methods {
+			checked = checked || method == service.AuthMethodOTP
+		}
+		if !checked {
+			// Without a code SecondFactor always answers with a challenge
+			middleware.SecondFactor(w, r, h.twoFactor, user, "")
+			return
+		}
+	}
+	middleware.WriteToken(w, h.tokens, user, entity.RoleScopes(user.Role), methods...)
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/biswasurmi/book-cli/service"
+)
+
+type PasswordHandler struct {
+	resetService service.PasswordResetService
+}
+
+func NewPasswordHandler(resetService service.PasswordResetService) *PasswordHandler {
+	return &PasswordHandler{resetService: resetService}
+}
+
+// Forgot sends a reset link. It answers 202 whether or not the email
+// belongs to an account, so it cannot be used to find registered users.
+func (h *PasswordHandler) Forgot(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.resetService.RequestReset(req.Email); err != nil {
+		http.Error(w, "Error requesting password reset", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *PasswordHandler) Reset(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := h.resetService.ResetPassword(req.Token, req.Password)
+	switch {
+	case errors.Is(err, service.ErrPasswordTooShort):
+		http.Error(w, "Password must be at least 8 characters", http.StatusBadRequest)
+	case errors.Is(err, service.ErrInvalidResetToken):
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+	case err != nil:
+		http.Error(w, "Error resetting password", http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -2,10 +2,14 @@ package handler
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/biswasurmi/book-cli/api/middleware"
+	"github.com/biswasurmi/book-cli/config"
+	"github.com/biswasurmi/book-cli/domain/entity"
 	"github.com/biswasurmi/book-cli/service"
 	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt"
 )
 
 type Server struct {
@@ -13,50 +17,159 @@ type Server struct {
 	Handler  *Handler
 	Services *service.Services
 	Auth     bool
+	Config   *config.Config
+
+	// IPLimiter and AccountLimiter throttle the login and token endpoints
+	// per client IP and per account.
+	IPLimiter      *middleware.RateLimiter
+	AccountLimiter *middleware.RateLimiter
 }
 
-func CreateNewServer(h *Handler, services *service.Services, auth bool) *Server {
+func CreateNewServer(h *Handler, services *service.Services, cfg *config.Config) *Server {
 	r := chi.NewRouter()
 	return &Server{
 		Router:   r,
 		Handler:  h,
 		Services: services,
-		Auth:     auth,
+		Auth:     cfg.Auth.Enabled,
+		Config:   cfg,
+		IPLimiter: middleware.NewRateLimiter(middleware.RateLimitConfig{
+			PerMinute: cfg.RateLimit.IPPerMinute,
+			Burst:     cfg.RateLimit.IPBurst,
+		}),
+		AccountLimiter: middleware.NewRateLimiter(middleware.RateLimitConfig{
+			PerMinute: cfg.RateLimit.AccountPerMinute,
+			Burst:     cfg.RateLimit.AccountBurst,
+		}),
 	}
 }
 
 func (s *Server) MountRoutes() {
+	s.Router.Use(middleware.RequestID)
+
 	s.Router.Post("/api/v1/register", s.Handler.UserHandler.Register)
-	s.Router.Post("/api/v1/login", func(w http.ResponseWriter, r *http.Request) {
-		s.Handler.UserHandler.Login(w, r)
-	})
+	s.Router.Get("/api/v1/verify-email", s.Handler.UserHandler.VerifyEmail)
+
+	// Resource servers call these for every token they see, so they are
+	// not rate limited like the login endpoints
+	s.Router.Post("/oauth/introspect", s.Handler.OAuthHandler.Introspect)
+	s.Router.Post("/oauth/revoke", s.Handler.OAuthHandler.Revoke)
+
+	// Credential endpoints are rate limited to slow down password guessing
+	s.Router.Group(func(r chi.Router) {
+		r.Use(middleware.RateLimit(s.IPLimiter, middleware.ClientIP))
+		r.Use(middleware.RateLimit(s.AccountLimiter, middleware.AccountKey))
 
-	if s.Auth {
-		s.Router.Group(func(r chi.Router) {
-			r.Use(middleware.BasicAuth(&middleware.BasicAuthConfig{UserService: s.Services.UserService}))
-			r.Get("/api/v1/get-token", func(w http.ResponseWriter, r *http.Request) {
-				middleware.GetTokenHandler(w, r, s.Auth, s.Services.UserService)
-			})
+		r.Post("/api/v1/login", func(w http.ResponseWriter, r *http.Request) {
+			s.Handler.UserHandler.Login(w, r)
 		})
-	} else {
-		s.Router.Get("/api/v1/get-token", func(w http.ResponseWriter, r *http.Request) {
-			middleware.GetTokenHandler(w, r, s.Auth, s.Services.UserService)
+		r.Post("/api/v1/password/forgot", s.Handler.PasswordHandler.Forgot)
+		r.Post("/api/v1/password/reset", s.Handler.PasswordHandler.Reset)
+		r.Post("/api/v1/verify-email/resend", s.Handler.UserHandler.ResendVerification)
+		r.Post("/api/v1/login/2fa", s.Handler.TwoFactorHandler.CompleteLogin)
+		if s.Handler.OIDCHandler != nil {
+			r.Get("/api/v1/login/oidc", s.Handler.OIDCHandler.Login)
+			r.Get(config.OIDCCallbackPath, s.Handler.OIDCHandler.Callback)
+		}
+
+		// OAuth2 authorization server
+		r.Get("/oauth/authorize", s.Handler.OAuthHandler.Authorize)
+		r.Post("/oauth/authorize", s.Handler.OAuthHandler.Authorize)
+		r.Post("/oauth/token", s.Handler.OAuthHandler.Token)
+
+		// GetTokenHandler checks the Basic Auth credentials itself, so each
+		// attempt is counted and audited once
+		r.Get("/api/v1/get-token", func(w http.ResponseWriter, r *http.Request) {
+			middleware.GetTokenHandler(w, r, s.Auth, s.Services.UserService, s.Services.TokenService, s.Services.TwoFactor)
 		})
-	}
+	})
 
-	// Protected routes (JWT required when auth=true)
+	// Protected routes (JWT or API key required when auth=true)
 	s.Router.Group(func(r chi.Router) {
 		if s.Auth {
-			r.Use(middleware.JWTAuth())
+			if s.Config.TLS.ClientAuth != config.ClientAuthNone {
+				r.Use(middleware.ClientCertAuth(s.Services.UserService, s.Config.TLS.SubjectUsers))
+			}
+			r.Use(middleware.APIKeyAuth(s.Services.APIKeys))
+			r.Use(middleware.JWTAuth(s.Services.TokenService))
+			r.Use(middleware.ResolveActor(s.Services.UserService, s.Config.Auth.RequiresTwoFactor))
 		}
-		r.Get("/api/v1/books", s.Handler.BookHandler.ListBooks)
-		r.Post("/api/v1/books", s.Handler.BookHandler.CreateBook)
-		r.Get("/api/v1/books/{uuid}", s.Handler.BookHandler.GetBook)
-		r.Put("/api/v1/books/{uuid}", s.Handler.BookHandler.UpdateBook)
-		r.Delete("/api/v1/books/{uuid}", s.Handler.BookHandler.DeleteBook)
-		r.Get("/api/v1/users/{id}", s.Handler.UserHandler.GetUser)
+		r.With(middleware.RequireScope(entity.ScopeBooksRead)).Get("/api/v1/books", s.Handler.BookHandler.ListBooks)
+		r.With(middleware.RequireScope(entity.ScopeBooksWrite)).Post("/api/v1/books", s.Handler.BookHandler.CreateBook)
+		r.With(middleware.RequireScope(entity.ScopeBooksRead)).Get("/api/v1/books/{uuid}", s.Handler.BookHandler.GetBook)
+		r.With(middleware.RequireScope(entity.ScopeBooksWrite)).Put("/api/v1/books/{uuid}", s.Handler.BookHandler.UpdateBook)
+		r.With(middleware.RequireScope(entity.ScopeBooksWrite)).Delete("/api/v1/books/{uuid}", s.Handler.BookHandler.DeleteBook)
+		r.With(middleware.RequireScope(entity.ScopeBooksRead)).Get("/api/v1/books/{uuid}/revisions", s.Handler.BookHandler.ListRevisions)
+		r.With(middleware.RequireScope(entity.ScopeBooksRead)).Get("/api/v1/books/{uuid}/revisions/diff", s.Handler.BookHandler.DiffRevisions)
+		r.With(middleware.RequireScope(entity.ScopeBooksRead)).Get("/api/v1/books/{uuid}/revisions/{n}", s.Handler.BookHandler.GetRevision)
+		r.With(middleware.RequireScope(entity.ScopeBooksWrite)).Post("/api/v1/books/{uuid}/revisions/{n}/restore", s.Handler.BookHandler.RestoreRevision)
+		r.With(middleware.RequireScope(entity.ScopeBooksRead)).Get("/api/v1/events", s.Handler.EventsHandler.Stream(s.Config.Events.KeepAlive))
 		r.Get("/api/v1/users/me", s.Handler.UserHandler.GetMe)
-		r.Put("/api/v1/users/{id}", s.Handler.UserHandler.UpdateUser)
-		r.Delete("/api/v1/users/{id}", s.Handler.UserHandler.Delete)
+		r.With(middleware.RequireScope(entity.ScopeBooksRead)).Get("/api/v1/users/me/books", s.Handler.BookHandler.ListMyBooks)
+		r.With(middleware.RequireScopeFunc(userScope), s.ownAccountOrAdmin).Get("/api/v1/users/{id}", s.Handler.UserHandler.GetUser)
+		r.With(middleware.RequireScopeFunc(userScope), s.ownAccountOrAdmin).Put("/api/v1/users/{id}", s.Handler.UserHandler.UpdateUser)
+		r.With(middleware.RequireScopeFunc(userScope), s.ownAccountOrAdmin).Delete("/api/v1/users/{id}", s.Handler.UserHandler.Delete)
+
+		// Managing credentials needs a login token, not an API key or OAuth2
+		// token, which never carry the account scope
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireScope(entity.ScopeAccount))
+			r.Post("/api/v1/users/me/2fa", s.Handler.TwoFactorHandler.Enroll)
+			r.Post("/api/v1/users/me/2fa/confirm", s.Handler.TwoFactorHandler.Confirm)
+			r.Post("/api/v1/users/me/2fa/recovery-codes", s.Handler.TwoFactorHandler.RegenerateRecoveryCodes)
+			r.Delete("/api/v1/users/me/2fa", s.Handler.TwoFactorHandler.Disable)
+			r.Post("/api/v1/users/me/api-keys", s.Handler.APIKeyHandler.Create)
+			r.Get("/api/v1/users/me/api-keys", s.Handler.APIKeyHandler.List)
+			r.Delete("/api/v1/users/me/api-keys/{id}", s.Handler.APIKeyHandler.Revoke)
+			r.Post("/api/v1/oauth/clients", s.Handler.OAuthHandler.RegisterClient)
+			r.Get("/api/v1/oauth/clients", s.Handler.OAuthHandler.ListClients)
+			r.Delete("/api/v1/oauth/clients/{id}", s.Handler.OAuthHandler.DeleteClient)
+		})
+
+		// Admin-only routes
+		r.Group(func(r chi.Router) {
+			if s.Auth {
+				r.Use(middleware.RequireRole(s.Services.UserService, entity.RoleAdmin,
+					s.Config.Auth.RequiresTwoFactor(entity.RoleAdmin)))
+			}
+			r.Use(middleware.RequireScope(entity.ScopeUsersAdmin))
+			r.Get("/api/v1/admin/lockouts", s.Handler.AdminHandler.ListLockouts)
+			r.Delete("/api/v1/admin/lockouts/{account}", s.Handler.AdminHandler.Unlock)
+			r.Get("/api/v1/audit", s.Handler.AuditHandler.List)
+			r.Get("/api/v1/trash", s.Handler.TrashHandler.List)
+			r.Post("/api/v1/trash/books/{uuid}/restore", s.Handler.TrashHandler.RestoreBook)
+			r.Post("/api/v1/trash/users/{id}/restore", s.Handler.TrashHandler.RestoreUser)
+			r.Post("/api/v1/webhooks", s.Handler.WebhookHandler.Create)
+			r.Get("/api/v1/webhooks", s.Handler.WebhookHandler.List)
+			r.Get("/api/v1/webhooks/{id}", s.Handler.WebhookHandler.Get)
+			r.Put("/api/v1/webhooks/{id}", s.Handler.WebhookHandler.Update)
+			r.Delete("/api/v1/webhooks/{id}", s.Handler.WebhookHandler.Delete)
+			r.Get("/api/v1/webhooks/{id}/deliveries", s.Handler.WebhookHandler.Deliveries)
+		})
 	})
-}
\ No newline at end of file
+}
+
+// ownAccountOrAdmin lets users act on their own record on
+// /api/v1/users/{id} and requires the admin role for anyone else's, as a
+// scope alone does not prove the role.
+func (s *Server) ownAccountOrAdmin(next http.Handler) http.Handler {
+	admin := middleware.RequireRole(s.Services.UserService, entity.RoleAdmin,
+		s.Config.Auth.RequiresTwoFactor(entity.RoleAdmin))(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.Auth || userScope(r) == entity.ScopeAccount {
+			next.ServeHTTP(w, r)
+			return
+		}
+		admin.ServeHTTP(w, r)
+	})
+}
+
+// userScope is the scope required on /api/v1/users/{id}: users:admin for
+// other users' accounts, and account for the caller's own.
+func userScope(r *http.Request) string {
+	claims, _ := r.Context().Value("jwt_claims").(jwt.MapClaims)
+	if userID, err := service.UserIDFromClaims(claims); err == nil && chi.URLParam(r, "id") == strconv.FormatInt(userID, 10) {
+		return entity.ScopeAccount
+	}
+	return entity.ScopeUsersAdmin
+}
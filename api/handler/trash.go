@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/biswasurmi/book-cli/api/middleware"
+	"github.com/biswasurmi/book-cli/domain/repository"
+	"github.com/biswasurmi/book-cli/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type TrashHandler struct {
+	trash service.TrashService
+}
+
+func NewTrashHandler(trash service.TrashService) *TrashHandler {
+	return &TrashHandler{trash: trash}
+}
+
+// List returns the deleted books and users that have not been purged yet.
+func (h *TrashHandler) List(w http.ResponseWriter, r *http.Request) {
+	trash, err := h.trash.List()
+	if err != nil {
+		http.Error(w, "Error fetching trash", http.StatusInternalServerError)
+		return
+	}
+	for i, user := range trash.Users {
+		trash.Users[i] = user.WithoutSecrets()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trash)
+}
+
+func (h *TrashHandler) RestoreBook(w http.ResponseWriter, r *http.Request) {
+	book, err := h.trash.RestoreBook(middleware.RequestActor(r), chi.URLParam(r, "uuid"))
+	if err != nil {
+		if errors.Is(err, repository.ErrBookNotFound) {
+			http.Error(w, "Book not found in trash", http.StatusNotFound)
+		} else {
+			http.Error(w, "Error restoring book", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(book)
+}
+
+func (h *TrashHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	user, err := h.trash.RestoreUser(middleware.RequestActor(r), id)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			http.Error(w, "User not found in trash", http.StatusNotFound)
+		} else {
+			http.Error(w, "Error restoring user", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user.WithoutSecrets())
+}
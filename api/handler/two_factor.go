@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/biswasurmi/book-cli/api/middleware"
+	"github.com/biswasurmi/book-cli/service"
+	"github.com/golang-jwt/jwt"
+)
+
+type TwoFactorHandler struct {
+	twoFactor    service.TwoFactorService
+	tokenService service.TokenService
+}
+
+func NewTwoFactorHandler(twoFactor service.TwoFactorService, tokenService service.TokenService) *TwoFactorHandler {
+	return &TwoFactorHandler{twoFactor: twoFactor, tokenService: tokenService}
+}
+
+type codeRequest struct {
+	Code string `json:"code"`
+}
+
+// Enroll starts enrollment for the current user and returns the secret and
+// otpauth URI for their authenticator app.
+func (h *TwoFactorHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	enrollment, err := h.twoFactor.Enroll(userID)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+// Confirm enables two-factor authentication with the first code from the
+// authenticator and returns the recovery codes.
+func (h *TwoFactorHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	h.withCode(w, r, func(userID int64, code string) {
+		codes, err := h.twoFactor.Confirm(userID, code)
+		if err != nil {
+			writeTwoFactorError(w, err)
+			return
+		}
+		writeRecoveryCodes(w, codes)
+	})
+}
+
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	h.withCode(w, r, func(userID int64, code string) {
+		codes, err := h.twoFactor.RegenerateRecoveryCodes(userID, code)
+		if err != nil {
+			writeTwoFactorError(w, err)
+			return
+		}
+		writeRecoveryCodes(w, codes)
+	})
+}
+
+func (h *TwoFactorHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	h.withCode(w, r, func(userID int64, code string) {
+		if err := h.twoFactor.Disable(userID, code); err != nil {
+			writeTwoFactorError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// CompleteLogin is the second step of a login that answered with a
+// challenge: it exchanges the challenge and a code for a token. Like the
+// first step it takes an optional "scope" to limit the token.
+func (h *TwoFactorHandler) CompleteLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+		Scope    string `json:"scope"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" || req.Code == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.twoFactor.Complete(middleware.RequestActor(r), req.MFAToken, req.Code)
+	if middleware.AuthenticationRefused(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, service.ErrInvalidChallenge):
+		http.Error(w, "Invalid or expired two-factor challenge", http.StatusUnauthorized)
+		return
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return
+	case err != nil:
+		http.Error(w, "Error completing login", http.StatusInternalServerError)
+		return
+	}
+
+	scopes, ok := middleware.LoginScopes(w, user, req.Scope)
+	if !ok {
+		return
+	}
+	middleware.WriteToken(w, h.tokenService, user, scopes, service.AuthMethodPassword, service.AuthMethodOTP)
+}
+
+func (h *TwoFactorHandler) withCode(w http.ResponseWriter, r *http.Request, fn func(userID int64, code string)) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	var req codeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	fn(userID, req.Code)
+}
+
+// currentUserID returns the user the request's token was issued for.
+func currentUserID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	claims, ok := r.Context().Value("jwt_claims").(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return 0, false
+	}
+	userID, err := service.UserIDFromClaims(claims)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return 0, false
+	}
+	return userID, true
+}
+
+func writeRecoveryCodes(w http.ResponseWriter, codes []string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+func writeTwoFactorError(w http.ResponseWriter, err error) {
+	if middleware.AuthenticationRefused(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, service.ErrTwoFactorEnabled):
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+	case errors.Is(err, service.ErrTwoFactorNotEnrolled):
+		http.Error(w, "Two-factor authentication is not enrolled", http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		http.Error(w, "Invalid two-factor code", http.StatusBadRequest)
+	case err.Error() == "user not found":
+		http.Error(w, "User not found", http.StatusNotFound)
+	default:
+		http.Error(w, "Error updating two-factor authentication", http.StatusInternalServerError)
+	}
+}
@@ -2,33 +2,35 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
-	"time"
 
+	"github.com/biswasurmi/book-cli/api/middleware"
 	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
 	"github.com/biswasurmi/book-cli/service"
 	"github.com/go-chi/chi/v5"
 	"github.com/golang-jwt/jwt"
-	"github.com/joho/godotenv"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func init() {
-	if err := godotenv.Load(); err != nil {
-		// Log error but continue
-	}
-}
-
 type UserHandler struct {
-	userService service.UserService
+	userService  service.UserService
+	tokenService service.TokenService
+	verification service.EmailVerificationService
+	twoFactor    service.TwoFactorService
+	passwords    service.PasswordHasher
 }
 
-func NewUserHandler(userService service.UserService) *UserHandler {
+func NewUserHandler(userService service.UserService, tokenService service.TokenService, verification service.EmailVerificationService, twoFactor service.TwoFactorService, passwords service.PasswordHasher) *UserHandler {
 	return &UserHandler{
-		userService: userService,
+		userService:  userService,
+		passwords:    passwords,
+		tokenService: tokenService,
+		verification: verification,
+		twoFactor:    twoFactor,
 	}
 }
 
@@ -40,39 +42,57 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user.Email = entity.NormalizeEmail(user.Email)
+	user.Username = strings.TrimSpace(user.Username)
 	if !strings.Contains(user.Email, "@") {
 		http.Error(w, "Invalid email format", http.StatusBadRequest)
 		return
 	}
-	if len(user.Password) < 8 {
+	if len(user.Password) < service.MinPasswordLength {
 		http.Error(w, "Password must be at least 8 characters", http.StatusBadRequest)
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hashedPassword, err := h.passwords.Hash(user.Password)
 	if err != nil {
 		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
 		return
 	}
 
-	user.Password = string(hashedPassword)
-	user.ID = time.Now().UnixNano()
+	user.Password = hashedPassword
+	user.Role = entity.RoleUser
+	user.VerificationPending = true
+	// Provider identities are only linked by logging in through them
+	user.ExternalIssuer = ""
+	user.ExternalSubject = ""
 
-	createdUser, err := h.userService.CreateUser(user)
+	createdUser, err := h.userService.CreateUser(middleware.RequestActor(r), user)
 	if err != nil {
-		http.Error(w, "Error creating user", http.StatusBadRequest)
+		if !writeConflict(w, err) {
+			http.Error(w, "Error creating user", http.StatusBadRequest)
+		}
 		return
 	}
+	// The account exists either way; the user can ask for another link
+	if err := h.verification.Send(createdUser); err != nil {
+		log.Printf("Sending verification email to %s: %v", createdUser.Email, err)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(createdUser)
+	json.NewEncoder(w).Encode(createdUser.WithoutSecrets())
 }
 
 func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var creds struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		// Code is the TOTP or recovery code of users with two-factor
+		// authentication; without it they get a challenge instead
+		Code string `json:"code"`
+		// Scope optionally limits the token to fewer scopes than the
+		// user's role allows, space separated
+		Scope string `json:"scope"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
@@ -80,31 +100,24 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.userService.Authenticate(creds.Email, creds.Password)
+	user, err := h.userService.Authenticate(middleware.RequestActor(r), creds.Email, creds.Password)
+	if middleware.AuthenticationRefused(w, err) {
+		return
+	}
 	if err != nil {
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	secretKey := []byte(os.Getenv("JWT_SECRET"))
-	if len(secretKey) == 0 {
-		http.Error(w, "Server configuration error", http.StatusInternalServerError)
+	scopes, ok := middleware.LoginScopes(w, user, creds.Scope)
+	if !ok {
 		return
 	}
-
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["user_id"] = user.ID
-	claims["exp"] = time.Now().Add(time.Hour * 24).Unix()
-
-	tokenString, err := token.SignedString(secretKey)
-	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+	methods, ok := middleware.SecondFactor(w, r, h.twoFactor, user, creds.Code)
+	if !ok {
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"token": tokenString})
+	middleware.WriteToken(w, h.tokenService, user, scopes, methods...)
 }
 
 func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
@@ -126,7 +139,7 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(user.WithoutSecrets())
 }
 
 func (h *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
@@ -137,13 +150,13 @@ func (h *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, ok := claims["user_id"].(float64)
-	if !ok {
+	userID, err := service.UserIDFromClaims(claims)
+	if err != nil {
 		http.Error(w, "Invalid token", http.StatusUnauthorized)
 		return
 	}
 
-	user, err := h.userService.GetByID(int64(userID))
+	user, err := h.userService.GetByID(userID)
 	if err != nil {
 		if err.Error() == "user not found" {
 			http.Error(w, "User not found", http.StatusNotFound)
@@ -154,7 +167,7 @@ func (h *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(user.WithoutSecrets())
 }
 
 func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
@@ -171,33 +184,70 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user.Email = entity.NormalizeEmail(user.Email)
+	user.Username = strings.TrimSpace(user.Username)
 	if user.Email == "" {
 		http.Error(w, "Email is required", http.StatusBadRequest)
 		return
 	}
 
+	existing, err := h.userService.GetByID(id)
+	if err != nil {
+		if err.Error() == "user not found" {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		}
+		return
+	}
+
 	user.ID = id
+	user.Role = existing.Role // roles are only changed by administrators
+	user.Disabled = existing.Disabled
+	user.CreatedAt = existing.CreatedAt
+	user.SessionsRevokedAt = existing.SessionsRevokedAt
+	user.VerificationPending = existing.VerificationPending
+	user.VerificationSentAt = existing.VerificationSentAt
+	// Two-factor settings change only through the 2fa endpoints
+	user.TOTPSecret = existing.TOTPSecret
+	user.TOTPEnabled = existing.TOTPEnabled
+	user.TOTPLastStep = existing.TOTPLastStep
+	user.RecoveryCodes = existing.RecoveryCodes
+	user.ExternalIssuer = existing.ExternalIssuer
+	user.ExternalSubject = existing.ExternalSubject
+	emailChanged := user.Email != existing.Email
+	if emailChanged {
+		// A new address has to be confirmed again
+		user.VerificationPending = true
+	}
 	if user.Password != "" {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+		hashedPassword, err := h.passwords.Hash(user.Password)
 		if err != nil {
 			http.Error(w, "Failed to hash password", http.StatusInternalServerError)
 			return
 		}
-		user.Password = string(hashedPassword)
+		user.Password = hashedPassword
+	} else {
+		user.Password = existing.Password
 	}
 
-	updatedUser, err := h.userService.Update(user)
+	updatedUser, err := h.userService.Update(middleware.RequestActor(r), user)
 	if err != nil {
 		if err.Error() == "user not found" {
 			http.Error(w, "User not found", http.StatusNotFound)
-		} else {
+		} else if !writeConflict(w, err) {
 			http.Error(w, "Error updating user", http.StatusInternalServerError)
 		}
 		return
 	}
+	if emailChanged {
+		if err := h.verification.Send(updatedUser); err != nil {
+			log.Printf("Sending verification email to %s: %v", updatedUser.Email, err)
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(updatedUser)
+	json.NewEncoder(w).Encode(updatedUser.WithoutSecrets())
 }
 
 func (h *UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
@@ -218,7 +268,7 @@ func (h *UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.userService.Delete(user)
+	err = h.userService.Delete(middleware.RequestActor(r), user)
 	if err != nil {
 		if err.Error() == "user not found" {
 			http.Error(w, "User not found", http.StatusNotFound)
@@ -229,4 +279,54 @@ func (h *UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.WriteHeader(http.StatusNoContent)
-}
\ No newline at end of file
+}
+
+// VerifyEmail is the target of the link in the verification email.
+func (h *UserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	user, err := h.verification.Verify(r.URL.Query().Get("token"))
+	switch {
+	case errors.Is(err, service.ErrInvalidVerificationToken):
+		http.Error(w, "Invalid or expired verification link", http.StatusBadRequest)
+		return
+	case errors.Is(err, service.ErrMissingSecret):
+		http.Error(w, "Server configuration error", http.StatusInternalServerError)
+		return
+	case err != nil:
+		http.Error(w, "Error verifying email", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"email": user.Email, "status": "verified"})
+}
+
+// ResendVerification sends a new verification link. It answers 202 whether
+// or not the email belongs to a pending account.
+func (h *UserHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.verification.Resend(req.Email); err != nil {
+		http.Error(w, "Error sending verification email", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// writeConflict answers 409 Conflict if err is a uniqueness violation and
+// reports whether it did.
+func writeConflict(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, repository.ErrEmailTaken):
+		http.Error(w, "Email already registered", http.StatusConflict)
+	case errors.Is(err, repository.ErrUsernameTaken):
+		http.Error(w, "Username already taken", http.StatusConflict)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/biswasurmi/book-cli/api/middleware"
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+	"github.com/biswasurmi/book-cli/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type WebhookHandler struct {
+	webhooks service.WebhookService
+}
+
+func NewWebhookHandler(webhooks service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{webhooks: webhooks}
+}
+
+type createWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// Create adds a webhook. The response is the only one that includes the
+// signing secret.
+func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req createWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	webhook, err := h.webhooks.Create(middleware.RequestActor(r), req.URL, req.Events)
+	if err != nil {
+		writeWebhookError(w, err, "Error creating webhook")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func (h *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.webhooks.List()
+	if err != nil {
+		http.Error(w, "Error listing webhooks", http.StatusInternalServerError)
+		return
+	}
+	out := make([]entity.Webhook, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		out = append(out, webhook.WithoutSecret())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func (h *WebhookHandler) Get(w http.ResponseWriter, r *http.Request) {
+	webhook, err := h.webhooks.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		writeWebhookError(w, err, "Error fetching webhook")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhook.WithoutSecret())
+}
+
+// Update changes the URL, event types or active flag of a webhook.
+func (h *WebhookHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var update service.WebhookUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	webhook, err := h.webhooks.Update(middleware.RequestActor(r), chi.URLParam(r, "id"), update)
+	if err != nil {
+		writeWebhookError(w, err, "Error updating webhook")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhook.WithoutSecret())
+}
+
+func (h *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := h.webhooks.Delete(middleware.RequestActor(r), chi.URLParam(r, "id")); err != nil {
+		writeWebhookError(w, err, "Error deleting webhook")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Deliveries returns the latest delivery attempts of a webhook, newest
+// first.
+func (h *WebhookHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := h.webhooks.Deliveries(chi.URLParam(r, "id"))
+	if err != nil {
+		writeWebhookError(w, err, "Error fetching deliveries")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+func writeWebhookError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, repository.ErrWebhookNotFound):
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidWebhookURL), errors.Is(err, service.ErrInvalidWebhookEvent):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
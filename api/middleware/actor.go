@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/service"
+	"github.com/golang-jwt/jwt"
+)
+
+// ResolveActor stores the service.Actor for the request's credentials in
+// the context under "actor". Credentials of users who no longer exist or
+// are in the trash are refused with 401, and those of disabled users with
+// 403, however long the credentials themselves stay valid. An admin only
+// acts as one with credentials
+// that carry users:admin, and with a second factor if requiresTwoFactor
+// says the role needs one, the same rules as RequireRole and RequireScope.
+// It must run after JWTAuth.
+func ResolveActor(userService service.UserService, requiresTwoFactor func(role string) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := r.Context().Value("jwt_claims").(jwt.MapClaims)
+			userID, err := service.UserIDFromClaims(claims)
+			if err != nil {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			user, err := userService.GetByID(userID)
+			if err != nil {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+			if user.Disabled {
+				http.Error(w, "Account disabled", http.StatusForbidden)
+				return
+			}
+
+			actor := RequestActor(r)
+			actor.UserID = userID
+			actor.Role = user.Role
+			if actor.Role == entity.RoleAdmin {
+				granted, restricted := claims["scope"].(string)
+				if (restricted && !hasScope(granted, entity.ScopeUsersAdmin)) ||
+					(requiresTwoFactor(actor.Role) && !service.HasAuthMethod(claims, service.AuthMethodOTP)) {
+					actor.Role = entity.RoleUser
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), "actor", actor)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/biswasurmi/book-cli/service"
+	"github.com/golang-jwt/jwt"
+)
+
+// APIKeyScheme is the Authorization scheme for API keys:
+//
+//	Authorization: ApiKey bk_<id>.<secret>
+const APIKeyScheme = "ApiKey "
+
+// APIKeyAuth authenticates requests that carry an API key. Like
+// ClientCertAuth it stores the claims JWTAuth would provide, plus the
+// key's scopes in a space separated "scope" claim and its ID in
+// "api_key", so JWTAuth lets the request through. Requests without an API
+// key are passed on unchanged.
+func APIKeyAuth(keys service.APIKeyService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if !strings.HasPrefix(authHeader, APIKeyScheme) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key, user, err := keys.Authenticate(strings.TrimPrefix(authHeader, APIKeyScheme))
+			if errors.Is(err, service.ErrAccountDisabled) {
+				http.Error(w, "Account disabled", http.StatusForbidden)
+				return
+			}
+			if err != nil {
+				http.Error(w, "You're Unauthorized due to Invalid API key", http.StatusUnauthorized)
+				return
+			}
+
+			claims := jwt.MapClaims{
+				"sub":     strconv.FormatInt(user.ID, 10),
+				"user_id": user.ID,
+				"email":   user.Email,
+				"scope":   strings.Join(key.Scopes, " "),
+				"api_key": key.ID,
+			}
+			ctx := context.WithValue(r.Context(), "jwt_claims", claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/biswasurmi/book-cli/service"
+)
+
+// AuthenticationRefused writes the response for an Authenticate error
+// that is not a plain credential mismatch, such as a locked or disabled
+// account, and reports whether it did.
+func AuthenticationRefused(w http.ResponseWriter, err error) bool {
+	var locked *service.LockedError
+	switch {
+	case errors.As(err, &locked):
+		TooManyRequests(w, locked.RetryAfter)
+	case errors.Is(err, service.ErrAccountDisabled):
+		http.Error(w, "Account disabled", http.StatusForbidden)
+	case errors.Is(err, service.ErrEmailNotVerified):
+		http.Error(w, "Email address not verified", http.StatusForbidden)
+	default:
+		return false
+	}
+	return true
+}
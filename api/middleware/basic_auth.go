@@ -20,7 +20,10 @@ func BasicAuth(config *BasicAuthConfig) func(http.Handler) http.Handler {
 				return
 			}
 
-			_, err := config.UserService.Authenticate(email, password)
+			_, err := config.UserService.Authenticate(RequestActor(r), email, password)
+			if AuthenticationRefused(w, err) {
+				return
+			}
 			if err != nil {
 				w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
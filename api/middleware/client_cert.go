@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/service"
+	"github.com/golang-jwt/jwt"
+)
+
+// ClientCertAuth authenticates requests that arrive with a verified client
+// certificate. The certificate subject is mapped onto a user and the same
+// claims JWTAuth would provide for a login token, with the scopes of the
+// user's role, are stored in the context, so JWTAuth lets the request
+// through without a bearer token. Requests without a client
+// certificate are passed on unchanged.
+func ClientCertAuth(userService service.UserService, subjectUsers map[string]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			email := certificateEmail(r.TLS.VerifiedChains[0][0], subjectUsers)
+			user, err := userService.GetByEmail(email)
+			if email == "" || err != nil || user.Disabled {
+				http.Error(w, "Client certificate does not belong to a known user", http.StatusUnauthorized)
+				return
+			}
+
+			claims := jwt.MapClaims{
+				"sub":     strconv.FormatInt(user.ID, 10),
+				"user_id": user.ID,
+				"email":   user.Email,
+				"scope":   strings.Join(entity.RoleScopes(user.Role), " "),
+			}
+			ctx := context.WithValue(r.Context(), "jwt_claims", claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func certificateEmail(cert *x509.Certificate, subjectUsers map[string]string) string {
+	if email, ok := subjectUsers[cert.Subject.CommonName]; ok {
+		return email
+	}
+	if len(cert.EmailAddresses) > 0 {
+		return cert.EmailAddresses[0]
+	}
+	if strings.Contains(cert.Subject.CommonName, "@") {
+		return cert.Subject.CommonName
+	}
+	return ""
+}
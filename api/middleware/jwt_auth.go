@@ -2,27 +2,20 @@ package middleware
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"net/http"
-	"os"
 	"strings"
 
+	"github.com/biswasurmi/book-cli/service"
 	"github.com/golang-jwt/jwt"
-	"github.com/joho/godotenv"
 )
 
-func init() {
-	if err := godotenv.Load(); err != nil {
-		// Log error but continue
-	}
-}
-
-func JWTAuth() func(http.Handler) http.Handler {
+func JWTAuth(tokens service.TokenService) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			secretKey := []byte(os.Getenv("JWT_SECRET"))
-			if len(secretKey) == 0 {
-				http.Error(w, "Server configuration error", http.StatusInternalServerError)
+			// Already authenticated, e.g. by a client certificate
+			if _, ok := r.Context().Value("jwt_claims").(jwt.MapClaims); ok {
+				next.ServeHTTP(w, r)
 				return
 			}
 
@@ -39,27 +32,20 @@ func JWTAuth() func(http.Handler) http.Handler {
 
 			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-				}
-				return secretKey, nil
-			})
-
-			if err != nil || !token.Valid {
-				http.Error(w, "You're Unauthorized due to Invalid token", http.StatusUnauthorized)
+			claims, err := tokens.Parse(tokenString)
+			if errors.Is(err, service.ErrMissingSecret) {
+				http.Error(w, "Server configuration error", http.StatusInternalServerError)
 				return
 			}
-
-			claims, ok := token.Claims.(jwt.MapClaims)
-			if !ok {
-				http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+			if err != nil {
+				http.Error(w, "You're Unauthorized due to Invalid token", http.StatusUnauthorized)
 				return
 			}
+
 			ctx := r.Context()
 			ctx = context.WithValue(ctx, "jwt_claims", claims)
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+)
+
+// RateLimitConfig describes a token bucket: Burst requests may be made at
+// once, refilled at PerMinute tokens per minute. A zero PerMinute disables
+// limiting.
+type RateLimitConfig struct {
+	PerMinute int
+	Burst     int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter keeps one token bucket per key.
+type RateLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // tokens per second
+	burst     float64
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewRateLimiter(cfg RateLimitConfig) *RateLimiter {
+	burst := cfg.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:    float64(cfg.PerMinute) / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token for key. When the bucket is empty it reports how long
+// the caller has to wait for the next token.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	if l == nil || l.rate <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	} else {
+		b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops buckets that have refilled completely so idle clients do not
+// accumulate.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimit rejects requests with 429 once the bucket for the key returned
+// by keyFunc is exhausted. Requests with an empty key are not limited.
+func RateLimit(limiter *RateLimiter, keyFunc func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := keyFunc(r)
+			if key != "" {
+				if ok, wait := limiter.Allow(key); !ok {
+					TooManyRequests(w, wait)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TooManyRequests writes a 429 response with a Retry-After header rounded up
+// to whole seconds.
+func TooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, "Too many requests", http.StatusTooManyRequests)
+}
+
+// ClientIP returns the host part of the request's remote address.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// AccountKey returns the account a login request is for, taken from the
+// Basic Auth username or the "email" field of a JSON or form body. The
+// body is restored so the next handler can read it again.
+func AccountKey(r *http.Request) string {
+	if email, _, ok := r.BasicAuth(); ok {
+		return entity.NormalizeEmail(email)
+	}
+	if r.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return ""
+		}
+		return entity.NormalizeEmail(form.Get("email"))
+	}
+	var creds struct {
+		Email string `json:"email"`
+	}
+	if json.Unmarshal(body, &creds) != nil {
+		return ""
+	}
+	return entity.NormalizeEmail(creds.Email)
+}
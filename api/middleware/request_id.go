@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/biswasurmi/book-cli/service"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the ID of a request, both ways.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds IDs taken from clients, which end up in the
+// audit log.
+const maxRequestIDLength = 128
+
+// RequestID gives every request an ID, stored in the context under
+// "request_id" and echoed in the X-Request-ID response header. An ID sent
+// by the client or a proxy in X-Request-ID is kept if it is printable
+// ASCII of at most 128 characters.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), "request_id", id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestActor returns the actor stored by ResolveActor, or an anonymous
+// one for requests without credentials, with the request ID and client IP
+// filled in for the audit log.
+func RequestActor(r *http.Request) service.Actor {
+	actor, _ := r.Context().Value("actor").(service.Actor)
+	actor.RequestID, _ = r.Context().Value("request_id").(string)
+	actor.SourceIP = ClientIP(r)
+	return actor
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/biswasurmi/book-cli/service"
+	"github.com/golang-jwt/jwt"
+)
+
+// RequireRole only lets through requests whose JWT belongs to a user with
+// the given role. With requireTwoFactor the token must also come from a
+// login that included a TOTP code. It must run after JWTAuth.
+func RequireRole(userService service.UserService, role string, requireTwoFactor bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("jwt_claims").(jwt.MapClaims)
+			if !ok {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+			userID, err := service.UserIDFromClaims(claims)
+			if err != nil {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			user, err := userService.GetByID(userID)
+			if err != nil || user.Disabled || user.Role != role {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			if requireTwoFactor && !service.HasAuthMethod(claims, service.AuthMethodOTP) {
+				http.Error(w, "Two-factor authentication required", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/service"
+	"github.com/golang-jwt/jwt"
+)
+
+// RequireScope only lets through requests whose credentials were granted
+// scope. Credentials without a scope claim are granted nothing; the
+// token service gives older login tokens the scopes of the user's role
+// when it parses them. Other requests get 403 with an insufficient_scope
+// challenge (RFC 6750 section 3.1). It must run after JWTAuth; without
+// authentication there are no claims and nothing is restricted.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return RequireScopeFunc(func(*http.Request) string { return scope })
+}
+
+// RequireScopeFunc is RequireScope for routes whose required scope depends
+// on the request.
+func RequireScopeFunc(scopeFor func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scope := scopeFor(r)
+			claims, authenticated := r.Context().Value("jwt_claims").(jwt.MapClaims)
+			granted, _ := claims["scope"].(string)
+			if authenticated && !hasScope(granted, scope) {
+				scheme := "Bearer"
+				if _, ok := claims["api_key"]; ok {
+					scheme = strings.TrimSpace(APIKeyScheme)
+				}
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+					`%s error="insufficient_scope", error_description="The credentials lack the %s scope", scope="%s"`,
+					scheme, scope, scope))
+				http.Error(w, "Insufficient scope, requires "+scope, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func hasScope(granted, scope string) bool {
+	for _, s := range strings.Fields(granted) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// LoginScopes returns the scopes for a login token of user. requested is
+// the space separated "scope" parameter of the login request; without it
+// the token gets every scope of the user's role. It answers the request
+// itself and returns false if the requested scopes are refused.
+func LoginScopes(w http.ResponseWriter, user entity.User, requested string) ([]string, bool) {
+	scopes, err := service.LoginScopes(user, requested)
+	switch {
+	case errors.Is(err, service.ErrInvalidScope):
+		http.Error(w, "Unknown scope requested", http.StatusBadRequest)
+		return nil, false
+	case errors.Is(err, service.ErrScopeNotAllowed):
+		http.Error(w, "Scope not allowed for this user", http.StatusForbidden)
+		return nil, false
+	case err != nil:
+		http.Error(w, "Invalid scope", http.StatusBadRequest)
+		return nil, false
+	}
+	return scopes, true
+}
@@ -1,24 +1,22 @@
 package middleware
 
 import (
-	"encoding/json"
 	"net/http"
-	"os"
-	"time"
 
+	"github.com/biswasurmi/book-cli/domain/entity"
 	"github.com/biswasurmi/book-cli/service"
-	"github.com/golang-jwt/jwt"
-	"github.com/joho/godotenv"
 )
 
-// Load environment variables once during initialization
-func init() {
-	if err := godotenv.Load(); err != nil {
-		// Log error but continue
-	}
-}
+// TOTPHeader carries the two-factor code for GET /api/v1/get-token.
+const TOTPHeader = "X-TOTP-Code"
+
+func GetTokenHandler(w http.ResponseWriter, r *http.Request, authEnabled bool, userService service.UserService, tokens service.TokenService, twoFactor service.TwoFactorService) {
+	// If auth is disabled, hand out a token for a default user
+	user := entity.User{ID: 0, Email: "test@example.com"}
+	var methods []string
+	// A reduced set of scopes may be asked for with ?scope=books:read
+	requested := r.URL.Query().Get("scope")
 
-func GetTokenHandler(w http.ResponseWriter, r *http.Request, authEnabled bool, userService service.UserService) {
 	if authEnabled {
 		email, password, ok := r.BasicAuth()
 		if !ok {
@@ -27,61 +25,27 @@ func GetTokenHandler(w http.ResponseWriter, r *http.Request, authEnabled bool, u
 			return
 		}
 
-		user, err := userService.Authenticate(email, password)
-		if err != nil {
-			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		var err error
+		user, err = userService.Authenticate(RequestActor(r), email, password)
+		if AuthenticationRefused(w, err) {
 			return
 		}
-
-		// Get the secret key from environment variable
-		secretKey := []byte(os.Getenv("JWT_SECRET"))
-		if len(secretKey) == 0 {
-			http.Error(w, "Server configuration error", http.StatusInternalServerError)
-			return
-		}
-
-		// Generate JWT token using golang-jwt/jwt
-		token := jwt.New(jwt.SigningMethodHS256)
-		claims := token.Claims.(jwt.MapClaims)
-		claims["user_id"] = user.ID
-		claims["email"] = user.Email
-		claims["exp"] = time.Now().Add(time.Hour * 24).Unix()
-
-		tokenString, err := token.SignedString(secretKey)
 		if err != nil {
-			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"token": tokenString,
-		})
-		return
 	}
 
-	// If auth is disabled, return a default token
-	secretKey := []byte(os.Getenv("JWT_SECRET"))
-	if len(secretKey) == 0 {
-		http.Error(w, "Server configuration error", http.StatusInternalServerError)
+	scopes, ok := LoginScopes(w, user, requested)
+	if !ok {
 		return
 	}
-
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["user_id"] = 0
-	claims["email"] = "test@example.com"
-	claims["exp"] = time.Now().Add(time.Hour * 24).Unix()
-
-	tokenString, err := token.SignedString(secretKey)
-	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
-		return
+	if authEnabled {
+		if methods, ok = SecondFactor(w, r, twoFactor, user, r.Header.Get(TOTPHeader)); !ok {
+			return
+		}
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"token": tokenString,
-	})
-}
\ No newline at end of file
+	WriteToken(w, tokens, user, scopes, methods...)
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/service"
+)
+
+// SecondFactor runs the second login step for a user who passed the
+// password check. Users without two-factor authentication pass straight
+// through. Without a code the response is 401 with a challenge token for
+// POST /api/v1/login/2fa. It returns the authentication methods to record
+// in the token, or false if it answered the request itself.
+func SecondFactor(w http.ResponseWriter, r *http.Request, twoFactor service.TwoFactorService, user entity.User, code string) ([]string, bool) {
+	if !user.TOTPEnabled {
+		return []string{service.AuthMethodPassword}, true
+	}
+
+	if code == "" {
+		challenge, err := twoFactor.Challenge(user)
+		if err != nil {
+			http.Error(w, "Failed to start two-factor login", http.StatusInternalServerError)
+			return nil, false
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":        "two-factor code required",
+			"mfa_required": true,
+			"mfa_token":    challenge,
+		})
+		return nil, false
+	}
+
+	err := twoFactor.Check(RequestActor(r), user, code)
+	if AuthenticationRefused(w, err) {
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return nil, false
+	}
+	return []string{service.AuthMethodPassword, service.AuthMethodOTP}, true
+}
+
+// WriteToken answers a successful login with a new token for user,
+// limited to scopes.
+func WriteToken(w http.ResponseWriter, tokens service.TokenService, user entity.User, scopes []string, methods ...string) {
+	issued, err := tokens.Issue(user, service.TokenOptions{Methods: methods, Scopes: scopes})
+	if errors.Is(err, service.ErrMissingSecret) {
+		http.Error(w, "Server configuration error", http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"token": issued.Token, "scope": strings.Join(scopes, " ")})
+}
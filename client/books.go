@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+)
+
+func (c *Client) ListBooks(ctx context.Context, filter entity.BookFilter) ([]entity.Book, error) {
+	return c.listBooks(ctx, "/api/v1/books", filter)
+}
+
+// MyBooks lists the books the logged in user created. filter.CreatedBy is
+// ignored.
+func (c *Client) MyBooks(ctx context.Context, filter entity.BookFilter) ([]entity.Book, error) {
+	return c.listBooks(ctx, "/api/v1/users/me/books", filter)
+}
+
+func (c *Client) listBooks(ctx context.Context, path string, filter entity.BookFilter) ([]entity.Book, error) {
+	query := url.Values{}
+	if filter.Name != "" {
+		query.Set("name", filter.Name)
+	}
+	if filter.Author != "" {
+		query.Set("author", filter.Author)
+	}
+	if filter.ISBN != "" {
+		query.Set("isbn", filter.ISBN)
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var books []entity.Book
+	err := c.do(ctx, http.MethodGet, path, nil, &books)
+	return books, err
+}
+
+func (c *Client) CreateBook(ctx context.Context, book entity.Book) (entity.Book, error) {
+	var created entity.Book
+	err := c.do(ctx, http.MethodPost, "/api/v1/books", book, &created)
+	return created, err
+}
+
+func (c *Client) GetBook(ctx context.Context, uuid string) (entity.Book, error) {
+	var book entity.Book
+	err := c.do(ctx, http.MethodGet, "/api/v1/books/"+url.PathEscape(uuid), nil, &book)
+	return book, err
+}
+
+func (c *Client) UpdateBook(ctx context.Context, book entity.Book) (entity.Book, error) {
+	var updated entity.Book
+	err := c.do(ctx, http.MethodPut, "/api/v1/books/"+url.PathEscape(book.UUID), book, &updated)
+	return updated, err
+}
+
+func (c *Client) DeleteBook(ctx context.Context, uuid string) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/books/"+url.PathEscape(uuid), nil, nil)
+}
+
+// BookRevisions lists the saved revisions of a book, oldest first.
+func (c *Client) BookRevisions(ctx context.Context, uuid string) ([]entity.BookRevision, error) {
+	var revisions []entity.BookRevision
+	err := c.do(ctx, http.MethodGet, "/api/v1/books/"+url.PathEscape(uuid)+"/revisions", nil, &revisions)
+	return revisions, err
+}
+
+// DiffBookRevisions returns the fields that differ between two revisions.
+func (c *Client) DiffBookRevisions(ctx context.Context, uuid string, from, to int) (entity.BookRevisionDiff, error) {
+	query := url.Values{"from": {strconv.Itoa(from)}, "to": {strconv.Itoa(to)}}
+	var diff entity.BookRevisionDiff
+	err := c.do(ctx, http.MethodGet, "/api/v1/books/"+url.PathEscape(uuid)+"/revisions/diff?"+query.Encode(), nil, &diff)
+	return diff, err
+}
+
+// RestoreBookRevision rolls a book back to a revision and returns the
+// book as saved.
+func (c *Client) RestoreBookRevision(ctx context.Context, uuid string, number int) (entity.Book, error) {
+	var book entity.Book
+	err := c.do(ctx, http.MethodPost, "/api/v1/books/"+url.PathEscape(uuid)+"/revisions/"+strconv.Itoa(number)+"/restore", nil, &book)
+	return book, err
+}
@@ -0,0 +1,214 @@
+// Package client is a Go SDK for the book API. It takes care of obtaining
+// and refreshing JWTs, retries transient failures with backoff and maps
+// error responses onto typed errors.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+type Config struct {
+	// BaseURL of the server, e.g. "http://localhost:8080".
+	BaseURL string
+	// Email and Password are used to log in whenever a token is needed.
+	Email    string
+	Password string
+	// Scopes, if set, limits the tokens from logging in to these scopes
+	// instead of every scope of the user's role.
+	Scopes []string
+	// Token is used as is when no credentials are configured.
+	Token string
+	// APIKey, if set, is sent instead of logging in or using Token.
+	APIKey string
+
+	HTTPClient *http.Client
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry; it doubles for each
+	// further retry.
+	RetryBackoff time.Duration
+}
+
+type Client struct {
+	cfg        Config
+	httpClient *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func New(cfg Config) *Client {
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = 200 * time.Millisecond
+	}
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{cfg: cfg, httpClient: httpClient, token: cfg.Token}
+}
+
+// Token returns the token currently in use, logging in first if needed.
+func (c *Client) Token(ctx context.Context) (string, error) {
+	return c.currentToken(ctx, false)
+}
+
+func (c *Client) currentToken(ctx context.Context, refresh bool) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cfg.Email == "" {
+		return c.token, nil
+	}
+	if !refresh && c.token != "" && (c.expiry.IsZero() || time.Until(c.expiry) > 30*time.Second) {
+		return c.token, nil
+	}
+
+	token, err := c.login(ctx, c.cfg.Email, c.cfg.Password, "")
+	if err != nil {
+		return "", err
+	}
+	c.setToken(token)
+	return token, nil
+}
+
+func (c *Client) setToken(token string) {
+	c.token = token
+	c.expiry = time.Time{}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err == nil {
+		if exp, ok := claims["exp"].(float64); ok {
+			c.expiry = time.Unix(int64(exp), 0)
+		}
+	}
+}
+
+// do sends an authenticated request, refreshing the token once if the
+// server rejects it.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	if c.cfg.APIKey != "" {
+		return c.send(ctx, method, path, "ApiKey "+c.cfg.APIKey, in, out)
+	}
+
+	token, err := c.currentToken(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	err = c.send(ctx, method, path, bearer(token), in, out)
+	if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == http.StatusUnauthorized && c.cfg.Email != "" {
+		if token, err = c.currentToken(ctx, true); err != nil {
+			return err
+		}
+		return c.send(ctx, method, path, bearer(token), in, out)
+	}
+	return err
+}
+
+func bearer(token string) string {
+	if token == "" {
+		return ""
+	}
+	return "Bearer " + token
+}
+
+// send performs a single logical request, retrying transient failures.
+// authorization is the Authorization header, if any.
+func (c *Client) send(ctx context.Context, method, path, authorization string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	idempotent := method != http.MethodPost
+	backoff := c.cfg.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, c.cfg.BaseURL+path, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		if in != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if !idempotent || attempt >= c.cfg.MaxRetries || ctx.Err() != nil {
+				return err
+			}
+		case retryable(resp.StatusCode, idempotent) && attempt < c.cfg.MaxRetries:
+			wait = retryAfter(resp)
+			resp.Body.Close()
+		default:
+			return decodeResponse(resp, out)
+		}
+
+		if wait == 0 {
+			wait = backoff + time.Duration(rand.Int63n(int64(backoff)/2+1))
+		}
+		backoff *= 2
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// retryable reports whether a response status is worth another attempt.
+// 429 and 503 mean the request was not processed, so even non-idempotent
+// requests may be repeated.
+func retryable(status int, idempotent bool) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func decodeResponse(resp *http.Response, out interface{}) error {
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
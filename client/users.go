@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+)
+
+// Register creates a new account. It does not need a token.
+func (c *Client) Register(ctx context.Context, user entity.User) (entity.User, error) {
+	var created entity.User
+	err := c.send(ctx, http.MethodPost, "/api/v1/register", "", user, &created)
+	return created, err
+}
+
+// Login exchanges credentials for a token, which the client then uses for
+// subsequent requests.
+func (c *Client) Login(ctx context.Context, email, password string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	token, err := c.login(ctx, email, password, "")
+	if err != nil {
+		return "", err
+	}
+	c.setToken(token)
+	return token, nil
+}
+
+// LoginWithCode is Login for accounts with two-factor authentication; code
+// is a current TOTP code or a recovery code.
+func (c *Client) LoginWithCode(ctx context.Context, email, password, code string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	token, err := c.login(ctx, email, password, code)
+	if err != nil {
+		return "", err
+	}
+	c.setToken(token)
+	return token, nil
+}
+
+func (c *Client) login(ctx context.Context, email, password, code string) (string, error) {
+	creds := map[string]string{"email": email, "password": password}
+	if code != "" {
+		creds["code"] = code
+	}
+	if len(c.cfg.Scopes) > 0 {
+		creds["scope"] = strings.Join(c.cfg.Scopes, " ")
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := c.send(ctx, http.MethodPost, "/api/v1/login", "", creds, &resp); err != nil {
+		return "", err
+	}
+	return resp.Token, nil
+}
+
+func (c *Client) GetUser(ctx context.Context, id int64) (entity.User, error) {
+	var user entity.User
+	err := c.do(ctx, http.MethodGet, "/api/v1/users/"+strconv.FormatInt(id, 10), nil, &user)
+	return user, err
+}
+
+func (c *Client) Me(ctx context.Context) (entity.User, error) {
+	var user entity.User
+	err := c.do(ctx, http.MethodGet, "/api/v1/users/me", nil, &user)
+	return user, err
+}
+
+func (c *Client) UpdateUser(ctx context.Context, user entity.User) (entity.User, error) {
+	var updated entity.User
+	err := c.do(ctx, http.MethodPut, "/api/v1/users/"+strconv.FormatInt(user.ID, 10), user, &updated)
+	return updated, err
+}
+
+func (c *Client) DeleteUser(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/users/"+strconv.FormatInt(id, 10), nil, nil)
+}
+
+// ForgotPassword asks the server to email a password reset token. It
+// succeeds whether or not the email belongs to an account.
+func (c *Client) ForgotPassword(ctx context.Context, email string) error {
+	return c.send(ctx, http.MethodPost, "/api/v1/password/forgot", "", map[string]string{"email": email}, nil)
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword.
+func (c *Client) ResetPassword(ctx context.Context, token, password string) error {
+	return c.send(ctx, http.MethodPost, "/api/v1/password/reset", "", map[string]string{"token": token, "password": password}, nil)
+}
+
+// VerifyEmail confirms an email address using the token from the
+// verification email.
+func (c *Client) VerifyEmail(ctx context.Context, token string) error {
+	return c.send(ctx, http.MethodGet, "/api/v1/verify-email?token="+url.QueryEscape(token), "", nil, nil)
+}
+
+// ResendVerification asks the server to email a new verification link. It
+// succeeds whether or not the email belongs to a pending account.
+func (c *Client) ResendVerification(ctx context.Context, email string) error {
+	return c.send(ctx, http.MethodPost, "/api/v1/verify-email/resend", "", map[string]string{"email": email}, nil)
+}
+
+// CreateAPIKey issues an API key for the current user and returns it with
+// the full key, which the server does not show again. A zero expiresAt
+// picks the server's default lifetime.
+func (c *Client) CreateAPIKey(ctx context.Context, name string, scopes []string, expiresAt time.Time) (entity.APIKey, string, error) {
+	req := map[string]interface{}{"name": name, "scopes": scopes}
+	if !expiresAt.IsZero() {
+		req["expires_at"] = expiresAt
+	}
+	var created struct {
+		entity.APIKey
+		Key string `json:"key"`
+	}
+	err := c.do(ctx, http.MethodPost, "/api/v1/users/me/api-keys", req, &created)
+	return created.APIKey, created.Key, err
+}
+
+func (c *Client) ListAPIKeys(ctx context.Context) ([]entity.APIKey, error) {
+	var keys []entity.APIKey
+	err := c.do(ctx, http.MethodGet, "/api/v1/users/me/api-keys", nil, &keys)
+	return keys, err
+}
+
+func (c *Client) RevokeAPIKey(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/users/me/api-keys/"+url.PathEscape(id), nil, nil)
+}
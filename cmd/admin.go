@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/biswasurmi/book-cli/config"
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+	"github.com/biswasurmi/book-cli/infrastructure/persistance"
+	"github.com/biswasurmi/book-cli/service"
+	"github.com/spf13/cobra"
+)
+
+var adminFlags struct {
+	email    string
+	username string
+	role     string
+}
+
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Administer the data store directly, without a running server",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		cmd.SilenceUsage = true
+	},
+}
+
+var adminUsersCmd = &cobra.Command{
+	Use:   "users",
+	Short: "Manage user accounts in the configured store",
+}
+
+// openUserRepository opens the store from the configuration for offline
+// administration. The returned function releases the store.
+func openUserRepository(cmd *cobra.Command) (repository.UserRepository, func() error, error) {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.Storage.Driver == config.StorageMemory {
+		log.Println("Warning: the memory storage driver does not persist changes made by admin commands")
+	}
+	repos, closeStore, err := persistance.Open(cfg.Storage)
+	if err != nil {
+		return nil, nil, err
+	}
+	return repos.UserRepository, closeStore, nil
+}
+
+// findUser looks a user up by email or numeric ID.
+func findUser(repo repository.UserRepository, ref string) (entity.User, error) {
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		return repo.GetByID(id)
+	}
+	return repo.GetByEmail(ref)
+}
+
+func validRole(role string) error {
+	if !slices.Contains(entity.Roles, role) {
+		return fmt.Errorf("unknown role %q (valid roles: %s)", role, strings.Join(entity.Roles, ", "))
+	}
+	return nil
+}
+
+var adminUsersCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a user, e.g. the first administrator",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		adminFlags.email = entity.NormalizeEmail(adminFlags.email)
+		if !strings.Contains(adminFlags.email, "@") {
+			return errors.New("invalid email format")
+		}
+		if err := validRole(adminFlags.role); err != nil {
+			return err
+		}
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+		if len(password) < service.MinPasswordLength {
+			return fmt.Errorf("password must be at least %d characters", service.MinPasswordLength)
+		}
+
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+		repo, closeStore, err := openUserRepository(cmd)
+		if err != nil {
+			return err
+		}
+		defer closeStore()
+		if _, err := repo.GetByEmail(adminFlags.email); err == nil {
+			return fmt.Errorf("a user with email %s already exists", adminFlags.email)
+		}
+
+		hashed, err := service.NewPasswordHasher(cfg.Passwords).Hash(password)
+		if err != nil {
+			return err
+		}
+		id, err := service.NewUserID(repo, service.NewIDGenerator(cfg.Server.NodeID))
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		user, err := repo.CreateUser(entity.User{
+			ID:        id,
+			Username:  adminFlags.username,
+			Email:     adminFlags.email,
+			Password:  hashed,
+			Role:      adminFlags.role,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+		return printUsers(cmd, user, []entity.User{user})
+	},
+}
+
+var adminUsersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all users",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repo, closeStore, err := openUserRepository(cmd)
+		if err != nil {
+			return err
+		}
+		defer closeStore()
+		users, err := repo.GetAllUsers()
+		if err != nil {
+			return err
+		}
+		if users == nil {
+			users = []entity.User{}
+		}
+		slices.SortFunc(users, func(a, b entity.User) int { return strings.Compare(a.Email, b.Email) })
+		for i := range users {
+			users[i] = users[i].WithoutSecrets()
+		}
+		return printUsers(cmd, users, users)
+	},
+}
+
+var adminUsersResetPasswordCmd = &cobra.Command{
+	Use:   "reset-password <email|id>",
+	Short: "Set a new password for a user and sign out their sessions",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+		if len(password) < service.MinPasswordLength {
+			return fmt.Errorf("password must be at least %d characters", service.MinPasswordLength)
+		}
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+		passwords := service.NewPasswordHasher(cfg.Passwords)
+		return updateUser(cmd, args[0], func(user *entity.User) error {
+			hashed, err := passwords.Hash(password)
+			user.Password = hashed
+			user.SessionsRevokedAt = time.Now()
+			return err
+		})
+	},
+}
+
+var adminUsersDisableCmd = &cobra.Command{
+	Use:   "disable <email|id>",
+	Short: "Prevent a user from logging in",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateUser(cmd, args[0], func(user *entity.User) error {
+			user.Disabled = true
+			return nil
+		})
+	},
+}
+
+var adminUsersEnableCmd = &cobra.Command{
+	Use:   "enable <email|id>",
+	Short: "Allow a disabled user to log in again",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateUser(cmd, args[0], func(user *entity.User) error {
+			user.Disabled = false
+			return nil
+		})
+	},
+}
+
+var adminUsersReset2FACmd = &cobra.Command{
+	Use:   "reset-2fa <email|id>",
+	Short: "Turn off two-factor authentication for a user who lost their authenticator",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateUser(cmd, args[0], func(user *entity.User) error {
+			user.TOTPEnabled = false
+			user.TOTPSecret = ""
+			user.TOTPLastStep = 0
+			user.RecoveryCodes = nil
+			return nil
+		})
+	},
+}
+
+var adminUsersSetRoleCmd = &cobra.Command{
+	Use:   "set-role <email|id> <role>",
+	Short: "Change the role of a user",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validRole(args[1]); err != nil {
+			return err
+		}
+		return updateUser(cmd, args[0], func(user *entity.User) error {
+			user.Role = args[1]
+			return nil
+		})
+	},
+}
+
+func updateUser(cmd *cobra.Command, ref string, change func(*entity.User) error) error {
+	repo, closeStore, err := openUserRepository(cmd)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+	user, err := findUser(repo, ref)
+	if err != nil {
+		return err
+	}
+	if err := change(&user); err != nil {
+		return err
+	}
+	user, err = repo.Update(user)
+	if err != nil {
+		return err
+	}
+	user = user.WithoutSecrets()
+	return printUsers(cmd, user, []entity.User{user})
+}
+
+func init() {
+	rootCmd.AddCommand(adminCmd)
+	adminCmd.AddCommand(adminUsersCmd)
+	adminUsersCmd.AddCommand(adminUsersCreateCmd, adminUsersListCmd, adminUsersResetPasswordCmd,
+		adminUsersDisableCmd, adminUsersEnableCmd, adminUsersSetRoleCmd, adminUsersReset2FACmd)
+	adminCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "table", "Output format: table, json or yaml")
+	adminCmd.PersistentFlags().String("storage-driver", "", "Storage driver, overrides the config")
+	adminCmd.PersistentFlags().String("storage-path", "", "Storage path, overrides the config")
+
+	adminUsersCreateCmd.Flags().StringVar(&adminFlags.email, "email", "", "Account email")
+	adminUsersCreateCmd.Flags().StringVar(&adminFlags.username, "username", "", "Display name")
+	adminUsersCreateCmd.Flags().StringVar(&adminFlags.role, "role", entity.RoleUser, "Role of the new user")
+	adminUsersCreateCmd.MarkFlagRequired("email")
+
+	for _, c := range []*cobra.Command{adminUsersCreateCmd, adminUsersResetPasswordCmd} {
+		c.Flags().StringVar(&userFlags.password, "password", "", "New password")
+		c.Flags().BoolVar(&userFlags.passwordStdin, "password-stdin", false, "Read the password from standard input")
+	}
+}
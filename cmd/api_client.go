@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/biswasurmi/book-cli/client"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	serverURL       string
+	credentialsFile string
+	outputFormat    string
+)
+
+// credentials is what `users login` remembers between invocations.
+type credentials struct {
+	Server string `json:"server"`
+	Token  string `json:"token"`
+}
+
+func credentialsPath() (string, error) {
+	if credentialsFile != "" {
+		return credentialsFile, nil
+	}
+	if path := os.Getenv("BOOK_CREDENTIALS"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "book-cli", "credentials.json"), nil
+}
+
+func loadCredentials() (credentials, error) {
+	var creds credentials
+	path, err := credentialsPath()
+	if err != nil {
+		return creds, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return creds, nil
+	}
+	if err != nil {
+		return creds, err
+	}
+	return creds, json.Unmarshal(data, &creds)
+}
+
+func saveCredentials(creds credentials) (string, error) {
+	path, err := credentialsPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, data, 0o600)
+}
+
+// newAPIClient returns a client for the server given by --server, falling
+// back to the server the stored token was issued by.
+func newAPIClient() (*client.Client, credentials, error) {
+	creds, err := loadCredentials()
+	if err != nil {
+		return nil, creds, fmt.Errorf("reading credentials: %w", err)
+	}
+
+	server := serverURL
+	if server == "" {
+		server = os.Getenv("BOOK_SERVER")
+	}
+	if server == "" {
+		server = creds.Server
+	}
+	if server == "" {
+		server = "http://localhost:8080"
+	}
+
+	token := ""
+	if creds.Server == server {
+		token = creds.Token
+	}
+	creds.Server = server
+	return client.New(client.Config{BaseURL: server, Token: token, MaxRetries: 2}), creds, nil
+}
+
+// apiError turns client errors into messages that tell the user what to do.
+func apiError(err error) error {
+	if errors.Is(err, client.ErrUnauthorized) {
+		return fmt.Errorf("%w (run `book-cli users login` first)", err)
+	}
+	return err
+}
+
+// printOutput writes v in the format selected with --output. table renders
+// the rows returned by tableRows.
+func printOutput(w io.Writer, v interface{}, header []string, tableRows func() [][]string) error {
+	switch outputFormat {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "yaml":
+		// Round-trip through JSON so YAML keys match the API's field names
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var generic interface{}
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return err
+		}
+		return yaml.NewEncoder(w).Encode(generic)
+	case "table", "":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		for _, row := range tableRows() {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q (use table, json or yaml)", outputFormat)
+	}
+}
+
+// addClientFlags registers the flags shared by commands that talk to a
+// running server.
+func addClientFlags(cmd *cobra.Command) {
+	// Errors past argument parsing come from the server, usage won't help
+	cmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		cmd.SilenceUsage = true
+	}
+	cmd.PersistentFlags().StringVar(&serverURL, "server", "", "Book server URL (default $BOOK_SERVER or the server you logged in to)")
+	cmd.PersistentFlags().StringVar(&credentialsFile, "credentials", "", "Credentials file (default $BOOK_CREDENTIALS or the user config dir)")
+	cmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "table", "Output format: table, json or yaml")
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/biswasurmi/book-cli/infrastructure/backup"
+	"github.com/biswasurmi/book-cli/infrastructure/persistance"
+	"github.com/spf13/cobra"
+)
+
+var backupFile string
+var restoreOverwrite bool
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Export all data from the configured store into an archive",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+		repos, closeStore, err := persistance.Open(cfg.Storage)
+		if err != nil {
+			return err
+		}
+		defer closeStore()
+
+		var w io.Writer = cmd.OutOrStdout()
+		if backupFile != "-" {
+			f, err := os.OpenFile(backupFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+
+		manifest, err := backup.Write(w, repos)
+		if err != nil {
+			return err
+		}
+		if backupFile != "-" {
+			printCollections(cmd.ErrOrStderr(), "Backed up", func(name string) int {
+				return manifest.Collections[name].Count
+			}, manifest.Collections)
+		}
+		return nil
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <archive>",
+	Short: "Load an archive created by backup into the configured store",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		archive, err := backup.Read(f)
+		if err != nil {
+			return err
+		}
+
+		repos, closeStore, err := persistance.Open(cfg.Storage)
+		if err != nil {
+			return err
+		}
+		defer closeStore()
+		restored, err := backup.Restore(repos, archive, backup.RestoreOptions{Overwrite: restoreOverwrite})
+		if err != nil {
+			return err
+		}
+		printCollections(cmd.OutOrStdout(), "Restored", func(name string) int { return restored[name] }, archive.Manifest.Collections)
+		return nil
+	},
+}
+
+func printCollections(w io.Writer, verb string, count func(string) int, collections map[string]backup.CollectionInfo) {
+	names := make([]string, 0, len(collections))
+	for name := range collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s %d %s\n", verb, count(name), name)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd, restoreCmd)
+	backupCmd.Flags().StringVarP(&backupFile, "file", "f", "-", "Archive to write, - for standard output")
+	restoreCmd.Flags().BoolVar(&restoreOverwrite, "overwrite", false, "Replace existing records instead of requiring an empty store")
+
+	for _, c := range []*cobra.Command{backupCmd, restoreCmd} {
+		c.Flags().String("storage-driver", "", "Storage driver, overrides the config")
+		c.Flags().String("storage-path", "", "Storage path, overrides the config")
+	}
+}
@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/spf13/cobra"
+)
+
+var bookFlags struct {
+	name        string
+	authors     []string
+	author      string
+	publishDate string
+	isbn        string
+}
+
+var booksCmd = &cobra.Command{
+	Use:   "books",
+	Short: "Manage books on a running server",
+}
+
+func printBooks(cmd *cobra.Command, v interface{}, books []entity.Book) error {
+	return printOutput(cmd.OutOrStdout(), v, []string{"UUID", "NAME", "AUTHORS", "PUBLISHED", "ISBN"}, func() [][]string {
+		rows := make([][]string, 0, len(books))
+		for _, b := range books {
+			rows = append(rows, []string{b.UUID, b.Name, strings.Join(b.AuthorList, ", "), b.PublishDate, b.ISBN})
+		}
+		return rows
+	})
+}
+
+var booksListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List books, optionally filtered",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, _, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		filter := entity.BookFilter{Name: bookFlags.name, Author: bookFlags.author, ISBN: bookFlags.isbn}
+		books, err := c.ListBooks(cmd.Context(), filter)
+		if err != nil {
+			return apiError(err)
+		}
+		return printBooks(cmd, books, books)
+	},
+}
+
+var booksGetCmd = &cobra.Command{
+	Use:   "get <uuid>",
+	Short: "Show a single book",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, _, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		book, err := c.GetBook(cmd.Context(), args[0])
+		if err != nil {
+			return apiError(err)
+		}
+		return printBooks(cmd, book, []entity.Book{book})
+	},
+}
+
+var booksCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Add a book",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if bookFlags.name == "" {
+			return fmt.Errorf("--name is required")
+		}
+		c, _, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		book, err := c.CreateBook(cmd.Context(), entity.Book{
+			Name:        bookFlags.name,
+			AuthorList:  bookFlags.authors,
+			PublishDate: bookFlags.publishDate,
+			ISBN:        bookFlags.isbn,
+		})
+		if err != nil {
+			return apiError(err)
+		}
+		return printBooks(cmd, book, []entity.Book{book})
+	},
+}
+
+var booksUpdateCmd = &cobra.Command{
+	Use:   "update <uuid>",
+	Short: "Change fields of a book; fields without a flag are kept",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, _, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		book, err := c.GetBook(cmd.Context(), args[0])
+		if err != nil {
+			return apiError(err)
+		}
+
+		flags := cmd.Flags()
+		if flags.Changed("name") {
+			book.Name = bookFlags.name
+		}
+		if flags.Changed("author") {
+			book.AuthorList = bookFlags.authors
+		}
+		if flags.Changed("publish-date") {
+			book.PublishDate = bookFlags.publishDate
+		}
+		if flags.Changed("isbn") {
+			book.ISBN = bookFlags.isbn
+		}
+
+		book, err = c.UpdateBook(cmd.Context(), book)
+		if err != nil {
+			return apiError(err)
+		}
+		return printBooks(cmd, book, []entity.Book{book})
+	},
+}
+
+var booksDeleteCmd = &cobra.Command{
+	Use:   "delete <uuid>",
+	Short: "Delete a book",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, _, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		if err := c.DeleteBook(cmd.Context(), args[0]); err != nil {
+			return apiError(err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Deleted book %s\n", args[0])
+		return nil
+	},
+}
+
+var booksRevisionsCmd = &cobra.Command{
+	Use:   "revisions <uuid>",
+	Short: "List the saved revisions of a book",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, _, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		revisions, err := c.BookRevisions(cmd.Context(), args[0])
+		if err != nil {
+			return apiError(err)
+		}
+		return printOutput(cmd.OutOrStdout(), revisions, []string{"REVISION", "SAVED", "BY", "NAME", "RESTORED FROM"}, func() [][]string {
+			rows := make([][]string, 0, len(revisions))
+			for _, r := range revisions {
+				restored := ""
+				if r.RestoredFrom != 0 {
+					restored = strconv.Itoa(r.RestoredFrom)
+				}
+				rows = append(rows, []string{strconv.Itoa(r.Number), r.CreatedAt.Format(time.RFC3339),
+					strconv.FormatInt(r.CreatedBy, 10), r.Book.Name, restored})
+			}
+			return rows
+		})
+	},
+}
+
+var booksRestoreCmd = &cobra.Command{
+	Use:   "restore <uuid> <revision>",
+	Short: "Roll a book back to a saved revision",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		number, err := strconv.Atoi(args[1])
+		if err != nil || number < 1 {
+			return fmt.Errorf("invalid revision %q", args[1])
+		}
+		c, _, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		book, err := c.RestoreBookRevision(cmd.Context(), args[0], number)
+		if err != nil {
+			return apiError(err)
+		}
+		return printBooks(cmd, book, []entity.Book{book})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(booksCmd)
+	addClientFlags(booksCmd)
+	booksCmd.AddCommand(booksListCmd, booksGetCmd, booksCreateCmd, booksUpdateCmd, booksDeleteCmd,
+		booksRevisionsCmd, booksRestoreCmd)
+
+	booksListCmd.Flags().StringVar(&bookFlags.name, "name", "", "Only books whose name contains this text")
+	booksListCmd.Flags().StringVar(&bookFlags.author, "author", "", "Only books with an author containing this text")
+	booksListCmd.Flags().StringVar(&bookFlags.isbn, "isbn", "", "Only the book with this ISBN")
+
+	for _, c := range []*cobra.Command{booksCreateCmd, booksUpdateCmd} {
+		c.Flags().StringVar(&bookFlags.name, "name", "", "Book name")
+		c.Flags().StringSliceVar(&bookFlags.authors, "author", nil, "Author, may be repeated")
+		c.Flags().StringVar(&bookFlags.publishDate, "publish-date", "", "Publish date, e.g. 2022-01-02")
+		c.Flags().StringVar(&bookFlags.isbn, "isbn", "", "ISBN")
+	}
+}
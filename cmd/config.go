@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/biswasurmi/book-cli/config"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var configFile string
+
+// loadConfig resolves the effective configuration for a command: defaults,
+// then the config file, then environment variables, then any flags the user
+// set explicitly on the command line.
+func loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	path := configFile
+	if path == "" {
+		path = os.Getenv("BOOK_CONFIG")
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := cmd.Flags()
+	if flags.Changed("port") {
+		cfg.Server.Port, _ = flags.GetString("port")
+	}
+	if flags.Changed("auth") {
+		cfg.Auth.Enabled, _ = flags.GetBool("auth")
+	}
+	if flags.Changed("tls-cert") {
+		cfg.TLS.CertFile, _ = flags.GetString("tls-cert")
+	}
+	if flags.Changed("tls-key") {
+		cfg.TLS.KeyFile, _ = flags.GetString("tls-key")
+	}
+	if flags.Changed("tls-client-ca") {
+		cfg.TLS.ClientCAFile, _ = flags.GetString("tls-client-ca")
+	}
+	if flags.Changed("tls-client-auth") {
+		cfg.TLS.ClientAuth, _ = flags.GetString("tls-client-auth")
+	}
+	if flags.Changed("self-signed") {
+		cfg.TLS.SelfSigned, _ = flags.GetBool("self-signed")
+	}
+	if flags.Changed("storage-driver") {
+		cfg.Storage.Driver, _ = flags.GetString("storage-driver")
+	}
+	if flags.Changed("storage-path") {
+		cfg.Storage.Path, _ = flags.GetString("storage-path")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the server configuration",
+}
+
+var configPrintCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Print the effective configuration with secrets redacted",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+		out, err := yaml.Marshal(cfg.Redacted())
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(cmd.OutOrStdout(), string(out))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configPrintCmd)
+}
@@ -21,6 +21,7 @@ func Execute() {
 
 func init() {
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Path to a YAML or TOML config file (default $BOOK_CONFIG)")
 }
 
 
@@ -1,44 +1,108 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/biswasurmi/book-cli/api/handler"
-	"github.com/biswasurmi/book-cli/infrastructure/persistance/inmemory"
+	"github.com/biswasurmi/book-cli/infrastructure/certs"
+	"github.com/biswasurmi/book-cli/infrastructure/persistance"
 	"github.com/biswasurmi/book-cli/service"
 	"github.com/spf13/cobra"
 )
 
-var port string
-var auth bool
-
 var startProject = &cobra.Command{
 	Use:   "startProject",
 	Short: "Start the Book Server",
 	Run: func(cmd *cobra.Command, args []string) {
-		log.Println("Starting Book Server on port", port)
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			log.Fatalf("Configuration error: %v", err)
+		}
 
-		repos := inmemory.GetRepositories()
-		services := service.GetServices(repos)
-		h := &handler.Handler{
-			BookHandler: handler.NewBookHandler(services.BookService),
-			UserHandler: handler.NewUserHandler(services.UserService),
+		log.Println("Starting Book Server on port", cfg.Server.Port)
+
+		repos, closeStore, err := persistance.Open(cfg.Storage)
+		if err != nil {
+			log.Fatalf("Storage error: %v", err)
 		}
+		services := service.GetServices(repos, cfg)
+		h := handler.GetHandlers(services)
 
-		server := handler.CreateNewServer(h, services, auth)
+		server := handler.CreateNewServer(h, services, cfg)
 		server.MountRoutes()
 
-		addr := ":" + port
-		log.Printf("Server listening on %s", addr)
-		if err := http.ListenAndServe(addr, server.Router); err != nil {
-			log.Fatalf("Server error: %v", err)
+		httpServer := &http.Server{
+			Addr:    ":" + cfg.Server.Port,
+			Handler: server.Router,
+		}
+		// Shutdown waits for open requests, so end the event streams
+		httpServer.RegisterOnShutdown(services.Events.Close)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if cfg.Trash.Retention > 0 {
+			go services.Trash.Run(ctx, cfg.Trash.PurgeInterval)
+		}
+		go services.Webhooks.Run(ctx)
+
+		serve := httpServer.ListenAndServe
+		if cfg.TLS.Enabled() {
+			tlsConfig, err := certs.ServerConfig(ctx, cfg.TLS)
+			if err != nil {
+				log.Fatalf("TLS configuration error: %v", err)
+			}
+			httpServer.TLSConfig = tlsConfig
+			if cfg.TLS.SelfSigned {
+				log.Println("Using a self-signed certificate; do not use this in production")
+			}
+			serve = func() error { return httpServer.ListenAndServeTLS("", "") }
+			log.Printf("Server listening on %s (HTTPS)", httpServer.Addr)
+		} else {
+			log.Printf("Server listening on %s", httpServer.Addr)
+		}
+
+		errCh := make(chan error, 1)
+		go func() { errCh <- serve() }()
+
+		select {
+		case err := <-errCh:
+			if !errors.Is(err, http.ErrServerClosed) {
+				closeStore()
+				log.Fatalf("Server error: %v", err)
+			}
+		case <-ctx.Done():
+			log.Println("Shutting down")
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := httpServer.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Shutdown error: %v", err)
+			}
+		}
+
+		// Flush the store only after in-flight requests have finished
+		if err := closeStore(); err != nil {
+			log.Fatalf("Storage error: %v", err)
 		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(startProject)
-	startProject.PersistentFlags().StringVarP(&port, "port", "p", "8080", "Port to run server")
-	startProject.PersistentFlags().BoolVarP(&auth, "auth", "a", true, "Enable basic auth and JWT")
-}
\ No newline at end of file
+	startProject.PersistentFlags().StringP("port", "p", "8080", "Port to run server")
+	startProject.PersistentFlags().BoolP("auth", "a", true, "Enable basic auth and JWT")
+	startProject.PersistentFlags().String("tls-cert", "", "TLS certificate file, enables HTTPS")
+	startProject.PersistentFlags().String("tls-key", "", "TLS private key file")
+	startProject.PersistentFlags().String("tls-client-ca", "", "CA bundle used to verify client certificates")
+	startProject.PersistentFlags().String("tls-client-auth", "", "Client certificate mode: none, optional or require")
+	startProject.PersistentFlags().String("storage-driver", "", "Storage driver: memory or file")
+	startProject.PersistentFlags().String("storage-path", "", "Directory for the file storage driver")
+	startProject.PersistentFlags().Bool("self-signed", false, "Serve HTTPS with a generated self-signed certificate (development only)")
+}
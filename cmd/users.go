@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/spf13/cobra"
+)
+
+var userFlags struct {
+	email         string
+	password      string
+	passwordStdin bool
+	username      string
+}
+
+var usersCmd = &cobra.Command{
+	Use:   "users",
+	Short: "Register, log in and inspect your account on a running server",
+}
+
+func printUsers(cmd *cobra.Command, v interface{}, users []entity.User) error {
+	return printOutput(cmd.OutOrStdout(), v, []string{"ID", "USERNAME", "EMAIL", "ROLE", "DISABLED"}, func() [][]string {
+		rows := make([][]string, 0, len(users))
+		for _, u := range users {
+			rows = append(rows, []string{strconv.FormatInt(u.ID, 10), u.Username, u.Email, u.Role, strconv.FormatBool(u.Disabled)})
+		}
+		return rows
+	})
+}
+
+// readPassword returns the password from --password or, with
+// --password-stdin, from the first line of standard input.
+func readPassword() (string, error) {
+	if !userFlags.passwordStdin {
+		if userFlags.password == "" {
+			return "", errors.New("--password or --password-stdin is required")
+		}
+		return userFlags.password, nil
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("reading password from stdin: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+var usersRegisterCmd = &cobra.Command{
+	Use:   "register",
+	Short: "Create a new account",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+		c, _, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		user, err := c.Register(cmd.Context(), entity.User{
+			Email:    userFlags.email,
+			Username: userFlags.username,
+			Password: password,
+		})
+		if err != nil {
+			return apiError(err)
+		}
+		return printUsers(cmd, user, []entity.User{user})
+	},
+}
+
+var usersLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in and store the token in the credentials file",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+		c, creds, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		token, err := c.Login(cmd.Context(), userFlags.email, password)
+		if err != nil {
+			return apiError(err)
+		}
+
+		creds.Token = token
+		path, err := saveCredentials(creds)
+		if err != nil {
+			return fmt.Errorf("saving credentials: %w", err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Logged in to %s, token saved to %s\n", creds.Server, path)
+		return nil
+	},
+}
+
+var usersMeCmd = &cobra.Command{
+	Use:   "me",
+	Short: "Show the logged in user",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, _, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		user, err := c.Me(cmd.Context())
+		if err != nil {
+			return apiError(err)
+		}
+		return printUsers(cmd, user, []entity.User{user})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(usersCmd)
+	addClientFlags(usersCmd)
+	usersCmd.AddCommand(usersRegisterCmd, usersLoginCmd, usersMeCmd)
+
+	for _, c := range []*cobra.Command{usersRegisterCmd, usersLoginCmd} {
+		c.Flags().StringVar(&userFlags.email, "email", "", "Account email")
+		c.Flags().StringVar(&userFlags.password, "password", "", "Account password")
+		c.Flags().BoolVar(&userFlags.passwordStdin, "password-stdin", false, "Read the password from standard input")
+		c.MarkFlagRequired("email")
+	}
+	usersRegisterCmd.Flags().StringVar(&userFlags.username, "username", "", "Display name")
+}
@@ -0,0 +1,572 @@
+// Package config holds the typed settings of the book server. Values are
+// resolved from built-in defaults, an optional YAML or TOML file, environment
+// variables and finally command line flags, each overriding the previous.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Server    Server    `yaml:"server" toml:"server"`
+	TLS       TLS       `yaml:"tls" toml:"tls"`
+	Auth      Auth      `yaml:"auth" toml:"auth"`
+	Storage   Storage   `yaml:"storage" toml:"storage"`
+	RateLimit RateLimit `yaml:"rateLimit" toml:"rateLimit"`
+	Lockout   Lockout   `yaml:"lockout" toml:"lockout"`
+	Trash     Trash     `yaml:"trash" toml:"trash"`
+	Events    Events    `yaml:"events" toml:"events"`
+	Webhooks  Webhooks  `yaml:"webhooks" toml:"webhooks"`
+	Mail      Mail      `yaml:"mail" toml:"mail"`
+	Passwords Passwords `yaml:"passwords" toml:"passwords"`
+	OIDC      OIDC      `yaml:"oidc" toml:"oidc"`
+}
+
+// Server configures the HTTP listener. NodeID distinguishes the IDs
+// generated by servers sharing a store and must be unique among them.
+// PublicURL is the address users reach the server at, used for links in
+// emails.
+type Server struct {
+	Port      string `yaml:"port" toml:"port" env:"BOOK_PORT"`
+	NodeID    int    `yaml:"nodeID" toml:"nodeID" env:"BOOK_NODE_ID"`
+	PublicURL string `yaml:"publicURL" toml:"publicURL" env:"BOOK_PUBLIC_URL"`
+}
+
+// MaxNodeID is the largest Server.NodeID, matching the 10 node bits of a
+// generated ID.
+const MaxNodeID = 1023
+
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// TLS enables HTTPS when a certificate file or self-signed mode is set.
+// With ClientAuth other than "none", client certificates signed by
+// ClientCAFile are verified and mapped onto users.
+type TLS struct {
+	CertFile           string        `yaml:"certFile" toml:"certFile" env:"BOOK_TLS_CERT"`
+	KeyFile            string        `yaml:"keyFile" toml:"keyFile" env:"BOOK_TLS_KEY"`
+	ReloadInterval     time.Duration `yaml:"reloadInterval" toml:"reloadInterval" env:"BOOK_TLS_RELOAD_INTERVAL"`
+	SelfSigned         bool          `yaml:"selfSigned" toml:"selfSigned" env:"BOOK_TLS_SELF_SIGNED"`
+	SelfSignedHosts    []string      `yaml:"selfSignedHosts" toml:"selfSignedHosts" env:"BOOK_TLS_SELF_SIGNED_HOSTS"`
+	SelfSignedValidFor time.Duration `yaml:"selfSignedValidFor" toml:"selfSignedValidFor"`
+	ClientAuth         string        `yaml:"clientAuth" toml:"clientAuth" env:"BOOK_TLS_CLIENT_AUTH"`
+	ClientCAFile       string        `yaml:"clientCAFile" toml:"clientCAFile" env:"BOOK_TLS_CLIENT_CA"`
+	// SubjectUsers maps a client certificate's subject common name to the
+	// email of the user it authenticates as. Without an entry the
+	// certificate's email address, or a common name that is an email, is
+	// used.
+	SubjectUsers map[string]string `yaml:"subjectUsers" toml:"subjectUsers"`
+}
+
+func (t TLS) Enabled() bool {
+	return t.SelfSigned || t.CertFile != ""
+}
+
+type Auth struct {
+	Enabled   bool          `yaml:"enabled" toml:"enabled" env:"BOOK_AUTH"`
+	JWTSecret string        `yaml:"jwtSecret" toml:"jwtSecret" env:"JWT_SECRET" secret:"true"`
+	TokenTTL  time.Duration `yaml:"tokenTTL" toml:"tokenTTL" env:"BOOK_TOKEN_TTL"`
+	// ResetTokenTTL is how long a password reset link stays valid.
+	ResetTokenTTL time.Duration `yaml:"resetTokenTTL" toml:"resetTokenTTL" env:"BOOK_RESET_TOKEN_TTL"`
+	// RequireVerifiedEmail refuses logins of registered users who have not
+	// confirmed their email address yet.
+	RequireVerifiedEmail bool          `yaml:"requireVerifiedEmail" toml:"requireVerifiedEmail" env:"BOOK_REQUIRE_VERIFIED_EMAIL"`
+	VerificationTTL      time.Duration `yaml:"verificationTTL" toml:"verificationTTL" env:"BOOK_VERIFICATION_TTL"`
+	// VerificationResendInterval is the minimum time between two
+	// verification emails to the same account.
+	VerificationResendInterval time.Duration `yaml:"verificationResendInterval" toml:"verificationResendInterval" env:"BOOK_VERIFICATION_RESEND_INTERVAL"`
+	// TOTPIssuer names the service in authenticator apps.
+	TOTPIssuer string `yaml:"totpIssuer" toml:"totpIssuer" env:"BOOK_TOTP_ISSUER"`
+	// TwoFactorRoles lists roles whose privileges may only be used with a
+	// token from a login that included a TOTP code.
+	TwoFactorRoles []string `yaml:"twoFactorRoles" toml:"twoFactorRoles" env:"BOOK_TWO_FACTOR_ROLES"`
+	// APIKeyTTL is how long an API key stays valid when its owner does not
+	// pick an expiry; APIKeyMaxTTL caps the expiry they may pick.
+	APIKeyTTL    time.Duration `yaml:"apiKeyTTL" toml:"apiKeyTTL" env:"BOOK_API_KEY_TTL"`
+	APIKeyMaxTTL time.Duration `yaml:"apiKeyMaxTTL" toml:"apiKeyMaxTTL" env:"BOOK_API_KEY_MAX_TTL"`
+	// OAuthTokenTTL is the lifetime of access tokens from /oauth/token and
+	// OAuthCodeTTL that of the authorization codes exchanged for them.
+	OAuthTokenTTL time.Duration `yaml:"oauthTokenTTL" toml:"oauthTokenTTL" env:"BOOK_OAUTH_TOKEN_TTL"`
+	OAuthCodeTTL  time.Duration `yaml:"oauthCodeTTL" toml:"oauthCodeTTL" env:"BOOK_OAUTH_CODE_TTL"`
+}
+
+// RequiresTwoFactor reports whether role is listed in TwoFactorRoles.
+func (a Auth) RequiresTwoFactor(role string) bool {
+	for _, r := range a.TwoFactorRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Storage drivers
+const (
+	StorageMemory = "memory"
+	StorageFile   = "file"
+)
+
+// Storage selects the backend for repositories. The memory driver keeps
+// nothing across restarts; the file driver keeps a snapshot and
+// write-ahead log in the Path directory.
+type Storage struct {
+	Driver        string        `yaml:"driver" toml:"driver" env:"BOOK_STORAGE_DRIVER"`
+	Path          string        `yaml:"path" toml:"path" env:"BOOK_STORAGE_PATH"`
+	Fsync         string        `yaml:"fsync" toml:"fsync" env:"BOOK_STORAGE_FSYNC"`
+	FsyncInterval time.Duration `yaml:"fsyncInterval" toml:"fsyncInterval" env:"BOOK_STORAGE_FSYNC_INTERVAL"`
+	CompactEvery  int           `yaml:"compactEvery" toml:"compactEvery" env:"BOOK_STORAGE_COMPACT_EVERY"`
+}
+
+// RateLimit configures the token buckets in front of the login and token
+// endpoints. A PerMinute of zero disables that limiter.
+type RateLimit struct {
+	IPPerMinute      int `yaml:"ipPerMinute" toml:"ipPerMinute" env:"BOOK_RATE_LIMIT_IP_PER_MINUTE"`
+	IPBurst          int `yaml:"ipBurst" toml:"ipBurst" env:"BOOK_RATE_LIMIT_IP_BURST"`
+	AccountPerMinute int `yaml:"accountPerMinute" toml:"accountPerMinute" env:"BOOK_RATE_LIMIT_ACCOUNT_PER_MINUTE"`
+	AccountBurst     int `yaml:"accountBurst" toml:"accountBurst" env:"BOOK_RATE_LIMIT_ACCOUNT_BURST"`
+}
+
+// Lockout configures progressive delays and temporary lockout after failed
+// logins.
+type Lockout struct {
+	FreeAttempts int           `yaml:"freeAttempts" toml:"freeAttempts" env:"BOOK_LOCKOUT_FREE_ATTEMPTS"`
+	BaseDelay    time.Duration `yaml:"baseDelay" toml:"baseDelay" env:"BOOK_LOCKOUT_BASE_DELAY"`
+	MaxDelay     time.Duration `yaml:"maxDelay" toml:"maxDelay" env:"BOOK_LOCKOUT_MAX_DELAY"`
+	Threshold    int           `yaml:"threshold" toml:"threshold" env:"BOOK_LOCKOUT_THRESHOLD"`
+	Duration     time.Duration `yaml:"duration" toml:"duration" env:"BOOK_LOCKOUT_DURATION"`
+	ResetAfter   time.Duration `yaml:"resetAfter" toml:"resetAfter" env:"BOOK_LOCKOUT_RESET_AFTER"`
+}
+
+// Trash configures how long deleted books and users are kept before
+// they are purged for good. A Retention of 0 keeps them forever.
+type Trash struct {
+	Retention     time.Duration `yaml:"retention" toml:"retention" env:"BOOK_TRASH_RETENTION"`
+	PurgeInterval time.Duration `yaml:"purgeInterval" toml:"purgeInterval" env:"BOOK_TRASH_PURGE_INTERVAL"`
+}
+
+// Events configures the change feed at /api/v1/events. The last History
+// events are kept so clients can resume after reconnecting; a client that
+// falls ClientBuffer events behind is disconnected. A comment is sent
+// every KeepAlive to hold idle connections open.
+type Events struct {
+	History      int           `yaml:"history" toml:"history" env:"BOOK_EVENTS_HISTORY"`
+	ClientBuffer int           `yaml:"clientBuffer" toml:"clientBuffer" env:"BOOK_EVENTS_CLIENT_BUFFER"`
+	KeepAlive    time.Duration `yaml:"keepAlive" toml:"keepAlive" env:"BOOK_EVENTS_KEEP_ALIVE"`
+}
+
+// Webhooks configures delivery of change events to webhook subscribers.
+// Up to Workers deliveries run at once, each waiting up to Timeout for a
+// response. A failed delivery is retried up to MaxAttempts times in all,
+// waiting RetryBase after the first failure and twice as long after each
+// next one, but never more than RetryMax. A webhook is disabled after
+// DisableAfter failures in a row; 0 never disables it. The last
+// DeliveryLog deliveries of each webhook are kept for inspection.
+type Webhooks struct {
+	Workers      int           `yaml:"workers" toml:"workers" env:"BOOK_WEBHOOK_WORKERS"`
+	Timeout      time.Duration `yaml:"timeout" toml:"timeout" env:"BOOK_WEBHOOK_TIMEOUT"`
+	MaxAttempts  int           `yaml:"maxAttempts" toml:"maxAttempts" env:"BOOK_WEBHOOK_MAX_ATTEMPTS"`
+	RetryBase    time.Duration `yaml:"retryBase" toml:"retryBase" env:"BOOK_WEBHOOK_RETRY_BASE"`
+	RetryMax     time.Duration `yaml:"retryMax" toml:"retryMax" env:"BOOK_WEBHOOK_RETRY_MAX"`
+	DisableAfter int           `yaml:"disableAfter" toml:"disableAfter" env:"BOOK_WEBHOOK_DISABLE_AFTER"`
+	DeliveryLog  int           `yaml:"deliveryLog" toml:"deliveryLog" env:"BOOK_WEBHOOK_DELIVERY_LOG"`
+}
+
+// Mail drivers
+const (
+	MailLog  = "log"
+	MailFile = "file"
+	MailSMTP = "smtp"
+)
+
+// Mail selects how outgoing email is delivered. The log driver only logs
+// messages and the file driver writes them into Dir, both meant for local
+// development; smtp sends them through an SMTP relay.
+type Mail struct {
+	Driver       string `yaml:"driver" toml:"driver" env:"BOOK_MAIL_DRIVER"`
+	From         string `yaml:"from" toml:"from" env:"BOOK_MAIL_FROM"`
+	Dir          string `yaml:"dir" toml:"dir" env:"BOOK_MAIL_DIR"`
+	SMTPHost     string `yaml:"smtpHost" toml:"smtpHost" env:"BOOK_SMTP_HOST"`
+	SMTPPort     int    `yaml:"smtpPort" toml:"smtpPort" env:"BOOK_SMTP_PORT"`
+	SMTPUsername string `yaml:"smtpUsername" toml:"smtpUsername" env:"BOOK_SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtpPassword" toml:"smtpPassword" env:"BOOK_SMTP_PASSWORD" secret:"true"`
+}
+
+// Password hashing algorithms
+const (
+	HashArgon2id = "argon2id"
+	HashBcrypt   = "bcrypt"
+)
+
+// Passwords selects how new passwords are hashed. Stored hashes made with
+// another algorithm or other parameters keep working and are replaced the
+// next time their user logs in.
+type Passwords struct {
+	Algorithm string `yaml:"algorithm" toml:"algorithm" env:"BOOK_PASSWORD_HASH"`
+	// Argon2Memory is the argon2id memory cost in KiB.
+	Argon2Memory      int `yaml:"argon2Memory" toml:"argon2Memory" env:"BOOK_ARGON2_MEMORY"`
+	Argon2Iterations  int `yaml:"argon2Iterations" toml:"argon2Iterations" env:"BOOK_ARGON2_ITERATIONS"`
+	Argon2Parallelism int `yaml:"argon2Parallelism" toml:"argon2Parallelism" env:"BOOK_ARGON2_PARALLELISM"`
+	BcryptCost        int `yaml:"bcryptCost" toml:"bcryptCost" env:"BOOK_BCRYPT_COST"`
+}
+
+// OIDC enables login through an external OpenID Connect provider. Users
+// are matched by the provider's subject, then by verified email, and
+// created on first login when CreateUsers is set. RedirectURL defaults to
+// the callback under Server.PublicURL and must be registered with the
+// provider. AllowedDomains, if set, limits logins to those email domains.
+type OIDC struct {
+	Enabled        bool     `yaml:"enabled" toml:"enabled" env:"BOOK_OIDC"`
+	IssuerURL      string   `yaml:"issuerURL" toml:"issuerURL" env:"BOOK_OIDC_ISSUER"`
+	ClientID       string   `yaml:"clientID" toml:"clientID" env:"BOOK_OIDC_CLIENT_ID"`
+	ClientSecret   string   `yaml:"clientSecret" toml:"clientSecret" env:"BOOK_OIDC_CLIENT_SECRET" secret:"true"`
+	RedirectURL    string   `yaml:"redirectURL" toml:"redirectURL" env:"BOOK_OIDC_REDIRECT_URL"`
+	Scopes         []string `yaml:"scopes" toml:"scopes" env:"BOOK_OIDC_SCOPES"`
+	AllowedDomains []string `yaml:"allowedDomains" toml:"allowedDomains" env:"BOOK_OIDC_ALLOWED_DOMAINS"`
+	CreateUsers    bool     `yaml:"createUsers" toml:"createUsers" env:"BOOK_OIDC_CREATE_USERS"`
+}
+
+// OIDCCallbackPath is where the provider sends users back to.
+const OIDCCallbackPath = "/api/v1/login/oidc/callback"
+
+// CallbackURL returns RedirectURL, or the callback under publicURL if it is
+// not set.
+func (o OIDC) CallbackURL(publicURL string) string {
+	if o.RedirectURL != "" {
+		return o.RedirectURL
+	}
+	return strings.TrimRight(publicURL, "/") + OIDCCallbackPath
+}
+
+// Default returns the configuration used when nothing else is specified.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port: "8080",
+		},
+		TLS: TLS{
+			ReloadInterval:     30 * time.Second,
+			SelfSignedHosts:    []string{"localhost", "127.0.0.1", "::1"},
+			SelfSignedValidFor: 30 * 24 * time.Hour,
+			ClientAuth:         ClientAuthNone,
+		},
+		Auth: Auth{
+			Enabled:                    true,
+			TokenTTL:                   24 * time.Hour,
+			ResetTokenTTL:              time.Hour,
+			RequireVerifiedEmail:       true,
+			VerificationTTL:            48 * time.Hour,
+			VerificationResendInterval: time.Minute,
+			TOTPIssuer:                 "Book API",
+			APIKeyTTL:                  90 * 24 * time.Hour,
+			APIKeyMaxTTL:               365 * 24 * time.Hour,
+			OAuthTokenTTL:              time.Hour,
+			OAuthCodeTTL:               time.Minute,
+		},
+		Storage: Storage{
+			Driver:        StorageMemory,
+			Fsync:         "always",
+			FsyncInterval: time.Second,
+			CompactEvery:  1000,
+		},
+		RateLimit: RateLimit{
+			IPPerMinute:      30,
+			IPBurst:          10,
+			AccountPerMinute: 10,
+			AccountBurst:     5,
+		},
+		Lockout: Lockout{
+			FreeAttempts: 3,
+			BaseDelay:    time.Second,
+			MaxDelay:     time.Minute,
+			Threshold:    10,
+			Duration:     15 * time.Minute,
+			ResetAfter:   time.Hour,
+		},
+		Trash: Trash{
+			Retention:     30 * 24 * time.Hour,
+			PurgeInterval: time.Hour,
+		},
+		Events: Events{
+			History:      1000,
+			ClientBuffer: 64,
+			KeepAlive:    30 * time.Second,
+		},
+		Webhooks: Webhooks{
+			Workers:      4,
+			Timeout:      10 * time.Second,
+			MaxAttempts:  5,
+			RetryBase:    5 * time.Second,
+			RetryMax:     10 * time.Minute,
+			DisableAfter: 20,
+			DeliveryLog:  100,
+		},
+		Mail: Mail{
+			Driver:   MailLog,
+			From:     "books@localhost",
+			SMTPPort: 587,
+		},
+		Passwords: Passwords{
+			Algorithm:         HashArgon2id,
+			Argon2Memory:      64 * 1024,
+			Argon2Iterations:  3,
+			Argon2Parallelism: 2,
+			BcryptCost:        10,
+		},
+		OIDC: OIDC{
+			Scopes:      []string{"openid", "email", "profile"},
+			CreateUsers: true,
+		},
+	}
+}
+
+// Load builds a configuration from the defaults, the file at path (if not
+// empty) and the environment. Variables from a .env file in the working
+// directory are loaded first but never override the real environment.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("loading .env: %w", err)
+	}
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := applyEnv(cfg, os.LookupEnv); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".toml":
+		err = toml.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("unsupported config file type %q (use .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every setting that would prevent the server from
+// starting correctly.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port: %q is not a valid port", c.Server.Port))
+	}
+	if c.Server.NodeID < 0 || c.Server.NodeID > MaxNodeID {
+		errs = append(errs, fmt.Errorf("server.nodeID: must be between 0 and %d", MaxNodeID))
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("tls: certFile and keyFile must be set together"))
+	}
+	if c.TLS.SelfSigned && c.TLS.CertFile != "" {
+		errs = append(errs, errors.New("tls.selfSigned: cannot be combined with certFile"))
+	}
+	if c.TLS.CertFile != "" && c.TLS.ReloadInterval <= 0 {
+		errs = append(errs, errors.New("tls.reloadInterval: must be positive"))
+	}
+	switch c.TLS.ClientAuth {
+	case "", ClientAuthNone:
+	case ClientAuthOptional, ClientAuthRequire:
+		if !c.TLS.Enabled() {
+			errs = append(errs, errors.New("tls.clientAuth: requires TLS to be enabled"))
+		}
+		if c.TLS.ClientCAFile == "" {
+			errs = append(errs, errors.New("tls.clientCAFile: required for client certificate authentication"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tls.clientAuth: %q must be one of none, optional, require", c.TLS.ClientAuth))
+	}
+	if c.Auth.Enabled && c.Auth.JWTSecret == "" {
+		errs = append(errs, errors.New("auth.jwtSecret: required when auth is enabled (set JWT_SECRET)"))
+	}
+	if c.Auth.TokenTTL <= 0 {
+		errs = append(errs, errors.New("auth.tokenTTL: must be positive"))
+	}
+	if c.Auth.ResetTokenTTL <= 0 {
+		errs = append(errs, errors.New("auth.resetTokenTTL: must be positive"))
+	}
+	if c.Auth.VerificationTTL <= 0 {
+		errs = append(errs, errors.New("auth.verificationTTL: must be positive"))
+	}
+	if c.Auth.VerificationResendInterval < 0 {
+		errs = append(errs, errors.New("auth.verificationResendInterval: must not be negative"))
+	}
+	if c.Auth.TOTPIssuer == "" || strings.Contains(c.Auth.TOTPIssuer, ":") {
+		errs = append(errs, fmt.Errorf("auth.totpIssuer: %q must be non-empty and contain no colon", c.Auth.TOTPIssuer))
+	}
+	if c.Auth.APIKeyTTL <= 0 || c.Auth.APIKeyMaxTTL < c.Auth.APIKeyTTL {
+		errs = append(errs, fmt.Errorf("auth.apiKeyTTL: %s must be positive and at most auth.apiKeyMaxTTL (%s)", c.Auth.APIKeyTTL, c.Auth.APIKeyMaxTTL))
+	}
+	if c.Auth.OAuthTokenTTL <= 0 {
+		errs = append(errs, errors.New("auth.oauthTokenTTL: must be positive"))
+	}
+	// RFC 6749 recommends at most ten minutes
+	if c.Auth.OAuthCodeTTL <= 0 || c.Auth.OAuthCodeTTL > 10*time.Minute {
+		errs = append(errs, fmt.Errorf("auth.oauthCodeTTL: %s must be positive and at most 10m", c.Auth.OAuthCodeTTL))
+	}
+	if c.Server.PublicURL != "" {
+		if u, err := url.Parse(c.Server.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("server.publicURL: %q is not an http(s) URL", c.Server.PublicURL))
+		}
+	}
+	switch c.Storage.Driver {
+	case StorageMemory:
+	case StorageFile:
+		if c.Storage.Path == "" {
+			errs = append(errs, errors.New("storage.path: required for the file driver"))
+		}
+		switch c.Storage.Fsync {
+		case "always", "never":
+		case "interval":
+			if c.Storage.FsyncInterval <= 0 {
+				errs = append(errs, errors.New("storage.fsyncInterval: must be positive"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("storage.fsync: %q must be one of always, interval, never", c.Storage.Fsync))
+		}
+		if c.Storage.CompactEvery < 0 {
+			errs = append(errs, errors.New("storage.compactEvery: must not be negative"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("storage.driver: unknown driver %q", c.Storage.Driver))
+	}
+	if c.RateLimit.IPPerMinute < 0 || c.RateLimit.AccountPerMinute < 0 {
+		errs = append(errs, errors.New("rateLimit: rates must not be negative"))
+	}
+	if c.RateLimit.IPBurst < 0 || c.RateLimit.AccountBurst < 0 {
+		errs = append(errs, errors.New("rateLimit: bursts must not be negative"))
+	}
+	if c.Lockout.FreeAttempts < 0 || c.Lockout.Threshold < 0 {
+		errs = append(errs, errors.New("lockout: attempt counts must not be negative"))
+	}
+	if c.Lockout.BaseDelay < 0 || c.Lockout.MaxDelay < 0 || c.Lockout.Duration < 0 || c.Lockout.ResetAfter < 0 {
+		errs = append(errs, errors.New("lockout: durations must not be negative"))
+	}
+	if c.Lockout.Threshold > 0 && c.Lockout.Duration == 0 {
+		errs = append(errs, errors.New("lockout.duration: required when lockout.threshold is set"))
+	}
+	if c.Trash.Retention < 0 {
+		errs = append(errs, errors.New("trash.retention: must not be negative"))
+	}
+	if c.Trash.Retention > 0 && c.Trash.PurgeInterval <= 0 {
+		errs = append(errs, errors.New("trash.purgeInterval: must be positive when trash.retention is set"))
+	}
+	if c.Events.History < 0 {
+		errs = append(errs, errors.New("events.history: must not be negative"))
+	}
+	if c.Events.ClientBuffer < 1 {
+		errs = append(errs, errors.New("events.clientBuffer: must be at least 1"))
+	}
+	if c.Events.KeepAlive <= 0 {
+		errs = append(errs, errors.New("events.keepAlive: must be positive"))
+	}
+	if c.Webhooks.Workers < 1 {
+		errs = append(errs, errors.New("webhooks.workers: must be at least 1"))
+	}
+	if c.Webhooks.Timeout <= 0 {
+		errs = append(errs, errors.New("webhooks.timeout: must be positive"))
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		errs = append(errs, errors.New("webhooks.maxAttempts: must be at least 1"))
+	}
+	if c.Webhooks.RetryBase <= 0 {
+		errs = append(errs, errors.New("webhooks.retryBase: must be positive"))
+	}
+	if c.Webhooks.RetryMax < c.Webhooks.RetryBase {
+		errs = append(errs, errors.New("webhooks.retryMax: must not be less than webhooks.retryBase"))
+	}
+	if c.Webhooks.DisableAfter < 0 {
+		errs = append(errs, errors.New("webhooks.disableAfter: must not be negative"))
+	}
+	if c.Webhooks.DeliveryLog < 0 {
+		errs = append(errs, errors.New("webhooks.deliveryLog: must not be negative"))
+	}
+	if !strings.Contains(c.Mail.From, "@") {
+		errs = append(errs, fmt.Errorf("mail.from: %q is not an email address", c.Mail.From))
+	}
+	switch c.Mail.Driver {
+	case MailLog:
+	case MailFile:
+		if c.Mail.Dir == "" {
+			errs = append(errs, errors.New("mail.dir: required for the file driver"))
+		}
+	case MailSMTP:
+		if c.Mail.SMTPHost == "" {
+			errs = append(errs, errors.New("mail.smtpHost: required for the smtp driver"))
+		}
+		if c.Mail.SMTPPort < 1 || c.Mail.SMTPPort > 65535 {
+			errs = append(errs, fmt.Errorf("mail.smtpPort: %d is not a valid port", c.Mail.SMTPPort))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("mail.driver: %q must be one of log, file, smtp", c.Mail.Driver))
+	}
+	switch c.Passwords.Algorithm {
+	case HashArgon2id:
+		if c.Passwords.Argon2Iterations < 1 {
+			errs = append(errs, errors.New("passwords.argon2Iterations: must be at least 1"))
+		}
+		if c.Passwords.Argon2Parallelism < 1 || c.Passwords.Argon2Parallelism > 255 {
+			errs = append(errs, errors.New("passwords.argon2Parallelism: must be between 1 and 255"))
+		}
+		if c.Passwords.Argon2Memory < 8*c.Passwords.Argon2Parallelism {
+			errs = append(errs, errors.New("passwords.argon2Memory: must be at least 8 KiB per thread"))
+		}
+	case HashBcrypt:
+		if c.Passwords.BcryptCost < 4 || c.Passwords.BcryptCost > 31 {
+			errs = append(errs, errors.New("passwords.bcryptCost: must be between 4 and 31"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("passwords.algorithm: %q must be one of argon2id, bcrypt", c.Passwords.Algorithm))
+	}
+	if c.OIDC.Enabled {
+		if u, err := url.Parse(c.OIDC.IssuerURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("oidc.issuerURL: %q is not an http(s) URL", c.OIDC.IssuerURL))
+		}
+		if c.OIDC.ClientID == "" {
+			errs = append(errs, errors.New("oidc.clientID: required when OIDC is enabled"))
+		}
+		if c.OIDC.RedirectURL == "" && c.Server.PublicURL == "" {
+			errs = append(errs, errors.New("oidc.redirectURL: required when server.publicURL is not set"))
+		}
+		hasOpenID := false
+		for _, scope := range c.OIDC.Scopes {
+			hasOpenID = hasOpenID || scope == "openid"
+		}
+		if !hasOpenID {
+			errs = append(errs, errors.New("oidc.scopes: must include openid"))
+		}
+	}
+
+	return errors.Join(errs...)
+}
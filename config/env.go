@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnv overrides every field tagged with `env` whose variable is set.
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	return walk(reflect.ValueOf(cfg).Elem(), func(field reflect.StructField, v reflect.Value) error {
+		name := field.Tag.Get("env")
+		if name == "" {
+			return nil
+		}
+		raw, ok := lookup(name)
+		if !ok {
+			return nil
+		}
+		if err := setValue(v, raw); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	})
+}
+
+// walk calls fn for every leaf field of the struct v, descending into
+// nested structs.
+func walk(v reflect.Value, fn func(reflect.StructField, reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			if err := walk(value, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(field, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// Redacted returns a copy of the configuration with every field tagged
+// `secret` masked, suitable for printing.
+func (c *Config) Redacted() *Config {
+	out := *c
+	walk(reflect.ValueOf(&out).Elem(), func(field reflect.StructField, v reflect.Value) error {
+		if field.Tag.Get("secret") == "true" && v.Kind() == reflect.String && v.String() != "" {
+			v.SetString("********")
+		}
+		return nil
+	})
+	return &out
+}
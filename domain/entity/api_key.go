@@ -0,0 +1,33 @@
+package entity
+
+import "time"
+
+// APIKey lets a program act on behalf of a user without their password. Only
+// a hash of the secret is stored; the full key is shown once, on creation.
+type APIKey struct {
+	ID     string   `json:"id" db:"id"`
+	UserID int64    `json:"user_id" db:"user_id"`
+	Name   string   `json:"name" db:"name"`
+	Scopes []string `json:"scopes" db:"scopes"`
+	// Hash is the SHA-256 of the key's secret part, hex encoded.
+	Hash       string    `json:"hash,omitempty" db:"hash"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at" db:"expires_at"`
+	LastUsedAt time.Time `json:"last_used_at" db:"last_used_at"`
+}
+
+// WithoutHash returns a copy of k that is safe to show to its owner.
+func (k APIKey) WithoutHash() APIKey {
+	k.Hash = ""
+	return k
+}
+
+// HasScope reports whether the key was granted scope.
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package entity
+
+import "time"
+
+// Audit actions. Changes to books, users and webhooks are recorded as
+// "<target type>.<create|update|delete|restore|purge>", and webhooks
+// disabled after failing as webhook.disable; logins as login.success and
+// login.failure.
+const (
+	AuditBookCreate     = "book.create"
+	AuditBookUpdate     = "book.update"
+	AuditBookDelete     = "book.delete"
+	AuditBookRestore    = "book.restore"
+	AuditBookPurge      = "book.purge"
+	AuditUserCreate     = "user.create"
+	AuditUserUpdate     = "user.update"
+	AuditUserDelete     = "user.delete"
+	AuditUserRestore    = "user.restore"
+	AuditUserPurge      = "user.purge"
+	AuditWebhookCreate  = "webhook.create"
+	AuditWebhookUpdate  = "webhook.update"
+	AuditWebhookDelete  = "webhook.delete"
+	AuditWebhookDisable = "webhook.disable"
+	AuditLoginSuccess   = "login.success"
+	AuditLoginFailure   = "login.failure"
+)
+
+// Audit target types.
+const (
+	AuditTargetBook    = "book"
+	AuditTargetUser    = "user"
+	AuditTargetWebhook = "webhook"
+)
+
+// AuditEvent records one change or login attempt. Events are never updated
+// or deleted once written.
+type AuditEvent struct {
+	ID   string    `json:"id" db:"id"`
+	Time time.Time `json:"time" db:"time"`
+	// ActorID is the user the request was made for, or 0 for anonymous
+	// requests such as registrations and failed logins.
+	ActorID    int64  `json:"actor_id,omitempty" db:"actor_id"`
+	Action     string `json:"action" db:"action"`
+	TargetType string `json:"target_type" db:"target_type"`
+	TargetID   string `json:"target_id,omitempty" db:"target_id"`
+	// Changes holds the fields that differ between the target before and
+	// after the change, keyed by their JSON name. Secrets are redacted.
+	Changes   map[string]FieldChange `json:"changes,omitempty" db:"changes"`
+	RequestID string                 `json:"request_id,omitempty" db:"request_id"`
+	SourceIP  string                 `json:"source_ip,omitempty" db:"source_ip"`
+	// Reason says why a login failed.
+	Reason string `json:"reason,omitempty" db:"reason"`
+}
+
+// AuditFilter narrows an audit log listing. Zero fields match every event.
+type AuditFilter struct {
+	ActorID    int64
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+}
@@ -1,9 +1,27 @@
 package entity
 
+import "time"
+
 type Book struct {
 	UUID        string   `json:"uuid"`
 	Name        string   `json:"name"`
 	AuthorList  []string `json:"authorList"`
 	PublishDate string   `json:"publishDate"`
 	ISBN        string   `json:"isbn"`
+	// CreatedBy and UpdatedBy are the IDs of the users who added the book
+	// and last changed it. Books from before they were recorded have 0.
+	CreatedBy int64 `json:"createdBy,omitempty"`
+	UpdatedBy int64 `json:"updatedBy,omitempty"`
+	// DeletedAt is set while the book is in the trash.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+// BookFilter narrows a book listing. Empty fields match every book; Name
+// and Author match case-insensitive substrings, ISBN and CreatedBy must
+// match exactly.
+type BookFilter struct {
+	Name      string
+	Author    string
+	ISBN      string
+	CreatedBy int64
 }
@@ -0,0 +1,24 @@
+package entity
+
+import "time"
+
+// BookRevision is an immutable copy of a book as it was saved. Revisions
+// of a book are numbered from 1 in the order they were made.
+type BookRevision struct {
+	BookUUID  string    `json:"bookUuid"`
+	Number    int       `json:"number"`
+	Book      Book      `json:"book"`
+	CreatedAt time.Time `json:"createdAt"`
+	// CreatedBy is the user whose change produced the revision.
+	CreatedBy int64 `json:"createdBy,omitempty"`
+	// RestoredFrom is the number of the revision this one restored.
+	RestoredFrom int `json:"restoredFrom,omitempty"`
+}
+
+// BookRevisionDiff lists the fields that differ between two revisions of
+// a book, keyed by their JSON name.
+type BookRevisionDiff struct {
+	From    int                    `json:"from"`
+	To      int                    `json:"to"`
+	Changes map[string]FieldChange `json:"changes"`
+}
@@ -0,0 +1,9 @@
+package entity
+
+// FieldChange is the value of one field before and after a change, as it
+// appears in JSON. Before is null for created records and After is null
+// for deleted ones.
+type FieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
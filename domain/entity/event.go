@@ -0,0 +1,42 @@
+package entity
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Event types published when books and users change.
+const (
+	EventBookCreated  = "book.created"
+	EventBookUpdated  = "book.updated"
+	EventBookDeleted  = "book.deleted"
+	EventBookRestored = "book.restored"
+	EventUserCreated  = "user.created"
+	EventUserUpdated  = "user.updated"
+	EventUserDeleted  = "user.deleted"
+	EventUserRestored = "user.restored"
+)
+
+// EventTypes lists every event type.
+var EventTypes = []string{
+	EventBookCreated, EventBookUpdated, EventBookDeleted, EventBookRestored,
+	EventUserCreated, EventUserUpdated, EventUserDeleted, EventUserRestored,
+}
+
+// Event is a change to a book or user. IDs increase in the order events
+// were published, so a client can resume after the last ID it has seen.
+type Event struct {
+	ID   int64     `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// Data is the book or user after the change, or before it for
+	// deletes. Users never include their password or secrets.
+	Data json.RawMessage `json:"data"`
+}
+
+// IsUserEvent reports whether the event describes a user, which only
+// admins may see.
+func (e Event) IsUserEvent() bool {
+	return strings.HasPrefix(e.Type, "user.")
+}
@@ -0,0 +1,12 @@
+package entity
+
+import "time"
+
+// Lockout describes the failed-login state tracked for a single account.
+type Lockout struct {
+	Account      string    `json:"account"`
+	Failures     int       `json:"failures"`
+	LastFailure  time.Time `json:"lastFailure"`
+	BlockedUntil time.Time `json:"blockedUntil"`
+	Locked       bool      `json:"locked"`
+}
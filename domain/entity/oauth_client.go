@@ -0,0 +1,55 @@
+package entity
+
+import "time"
+
+// OAuth2 grant types a client may use
+const (
+	GrantClientCredentials = "client_credentials"
+	GrantAuthorizationCode = "authorization_code"
+)
+
+// OAuthClient is an application registered to obtain tokens from the OAuth2
+// endpoints. Confidential clients have a secret, of which only a hash is
+// stored; public clients have none and must use PKCE.
+type OAuthClient struct {
+	ID      string `json:"client_id" db:"id"`
+	Name    string `json:"name" db:"name"`
+	OwnerID int64  `json:"owner_id" db:"owner_id"`
+	// SecretHash is the SHA-256 of the client secret, hex encoded.
+	SecretHash   string    `json:"secret_hash,omitempty" db:"secret_hash"`
+	RedirectURIs []string  `json:"redirect_uris" db:"redirect_uris"`
+	GrantTypes   []string  `json:"grant_types" db:"grant_types"`
+	Scopes       []string  `json:"scopes" db:"scopes"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// Public reports whether the client has no secret.
+func (c OAuthClient) Public() bool {
+	return c.SecretHash == ""
+}
+
+// WithoutSecret returns a copy of c that is safe to show to its owner.
+func (c OAuthClient) WithoutSecret() OAuthClient {
+	c.SecretHash = ""
+	return c
+}
+
+// AllowsGrant reports whether the client was registered for grant.
+func (c OAuthClient) AllowsGrant(grant string) bool {
+	return contains(c.GrantTypes, grant)
+}
+
+// AllowsRedirect reports whether uri exactly matches a registered redirect
+// URI.
+func (c OAuthClient) AllowsRedirect(uri string) bool {
+	return contains(c.RedirectURIs, uri)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
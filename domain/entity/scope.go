@@ -0,0 +1,37 @@
+package entity
+
+// Scopes limit what a credential may do. Tokens from a login carry the
+// scopes of the user's role, or fewer if the client asked for fewer; API
+// keys and OAuth2 tokens carry the scopes they were granted.
+const (
+	ScopeBooksRead  = "books:read"
+	ScopeBooksWrite = "books:write"
+	ScopeUsersAdmin = "users:admin"
+	// ScopeAccount allows managing the user's own credentials: two-factor
+	// settings, API keys and OAuth2 clients. Only login tokens carry it, so
+	// a delegated credential cannot mint further credentials.
+	ScopeAccount = "account"
+)
+
+// Scopes lists every scope that may be delegated to API keys and OAuth2
+// clients.
+var Scopes = []string{ScopeBooksRead, ScopeBooksWrite, ScopeUsersAdmin}
+
+// ValidScope reports whether scope is one of Scopes.
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleScopes returns the scopes of a login token for a user with role.
+func RoleScopes(role string) []string {
+	scopes := []string{ScopeBooksRead, ScopeBooksWrite, ScopeAccount}
+	if role == RoleAdmin {
+		scopes = append(scopes, ScopeUsersAdmin)
+	}
+	return scopes
+}
@@ -0,0 +1,7 @@
+package entity
+
+// Trash lists the deleted books and users that have not been purged yet.
+type Trash struct {
+	Books []Book `json:"books"`
+	Users []User `json:"users"`
+}
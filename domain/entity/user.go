@@ -1,12 +1,70 @@
 package entity
 
-import "time"
+import (
+	"strings"
+	"time"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Roles lists every valid value of User.Role.
+var Roles = []string{RoleUser, RoleAdmin}
 
 type User struct {
 	ID        int64     `json:"id" db:"id"`
 	Username  string    `json:"username" db:"username"`
 	Email     string    `json:"email" db:"email"`
 	Password  string    `json:"password" db:"password"`
+	Role      string    `json:"role" db:"role"`
+	Disabled  bool      `json:"disabled" db:"disabled"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
-}
\ No newline at end of file
+	// SessionsRevokedAt invalidates every token issued before it, e.g.
+	// after a password reset.
+	SessionsRevokedAt time.Time `json:"sessions_revoked_at" db:"sessions_revoked_at"`
+	// VerificationPending is set for self-registered users until they
+	// confirm their email address.
+	VerificationPending bool      `json:"verification_pending" db:"verification_pending"`
+	VerificationSentAt  time.Time `json:"verification_sent_at" db:"verification_sent_at"`
+	// TOTPSecret is the base32 secret of the user's authenticator. It is
+	// stored on enrollment but only required at login once TOTPEnabled is
+	// set by confirming a first code.
+	TOTPSecret  string `json:"totp_secret,omitempty" db:"totp_secret"`
+	TOTPEnabled bool   `json:"totp_enabled" db:"totp_enabled"`
+	// TOTPLastStep is the time step of the last accepted code, so a code
+	// cannot be used twice.
+	TOTPLastStep int64 `json:"totp_last_step,omitempty" db:"totp_last_step"`
+	// RecoveryCodes holds SHA-256 hashes of the unused recovery codes.
+	RecoveryCodes []string `json:"recovery_codes,omitempty" db:"recovery_codes"`
+	// ExternalIssuer and ExternalSubject identify the account at the
+	// OpenID Connect provider the user logs in with, if any.
+	ExternalIssuer  string `json:"external_issuer,omitempty" db:"external_issuer"`
+	ExternalSubject string `json:"external_subject,omitempty" db:"external_subject"`
+	// DeletedAt is set while the user is in the trash. A deleted user
+	// cannot log in but keeps their email and username reserved.
+	DeletedAt time.Time `json:"deleted_at" db:"deleted_at"`
+}
+
+// WithoutSecrets returns a copy of u that is safe to show to its owner,
+// without the TOTP secret and recovery code hashes.
+func (u User) WithoutSecrets() User {
+	u.TOTPSecret = ""
+	u.TOTPLastStep = 0
+	u.RecoveryCodes = nil
+	return u
+}
+
+// NormalizeEmail returns the canonical form of an email address. Emails are
+// stored, looked up and compared for uniqueness in this form.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// UsernameKey returns the form in which usernames are compared for
+// uniqueness. The username itself is stored as entered.
+func UsernameKey(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
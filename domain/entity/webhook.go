@@ -0,0 +1,61 @@
+package entity
+
+import "time"
+
+// Webhook is a subscription that has events POSTed to URL. Deliveries are
+// signed with Secret, which is shown only when the webhook is created.
+// A webhook is disabled after too many failed deliveries in a row.
+type Webhook struct {
+	ID  string `json:"id" db:"id"`
+	URL string `json:"url" db:"url"`
+	// Events lists the event types to deliver; empty means all of them.
+	Events    []string `json:"events" db:"events"`
+	Secret    string   `json:"secret,omitempty" db:"secret"`
+	Active    bool     `json:"active" db:"active"`
+	CreatedBy int64    `json:"created_by" db:"created_by"`
+	// Failures counts the failed delivery attempts since the last
+	// successful one.
+	Failures       int       `json:"failures" db:"failures"`
+	DisabledAt     time.Time `json:"disabled_at" db:"disabled_at"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	LastDeliveryAt time.Time `json:"last_delivery_at" db:"last_delivery_at"`
+}
+
+// WithoutSecret returns a copy of w that is safe to list.
+func (w Webhook) WithoutSecret() Webhook {
+	w.Secret = ""
+	return w
+}
+
+// Wants reports whether the webhook subscribes to events of eventType.
+func (w Webhook) Wants(eventType string) bool {
+	return len(w.Events) == 0 || contains(w.Events, eventType)
+}
+
+// WebhookDelivery records one attempt to deliver an event to a webhook.
+type WebhookDelivery struct {
+	ID        string    `json:"id"`
+	WebhookID string    `json:"webhook_id"`
+	EventID   int64     `json:"event_id"`
+	EventType string    `json:"event_type"`
+	Attempt   int       `json:"attempt"`
+	Time      time.Time `json:"time"`
+	// StatusCode is the receiver's response status, 0 if there was none.
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// Duration is how long the attempt took, in milliseconds.
+	Duration int64 `json:"duration_ms"`
+	Success  bool  `json:"success"`
+}
+
+// PendingWebhookDelivery is a delivery of an event to a webhook that has
+// neither succeeded nor been given up yet. It is stored so deliveries carry
+// on after a restart.
+type PendingWebhookDelivery struct {
+	ID        string `json:"id"`
+	WebhookID string `json:"webhook_id"`
+	Event     Event  `json:"event"`
+	// Attempt is the number of the next attempt, which is due at DueAt.
+	Attempt int       `json:"attempt"`
+	DueAt   time.Time `json:"due_at"`
+}
@@ -0,0 +1,18 @@
+package repository
+
+import "github.com/biswasurmi/book-cli/domain/entity"
+
+// APIKeyRepository stores API keys keyed by ID. GetAllAPIKeys returns keys
+// ordered by ID and ListAPIKeys returns one user's keys in the same order;
+// GetAPIKey, UpdateAPIKey and DeleteAPIKey return ErrAPIKeyNotFound for an
+// unknown ID. Creating a key with an existing ID replaces that key.
+// Implementations must be safe for concurrent use.
+// repositorytest.RunAPIKeyRepository checks these rules.
+type APIKeyRepository interface {
+	GetAllAPIKeys() ([]entity.APIKey, error)
+	ListAPIKeys(userID int64) ([]entity.APIKey, error)
+	CreateAPIKey(key entity.APIKey) (entity.APIKey, error)
+	GetAPIKey(id string) (entity.APIKey, error)
+	UpdateAPIKey(key entity.APIKey) (entity.APIKey, error)
+	DeleteAPIKey(id string) error
+}
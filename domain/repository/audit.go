@@ -0,0 +1,14 @@
+package repository
+
+import "github.com/biswasurmi/book-cli/domain/entity"
+
+// AuditRepository stores the audit log. It is append-only: there is no way
+// to change or remove an event. GetAuditEvents returns events ordered by ID,
+// which is the order they were recorded in; AppendAuditEvent returns
+// ErrAuditEventExists for an ID that is already stored.
+// Implementations must be safe for concurrent use.
+// repositorytest.RunAuditRepository checks these rules.
+type AuditRepository interface {
+	AppendAuditEvent(event entity.AuditEvent) error
+	GetAuditEvents() ([]entity.AuditEvent, error)
+}
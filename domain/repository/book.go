@@ -1,11 +1,33 @@
 package repository
 
-import "github.com/biswasurmi/book-cli/domain/entity"
+import (
+	"time"
 
+	"github.com/biswasurmi/book-cli/domain/entity"
+)
+
+// BookRepository stores books keyed by UUID. GetAllBooks returns books
+// ordered by UUID; GetBook, UpdateBook and DeleteBook return
+// ErrBookNotFound for an unknown UUID. Implementations must be safe for
+// concurrent use. repositorytest.RunBookRepository checks these rules.
+//
+// DeleteBook moves a book to the trash by setting its DeletedAt. Books in
+// the trash are left out of GetAllBooks and treated as unknown by GetBook,
+// UpdateBook and DeleteBook; GetDeletedBooks lists them ordered by UUID.
+// RestoreBook takes a book out of the trash and returns ErrBookNotFound
+// for a book that is not in it. PurgeBook removes a book for good, deleted
+// or not. PurgeDeletedBook only removes a book that is in the trash and was
+// deleted no later than deletedBefore, and returns ErrBookNotFound
+// otherwise, so a book restored in the meantime survives. CreateBook stores
+// the book as given, replacing any existing one.
 type BookRepository interface {
 	GetAllBooks() ([]entity.Book, error)
 	CreateBook(book entity.Book) (entity.Book, error)
 	GetBook(uuid string) (entity.Book, error)
 	UpdateBook(book entity.Book) (entity.Book, error)
 	DeleteBook(uuid string) error
+	GetDeletedBooks() ([]entity.Book, error)
+	RestoreBook(uuid string) (entity.Book, error)
+	PurgeBook(uuid string) error
+	PurgeDeletedBook(uuid string, deletedBefore time.Time) error
 }
\ No newline at end of file
@@ -0,0 +1,21 @@
+package repository
+
+import "github.com/biswasurmi/book-cli/domain/entity"
+
+// BookRevisionRepository stores revisions keyed by book UUID and number.
+// Revisions never change: AddBookRevision returns ErrBookRevisionExists if
+// the book already has a revision with that number. GetBookRevisions
+// returns one book's revisions ordered by number, an empty list for a book
+// without any, and GetAllBookRevisions returns every revision ordered by
+// book UUID and number. GetBookRevision returns ErrBookRevisionNotFound
+// for an unknown revision. DeleteBookRevisions removes every revision of
+// a book when the book itself is purged. Implementations must be safe for
+// concurrent use. repositorytest.RunBookRevisionRepository checks these
+// rules.
+type BookRevisionRepository interface {
+	AddBookRevision(revision entity.BookRevision) error
+	GetBookRevisions(bookUUID string) ([]entity.BookRevision, error)
+	GetBookRevision(bookUUID string, number int) (entity.BookRevision, error)
+	GetAllBookRevisions() ([]entity.BookRevision, error)
+	DeleteBookRevisions(bookUUID string) error
+}
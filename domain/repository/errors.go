@@ -0,0 +1,20 @@
+package repository
+
+import "errors"
+
+// Errors every implementation returns, so callers can tell a missing record
+// from a storage failure.
+var (
+	ErrBookNotFound            = errors.New("book not found")
+	ErrUserNotFound            = errors.New("user not found")
+	ErrInvalidCredentials      = errors.New("invalid credentials")
+	ErrEmailTaken              = errors.New("email already registered")
+	ErrUsernameTaken           = errors.New("username already taken")
+	ErrAPIKeyNotFound          = errors.New("api key not found")
+	ErrOAuthClientNotFound     = errors.New("oauth client not found")
+	ErrAuditEventExists        = errors.New("audit event already recorded")
+	ErrBookRevisionExists      = errors.New("book revision already exists")
+	ErrBookRevisionNotFound    = errors.New("book revision not found")
+	ErrWebhookNotFound         = errors.New("webhook not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+)
@@ -0,0 +1,18 @@
+package repository
+
+import "github.com/biswasurmi/book-cli/domain/entity"
+
+// OAuthClientRepository stores OAuth2 clients keyed by client ID.
+// GetAllOAuthClients returns clients ordered by ID and ListOAuthClients
+// returns one owner's clients in the same order; GetOAuthClient and
+// DeleteOAuthClient return ErrOAuthClientNotFound for an unknown ID.
+// Creating a client with an existing ID replaces that client.
+// Implementations must be safe for concurrent use.
+// repositorytest.RunOAuthClientRepository checks these rules.
+type OAuthClientRepository interface {
+	GetAllOAuthClients() ([]entity.OAuthClient, error)
+	ListOAuthClients(ownerID int64) ([]entity.OAuthClient, error)
+	CreateOAuthClient(client entity.OAuthClient) (entity.OAuthClient, error)
+	GetOAuthClient(id string) (entity.OAuthClient, error)
+	DeleteOAuthClient(id string) error
+}
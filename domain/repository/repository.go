@@ -1,9 +1,13 @@
 package repository
 
-
-
 // Repositories aggregates all repository interfaces
 type Repositories struct {
-	BookRepository BookRepository
-	UserRepository UserRepository
-}
\ No newline at end of file
+	BookRepository            BookRepository
+	UserRepository            UserRepository
+	APIKeyRepository          APIKeyRepository
+	OAuthClientRepository     OAuthClientRepository
+	AuditRepository           AuditRepository
+	BookRevisionRepository    BookRevisionRepository
+	WebhookRepository         WebhookRepository
+	WebhookDeliveryRepository WebhookDeliveryRepository
+}
@@ -0,0 +1,1154 @@
+// Package repositorytest is a conformance suite for repository
+// implementations. A backend runs it from its own tests:
+//
+//	func TestBooks(t *testing.T) {
+//		repositorytest.RunBookRepository(t, func(t *testing.T) repository.BookRepository {
+//			return newBackend(t).BookRepository
+//		})
+//	}
+//
+// The factory is called once per subtest and must return an empty
+// repository; use t.Cleanup to release it.
+package repositorytest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// concurrency is the number of goroutines used by the concurrency checks.
+const concurrency = 20
+
+// RunBookRepository checks newRepo against the BookRepository contract.
+func RunBookRepository(t *testing.T, newRepo func(t *testing.T) repository.BookRepository) {
+	t.Run("Empty", func(t *testing.T) {
+		repo := newRepo(t)
+		books, err := repo.GetAllBooks()
+		if err != nil || len(books) != 0 {
+			t.Errorf("GetAllBooks on empty repository: got %+v, %v", books, err)
+		}
+	})
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		repo := newRepo(t)
+		book := entity.Book{UUID: "b-1", Name: "Learn API", AuthorList: []string{"Urmi", "Biswas"}, PublishDate: "2024-01-01", ISBN: "0999-0555-5914"}
+		if _, err := repo.CreateBook(book); err != nil {
+			t.Fatalf("CreateBook: %v", err)
+		}
+		got, err := repo.GetBook("b-1")
+		if err != nil {
+			t.Fatalf("GetBook: %v", err)
+		}
+		if got.Name != book.Name || got.ISBN != book.ISBN || got.PublishDate != book.PublishDate || len(got.AuthorList) != 2 || got.AuthorList[1] != "Biswas" {
+			t.Errorf("GetBook: got %+v, want %+v", got, book)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.GetBook("missing"); !errors.Is(err, repository.ErrBookNotFound) {
+			t.Errorf("GetBook: expected ErrBookNotFound, got %v", err)
+		}
+		if err := repo.DeleteBook("missing"); !errors.Is(err, repository.ErrBookNotFound) {
+			t.Errorf("DeleteBook: expected ErrBookNotFound, got %v", err)
+		}
+	})
+
+	t.Run("UpdateMissing", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.UpdateBook(entity.Book{UUID: "missing", Name: "Ghost"}); !errors.Is(err, repository.ErrBookNotFound) {
+			t.Errorf("UpdateBook: expected ErrBookNotFound, got %v", err)
+		}
+		if _, err := repo.GetBook("missing"); err == nil {
+			t.Error("UpdateBook of a missing book must not create it")
+		}
+	})
+
+	t.Run("UpdateAndDelete", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.CreateBook(entity.Book{UUID: "b-1", Name: "Learn API"})
+		repo.CreateBook(entity.Book{UUID: "b-2", Name: "Learn Go"})
+
+		if _, err := repo.UpdateBook(entity.Book{UUID: "b-1", Name: "Updated"}); err != nil {
+			t.Fatalf("UpdateBook: %v", err)
+		}
+		if got, _ := repo.GetBook("b-1"); got.Name != "Updated" {
+			t.Errorf("Expected updated name, got %+v", got)
+		}
+		if got, _ := repo.GetBook("b-2"); got.Name != "Learn Go" {
+			t.Errorf("Update changed another book: %+v", got)
+		}
+
+		if err := repo.DeleteBook("b-1"); err != nil {
+			t.Fatalf("DeleteBook: %v", err)
+		}
+		if _, err := repo.GetBook("b-1"); !errors.Is(err, repository.ErrBookNotFound) {
+			t.Errorf("Expected deleted book to be gone, got %v", err)
+		}
+		if books, _ := repo.GetAllBooks(); len(books) != 1 {
+			t.Errorf("Expected 1 book after delete, got %+v", books)
+		}
+	})
+
+	t.Run("Trash", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.CreateBook(entity.Book{UUID: "b-2", Name: "Learn Go"})
+		repo.CreateBook(entity.Book{UUID: "b-1", Name: "Learn API"})
+		repo.CreateBook(entity.Book{UUID: "b-3", Name: "Learn SQL"})
+		for _, uuid := range []string{"b-2", "b-1"} {
+			if err := repo.DeleteBook(uuid); err != nil {
+				t.Fatalf("DeleteBook(%s): %v", uuid, err)
+			}
+		}
+
+		deleted, err := repo.GetDeletedBooks()
+		if err != nil || len(deleted) != 2 || deleted[0].UUID != "b-1" || deleted[1].Name != "Learn Go" || deleted[0].DeletedAt == nil {
+			t.Fatalf("GetDeletedBooks: got %+v, %v", deleted, err)
+		}
+		if err := repo.DeleteBook("b-1"); !errors.Is(err, repository.ErrBookNotFound) {
+			t.Errorf("DeleteBook of a deleted book: expected ErrBookNotFound, got %v", err)
+		}
+		if _, err := repo.UpdateBook(entity.Book{UUID: "b-1", Name: "Updated"}); !errors.Is(err, repository.ErrBookNotFound) {
+			t.Errorf("UpdateBook of a deleted book: expected ErrBookNotFound, got %v", err)
+		}
+		if _, err := repo.RestoreBook("b-3"); !errors.Is(err, repository.ErrBookNotFound) {
+			t.Errorf("RestoreBook of a book outside the trash: expected ErrBookNotFound, got %v", err)
+		}
+
+		restored, err := repo.RestoreBook("b-1")
+		if err != nil || restored.Name != "Learn API" || restored.DeletedAt != nil {
+			t.Fatalf("RestoreBook: got %+v, %v", restored, err)
+		}
+		if got, err := repo.GetBook("b-1"); err != nil || got.DeletedAt != nil {
+			t.Errorf("GetBook after restore: got %+v, %v", got, err)
+		}
+
+		if err := repo.PurgeDeletedBook("b-3", time.Now()); !errors.Is(err, repository.ErrBookNotFound) {
+			t.Errorf("PurgeDeletedBook of a book outside the trash: expected ErrBookNotFound, got %v", err)
+		}
+		if err := repo.PurgeDeletedBook("b-2", time.Now().Add(-time.Hour)); !errors.Is(err, repository.ErrBookNotFound) {
+			t.Errorf("PurgeDeletedBook of a book deleted after the cutoff: expected ErrBookNotFound, got %v", err)
+		}
+		if err := repo.PurgeDeletedBook("b-2", time.Now()); err != nil {
+			t.Fatalf("PurgeDeletedBook: %v", err)
+		}
+		if err := repo.PurgeBook("b-2"); !errors.Is(err, repository.ErrBookNotFound) {
+			t.Errorf("PurgeBook of a purged book: expected ErrBookNotFound, got %v", err)
+		}
+		repo.CreateBook(entity.Book{UUID: "b-4", Name: "Learn Testing"})
+		if err := repo.PurgeBook("b-4"); err != nil {
+			t.Fatalf("PurgeBook of a live book: %v", err)
+		}
+		if deleted, _ := repo.GetDeletedBooks(); len(deleted) != 0 {
+			t.Errorf("Expected an empty trash, got %+v", deleted)
+		}
+		if books, _ := repo.GetAllBooks(); len(books) != 2 {
+			t.Errorf("Expected 2 books, got %+v", books)
+		}
+	})
+
+	t.Run("Ordering", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, id := range []string{"c", "a", "d", "b"} {
+			repo.CreateBook(entity.Book{UUID: id})
+		}
+		books, err := repo.GetAllBooks()
+		if err != nil {
+			t.Fatalf("GetAllBooks: %v", err)
+		}
+		var got []string
+		for _, book := range books {
+			got = append(got, book.UUID)
+		}
+		if fmt.Sprint(got) != "[a b c d]" {
+			t.Errorf("Expected books ordered by UUID, got %v", got)
+		}
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		repo := newRepo(t)
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				id := fmt.Sprintf("b-%02d", i)
+				repo.CreateBook(entity.Book{UUID: id, Name: "Book"})
+				repo.GetAllBooks()
+				repo.UpdateBook(entity.Book{UUID: id, Name: "Updated"})
+				repo.GetBook(id)
+				if i%2 == 0 {
+					repo.DeleteBook(id)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		books, err := repo.GetAllBooks()
+		if err != nil || len(books) != concurrency/2 {
+			t.Fatalf("Expected %d books, got %d, %v", concurrency/2, len(books), err)
+		}
+		for _, book := range books {
+			if book.Name != "Updated" {
+				t.Errorf("Lost update for %s", book.UUID)
+			}
+		}
+	})
+}
+
+// RunUserRepository checks newRepo against the UserRepository contract.
+func RunUserRepository(t *testing.T, newRepo func(t *testing.T) repository.UserRepository) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newUser := func(id int64, email string) entity.User {
+		now := time.Now()
+		return entity.User{ID: id, Username: email, Email: email, Password: string(hash), Role: entity.RoleUser, CreatedAt: now, UpdatedAt: now}
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		repo := newRepo(t)
+		users, err := repo.GetAllUsers()
+		if err != nil || len(users) != 0 {
+			t.Errorf("GetAllUsers on empty repository: got %+v, %v", users, err)
+		}
+	})
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		repo := newRepo(t)
+		user := newUser(1, "urmi@example.com")
+		user.Role = entity.RoleAdmin
+		if _, err := repo.CreateUser(user); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		got, err := repo.GetByID(1)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if got.Email != user.Email || got.Password != user.Password || got.Role != entity.RoleAdmin || !got.CreatedAt.Equal(user.CreatedAt) {
+			t.Errorf("GetByID: got %+v, want %+v", got, user)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.GetByID(42); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Errorf("GetByID: expected ErrUserNotFound, got %v", err)
+		}
+		if _, err := repo.GetByEmail("missing@example.com"); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Errorf("GetByEmail: expected ErrUserNotFound, got %v", err)
+		}
+		if err := repo.Delete(42); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Errorf("Delete: expected ErrUserNotFound, got %v", err)
+		}
+	})
+
+	t.Run("UpdateMissing", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.Update(newUser(42, "ghost@example.com")); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Errorf("Update: expected ErrUserNotFound, got %v", err)
+		}
+		if _, err := repo.GetByID(42); err == nil {
+			t.Error("Update of a missing user must not create it")
+		}
+	})
+
+	t.Run("EmailLookup", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.CreateUser(newUser(1, "first@example.com"))
+		repo.CreateUser(newUser(2, "second@example.com"))
+		repo.CreateUser(newUser(3, "third@example.com"))
+
+		got, err := repo.GetByEmail("second@example.com")
+		if err != nil || got.ID != 2 {
+			t.Errorf("GetByEmail: got %+v, %v", got, err)
+		}
+
+		// The old email must stop resolving once it is changed
+		got.Email = "renamed@example.com"
+		if _, err := repo.Update(got); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if _, err := repo.GetByEmail("second@example.com"); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Errorf("Expected old email to be gone, got %v", err)
+		}
+		if got, err := repo.GetByEmail("renamed@example.com"); err != nil || got.ID != 2 {
+			t.Errorf("GetByEmail after update: got %+v, %v", got, err)
+		}
+	})
+
+	t.Run("UpdateAndDelete", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.CreateUser(newUser(1, "first@example.com"))
+		repo.CreateUser(newUser(2, "second@example.com"))
+
+		user, _ := repo.GetByID(1)
+		user.Username = "renamed"
+		if _, err := repo.Update(user); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if got, _ := repo.GetByID(1); got.Username != "renamed" {
+			t.Errorf("Expected updated username, got %+v", got)
+		}
+		if got, _ := repo.GetByID(2); got.Username != "second@example.com" {
+			t.Errorf("Update changed another user: %+v", got)
+		}
+
+		if err := repo.Delete(1); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := repo.GetByID(1); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Errorf("Expected deleted user to be gone, got %v", err)
+		}
+		if _, err := repo.GetByEmail("first@example.com"); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Errorf("Expected deleted user's email to be gone, got %v", err)
+		}
+	})
+
+	t.Run("Trash", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.CreateUser(newUser(2, "second@example.com"))
+		repo.CreateUser(newUser(1, "first@example.com"))
+		repo.CreateUser(newUser(3, "third@example.com"))
+		for _, id := range []int64{2, 1} {
+			if err := repo.Delete(id); err != nil {
+				t.Fatalf("Delete(%d): %v", id, err)
+			}
+		}
+
+		deleted, err := repo.GetDeletedUsers()
+		if err != nil || len(deleted) != 2 || deleted[0].ID != 1 || deleted[1].ID != 2 || deleted[0].DeletedAt.IsZero() {
+			t.Fatalf("GetDeletedUsers: got %+v, %v", deleted, err)
+		}
+		if users, _ := repo.GetAllUsers(); len(users) != 1 || users[0].ID != 3 {
+			t.Errorf("Expected only user 3 to be listed, got %+v", users)
+		}
+		if err := repo.Delete(1); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Errorf("Delete of a deleted user: expected ErrUserNotFound, got %v", err)
+		}
+		if _, err := repo.Update(deleted[0]); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Errorf("Update of a deleted user: expected ErrUserNotFound, got %v", err)
+		}
+		if _, err := repo.Authenticate("first@example.com", "password123"); !errors.Is(err, repository.ErrInvalidCredentials) {
+			t.Errorf("Authenticate as a deleted user: expected ErrInvalidCredentials, got %v", err)
+		}
+		// Deleted users keep their email and username
+		if _, err := repo.CreateUser(newUser(4, "FIRST@example.com")); !errors.Is(err, repository.ErrEmailTaken) {
+			t.Errorf("CreateUser with a deleted user's email: expected ErrEmailTaken, got %v", err)
+		}
+		if _, err := repo.RestoreUser(3); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Errorf("RestoreUser of a user outside the trash: expected ErrUserNotFound, got %v", err)
+		}
+
+		restored, err := repo.RestoreUser(1)
+		if err != nil || !restored.DeletedAt.IsZero() {
+			t.Fatalf("RestoreUser: got %+v, %v", restored, err)
+		}
+		if got, err := repo.Authenticate("first@example.com", "password123"); err != nil || got.ID != 1 {
+			t.Errorf("Authenticate after restore: got %+v, %v", got, err)
+		}
+
+		if err := repo.PurgeDeletedUser(3, time.Now()); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Errorf("PurgeDeletedUser of a user outside the trash: expected ErrUserNotFound, got %v", err)
+		}
+		if err := repo.PurgeDeletedUser(2, time.Now().Add(-time.Hour)); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Errorf("PurgeDeletedUser of a user deleted after the cutoff: expected ErrUserNotFound, got %v", err)
+		}
+		if err := repo.PurgeDeletedUser(2, time.Now()); err != nil {
+			t.Fatalf("PurgeDeletedUser: %v", err)
+		}
+		if err := repo.PurgeUser(2); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Errorf("PurgeUser of a purged user: expected ErrUserNotFound, got %v", err)
+		}
+		if err := repo.PurgeUser(3); err != nil {
+			t.Fatalf("PurgeUser of a live user: %v", err)
+		}
+		if deleted, _ := repo.GetDeletedUsers(); len(deleted) != 0 {
+			t.Errorf("Expected an empty trash, got %+v", deleted)
+		}
+	})
+
+	t.Run("Authenticate", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.CreateUser(newUser(1, "urmi@example.com"))
+
+		if got, err := repo.Authenticate("urmi@example.com", "password123"); err != nil || got.ID != 1 {
+			t.Errorf("Authenticate: got %+v, %v", got, err)
+		}
+		if _, err := repo.Authenticate("urmi@example.com", "wrong-password"); !errors.Is(err, repository.ErrInvalidCredentials) {
+			t.Errorf("Wrong password: expected ErrInvalidCredentials, got %v", err)
+		}
+		if _, err := repo.Authenticate("missing@example.com", "password123"); !errors.Is(err, repository.ErrInvalidCredentials) {
+			t.Errorf("Unknown email: expected ErrInvalidCredentials, got %v", err)
+		}
+	})
+
+	t.Run("EmailCaseInsensitive", func(t *testing.T) {
+		repo := newRepo(t)
+		created, err := repo.CreateUser(newUser(1, "  Urmi@Example.COM "))
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		if created.Email != "urmi@example.com" {
+			t.Errorf("Expected normalized email, got %q", created.Email)
+		}
+		if got, err := repo.GetByEmail("URMI@example.com"); err != nil || got.ID != 1 {
+			t.Errorf("GetByEmail with different case: got %+v, %v", got, err)
+		}
+		if _, err := repo.Authenticate(" urmi@EXAMPLE.com", "password123"); err != nil {
+			t.Errorf("Authenticate with different case: %v", err)
+		}
+	})
+
+	t.Run("Uniqueness", func(t *testing.T) {
+		repo := newRepo(t)
+		first := newUser(1, "urmi@example.com")
+		first.Username = "Urmi"
+		repo.CreateUser(first)
+
+		if _, err := repo.CreateUser(newUser(2, "URMI@example.com")); !errors.Is(err, repository.ErrEmailTaken) {
+			t.Errorf("Duplicate email: expected ErrEmailTaken, got %v", err)
+		}
+		second := newUser(2, "other@example.com")
+		second.Username = "urmi"
+		if _, err := repo.CreateUser(second); !errors.Is(err, repository.ErrUsernameTaken) {
+			t.Errorf("Duplicate username: expected ErrUsernameTaken, got %v", err)
+		}
+		if _, err := repo.GetByID(2); err == nil {
+			t.Error("A rejected user must not be stored")
+		}
+
+		// Empty usernames do not clash
+		repo.CreateUser(entity.User{ID: 3, Email: "a@example.com", Password: string(hash)})
+		if _, err := repo.CreateUser(entity.User{ID: 4, Email: "b@example.com", Password: string(hash)}); err != nil {
+			t.Errorf("Empty usernames must not clash: %v", err)
+		}
+
+		// Updates are checked too, but a user may keep its own values
+		user, _ := repo.GetByID(3)
+		user.Email = "Urmi@example.com"
+		if _, err := repo.Update(user); !errors.Is(err, repository.ErrEmailTaken) {
+			t.Errorf("Update to taken email: expected ErrEmailTaken, got %v", err)
+		}
+		first.Username = "URMI"
+		if _, err := repo.Update(first); err != nil {
+			t.Errorf("Update keeping own email and username: %v", err)
+		}
+
+		// A purged user's email can be reused
+		repo.Delete(1)
+		repo.PurgeUser(1)
+		if _, err := repo.CreateUser(newUser(5, "urmi@example.com")); err != nil {
+			t.Errorf("Reusing a purged user's email: %v", err)
+		}
+	})
+
+	t.Run("Ordering", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, id := range []int64{30, 10, 40, 20} {
+			repo.CreateUser(newUser(id, fmt.Sprintf("user%d@example.com", id)))
+		}
+		users, err := repo.GetAllUsers()
+		if err != nil {
+			t.Fatalf("GetAllUsers: %v", err)
+		}
+		var got []int64
+		for _, user := range users {
+			got = append(got, user.ID)
+		}
+		if fmt.Sprint(got) != "[10 20 30 40]" {
+			t.Errorf("Expected users ordered by ID, got %v", got)
+		}
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		repo := newRepo(t)
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(id int64) {
+				defer wg.Done()
+				email := fmt.Sprintf("user%d@example.com", id)
+				repo.CreateUser(newUser(id, email))
+				repo.GetAllUsers()
+				repo.GetByEmail(email)
+				user, _ := repo.GetByID(id)
+				user.Username = fmt.Sprintf("updated-%d", id)
+				repo.Update(user)
+				if id%2 == 0 {
+					repo.Delete(id)
+				}
+			}(int64(i + 1))
+		}
+		wg.Wait()
+
+		users, err := repo.GetAllUsers()
+		if err != nil || len(users) != concurrency/2 {
+			t.Fatalf("Expected %d users, got %d, %v", concurrency/2, len(users), err)
+		}
+		for _, user := range users {
+			if user.Username != fmt.Sprintf("updated-%d", user.ID) {
+				t.Errorf("Lost update for user %d", user.ID)
+			}
+		}
+	})
+}
+
+// RunAPIKeyRepository checks newRepo against the APIKeyRepository contract.
+func RunAPIKeyRepository(t *testing.T, newRepo func(t *testing.T) repository.APIKeyRepository) {
+	newKey := func(id string, userID int64) entity.APIKey {
+		return entity.APIKey{
+			ID:        id,
+			UserID:    userID,
+			Name:      "ci",
+			Scopes:    []string{entity.ScopeBooksRead},
+			Hash:      "hash-" + id,
+			CreatedAt: time.Now().UTC().Truncate(time.Second),
+			ExpiresAt: time.Now().UTC().Add(time.Hour).Truncate(time.Second),
+		}
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		repo := newRepo(t)
+		keys, err := repo.GetAllAPIKeys()
+		if err != nil || len(keys) != 0 {
+			t.Errorf("GetAllAPIKeys on empty repository: got %+v, %v", keys, err)
+		}
+	})
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		repo := newRepo(t)
+		key := newKey("k-1", 1)
+		if _, err := repo.CreateAPIKey(key); err != nil {
+			t.Fatalf("CreateAPIKey: %v", err)
+		}
+		got, err := repo.GetAPIKey("k-1")
+		if err != nil {
+			t.Fatalf("GetAPIKey: %v", err)
+		}
+		if got.UserID != 1 || got.Hash != key.Hash || !got.ExpiresAt.Equal(key.ExpiresAt) || len(got.Scopes) != 1 || got.Scopes[0] != entity.ScopeBooksRead {
+			t.Errorf("GetAPIKey: got %+v, want %+v", got, key)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.GetAPIKey("missing"); !errors.Is(err, repository.ErrAPIKeyNotFound) {
+			t.Errorf("GetAPIKey: expected ErrAPIKeyNotFound, got %v", err)
+		}
+		if _, err := repo.UpdateAPIKey(newKey("missing", 1)); !errors.Is(err, repository.ErrAPIKeyNotFound) {
+			t.Errorf("UpdateAPIKey: expected ErrAPIKeyNotFound, got %v", err)
+		}
+		if err := repo.DeleteAPIKey("missing"); !errors.Is(err, repository.ErrAPIKeyNotFound) {
+			t.Errorf("DeleteAPIKey: expected ErrAPIKeyNotFound, got %v", err)
+		}
+	})
+
+	t.Run("UpdateAndDelete", func(t *testing.T) {
+		repo := newRepo(t)
+		key := newKey("k-1", 1)
+		repo.CreateAPIKey(key)
+
+		key.LastUsedAt = time.Now().UTC().Truncate(time.Second)
+		if _, err := repo.UpdateAPIKey(key); err != nil {
+			t.Fatalf("UpdateAPIKey: %v", err)
+		}
+		if got, _ := repo.GetAPIKey("k-1"); !got.LastUsedAt.Equal(key.LastUsedAt) {
+			t.Errorf("Expected last use %v, got %v", key.LastUsedAt, got.LastUsedAt)
+		}
+		if err := repo.DeleteAPIKey("k-1"); err != nil {
+			t.Fatalf("DeleteAPIKey: %v", err)
+		}
+		if _, err := repo.GetAPIKey("k-1"); !errors.Is(err, repository.ErrAPIKeyNotFound) {
+			t.Errorf("Expected deleted key to be gone, got %v", err)
+		}
+	})
+
+	t.Run("ListByUser", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, id := range []string{"k-3", "k-1", "k-2"} {
+			repo.CreateAPIKey(newKey(id, 1))
+		}
+		repo.CreateAPIKey(newKey("k-0", 2))
+
+		keys, err := repo.ListAPIKeys(1)
+		if err != nil || len(keys) != 3 {
+			t.Fatalf("ListAPIKeys: got %+v, %v", keys, err)
+		}
+		for i, want := range []string{"k-1", "k-2", "k-3"} {
+			if keys[i].ID != want {
+				t.Errorf("Expected %s at position %d, got %s", want, i, keys[i].ID)
+			}
+		}
+		if all, _ := repo.GetAllAPIKeys(); len(all) != 4 || all[0].ID != "k-0" {
+			t.Errorf("GetAllAPIKeys: got %+v", all)
+		}
+		if none, err := repo.ListAPIKeys(3); err != nil || len(none) != 0 {
+			t.Errorf("ListAPIKeys for a user without keys: got %+v, %v", none, err)
+		}
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		repo := newRepo(t)
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				key := newKey(fmt.Sprintf("k-%02d", i), 1)
+				repo.CreateAPIKey(key)
+				repo.ListAPIKeys(1)
+				key.Name = "updated"
+				repo.UpdateAPIKey(key)
+				if i%2 == 0 {
+					repo.DeleteAPIKey(key.ID)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		keys, err := repo.ListAPIKeys(1)
+		if err != nil || len(keys) != concurrency/2 {
+			t.Fatalf("Expected %d keys, got %d, %v", concurrency/2, len(keys), err)
+		}
+		for _, key := range keys {
+			if key.Name != "updated" {
+				t.Errorf("Lost update for %s", key.ID)
+			}
+		}
+	})
+}
+
+// RunOAuthClientRepository checks newRepo against the OAuthClientRepository contract.
+func RunOAuthClientRepository(t *testing.T, newRepo func(t *testing.T) repository.OAuthClientRepository) {
+	newClient := func(id string, ownerID int64) entity.OAuthClient {
+		return entity.OAuthClient{
+			ID:           id,
+			Name:         "app",
+			OwnerID:      ownerID,
+			SecretHash:   "hash-" + id,
+			RedirectURIs: []string{"https://app.example.com/callback"},
+			GrantTypes:   []string{entity.GrantAuthorizationCode},
+			Scopes:       []string{entity.ScopeBooksRead},
+			CreatedAt:    time.Now().UTC().Truncate(time.Second),
+		}
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		repo := newRepo(t)
+		clients, err := repo.GetAllOAuthClients()
+		if err != nil || len(clients) != 0 {
+			t.Errorf("GetAllOAuthClients on empty repository: got %+v, %v", clients, err)
+		}
+	})
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		repo := newRepo(t)
+		client := newClient("c-1", 1)
+		if _, err := repo.CreateOAuthClient(client); err != nil {
+			t.Fatalf("CreateOAuthClient: %v", err)
+		}
+		got, err := repo.GetOAuthClient("c-1")
+		if err != nil {
+			t.Fatalf("GetOAuthClient: %v", err)
+		}
+		if got.OwnerID != 1 || got.SecretHash != client.SecretHash || !got.AllowsRedirect(client.RedirectURIs[0]) ||
+			!got.AllowsGrant(entity.GrantAuthorizationCode) || len(got.Scopes) != 1 {
+			t.Errorf("GetOAuthClient: got %+v, want %+v", got, client)
+		}
+	})
+
+	t.Run("NotFoundAndDelete", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.GetOAuthClient("missing"); !errors.Is(err, repository.ErrOAuthClientNotFound) {
+			t.Errorf("GetOAuthClient: expected ErrOAuthClientNotFound, got %v", err)
+		}
+		if err := repo.DeleteOAuthClient("missing"); !errors.Is(err, repository.ErrOAuthClientNotFound) {
+			t.Errorf("DeleteOAuthClient: expected ErrOAuthClientNotFound, got %v", err)
+		}
+		repo.CreateOAuthClient(newClient("c-1", 1))
+		if err := repo.DeleteOAuthClient("c-1"); err != nil {
+			t.Fatalf("DeleteOAuthClient: %v", err)
+		}
+		if _, err := repo.GetOAuthClient("c-1"); !errors.Is(err, repository.ErrOAuthClientNotFound) {
+			t.Errorf("Expected deleted client to be gone, got %v", err)
+		}
+	})
+
+	t.Run("ListByOwner", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, id := range []string{"c-3", "c-1", "c-2"} {
+			repo.CreateOAuthClient(newClient(id, 1))
+		}
+		repo.CreateOAuthClient(newClient("c-0", 2))
+
+		clients, err := repo.ListOAuthClients(1)
+		if err != nil || len(clients) != 3 {
+			t.Fatalf("ListOAuthClients: got %+v, %v", clients, err)
+		}
+		for i, want := range []string{"c-1", "c-2", "c-3"} {
+			if clients[i].ID != want {
+				t.Errorf("Expected %s at position %d, got %s", want, i, clients[i].ID)
+			}
+		}
+		if all, _ := repo.GetAllOAuthClients(); len(all) != 4 || all[0].ID != "c-0" {
+			t.Errorf("GetAllOAuthClients: got %+v", all)
+		}
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		repo := newRepo(t)
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				client := newClient(fmt.Sprintf("c-%02d", i), 1)
+				repo.CreateOAuthClient(client)
+				repo.ListOAuthClients(1)
+				if i%2 == 0 {
+					repo.DeleteOAuthClient(client.ID)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		clients, err := repo.ListOAuthClients(1)
+		if err != nil || len(clients) != concurrency/2 {
+			t.Fatalf("Expected %d clients, got %d, %v", concurrency/2, len(clients), err)
+		}
+	})
+}
+
+// RunAuditRepository checks newRepo against the AuditRepository contract.
+func RunAuditRepository(t *testing.T, newRepo func(t *testing.T) repository.AuditRepository) {
+	newEvent := func(id string) entity.AuditEvent {
+		return entity.AuditEvent{
+			ID:         id,
+			Time:       time.Now().UTC().Truncate(time.Second),
+			ActorID:    1,
+			Action:     entity.AuditBookUpdate,
+			TargetType: entity.AuditTargetBook,
+			TargetID:   "b-1",
+			Changes:    map[string]entity.FieldChange{"name": {Before: "Learn API", After: "Learn Go"}},
+			RequestID:  "req-" + id,
+			SourceIP:   "192.0.2.1",
+		}
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		repo := newRepo(t)
+		events, err := repo.GetAuditEvents()
+		if err != nil || len(events) != 0 {
+			t.Errorf("GetAuditEvents on empty repository: got %+v, %v", events, err)
+		}
+	})
+
+	t.Run("AppendAndList", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, id := range []string{"e-2", "e-3", "e-1"} {
+			if err := repo.AppendAuditEvent(newEvent(id)); err != nil {
+				t.Fatalf("AppendAuditEvent(%s): %v", id, err)
+			}
+		}
+		events, err := repo.GetAuditEvents()
+		if err != nil || len(events) != 3 {
+			t.Fatalf("GetAuditEvents: got %+v, %v", events, err)
+		}
+		for i, want := range []string{"e-1", "e-2", "e-3"} {
+			if events[i].ID != want {
+				t.Errorf("Expected %s at position %d, got %s", want, i, events[i].ID)
+			}
+		}
+		got := events[0]
+		if got.ActorID != 1 || got.Action != entity.AuditBookUpdate || got.TargetID != "b-1" ||
+			got.RequestID != "req-e-1" || got.SourceIP != "192.0.2.1" || got.Changes["name"].After != "Learn Go" {
+			t.Errorf("GetAuditEvents: got %+v", got)
+		}
+	})
+
+	t.Run("AppendOnly", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.AppendAuditEvent(newEvent("e-1"))
+		changed := newEvent("e-1")
+		changed.Action = entity.AuditBookDelete
+		if err := repo.AppendAuditEvent(changed); !errors.Is(err, repository.ErrAuditEventExists) {
+			t.Errorf("AppendAuditEvent with an existing ID: expected ErrAuditEventExists, got %v", err)
+		}
+		if events, _ := repo.GetAuditEvents(); len(events) != 1 || events[0].Action != entity.AuditBookUpdate {
+			t.Errorf("Expected the original event to be kept, got %+v", events)
+		}
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		repo := newRepo(t)
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				repo.AppendAuditEvent(newEvent(fmt.Sprintf("e-%02d", i)))
+				repo.GetAuditEvents()
+			}(i)
+		}
+		wg.Wait()
+
+		events, err := repo.GetAuditEvents()
+		if err != nil || len(events) != concurrency {
+			t.Fatalf("Expected %d events, got %d, %v", concurrency, len(events), err)
+		}
+	})
+}
+
+// RunBookRevisionRepository checks newRepo against the
+// BookRevisionRepository contract.
+func RunBookRevisionRepository(t *testing.T, newRepo func(t *testing.T) repository.BookRevisionRepository) {
+	newRevision := func(uuid string, number int) entity.BookRevision {
+		return entity.BookRevision{
+			BookUUID:  uuid,
+			Number:    number,
+			Book:      entity.Book{UUID: uuid, Name: fmt.Sprintf("Learn API %d", number), AuthorList: []string{"Urmi"}},
+			CreatedAt: time.Now().UTC().Truncate(time.Second),
+			CreatedBy: 1,
+		}
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		repo := newRepo(t)
+		revisions, err := repo.GetBookRevisions("b-1")
+		if err != nil || len(revisions) != 0 {
+			t.Errorf("GetBookRevisions on empty repository: got %+v, %v", revisions, err)
+		}
+		if _, err := repo.GetBookRevision("b-1", 1); !errors.Is(err, repository.ErrBookRevisionNotFound) {
+			t.Errorf("GetBookRevision: expected ErrBookRevisionNotFound, got %v", err)
+		}
+	})
+
+	t.Run("AddAndList", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, n := range []int{2, 3, 1} {
+			if err := repo.AddBookRevision(newRevision("b-1", n)); err != nil {
+				t.Fatalf("AddBookRevision(%d): %v", n, err)
+			}
+		}
+		repo.AddBookRevision(newRevision("b-0", 1))
+
+		revisions, err := repo.GetBookRevisions("b-1")
+		if err != nil || len(revisions) != 3 {
+			t.Fatalf("GetBookRevisions: got %+v, %v", revisions, err)
+		}
+		for i, revision := range revisions {
+			if revision.Number != i+1 || revision.Book.Name != fmt.Sprintf("Learn API %d", i+1) {
+				t.Errorf("Expected revision %d at position %d, got %+v", i+1, i, revision)
+			}
+		}
+		got, err := repo.GetBookRevision("b-1", 2)
+		if err != nil || got.Book.Name != "Learn API 2" || got.CreatedBy != 1 || len(got.Book.AuthorList) != 1 {
+			t.Errorf("GetBookRevision: got %+v, %v", got, err)
+		}
+		all, err := repo.GetAllBookRevisions()
+		if err != nil || len(all) != 4 || all[0].BookUUID != "b-0" || all[3].Number != 3 {
+			t.Errorf("GetAllBookRevisions: got %+v, %v", all, err)
+		}
+	})
+
+	t.Run("Immutable", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.AddBookRevision(newRevision("b-1", 1))
+		changed := newRevision("b-1", 1)
+		changed.Book.Name = "Changed"
+		if err := repo.AddBookRevision(changed); !errors.Is(err, repository.ErrBookRevisionExists) {
+			t.Errorf("AddBookRevision with an existing number: expected ErrBookRevisionExists, got %v", err)
+		}
+		if got, _ := repo.GetBookRevision("b-1", 1); got.Book.Name != "Learn API 1" {
+			t.Errorf("Expected the original revision to be kept, got %+v", got)
+		}
+	})
+
+	t.Run("DeleteBookRevisions", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.AddBookRevision(newRevision("b-1", 1))
+		repo.AddBookRevision(newRevision("b-1", 2))
+		repo.AddBookRevision(newRevision("b-2", 1))
+
+		if err := repo.DeleteBookRevisions("b-1"); err != nil {
+			t.Fatalf("DeleteBookRevisions: %v", err)
+		}
+		if revisions, err := repo.GetBookRevisions("b-1"); err != nil || len(revisions) != 0 {
+			t.Errorf("Expected no revisions of b-1, got %+v, %v", revisions, err)
+		}
+		if all, _ := repo.GetAllBookRevisions(); len(all) != 1 || all[0].BookUUID != "b-2" {
+			t.Errorf("Expected the other book's revisions to be kept, got %+v", all)
+		}
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		repo := newRepo(t)
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				repo.AddBookRevision(newRevision("b-1", i+1))
+				repo.GetBookRevisions("b-1")
+			}(i)
+		}
+		wg.Wait()
+
+		revisions, err := repo.GetBookRevisions("b-1")
+		if err != nil || len(revisions) != concurrency {
+			t.Fatalf("Expected %d revisions, got %d, %v", concurrency, len(revisions), err)
+		}
+	})
+}
+
+// RunWebhookRepository checks newRepo against the WebhookRepository contract.
+func RunWebhookRepository(t *testing.T, newRepo func(t *testing.T) repository.WebhookRepository) {
+	newWebhook := func(id string) entity.Webhook {
+		return entity.Webhook{
+			ID:        id,
+			URL:       "https://example.com/hooks/" + id,
+			Events:    []string{entity.EventBookCreated},
+			Secret:    "whsec_" + id,
+			Active:    true,
+			CreatedBy: 1,
+			CreatedAt: time.Now().UTC().Truncate(time.Second),
+		}
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		repo := newRepo(t)
+		webhooks, err := repo.GetAllWebhooks()
+		if err != nil || len(webhooks) != 0 {
+			t.Errorf("GetAllWebhooks on empty repository: got %+v, %v", webhooks, err)
+		}
+	})
+
+	t.Run("CreateGetAndUpdate", func(t *testing.T) {
+		repo := newRepo(t)
+		webhook := newWebhook("w-1")
+		if _, err := repo.CreateWebhook(webhook); err != nil {
+			t.Fatalf("CreateWebhook: %v", err)
+		}
+		got, err := repo.GetWebhook("w-1")
+		if err != nil || got.URL != webhook.URL || got.Secret != webhook.Secret || !got.Wants(entity.EventBookCreated) {
+			t.Fatalf("GetWebhook: got %+v, %v", got, err)
+		}
+
+		got.Active = false
+		got.Failures = 3
+		if _, err := repo.UpdateWebhook(got); err != nil {
+			t.Fatalf("UpdateWebhook: %v", err)
+		}
+		if got, _ := repo.GetWebhook("w-1"); got.Active || got.Failures != 3 {
+			t.Errorf("Expected the update to be stored, got %+v", got)
+		}
+		if _, err := repo.UpdateWebhook(newWebhook("missing")); !errors.Is(err, repository.ErrWebhookNotFound) {
+			t.Errorf("UpdateWebhook: expected ErrWebhookNotFound, got %v", err)
+		}
+	})
+
+	t.Run("NotFoundAndDelete", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.GetWebhook("missing"); !errors.Is(err, repository.ErrWebhookNotFound) {
+			t.Errorf("GetWebhook: expected ErrWebhookNotFound, got %v", err)
+		}
+		if err := repo.DeleteWebhook("missing"); !errors.Is(err, repository.ErrWebhookNotFound) {
+			t.Errorf("DeleteWebhook: expected ErrWebhookNotFound, got %v", err)
+		}
+		repo.CreateWebhook(newWebhook("w-1"))
+		if err := repo.DeleteWebhook("w-1"); err != nil {
+			t.Fatalf("DeleteWebhook: %v", err)
+		}
+		if _, err := repo.GetWebhook("w-1"); !errors.Is(err, repository.ErrWebhookNotFound) {
+			t.Errorf("Expected deleted webhook to be gone, got %v", err)
+		}
+	})
+
+	t.Run("Ordering", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, id := range []string{"w-3", "w-1", "w-2"} {
+			repo.CreateWebhook(newWebhook(id))
+		}
+		webhooks, err := repo.GetAllWebhooks()
+		if err != nil || len(webhooks) != 3 {
+			t.Fatalf("GetAllWebhooks: got %+v, %v", webhooks, err)
+		}
+		for i, want := range []string{"w-1", "w-2", "w-3"} {
+			if webhooks[i].ID != want {
+				t.Errorf("Expected %s at position %d, got %s", want, i, webhooks[i].ID)
+			}
+		}
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		repo := newRepo(t)
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				webhook := newWebhook(fmt.Sprintf("w-%02d", i))
+				repo.CreateWebhook(webhook)
+				webhook.Failures = 1
+				repo.UpdateWebhook(webhook)
+				repo.GetAllWebhooks()
+				if i%2 == 0 {
+					repo.DeleteWebhook(webhook.ID)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		webhooks, err := repo.GetAllWebhooks()
+		if err != nil || len(webhooks) != concurrency/2 {
+			t.Fatalf("Expected %d webhooks, got %d, %v", concurrency/2, len(webhooks), err)
+		}
+	})
+}
+
+// RunWebhookDeliveryRepository checks newRepo against the
+// WebhookDeliveryRepository contract.
+func RunWebhookDeliveryRepository(t *testing.T, newRepo func(t *testing.T) repository.WebhookDeliveryRepository) {
+	newDelivery := func(id, webhookID string) entity.WebhookDelivery {
+		return entity.WebhookDelivery{
+			ID:         id,
+			WebhookID:  webhookID,
+			EventID:    1,
+			EventType:  entity.EventBookCreated,
+			Attempt:    1,
+			Time:       time.Now().UTC().Truncate(time.Second),
+			StatusCode: http.StatusOK,
+			Success:    true,
+		}
+	}
+	newPending := func(id string, due time.Time) entity.PendingWebhookDelivery {
+		return entity.PendingWebhookDelivery{
+			ID:        id,
+			WebhookID: "w-1",
+			Event:     entity.Event{ID: 1, Type: entity.EventBookCreated, Data: json.RawMessage(`{"uuid":"b-1"}`)},
+			Attempt:   1,
+			DueAt:     due.UTC().Truncate(time.Second),
+		}
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		repo := newRepo(t)
+		if deliveries, err := repo.GetAllWebhookDeliveries(); err != nil || len(deliveries) != 0 {
+			t.Errorf("GetAllWebhookDeliveries on empty repository: got %+v, %v", deliveries, err)
+		}
+		if deliveries, err := repo.GetWebhookDeliveries("w-1"); err != nil || len(deliveries) != 0 {
+			t.Errorf("GetWebhookDeliveries on empty repository: got %+v, %v", deliveries, err)
+		}
+		if pending, err := repo.GetPendingWebhookDeliveries(); err != nil || len(pending) != 0 {
+			t.Errorf("GetPendingWebhookDeliveries on empty repository: got %+v, %v", pending, err)
+		}
+	})
+
+	t.Run("Log", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, d := range []entity.WebhookDelivery{newDelivery("d-3", "w-2"), newDelivery("d-2", "w-1"), newDelivery("d-1", "w-1")} {
+			if err := repo.AddWebhookDelivery(d); err != nil {
+				t.Fatalf("AddWebhookDelivery: %v", err)
+			}
+		}
+		deliveries, err := repo.GetWebhookDeliveries("w-1")
+		if err != nil || len(deliveries) != 2 || deliveries[0].ID != "d-2" || deliveries[1].ID != "d-1" || !deliveries[0].Success {
+			t.Fatalf("GetWebhookDeliveries: expected d-2 and d-1 in the order added, got %+v, %v", deliveries, err)
+		}
+		all, err := repo.GetAllWebhookDeliveries()
+		if err != nil || len(all) != 3 || all[0].ID != "d-2" || all[1].ID != "d-1" || all[2].ID != "d-3" {
+			t.Fatalf("GetAllWebhookDeliveries: expected w-1's deliveries before w-2's, got %+v, %v", all, err)
+		}
+
+		failed := newDelivery("d-2", "w-1")
+		failed.Success = false
+		repo.AddWebhookDelivery(failed)
+		if deliveries, _ := repo.GetWebhookDeliveries("w-1"); len(deliveries) != 2 {
+			t.Errorf("Expected adding an existing ID to replace it, got %+v", deliveries)
+		}
+
+		if err := repo.DeleteWebhookDelivery("d-2"); err != nil {
+			t.Fatalf("DeleteWebhookDelivery: %v", err)
+		}
+		if deliveries, _ := repo.GetWebhookDeliveries("w-1"); len(deliveries) != 1 || deliveries[0].ID != "d-1" {
+			t.Errorf("Expected only d-1 to be left, got %+v", deliveries)
+		}
+		if err := repo.DeleteWebhookDelivery("d-2"); !errors.Is(err, repository.ErrWebhookDeliveryNotFound) {
+			t.Errorf("DeleteWebhookDelivery twice: expected ErrWebhookDeliveryNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Pending", func(t *testing.T) {
+		repo := newRepo(t)
+		now := time.Now()
+		repo.SavePendingWebhookDelivery(newPending("p-1", now.Add(time.Minute)))
+		repo.SavePendingWebhookDelivery(newPending("p-2", now))
+		pending, err := repo.GetPendingWebhookDeliveries()
+		if err != nil || len(pending) != 2 || pending[0].ID != "p-2" || pending[1].ID != "p-1" {
+			t.Fatalf("GetPendingWebhookDeliveries: expected p-2 first, got %+v, %v", pending, err)
+		}
+		if string(pending[0].Event.Data) != `{"uuid":"b-1"}` {
+			t.Errorf("Expected the event to be stored, got %+v", pending[0].Event)
+		}
+
+		retry := newPending("p-2", now.Add(2*time.Minute))
+		retry.Attempt = 2
+		if err := repo.SavePendingWebhookDelivery(retry); err != nil {
+			t.Fatalf("SavePendingWebhookDelivery: %v", err)
+		}
+		pending, _ = repo.GetPendingWebhookDeliveries()
+		if len(pending) != 2 || pending[1].ID != "p-2" || pending[1].Attempt != 2 {
+			t.Errorf("Expected saving an existing ID to replace it, got %+v", pending)
+		}
+
+		if err := repo.DeletePendingWebhookDelivery("p-1"); err != nil {
+			t.Fatalf("DeletePendingWebhookDelivery: %v", err)
+		}
+		if err := repo.DeletePendingWebhookDelivery("p-1"); !errors.Is(err, repository.ErrWebhookDeliveryNotFound) {
+			t.Errorf("DeletePendingWebhookDelivery twice: expected ErrWebhookDeliveryNotFound, got %v", err)
+		}
+		if pending, _ := repo.GetPendingWebhookDeliveries(); len(pending) != 1 {
+			t.Errorf("Expected one pending delivery, got %+v", pending)
+		}
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		repo := newRepo(t)
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				id := fmt.Sprintf("d-%02d", i)
+				repo.AddWebhookDelivery(newDelivery(id, "w-1"))
+				repo.SavePendingWebhookDelivery(newPending(id, time.Now()))
+				repo.GetWebhookDeliveries("w-1")
+				if i%2 == 0 {
+					repo.DeleteWebhookDelivery(id)
+					repo.DeletePendingWebhookDelivery(id)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		deliveries, err := repo.GetWebhookDeliveries("w-1")
+		if err != nil || len(deliveries) != concurrency/2 {
+			t.Fatalf("Expected %d deliveries, got %d, %v", concurrency/2, len(deliveries), err)
+		}
+		pending, err := repo.GetPendingWebhookDeliveries()
+		if err != nil || len(pending) != concurrency/2 {
+			t.Fatalf("Expected %d pending deliveries, got %d, %v", concurrency/2, len(pending), err)
+		}
+	})
+}
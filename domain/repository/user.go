@@ -1,14 +1,42 @@
 package repository
 
-import "github.com/biswasurmi/book-cli/domain/entity"
-
+import (
+	"time"
 
+	"github.com/biswasurmi/book-cli/domain/entity"
+)
 
+// UserRepository stores users keyed by ID. GetAllUsers returns users
+// ordered by ID; lookups, Update and Delete return ErrUserNotFound for an
+// unknown user, and Authenticate returns ErrInvalidCredentials for an
+// unknown email or wrong password. Emails are stored normalized with
+// entity.NormalizeEmail and matched case-insensitively. CreateUser and
+// Update return ErrEmailTaken or ErrUsernameTaken when another user already
+// has the email or (non-empty) username; creating a user with an existing
+// ID replaces that user. Implementations must be safe for
+// concurrent use. repositorytest.RunUserRepository checks these rules.
+//
+// Delete moves a user to the trash by setting their DeletedAt. Users in
+// the trash are left out of GetAllUsers, treated as unknown by lookups,
+// Update, Delete and Authenticate, but keep their email and username
+// taken. GetDeletedUsers lists them ordered by ID. RestoreUser takes a
+// user out of the trash and returns ErrUserNotFound for a user that is not
+// in it. PurgeUser removes a user for good, deleted or not.
+// PurgeDeletedUser only removes a user who is in the trash and was deleted
+// no later than deletedBefore, and returns ErrUserNotFound otherwise, so a
+// user restored in the meantime survives.
 type UserRepository interface {
+	GetAllUsers() ([]entity.User, error)
 	CreateUser(user entity.User) (entity.User, error)
 	GetByID (id int64) (entity.User, error)
 	GetByEmail (email string) (entity.User, error)
 	Update(user entity.User) (entity.User, error)
 	Delete(id int64) error
+	// Authenticate only understands bcrypt hashes. The server verifies
+	// passwords with service.PasswordHasher, which also reads argon2id.
 	Authenticate(email, password string) (entity.User, error)
+	GetDeletedUsers() ([]entity.User, error)
+	RestoreUser(id int64) (entity.User, error)
+	PurgeUser(id int64) error
+	PurgeDeletedUser(id int64, deletedBefore time.Time) error
 }
\ No newline at end of file
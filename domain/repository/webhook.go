@@ -0,0 +1,16 @@
+package repository
+
+import "github.com/biswasurmi/book-cli/domain/entity"
+
+// WebhookRepository stores webhooks keyed by ID. GetAllWebhooks returns
+// webhooks ordered by ID; GetWebhook, UpdateWebhook and DeleteWebhook
+// return ErrWebhookNotFound for an unknown ID. Creating a webhook with an
+// existing ID replaces it. Implementations must be safe for concurrent
+// use. repositorytest.RunWebhookRepository checks these rules.
+type WebhookRepository interface {
+	GetAllWebhooks() ([]entity.Webhook, error)
+	CreateWebhook(webhook entity.Webhook) (entity.Webhook, error)
+	GetWebhook(id string) (entity.Webhook, error)
+	UpdateWebhook(webhook entity.Webhook) (entity.Webhook, error)
+	DeleteWebhook(id string) error
+}
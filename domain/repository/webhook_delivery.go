@@ -0,0 +1,22 @@
+package repository
+
+import "github.com/biswasurmi/book-cli/domain/entity"
+
+// WebhookDeliveryRepository stores the delivery log of webhooks and the
+// deliveries still to be made, both keyed by ID. GetWebhookDeliveries
+// returns a webhook's logged deliveries in the order they were added, and
+// GetAllWebhookDeliveries those of every webhook ordered by webhook ID.
+// GetPendingWebhookDeliveries returns pending deliveries ordered by DueAt.
+// Adding a delivery or saving a pending one with an existing ID replaces
+// it; the deletes return ErrWebhookDeliveryNotFound for an unknown ID.
+// Implementations must be safe for concurrent use.
+// repositorytest.RunWebhookDeliveryRepository checks these rules.
+type WebhookDeliveryRepository interface {
+	AddWebhookDelivery(delivery entity.WebhookDelivery) error
+	GetWebhookDeliveries(webhookID string) ([]entity.WebhookDelivery, error)
+	GetAllWebhookDeliveries() ([]entity.WebhookDelivery, error)
+	DeleteWebhookDelivery(id string) error
+	SavePendingWebhookDelivery(pending entity.PendingWebhookDelivery) error
+	GetPendingWebhookDeliveries() ([]entity.PendingWebhookDelivery, error)
+	DeletePendingWebhookDelivery(id string) error
+}
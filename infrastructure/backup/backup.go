@@ -0,0 +1,191 @@
+// Package backup writes every record held by a set of repositories into a
+// versioned, checksummed archive and restores such archives into any
+// backend.
+//
+// An archive is a gzip compressed tar file holding one JSON file per
+// collection plus manifest.json, which records the format version and the
+// SHA-256 checksum and record count of every collection file.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/repository"
+)
+
+// FormatVersion is the archive format written by this package. Archives
+// with a newer version are rejected.
+const FormatVersion = 1
+
+const manifestName = "manifest.json"
+
+type Manifest struct {
+	Version     int                       `json:"version"`
+	CreatedAt   time.Time                 `json:"createdAt"`
+	Collections map[string]CollectionInfo `json:"collections"`
+}
+
+type CollectionInfo struct {
+	File   string `json:"file"`
+	Count  int    `json:"count"`
+	SHA256 string `json:"sha256"`
+}
+
+// Archive is a verified backup read into memory.
+type Archive struct {
+	Manifest Manifest
+	files    map[string][]byte
+}
+
+// Write exports all collections from repos into w.
+func Write(w io.Writer, repos *repository.Repositories) (Manifest, error) {
+	manifest := Manifest{
+		Version:     FormatVersion,
+		CreatedAt:   time.Now().UTC(),
+		Collections: make(map[string]CollectionInfo),
+	}
+
+	files := make(map[string][]byte)
+	for _, c := range collections {
+		records, count, err := c.export(repos)
+		if err != nil {
+			return Manifest{}, fmt.Errorf("exporting %s: %w", c.name, err)
+		}
+		data, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return Manifest{}, fmt.Errorf("encoding %s: %w", c.name, err)
+		}
+		sum := sha256.Sum256(data)
+		name := c.name + ".json"
+		files[name] = data
+		manifest.Collections[c.name] = CollectionInfo{File: name, Count: count, SHA256: hex.EncodeToString(sum[:])}
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	add := func(name string, data []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: manifest.CreatedAt}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	if err := add(manifestName, manifestData); err != nil {
+		return Manifest{}, err
+	}
+	for _, c := range collections {
+		name := manifest.Collections[c.name].File
+		if err := add(name, files[name]); err != nil {
+			return Manifest{}, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return Manifest{}, err
+	}
+	return manifest, gz.Close()
+}
+
+// Read loads an archive and verifies its version and checksums.
+func Read(r io.Reader) (*Archive, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	defer gz.Close()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading archive: %w", err)
+		}
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, tr); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", hdr.Name, err)
+		}
+		files[hdr.Name] = buf.Bytes()
+	}
+
+	manifestData, ok := files[manifestName]
+	if !ok {
+		return nil, errors.New("archive has no manifest")
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if manifest.Version < 1 || manifest.Version > FormatVersion {
+		return nil, fmt.Errorf("unsupported archive version %d (this build supports up to %d)", manifest.Version, FormatVersion)
+	}
+
+	for name, info := range manifest.Collections {
+		data, ok := files[info.File]
+		if !ok {
+			return nil, fmt.Errorf("collection %s: file %s missing from archive", name, info.File)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != info.SHA256 {
+			return nil, fmt.Errorf("collection %s: checksum mismatch, archive is corrupt", name)
+		}
+	}
+
+	return &Archive{Manifest: manifest, files: files}, nil
+}
+
+// RestoreOptions controls how an archive is applied to existing data.
+type RestoreOptions struct {
+	// Overwrite replaces records that already exist in the target. Without
+	// it restoring into a store that holds any data fails.
+	Overwrite bool
+}
+
+// Restore writes every collection of the archive into repos and returns the
+// number of records restored per collection.
+func Restore(repos *repository.Repositories, archive *Archive, opts RestoreOptions) (map[string]int, error) {
+	if !opts.Overwrite {
+		for _, c := range collections {
+			n, err := c.count(repos)
+			if err != nil {
+				return nil, fmt.Errorf("inspecting %s: %w", c.name, err)
+			}
+			if n > 0 {
+				return nil, fmt.Errorf("target store already contains %s; restore with overwrite to merge", c.name)
+			}
+		}
+	}
+
+	restored := make(map[string]int)
+	for _, c := range collections {
+		info, ok := archive.Manifest.Collections[c.name]
+		if !ok {
+			// Archives from older versions may lack newer collections
+			continue
+		}
+		n, err := c.restore(repos, archive.files[info.File], opts.Overwrite)
+		if err != nil {
+			return restored, fmt.Errorf("restoring %s: %w", c.name, err)
+		}
+		restored[c.name] = n
+	}
+	return restored, nil
+}
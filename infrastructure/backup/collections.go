@@ -0,0 +1,242 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+)
+
+// collection describes how one kind of record is exported from and
+// restored into a set of repositories.
+type collection struct {
+	name string
+	// export returns the records in a stable order.
+	export func(repos *repository.Repositories) (interface{}, int, error)
+	// count returns how many records already exist in the target.
+	count func(repos *repository.Repositories) (int, error)
+	// restore writes the records, replacing existing ones when overwrite
+	// is set.
+	restore func(repos *repository.Repositories, data []byte, overwrite bool) (int, error)
+}
+
+var collections = []collection{
+	{
+		name: "books",
+		export: func(repos *repository.Repositories) (interface{}, int, error) {
+			books, err := allBooks(repos)
+			if err != nil {
+				return nil, 0, err
+			}
+			sort.Slice(books, func(i, j int) bool { return books[i].UUID < books[j].UUID })
+			return books, len(books), nil
+		},
+		count: func(repos *repository.Repositories) (int, error) {
+			books, err := allBooks(repos)
+			return len(books), err
+		},
+		restore: func(repos *repository.Repositories, data []byte, overwrite bool) (int, error) {
+			var books []entity.Book
+			if err := json.Unmarshal(data, &books); err != nil {
+				return 0, err
+			}
+			for _, book := range books {
+				// CreateBook replaces an existing book and keeps DeletedAt,
+				// so books in the trash stay there
+				if _, err := repos.BookRepository.CreateBook(book); err != nil {
+					return 0, err
+				}
+			}
+			return len(books), nil
+		},
+	},
+	{
+		name: "users",
+		export: func(repos *repository.Repositories) (interface{}, int, error) {
+			users, err := allUsers(repos)
+			if err != nil {
+				return nil, 0, err
+			}
+			sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+			return users, len(users), nil
+		},
+		count: func(repos *repository.Repositories) (int, error) {
+			users, err := allUsers(repos)
+			return len(users), err
+		},
+		restore: func(repos *repository.Repositories, data []byte, overwrite bool) (int, error) {
+			var users []entity.User
+			if err := json.Unmarshal(data, &users); err != nil {
+				return 0, err
+			}
+			for _, user := range users {
+				// Like books, users keep their DeletedAt
+				if _, err := repos.UserRepository.CreateUser(user); err != nil {
+					return 0, err
+				}
+			}
+			return len(users), nil
+		},
+	},
+	{
+		name: "api_keys",
+		export: func(repos *repository.Repositories) (interface{}, int, error) {
+			keys, err := repos.APIKeyRepository.GetAllAPIKeys()
+			if err != nil {
+				return nil, 0, err
+			}
+			sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+			return keys, len(keys), nil
+		},
+		count: func(repos *repository.Repositories) (int, error) {
+			keys, err := repos.APIKeyRepository.GetAllAPIKeys()
+			return len(keys), err
+		},
+		restore: func(repos *repository.Repositories, data []byte, overwrite bool) (int, error) {
+			var keys []entity.APIKey
+			if err := json.Unmarshal(data, &keys); err != nil {
+				return 0, err
+			}
+			for _, key := range keys {
+				// Creating with an existing ID replaces the key
+				if _, err := repos.APIKeyRepository.CreateAPIKey(key); err != nil {
+					return 0, err
+				}
+			}
+			return len(keys), nil
+		},
+	},
+	{
+		name: "oauth_clients",
+		export: func(repos *repository.Repositories) (interface{}, int, error) {
+			clients, err := repos.OAuthClientRepository.GetAllOAuthClients()
+			if err != nil {
+				return nil, 0, err
+			}
+			sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+			return clients, len(clients), nil
+		},
+		count: func(repos *repository.Repositories) (int, error) {
+			clients, err := repos.OAuthClientRepository.GetAllOAuthClients()
+			return len(clients), err
+		},
+		restore: func(repos *repository.Repositories, data []byte, overwrite bool) (int, error) {
+			var clients []entity.OAuthClient
+			if err := json.Unmarshal(data, &clients); err != nil {
+				return 0, err
+			}
+			for _, client := range clients {
+				// Creating with an existing ID replaces the client
+				if _, err := repos.OAuthClientRepository.CreateOAuthClient(client); err != nil {
+					return 0, err
+				}
+			}
+			return len(clients), nil
+		},
+	},
+	{
+		name: "audit",
+		export: func(repos *repository.Repositories) (interface{}, int, error) {
+			events, err := repos.AuditRepository.GetAuditEvents()
+			if err != nil {
+				return nil, 0, err
+			}
+			return events, len(events), nil
+		},
+		count: func(repos *repository.Repositories) (int, error) {
+			events, err := repos.AuditRepository.GetAuditEvents()
+			return len(events), err
+		},
+		restore: func(repos *repository.Repositories, data []byte, overwrite bool) (int, error) {
+			var events []entity.AuditEvent
+			if err := json.Unmarshal(data, &events); err != nil {
+				return 0, err
+			}
+			for _, event := range events {
+				// The log is append-only, so events already present are
+				// kept as they are even when overwriting
+				err := repos.AuditRepository.AppendAuditEvent(event)
+				if err != nil && !errors.Is(err, repository.ErrAuditEventExists) {
+					return 0, err
+				}
+			}
+			return len(events), nil
+		},
+	},
+	{
+		name: "book_revisions",
+		export: func(repos *repository.Repositories) (interface{}, int, error) {
+			revisions, err := repos.BookRevisionRepository.GetAllBookRevisions()
+			if err != nil {
+				return nil, 0, err
+			}
+			return revisions, len(revisions), nil
+		},
+		count: func(repos *repository.Repositories) (int, error) {
+			revisions, err := repos.BookRevisionRepository.GetAllBookRevisions()
+			return len(revisions), err
+		},
+		restore: func(repos *repository.Repositories, data []byte, overwrite bool) (int, error) {
+			var revisions []entity.BookRevision
+			if err := json.Unmarshal(data, &revisions); err != nil {
+				return 0, err
+			}
+			for _, revision := range revisions {
+				// Revisions are immutable, so existing ones are kept
+				err := repos.BookRevisionRepository.AddBookRevision(revision)
+				if err != nil && !errors.Is(err, repository.ErrBookRevisionExists) {
+					return 0, err
+				}
+			}
+			return len(revisions), nil
+		},
+	}, {
+		name: "webhooks",
+		export: func(repos *repository.Repositories) (interface{}, int, error) {
+			webhooks, err := repos.WebhookRepository.GetAllWebhooks()
+			if err != nil {
+				return nil, 0, err
+			}
+			return webhooks, len(webhooks), nil
+		},
+		count: func(repos *repository.Repositories) (int, error) {
+			webhooks, err := repos.WebhookRepository.GetAllWebhooks()
+			return len(webhooks), err
+		},
+		restore: func(repos *repository.Repositories, data []byte, overwrite bool) (int, error) {
+			var webhooks []entity.Webhook
+			if err := json.Unmarshal(data, &webhooks); err != nil {
+				return 0, err
+			}
+			for _, webhook := range webhooks {
+				// Creating with an existing ID replaces the webhook
+				if _, err := repos.WebhookRepository.CreateWebhook(webhook); err != nil {
+					return 0, err
+				}
+			}
+			return len(webhooks), nil
+		},
+	},
+}
+
+// allBooks returns the books including those in the trash.
+func allBooks(repos *repository.Repositories) ([]entity.Book, error) {
+	books, err := repos.BookRepository.GetAllBooks()
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := repos.BookRepository.GetDeletedBooks()
+	return append(books, deleted...), err
+}
+
+// allUsers returns the users including those in the trash.
+func allUsers(repos *repository.Repositories) ([]entity.User, error) {
+	users, err := repos.UserRepository.GetAllUsers()
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := repos.UserRepository.GetDeletedUsers()
+	return append(users, deleted...), err
+}
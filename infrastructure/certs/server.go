@@ -0,0 +1,60 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/biswasurmi/book-cli/config"
+)
+
+// ServerConfig builds the server's TLS configuration. File based
+// certificates are watched for changes until ctx is cancelled.
+func ServerConfig(ctx context.Context, cfg config.TLS) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	switch {
+	case cfg.SelfSigned:
+		cert, err := SelfSigned(cfg.SelfSignedHosts, cfg.SelfSignedValidFor)
+		if err != nil {
+			return nil, fmt.Errorf("generating self-signed certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	case cfg.CertFile != "":
+		reloader, err := NewReloader(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		go reloader.Watch(ctx, cfg.ReloadInterval)
+		tlsConfig.GetCertificate = reloader.GetCertificate
+	default:
+		return nil, errors.New("no certificate configured")
+	}
+
+	if cfg.ClientAuth == "" || cfg.ClientAuth == config.ClientAuthNone {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", cfg.ClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+
+	if cfg.ClientAuth == config.ClientAuthRequire {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	} else {
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,37 @@
+package mail
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer returns a mailer that writes every message as an .eml file
+// into dir, which is created if needed.
+func NewFileMailer(dir, from string) Mailer {
+	return &fileMailer{dir: dir, from: from}
+}
+
+func (m *fileMailer) Send(msg Message) error {
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return err
+	}
+	now := time.Now()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	name := now.UTC().Format("20060102T150405.000000000") + "-" + hex.EncodeToString(suffix) + ".eml"
+
+	// Write under a temporary name so readers never see half a message
+	tmp := filepath.Join(m.dir, "."+name)
+	if err := os.WriteFile(tmp, format(m.from, msg, now), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(m.dir, name))
+}
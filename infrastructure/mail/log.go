@@ -0,0 +1,21 @@
+package mail
+
+import (
+	"log"
+	"time"
+)
+
+type logMailer struct {
+	from string
+}
+
+// NewLogMailer returns a mailer that writes messages to the standard
+// logger instead of sending them.
+func NewLogMailer(from string) Mailer {
+	return &logMailer{from: from}
+}
+
+func (m *logMailer) Send(msg Message) error {
+	log.Printf("mail: not sending, log driver in use\n%s", format(m.from, msg, time.Now()))
+	return nil
+}
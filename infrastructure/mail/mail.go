@@ -0,0 +1,55 @@
+// Package mail delivers the emails the server sends, such as password
+// reset links.
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/biswasurmi/book-cli/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends a plain text message.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New returns the mailer selected in cfg, which must have passed
+// config.Validate.
+func New(cfg config.Mail) Mailer {
+	switch cfg.Driver {
+	case config.MailSMTP:
+		return NewSMTPMailer(cfg)
+	case config.MailFile:
+		return NewFileMailer(cfg.Dir, cfg.From)
+	default:
+		return NewLogMailer(cfg.From)
+	}
+}
+
+// headerValue strips line breaks so a value cannot inject extra headers.
+var headerValue = strings.NewReplacer("\r", "", "\n", "")
+
+// format renders msg as an RFC 5322 message.
+func format(from string, msg Message, now time.Time) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", headerValue.Replace(from))
+	fmt.Fprintf(&buf, "To: %s\r\n", headerValue.Replace(msg.To))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerValue.Replace(msg.Subject)))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(msg.Body)
+	return buf.Bytes()
+}
@@ -0,0 +1,34 @@
+package mail
+
+import (
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/biswasurmi/book-cli/config"
+)
+
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer returns a mailer that relays through the configured SMTP
+// server, upgrading the connection with STARTTLS when the server offers it.
+// Credentials are only sent over TLS or to localhost.
+func NewSMTPMailer(cfg config.Mail) Mailer {
+	m := &smtpMailer{
+		addr: net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+		from: cfg.From,
+	}
+	if cfg.SMTPUsername != "" {
+		m.auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+	return m
+}
+
+func (m *smtpMailer) Send(msg Message) error {
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, format(m.from, msg, time.Now()))
+}
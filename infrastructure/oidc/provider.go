@@ -0,0 +1,326 @@
+// Package oidc is a minimal OpenID Connect relying party: it discovers a
+// provider's endpoints, builds authorization URLs, exchanges codes and
+// verifies ID tokens against the provider's published keys.
+package oidc
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+// keyRefreshInterval limits how often the key set is fetched again when a
+// token names an unknown key, so forged key IDs cannot make the server
+// hammer the provider.
+const keyRefreshInterval = time.Minute
+
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	HTTPClient   *http.Client
+}
+
+// Metadata is the part of the discovery document the relying party uses.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the verified claims of an ID token.
+type Claims struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	// AMR lists the authentication methods the provider reports.
+	AMR []string
+}
+
+// Provider is safe for concurrent use. Discovery happens on first use, so
+// the server starts even while the provider is unreachable.
+type Provider struct {
+	cfg        Config
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	metadata    *Metadata
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+func New(cfg Config) *Provider {
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	cfg.IssuerURL = strings.TrimRight(cfg.IssuerURL, "/")
+	return &Provider{cfg: cfg, httpClient: httpClient}
+}
+
+// Metadata returns the provider's discovery document, fetching it once.
+func (p *Provider) Metadata(ctx context.Context) (Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return *p.metadata, nil
+	}
+
+	var m Metadata
+	if err := p.getJSON(ctx, p.cfg.IssuerURL+"/.well-known/openid-configuration", &m); err != nil {
+		return Metadata{}, fmt.Errorf("oidc discovery: %w", err)
+	}
+	// The issuer must be exactly the one configured (OpenID Connect
+	// Discovery section 4.3)
+	if strings.TrimRight(m.Issuer, "/") != p.cfg.IssuerURL {
+		return Metadata{}, fmt.Errorf("oidc discovery: issuer %q does not match %q", m.Issuer, p.cfg.IssuerURL)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return Metadata{}, errors.New("oidc discovery: document lacks required endpoints")
+	}
+	p.metadata = &m
+	return m, nil
+}
+
+// AuthCodeURL returns the URL to send the user to. codeChallenge is the
+// S256 PKCE challenge.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	m, err := p.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(m.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// Exchange trades an authorization code for the raw ID token.
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	m, err := p.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("oidc token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("oidc token request failed: %d %s %s", resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", errors.New("oidc token response has no id_token")
+	}
+	return body.IDToken, nil
+}
+
+// Verify checks the ID token's signature, issuer, audience, expiry and
+// nonce (OpenID Connect Core section 3.1.3.7). Only RS256 is accepted.
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (Claims, error) {
+	m, err := p.Metadata(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	parser := &jwt.Parser{ValidMethods: []string{jwt.SigningMethodRS256.Alg()}}
+	token, err := parser.Parse(rawIDToken, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, m.JWKSURI, kid)
+	})
+	if err != nil || !token.Valid {
+		return Claims{}, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	claims := token.Claims.(jwt.MapClaims)
+
+	if iss, _ := claims["iss"].(string); iss != m.Issuer {
+		return Claims{}, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, iss)
+	}
+	if !audienceContains(claims["aud"], p.cfg.ClientID) {
+		return Claims{}, fmt.Errorf("%w: not issued for this client", ErrInvalidIDToken)
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != p.cfg.ClientID {
+		return Claims{}, fmt.Errorf("%w: authorized party %q", ErrInvalidIDToken, azp)
+	}
+	if _, ok := claims["exp"]; !ok {
+		return Claims{}, fmt.Errorf("%w: no expiry", ErrInvalidIDToken)
+	}
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return Claims{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	out := Claims{Issuer: m.Issuer}
+	out.Subject, _ = claims["sub"].(string)
+	out.Email, _ = claims["email"].(string)
+	out.Name, _ = claims["name"].(string)
+	if out.Subject == "" {
+		return Claims{}, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+	// Some providers send email_verified as a string
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		out.EmailVerified = v
+	case string:
+		out.EmailVerified = v == "true"
+	}
+	if amr, ok := claims["amr"].([]interface{}); ok {
+		for _, method := range amr {
+			if s, ok := method.(string); ok {
+				out.AMR = append(out.AMR, s)
+			}
+		}
+	}
+	return out, nil
+}
+
+func audienceContains(aud interface{}, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key returns the verification key with the given ID, fetching the key set
+// again if it is unknown.
+func (p *Provider) key(ctx context.Context, jwksURI, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookup(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < keyRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	keys, err := p.fetchKeys(ctx, jwksURI)
+	p.keysFetched = time.Now()
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	if key, ok := p.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookup finds a key by ID. A token without a key ID may use the only key.
+func (p *Provider) lookup(kid string) (*rsa.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) fetchKeys(ctx context.Context, jwksURI string) (map[string]*rsa.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc keys: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}
+	}
+	return keys, nil
+}
+
+// getJSON must be called with p.mu held, which also keeps concurrent
+// logins from fetching the same document at once.
+func (p *Provider) getJSON(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
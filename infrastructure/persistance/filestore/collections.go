@@ -0,0 +1,214 @@
+package filestore
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+)
+
+// collection knows how to replay records of one kind into the in-memory
+// repositories and how to dump them into a snapshot.
+type collection struct {
+	name string
+	// put stores the record exactly as logged, replacing any existing one.
+	put  func(repos *repository.Repositories, data json.RawMessage) error
+	del  func(repos *repository.Repositories, key string) error
+	dump func(repos *repository.Repositories) (interface{}, error)
+}
+
+var collections = []collection{
+	{
+		name: "books",
+		put: func(repos *repository.Repositories, data json.RawMessage) error {
+			var book entity.Book
+			if err := json.Unmarshal(data, &book); err != nil {
+				return err
+			}
+			_, err := repos.BookRepository.CreateBook(book)
+			return err
+		},
+		del: func(repos *repository.Repositories, key string) error {
+			repos.BookRepository.PurgeBook(key)
+			return nil
+		},
+		dump: func(repos *repository.Repositories) (interface{}, error) {
+			books, err := repos.BookRepository.GetAllBooks()
+			if err != nil {
+				return nil, err
+			}
+			deleted, err := repos.BookRepository.GetDeletedBooks()
+			return append(books, deleted...), err
+		},
+	},
+	{
+		name: "users",
+		put: func(repos *repository.Repositories, data json.RawMessage) error {
+			var user entity.User
+			if err := json.Unmarshal(data, &user); err != nil {
+				return err
+			}
+			repos.UserRepository.PurgeUser(user.ID)
+			_, err := repos.UserRepository.CreateUser(user)
+			return err
+		},
+		del: func(repos *repository.Repositories, key string) error {
+			id, err := strconv.ParseInt(key, 10, 64)
+			if err != nil {
+				return err
+			}
+			repos.UserRepository.PurgeUser(id)
+			return nil
+		},
+		dump: func(repos *repository.Repositories) (interface{}, error) {
+			users, err := repos.UserRepository.GetAllUsers()
+			if err != nil {
+				return nil, err
+			}
+			deleted, err := repos.UserRepository.GetDeletedUsers()
+			return append(users, deleted...), err
+		},
+	},
+	{
+		name: "api_keys",
+		put: func(repos *repository.Repositories, data json.RawMessage) error {
+			var key entity.APIKey
+			if err := json.Unmarshal(data, &key); err != nil {
+				return err
+			}
+			_, err := repos.APIKeyRepository.CreateAPIKey(key)
+			return err
+		},
+		del: func(repos *repository.Repositories, key string) error {
+			repos.APIKeyRepository.DeleteAPIKey(key)
+			return nil
+		},
+		dump: func(repos *repository.Repositories) (interface{}, error) {
+			return repos.APIKeyRepository.GetAllAPIKeys()
+		},
+	},
+	{
+		name: "oauth_clients",
+		put: func(repos *repository.Repositories, data json.RawMessage) error {
+			var client entity.OAuthClient
+			if err := json.Unmarshal(data, &client); err != nil {
+				return err
+			}
+			_, err := repos.OAuthClientRepository.CreateOAuthClient(client)
+			return err
+		},
+		del: func(repos *repository.Repositories, key string) error {
+			repos.OAuthClientRepository.DeleteOAuthClient(key)
+			return nil
+		},
+		dump: func(repos *repository.Repositories) (interface{}, error) {
+			return repos.OAuthClientRepository.GetAllOAuthClients()
+		},
+	},
+	{
+		name: "audit",
+		put: func(repos *repository.Repositories, data json.RawMessage) error {
+			var event entity.AuditEvent
+			if err := json.Unmarshal(data, &event); err != nil {
+				return err
+			}
+			err := repos.AuditRepository.AppendAuditEvent(event)
+			if errors.Is(err, repository.ErrAuditEventExists) {
+				// Events never change, so a repeated record is the same event
+				return nil
+			}
+			return err
+		},
+		del: func(repos *repository.Repositories, key string) error {
+			return errors.New("audit events cannot be deleted")
+		},
+		dump: func(repos *repository.Repositories) (interface{}, error) {
+			return repos.AuditRepository.GetAuditEvents()
+		},
+	},
+	{
+		name: "book_revisions",
+		put: func(repos *repository.Repositories, data json.RawMessage) error {
+			var revision entity.BookRevision
+			if err := json.Unmarshal(data, &revision); err != nil {
+				return err
+			}
+			err := repos.BookRevisionRepository.AddBookRevision(revision)
+			if errors.Is(err, repository.ErrBookRevisionExists) {
+				// Revisions never change, so a repeated record is the same one
+				return nil
+			}
+			return err
+		},
+		del: func(repos *repository.Repositories, key string) error {
+			// Revisions are only deleted together, keyed by book UUID
+			return repos.BookRevisionRepository.DeleteBookRevisions(key)
+		},
+		dump: func(repos *repository.Repositories) (interface{}, error) {
+			return repos.BookRevisionRepository.GetAllBookRevisions()
+		},
+	},
+	{
+		name: "webhooks",
+		put: func(repos *repository.Repositories, data json.RawMessage) error {
+			var webhook entity.Webhook
+			if err := json.Unmarshal(data, &webhook); err != nil {
+				return err
+			}
+			_, err := repos.WebhookRepository.CreateWebhook(webhook)
+			return err
+		},
+		del: func(repos *repository.Repositories, key string) error {
+			repos.WebhookRepository.DeleteWebhook(key)
+			return nil
+		},
+		dump: func(repos *repository.Repositories) (interface{}, error) {
+			return repos.WebhookRepository.GetAllWebhooks()
+		},
+	},
+	{
+		name: "webhook_deliveries",
+		put: func(repos *repository.Repositories, data json.RawMessage) error {
+			var delivery entity.WebhookDelivery
+			if err := json.Unmarshal(data, &delivery); err != nil {
+				return err
+			}
+			return repos.WebhookDeliveryRepository.AddWebhookDelivery(delivery)
+		},
+		del: func(repos *repository.Repositories, key string) error {
+			repos.WebhookDeliveryRepository.DeleteWebhookDelivery(key)
+			return nil
+		},
+		dump: func(repos *repository.Repositories) (interface{}, error) {
+			return repos.WebhookDeliveryRepository.GetAllWebhookDeliveries()
+		},
+	},
+	{
+		name: "webhook_pending",
+		put: func(repos *repository.Repositories, data json.RawMessage) error {
+			var pending entity.PendingWebhookDelivery
+			if err := json.Unmarshal(data, &pending); err != nil {
+				return err
+			}
+			return repos.WebhookDeliveryRepository.SavePendingWebhookDelivery(pending)
+		},
+		del: func(repos *repository.Repositories, key string) error {
+			repos.WebhookDeliveryRepository.DeletePendingWebhookDelivery(key)
+			return nil
+		},
+		dump: func(repos *repository.Repositories) (interface{}, error) {
+			return repos.WebhookDeliveryRepository.GetPendingWebhookDeliveries()
+		},
+	},
+}
+
+func findCollection(name string) (collection, bool) {
+	for _, c := range collections {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return collection{}, false
+}
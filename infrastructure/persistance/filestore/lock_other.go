@@ -0,0 +1,19 @@
+//go:build !unix
+
+package filestore
+
+import "os"
+
+// Advisory locking and directory syncs are only implemented on unix; other
+// platforms rely on the operator not starting two servers on one directory.
+func lockDir(name string) (*os.File, error) {
+	return os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0o600)
+}
+
+func unlockDir(f *os.File) error {
+	return f.Close()
+}
+
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,698 @@
+package filestore
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+)
+
+// bookRepo, userRepo, apiKeyRepo, oauthClientRepo, webhookRepo and
+// webhookDeliveryRepo apply each mutation to the in-memory repository and
+// then log the resulting record, undoing the mutation if that fails, all
+// under the store lock.
+// auditRepo and bookRevisionRepo log their records before applying them,
+// since callers supply them in full.
+type bookRepo struct {
+	s     *Store
+	inner repository.BookRepository
+}
+
+func (b *bookRepo) GetAllBooks() ([]entity.Book, error) {
+	b.s.mu.RLock()
+	defer b.s.mu.RUnlock()
+	return b.inner.GetAllBooks()
+}
+
+func (b *bookRepo) CreateBook(book entity.Book) (entity.Book, error) {
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+	if err := b.s.checkWritable(); err != nil {
+		return entity.Book{}, err
+	}
+	before := b.before(book.UUID)
+	created, err := b.inner.CreateBook(book)
+	if err != nil {
+		return entity.Book{}, err
+	}
+	if err := b.s.commit("books", opPut, created.UUID, created, before...); err != nil {
+		return entity.Book{}, err
+	}
+	return created, nil
+}
+
+func (b *bookRepo) GetBook(uuid string) (entity.Book, error) {
+	b.s.mu.RLock()
+	defer b.s.mu.RUnlock()
+	return b.inner.GetBook(uuid)
+}
+
+func (b *bookRepo) UpdateBook(book entity.Book) (entity.Book, error) {
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+	if err := b.s.checkWritable(); err != nil {
+		return entity.Book{}, err
+	}
+	before := b.before(book.UUID)
+	updated, err := b.inner.UpdateBook(book)
+	if err != nil {
+		return entity.Book{}, err
+	}
+	if err := b.s.commit("books", opPut, updated.UUID, updated, before...); err != nil {
+		return entity.Book{}, err
+	}
+	return updated, nil
+}
+
+func (b *bookRepo) DeleteBook(uuid string) error {
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+	if err := b.s.checkWritable(); err != nil {
+		return err
+	}
+	before := b.before(uuid)
+	if err := b.inner.DeleteBook(uuid); err != nil {
+		return err
+	}
+	// The book stays in the trash, so log it with its DeletedAt
+	return b.s.commit("books", opPut, uuid, b.deleted(uuid), before...)
+}
+
+func (b *bookRepo) GetDeletedBooks() ([]entity.Book, error) {
+	b.s.mu.RLock()
+	defer b.s.mu.RUnlock()
+	return b.inner.GetDeletedBooks()
+}
+
+func (b *bookRepo) RestoreBook(uuid string) (entity.Book, error) {
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+	if err := b.s.checkWritable(); err != nil {
+		return entity.Book{}, err
+	}
+	before := b.before(uuid)
+	restored, err := b.inner.RestoreBook(uuid)
+	if err != nil {
+		return entity.Book{}, err
+	}
+	if err := b.s.commit("books", opPut, restored.UUID, restored, before...); err != nil {
+		return entity.Book{}, err
+	}
+	return restored, nil
+}
+
+func (b *bookRepo) PurgeBook(uuid string) error {
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+	if err := b.s.checkWritable(); err != nil {
+		return err
+	}
+	before := b.before(uuid)
+	if err := b.inner.PurgeBook(uuid); err != nil {
+		return err
+	}
+	return b.s.commit("books", opDelete, uuid, nil, before...)
+}
+
+func (b *bookRepo) PurgeDeletedBook(uuid string, deletedBefore time.Time) error {
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+	if err := b.s.checkWritable(); err != nil {
+		return err
+	}
+	before := b.before(uuid)
+	if err := b.inner.PurgeDeletedBook(uuid, deletedBefore); err != nil {
+		return err
+	}
+	return b.s.commit("books", opDelete, uuid, nil, before...)
+}
+
+// deleted returns the book with the given UUID from the trash. It must be
+// called with the store lock held.
+func (b *bookRepo) deleted(uuid string) entity.Book {
+	books, _ := b.inner.GetDeletedBooks()
+	for _, book := range books {
+		if book.UUID == uuid {
+			return book
+		}
+	}
+	return entity.Book{}
+}
+
+// before returns the book with the given UUID, live or in the trash, for
+// undoing a mutation of it. It must be called with the store lock held.
+func (b *bookRepo) before(uuid string) []interface{} {
+	if book, err := b.inner.GetBook(uuid); err == nil {
+		return []interface{}{book}
+	}
+	if book := b.deleted(uuid); book.UUID != "" {
+		return []interface{}{book}
+	}
+	return nil
+}
+
+type userRepo struct {
+	s     *Store
+	inner repository.UserRepository
+}
+
+func (r *userRepo) GetAllUsers() ([]entity.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.inner.GetAllUsers()
+}
+
+func (r *userRepo) CreateUser(user entity.User) (entity.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return entity.User{}, err
+	}
+	before := r.before(user.ID)
+	created, err := r.inner.CreateUser(user)
+	if err != nil {
+		return entity.User{}, err
+	}
+	if err := r.s.commit("users", opPut, strconv.FormatInt(created.ID, 10), created, before...); err != nil {
+		return entity.User{}, err
+	}
+	return created, nil
+}
+
+func (r *userRepo) GetByID(id int64) (entity.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.inner.GetByID(id)
+}
+
+func (r *userRepo) GetByEmail(email string) (entity.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.inner.GetByEmail(email)
+}
+
+func (r *userRepo) Update(user entity.User) (entity.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return entity.User{}, err
+	}
+	before := r.before(user.ID)
+	updated, err := r.inner.Update(user)
+	if err != nil {
+		return entity.User{}, err
+	}
+	if err := r.s.commit("users", opPut, strconv.FormatInt(updated.ID, 10), updated, before...); err != nil {
+		return entity.User{}, err
+	}
+	return updated, nil
+}
+
+func (r *userRepo) Delete(id int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return err
+	}
+	before := r.before(id)
+	if err := r.inner.Delete(id); err != nil {
+		return err
+	}
+	// The user stays in the trash, so log them with their DeletedAt
+	return r.s.commit("users", opPut, strconv.FormatInt(id, 10), r.deleted(id), before...)
+}
+
+func (r *userRepo) GetDeletedUsers() ([]entity.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.inner.GetDeletedUsers()
+}
+
+func (r *userRepo) RestoreUser(id int64) (entity.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return entity.User{}, err
+	}
+	before := r.before(id)
+	restored, err := r.inner.RestoreUser(id)
+	if err != nil {
+		return entity.User{}, err
+	}
+	if err := r.s.commit("users", opPut, strconv.FormatInt(id, 10), restored, before...); err != nil {
+		return entity.User{}, err
+	}
+	return restored, nil
+}
+
+func (r *userRepo) PurgeUser(id int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return err
+	}
+	before := r.before(id)
+	if err := r.inner.PurgeUser(id); err != nil {
+		return err
+	}
+	return r.s.commit("users", opDelete, strconv.FormatInt(id, 10), nil, before...)
+}
+
+func (r *userRepo) PurgeDeletedUser(id int64, deletedBefore time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return err
+	}
+	before := r.before(id)
+	if err := r.inner.PurgeDeletedUser(id, deletedBefore); err != nil {
+		return err
+	}
+	return r.s.commit("users", opDelete, strconv.FormatInt(id, 10), nil, before...)
+}
+
+// deleted returns the user with the given ID from the trash. It must be
+// called with the store lock held.
+func (r *userRepo) deleted(id int64) entity.User {
+	users, _ := r.inner.GetDeletedUsers()
+	for _, user := range users {
+		if user.ID == id {
+			return user
+		}
+	}
+	return entity.User{}
+}
+
+// before returns the user with the given ID, live or in the trash, for
+// undoing a mutation of them. It must be called with the store lock held.
+func (r *userRepo) before(id int64) []interface{} {
+	if user, err := r.inner.GetByID(id); err == nil {
+		return []interface{}{user}
+	}
+	if user := r.deleted(id); user.ID != 0 {
+		return []interface{}{user}
+	}
+	return nil
+}
+
+func (r *userRepo) Authenticate(email, password string) (entity.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.inner.Authenticate(email, password)
+}
+
+type apiKeyRepo struct {
+	s     *Store
+	inner repository.APIKeyRepository
+}
+
+func (r *apiKeyRepo) GetAllAPIKeys() ([]entity.APIKey, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.inner.GetAllAPIKeys()
+}
+
+func (r *apiKeyRepo) ListAPIKeys(userID int64) ([]entity.APIKey, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.inner.ListAPIKeys(userID)
+}
+
+func (r *apiKeyRepo) CreateAPIKey(key entity.APIKey) (entity.APIKey, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return entity.APIKey{}, err
+	}
+	before := r.before(key.ID)
+	created, err := r.inner.CreateAPIKey(key)
+	if err != nil {
+		return entity.APIKey{}, err
+	}
+	if err := r.s.commit("api_keys", opPut, created.ID, created, before...); err != nil {
+		return entity.APIKey{}, err
+	}
+	return created, nil
+}
+
+func (r *apiKeyRepo) GetAPIKey(id string) (entity.APIKey, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.inner.GetAPIKey(id)
+}
+
+func (r *apiKeyRepo) UpdateAPIKey(key entity.APIKey) (entity.APIKey, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return entity.APIKey{}, err
+	}
+	before := r.before(key.ID)
+	updated, err := r.inner.UpdateAPIKey(key)
+	if err != nil {
+		return entity.APIKey{}, err
+	}
+	if err := r.s.commit("api_keys", opPut, updated.ID, updated, before...); err != nil {
+		return entity.APIKey{}, err
+	}
+	return updated, nil
+}
+
+func (r *apiKeyRepo) DeleteAPIKey(id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return err
+	}
+	before := r.before(id)
+	if err := r.inner.DeleteAPIKey(id); err != nil {
+		return err
+	}
+	return r.s.commit("api_keys", opDelete, id, nil, before...)
+}
+
+// before returns the key with the given ID for undoing a mutation of it.
+// It must be called with the store lock held.
+func (r *apiKeyRepo) before(id string) []interface{} {
+	if key, err := r.inner.GetAPIKey(id); err == nil {
+		return []interface{}{key}
+	}
+	return nil
+}
+
+type oauthClientRepo struct {
+	s     *Store
+	inner repository.OAuthClientRepository
+}
+
+func (r *oauthClientRepo) GetAllOAuthClients() ([]entity.OAuthClient, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.inner.GetAllOAuthClients()
+}
+
+func (r *oauthClientRepo) ListOAuthClients(ownerID int64) ([]entity.OAuthClient, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.inner.ListOAuthClients(ownerID)
+}
+
+func (r *oauthClientRepo) CreateOAuthClient(client entity.OAuthClient) (entity.OAuthClient, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return entity.OAuthClient{}, err
+	}
+	before := r.before(client.ID)
+	created, err := r.inner.CreateOAuthClient(client)
+	if err != nil {
+		return entity.OAuthClient{}, err
+	}
+	if err := r.s.commit("oauth_clients", opPut, created.ID, created, before...); err != nil {
+		return entity.OAuthClient{}, err
+	}
+	return created, nil
+}
+
+func (r *oauthClientRepo) GetOAuthClient(id string) (entity.OAuthClient, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.inner.GetOAuthClient(id)
+}
+
+func (r *oauthClientRepo) DeleteOAuthClient(id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return err
+	}
+	before := r.before(id)
+	if err := r.inner.DeleteOAuthClient(id); err != nil {
+		return err
+	}
+	return r.s.commit("oauth_clients", opDelete, id, nil, before...)
+}
+
+// before returns the client with the given ID for undoing a mutation of
+// it. It must be called with the store lock held.
+func (r *oauthClientRepo) before(id string) []interface{} {
+	if client, err := r.inner.GetOAuthClient(id); err == nil {
+		return []interface{}{client}
+	}
+	return nil
+}
+
+type auditRepo struct {
+	s     *Store
+	inner repository.AuditRepository
+}
+
+func (r *auditRepo) AppendAuditEvent(event entity.AuditEvent) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return err
+	}
+	// A repeated event is logged too but ignored on replay, as it is here
+	if err := r.s.append("audit", opPut, event.ID, event); err != nil {
+		return err
+	}
+	return r.inner.AppendAuditEvent(event)
+}
+
+func (r *auditRepo) GetAuditEvents() ([]entity.AuditEvent, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.inner.GetAuditEvents()
+}
+
+type bookRevisionRepo struct {
+	s     *Store
+	inner repository.BookRevisionRepository
+}
+
+func (r *bookRevisionRepo) AddBookRevision(revision entity.BookRevision) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return err
+	}
+	// A repeated revision is logged too but ignored on replay, as it is here
+	key := revision.BookUUID + "/" + strconv.Itoa(revision.Number)
+	if err := r.s.append("book_revisions", opPut, key, revision); err != nil {
+		return err
+	}
+	return r.inner.AddBookRevision(revision)
+}
+
+func (r *bookRevisionRepo) GetBookRevisions(bookUUID string) ([]entity.BookRevision, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.inner.GetBookRevisions(bookUUID)
+}
+
+func (r *bookRevisionRepo) GetBookRevision(bookUUID string, number int) (entity.BookRevision, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.inner.GetBookRevision(bookUUID, number)
+}
+
+func (r *bookRevisionRepo) GetAllBookRevisions() ([]entity.BookRevision, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.inner.GetAllBookRevisions()
+}
+
+func (r *bookRevisionRepo) DeleteBookRevisions(bookUUID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return err
+	}
+	revisions, err := r.inner.GetBookRevisions(bookUUID)
+	if err != nil {
+		return err
+	}
+	before := make([]interface{}, len(revisions))
+	for i, revision := range revisions {
+		before[i] = revision
+	}
+	if err := r.inner.DeleteBookRevisions(bookUUID); err != nil {
+		return err
+	}
+	// Logged under the book's UUID, which deletes all of its revisions
+	return r.s.commit("book_revisions", opDelete, bookUUID, nil, before...)
+}
+
+type webhookRepo struct {
+	s     *Store
+	inner repository.WebhookRepository
+}
+
+func (r *webhookRepo) GetAllWebhooks() ([]entity.Webhook, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.inner.GetAllWebhooks()
+}
+
+func (r *webhookRepo) CreateWebhook(webhook entity.Webhook) (entity.Webhook, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return entity.Webhook{}, err
+	}
+	before := r.before(webhook.ID)
+	created, err := r.inner.CreateWebhook(webhook)
+	if err != nil {
+		return entity.Webhook{}, err
+	}
+	if err := r.s.commit("webhooks", opPut, created.ID, created, before...); err != nil {
+		return entity.Webhook{}, err
+	}
+	return created, nil
+}
+
+func (r *webhookRepo) GetWebhook(id string) (entity.Webhook, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.inner.GetWebhook(id)
+}
+
+func (r *webhookRepo) UpdateWebhook(webhook entity.Webhook) (entity.Webhook, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return entity.Webhook{}, err
+	}
+	before := r.before(webhook.ID)
+	updated, err := r.inner.UpdateWebhook(webhook)
+	if err != nil {
+		return entity.Webhook{}, err
+	}
+	if err := r.s.commit("webhooks", opPut, updated.ID, updated, before...); err != nil {
+		return entity.Webhook{}, err
+	}
+	return updated, nil
+}
+
+func (r *webhookRepo) DeleteWebhook(id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return err
+	}
+	before := r.before(id)
+	if err := r.inner.DeleteWebhook(id); err != nil {
+		return err
+	}
+	return r.s.commit("webhooks", opDelete, id, nil, before...)
+}
+
+// before returns the webhook with the given ID for undoing a mutation of
+// it. It must be called with the store lock held.
+func (r *webhookRepo) before(id string) []interface{} {
+	if webhook, err := r.inner.GetWebhook(id); err == nil {
+		return []interface{}{webhook}
+	}
+	return nil
+}
+
+type webhookDeliveryRepo struct {
+	s     *Store
+	inner repository.WebhookDeliveryRepository
+}
+
+func (r *webhookDeliveryRepo) AddWebhookDelivery(delivery entity.WebhookDelivery) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return err
+	}
+	before := r.before(delivery.ID)
+	if err := r.inner.AddWebhookDelivery(delivery); err != nil {
+		return err
+	}
+	return r.s.commit("webhook_deliveries", opPut, delivery.ID, delivery, before...)
+}
+
+func (r *webhookDeliveryRepo) GetWebhookDeliveries(webhookID string) ([]entity.WebhookDelivery, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.inner.GetWebhookDeliveries(webhookID)
+}
+
+func (r *webhookDeliveryRepo) GetAllWebhookDeliveries() ([]entity.WebhookDelivery, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.inner.GetAllWebhookDeliveries()
+}
+
+func (r *webhookDeliveryRepo) DeleteWebhookDelivery(id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return err
+	}
+	before := r.before(id)
+	if err := r.inner.DeleteWebhookDelivery(id); err != nil {
+		return err
+	}
+	return r.s.commit("webhook_deliveries", opDelete, id, nil, before...)
+}
+
+// before returns the logged delivery with the given ID for undoing a
+// mutation of it. It must be called with the store lock held.
+func (r *webhookDeliveryRepo) before(id string) []interface{} {
+	deliveries, _ := r.inner.GetAllWebhookDeliveries()
+	for _, delivery := range deliveries {
+		if delivery.ID == id {
+			return []interface{}{delivery}
+		}
+	}
+	return nil
+}
+
+func (r *webhookDeliveryRepo) SavePendingWebhookDelivery(pending entity.PendingWebhookDelivery) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return err
+	}
+	before := r.pendingBefore(pending.ID)
+	if err := r.inner.SavePendingWebhookDelivery(pending); err != nil {
+		return err
+	}
+	return r.s.commit("webhook_pending", opPut, pending.ID, pending, before...)
+}
+
+func (r *webhookDeliveryRepo) GetPendingWebhookDeliveries() ([]entity.PendingWebhookDelivery, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return r.inner.GetPendingWebhookDeliveries()
+}
+
+func (r *webhookDeliveryRepo) DeletePendingWebhookDelivery(id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.s.checkWritable(); err != nil {
+		return err
+	}
+	before := r.pendingBefore(id)
+	if err := r.inner.DeletePendingWebhookDelivery(id); err != nil {
+		return err
+	}
+	return r.s.commit("webhook_pending", opDelete, id, nil, before...)
+}
+
+// pendingBefore returns the pending delivery with the given ID for undoing
+// a mutation of it. It must be called with the store lock held.
+func (r *webhookDeliveryRepo) pendingBefore(id string) []interface{} {
+	pending, _ := r.inner.GetPendingWebhookDeliveries()
+	for _, p := range pending {
+		if p.ID == id {
+			return []interface{}{p}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,426 @@
+// Package filestore is a durable repository backend for small deployments.
+// Data lives in the in-memory repositories; every mutation is appended to a
+// write-ahead log before it is acknowledged, and undone if that fails. The
+// log is periodically compacted into a JSON snapshot, and both are replayed
+// on startup.
+//
+// The directory contains
+//
+//	snapshot.json  the state up to a sequence number, replaced atomically
+//	wal.log        records after that sequence number
+//	LOCK           held while a process has the store open
+package filestore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/repository"
+	"github.com/biswasurmi/book-cli/infrastructure/persistance/inmemory"
+)
+
+const (
+	snapshotFile = "snapshot.json"
+	walFile      = "wal.log"
+	lockFile     = "LOCK"
+
+	snapshotVersion = 1
+)
+
+// Fsync policies
+const (
+	// FsyncAlways syncs the log before every mutation is acknowledged.
+	FsyncAlways = "always"
+	// FsyncInterval syncs the log in the background every FsyncInterval;
+	// a crash can lose the most recent mutations.
+	FsyncInterval = "interval"
+	// FsyncNever leaves flushing to the operating system.
+	FsyncNever = "never"
+)
+
+type Options struct {
+	Dir           string
+	Fsync         string
+	FsyncInterval time.Duration
+	// CompactEvery compacts the log into a new snapshot after this many
+	// records. Zero disables automatic compaction.
+	CompactEvery int
+}
+
+type snapshot struct {
+	Version     int                        `json:"version"`
+	Seq         uint64                     `json:"seq"`
+	CreatedAt   time.Time                  `json:"createdAt"`
+	Collections map[string]json.RawMessage `json:"collections"`
+}
+
+type Store struct {
+	opts Options
+
+	// mu serialises mutations with the log and guards reads of the
+	// in-memory state against concurrent replay or compaction.
+	mu      sync.RWMutex
+	inner   *repository.Repositories
+	wal     *os.File
+	lock    *os.File
+	seq     uint64
+	pending int // records in the log since the last snapshot
+	dirty   bool
+	failed  error
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Open loads the store in opts.Dir, creating it if needed, and recovers
+// from a torn final log record left by a crash. A corrupt record anywhere
+// else in the log is an error, so records after it are never dropped.
+func Open(opts Options) (*Store, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("filestore: directory is required")
+	}
+	if opts.Fsync == "" {
+		opts.Fsync = FsyncAlways
+	}
+	switch opts.Fsync {
+	case FsyncAlways, FsyncNever:
+	case FsyncInterval:
+		if opts.FsyncInterval <= 0 {
+			return nil, errors.New("filestore: fsync interval must be positive")
+		}
+	default:
+		return nil, fmt.Errorf("filestore: unknown fsync policy %q", opts.Fsync)
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+		return nil, err
+	}
+	lock, err := lockDir(filepath.Join(opts.Dir, lockFile))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		opts:  opts,
+		inner: inmemory.GetRepositories(),
+		lock:  lock,
+		done:  make(chan struct{}),
+	}
+	if err := s.load(); err != nil {
+		unlockDir(lock)
+		return nil, err
+	}
+
+	if opts.Fsync == FsyncInterval {
+		s.wg.Add(1)
+		go s.syncLoop()
+	}
+	return s, nil
+}
+
+// Repositories returns repositories backed by the store.
+func (s *Store) Repositories() *repository.Repositories {
+	return &repository.Repositories{
+		BookRepository:            &bookRepo{s: s, inner: s.inner.BookRepository},
+		UserRepository:            &userRepo{s: s, inner: s.inner.UserRepository},
+		APIKeyRepository:          &apiKeyRepo{s: s, inner: s.inner.APIKeyRepository},
+		OAuthClientRepository:     &oauthClientRepo{s: s, inner: s.inner.OAuthClientRepository},
+		AuditRepository:           &auditRepo{s: s, inner: s.inner.AuditRepository},
+		BookRevisionRepository:    &bookRevisionRepo{s: s, inner: s.inner.BookRevisionRepository},
+		WebhookRepository:         &webhookRepo{s: s, inner: s.inner.WebhookRepository},
+		WebhookDeliveryRepository: &webhookDeliveryRepo{s: s, inner: s.inner.WebhookDeliveryRepository},
+	}
+}
+
+func (s *Store) load() error {
+	data, err := os.ReadFile(filepath.Join(s.opts.Dir, snapshotFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		var snap snapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return fmt.Errorf("filestore: reading snapshot: %w", err)
+		}
+		if snap.Version != snapshotVersion {
+			return fmt.Errorf("filestore: unsupported snapshot version %d", snap.Version)
+		}
+		for name, raw := range snap.Collections {
+			c, ok := findCollection(name)
+			if !ok {
+				return fmt.Errorf("filestore: unknown collection %q in snapshot", name)
+			}
+			var items []json.RawMessage
+			if err := json.Unmarshal(raw, &items); err != nil {
+				return fmt.Errorf("filestore: reading %s from snapshot: %w", name, err)
+			}
+			for _, item := range items {
+				if err := c.put(s.inner, item); err != nil {
+					return fmt.Errorf("filestore: loading %s: %w", name, err)
+				}
+			}
+		}
+		s.seq = snap.Seq
+	}
+
+	wal, err := os.OpenFile(filepath.Join(s.opts.Dir, walFile), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+
+	end, err := readRecords(wal, func(rec record) error {
+		if rec.Seq <= s.seq {
+			// Already contained in the snapshot
+			return nil
+		}
+		if err := s.apply(rec); err != nil {
+			return fmt.Errorf("filestore: replaying record %d: %w", rec.Seq, err)
+		}
+		s.seq = rec.Seq
+		s.pending++
+		return nil
+	})
+	if errors.Is(err, errTornRecord) {
+		log.Printf("filestore: discarding torn write-ahead log tail at offset %d", end)
+		if err := wal.Truncate(end); err != nil {
+			wal.Close()
+			return err
+		}
+		if err := wal.Sync(); err != nil {
+			wal.Close()
+			return err
+		}
+	} else if err != nil {
+		wal.Close()
+		return err
+	}
+
+	if _, err := wal.Seek(end, io.SeekStart); err != nil {
+		wal.Close()
+		return err
+	}
+	s.wal = wal
+	return nil
+}
+
+func (s *Store) apply(rec record) error {
+	c, ok := findCollection(rec.Collection)
+	if !ok {
+		return fmt.Errorf("unknown collection %q", rec.Collection)
+	}
+	switch rec.Op {
+	case opPut:
+		return c.put(s.inner, rec.Data)
+	case opDelete:
+		return c.del(s.inner, rec.Key)
+	default:
+		return fmt.Errorf("unknown operation %q", rec.Op)
+	}
+}
+
+// commit logs a mutation that has already been applied to the in-memory
+// state, or undoes it if the log cannot be written. before holds the
+// records stored under key before the mutation. The caller must hold s.mu
+// for the whole mutation, so readers never see a change that is not logged.
+func (s *Store) commit(collection string, op opType, key string, value interface{}, before ...interface{}) error {
+	if err := s.append(collection, op, key, value); err != nil {
+		s.undo(collection, key, before)
+		return err
+	}
+	return nil
+}
+
+// undo puts back the records stored under key before a mutation that
+// could not be logged. The caller must hold s.mu.
+func (s *Store) undo(collection, key string, before []interface{}) {
+	c, ok := findCollection(collection)
+	if !ok {
+		return
+	}
+	if err := c.del(s.inner, key); err != nil {
+		log.Printf("filestore: undoing %s %s: %v", collection, key, err)
+	}
+	for _, value := range before {
+		data, err := json.Marshal(value)
+		if err == nil {
+			err = c.put(s.inner, data)
+		}
+		if err != nil {
+			log.Printf("filestore: undoing %s %s: %v", collection, key, err)
+		}
+	}
+}
+
+// append writes a record to the log. The caller must hold s.mu. If the log
+// cannot be written the store refuses all further mutations, since the
+// failed write may have left part of a record behind.
+func (s *Store) append(collection string, op opType, key string, value interface{}) error {
+	if s.failed != nil {
+		return s.failed
+	}
+
+	rec := record{Seq: s.seq + 1, Collection: collection, Op: op, Key: key}
+	if value != nil {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		rec.Data = data
+	}
+	frame, err := encodeRecord(rec)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.wal.Write(frame); err != nil {
+		s.failed = fmt.Errorf("filestore: write-ahead log unavailable: %w", err)
+		return s.failed
+	}
+	if s.opts.Fsync == FsyncAlways {
+		if err := s.wal.Sync(); err != nil {
+			s.failed = fmt.Errorf("filestore: write-ahead log unavailable: %w", err)
+			return s.failed
+		}
+	} else {
+		s.dirty = true
+	}
+
+	s.seq = rec.Seq
+	s.pending++
+	if s.opts.CompactEvery > 0 && s.pending >= s.opts.CompactEvery {
+		if err := s.compact(); err != nil {
+			// The log still holds everything, so this is not fatal
+			log.Printf("filestore: compaction failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// checkWritable must be called with s.mu held before a mutation is applied.
+func (s *Store) checkWritable() error {
+	return s.failed
+}
+
+// Compact writes the current state into a new snapshot and empties the log.
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compact()
+}
+
+func (s *Store) compact() error {
+	snap := snapshot{
+		Version:     snapshotVersion,
+		Seq:         s.seq,
+		CreatedAt:   time.Now().UTC(),
+		Collections: make(map[string]json.RawMessage),
+	}
+	for _, c := range collections {
+		items, err := c.dump(s.inner)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(items)
+		if err != nil {
+			return err
+		}
+		snap.Collections[c.name] = data
+	}
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write the snapshot under a temporary name and rename it into place so
+	// a crash leaves either the old or the new snapshot. Records up to
+	// snap.Seq are skipped on replay, so a crash before the log is
+	// truncated is harmless.
+	tmp := filepath.Join(s.opts.Dir, snapshotFile+".tmp")
+	if err := writeFileSync(tmp, data); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.opts.Dir, snapshotFile)); err != nil {
+		return err
+	}
+	if err := syncDir(s.opts.Dir); err != nil {
+		return err
+	}
+
+	if err := s.wal.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.wal.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := s.wal.Sync(); err != nil {
+		return err
+	}
+	s.pending = 0
+	s.dirty = false
+	return nil
+}
+
+func (s *Store) syncLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.opts.FsyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.dirty && s.failed == nil {
+				if err := s.wal.Sync(); err != nil {
+					s.failed = fmt.Errorf("filestore: write-ahead log unavailable: %w", err)
+					log.Print(s.failed)
+				}
+				s.dirty = false
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Close flushes the log and releases the directory lock.
+func (s *Store) Close() error {
+	close(s.done)
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.wal.Sync()
+	if cerr := s.wal.Close(); err == nil {
+		err = cerr
+	}
+	if uerr := unlockDir(s.lock); err == nil {
+		err = uerr
+	}
+	return err
+}
+
+func writeFileSync(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
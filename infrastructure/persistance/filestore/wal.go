@@ -0,0 +1,113 @@
+package filestore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Every WAL record is framed as
+//
+//	uint32 payload length | uint32 CRC-32 (IEEE) of payload | payload
+//
+// with big endian integers. The payload is a JSON encoded record. A torn
+// write at the end of the log fails either the length or the checksum
+// check and is discarded on replay. A bad record followed by more data is
+// corruption rather than a torn write, and replay stops with an error.
+const frameHeaderSize = 8
+
+// maxRecordSize guards against reading a garbage length as a huge
+// allocation.
+const maxRecordSize = 64 << 20
+
+type opType string
+
+const (
+	opPut    opType = "put"
+	opDelete opType = "delete"
+)
+
+type record struct {
+	Seq        uint64          `json:"seq"`
+	Collection string          `json:"collection"`
+	Op         opType          `json:"op"`
+	Key        string          `json:"key"`
+	Data       json.RawMessage `json:"data,omitempty"`
+}
+
+func encodeRecord(rec record) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	frame := make([]byte, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload))
+	copy(frame[frameHeaderSize:], payload)
+	return frame, nil
+}
+
+var errTornRecord = errors.New("incomplete record at the end of the log")
+
+// readRecords calls fn for every intact record in the log and returns the
+// offset just past the last one. Reading stops at the first bad record:
+// with errTornRecord if the bad frame runs to the end of the file, as a
+// write cut short by a crash does, and with an error naming its offset
+// otherwise.
+func readRecords(f *os.File, fn func(record) error) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(f)
+	size := info.Size()
+	// bad classifies a frame at offset that failed a check and declares
+	// length bytes of payload.
+	bad := func(offset int64, length uint32) error {
+		if offset+int64(frameHeaderSize)+int64(length) >= size {
+			return errTornRecord
+		}
+		return fmt.Errorf("filestore: corrupt write-ahead log record at offset %d", offset)
+	}
+
+	var offset int64
+	header := make([]byte, frameHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return offset, nil
+			}
+			return offset, errTornRecord
+		}
+		length := binary.BigEndian.Uint32(header[0:4])
+		sum := binary.BigEndian.Uint32(header[4:8])
+		if length > maxRecordSize {
+			return offset, fmt.Errorf("filestore: corrupt write-ahead log record at offset %d: length %d", offset, length)
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return offset, errTornRecord
+		}
+		if crc32.ChecksumIEEE(payload) != sum {
+			return offset, bad(offset, length)
+		}
+
+		var rec record
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			// The checksum matched, so this was written this way
+			return offset, fmt.Errorf("filestore: invalid write-ahead log record at offset %d: %w", offset, err)
+		}
+		if err := fn(rec); err != nil {
+			return offset, err
+		}
+		offset += int64(frameHeaderSize) + int64(length)
+	}
+}
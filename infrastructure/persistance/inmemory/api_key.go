@@ -0,0 +1,78 @@
+package inmemory
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+)
+
+type apiKeyRepo struct {
+	mu   sync.RWMutex
+	keys map[string]entity.APIKey
+}
+
+func NewAPIKeyRepo() repository.APIKeyRepository {
+	return &apiKeyRepo{
+		keys: make(map[string]entity.APIKey),
+	}
+}
+
+func (r *apiKeyRepo) GetAllAPIKeys() ([]entity.APIKey, error) {
+	return r.list(func(entity.APIKey) bool { return true }), nil
+}
+
+func (r *apiKeyRepo) ListAPIKeys(userID int64) ([]entity.APIKey, error) {
+	return r.list(func(k entity.APIKey) bool { return k.UserID == userID }), nil
+}
+
+func (r *apiKeyRepo) list(match func(entity.APIKey) bool) []entity.APIKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var result []entity.APIKey
+	for _, key := range r.keys {
+		if match(key) {
+			result = append(result, key)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+func (r *apiKeyRepo) CreateAPIKey(key entity.APIKey) (entity.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys[key.ID] = key
+	return key, nil
+}
+
+func (r *apiKeyRepo) GetAPIKey(id string) (entity.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, exists := r.keys[id]
+	if !exists {
+		return entity.APIKey{}, repository.ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func (r *apiKeyRepo) UpdateAPIKey(key entity.APIKey) (entity.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.keys[key.ID]; !exists {
+		return entity.APIKey{}, repository.ErrAPIKeyNotFound
+	}
+	r.keys[key.ID] = key
+	return key, nil
+}
+
+func (r *apiKeyRepo) DeleteAPIKey(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.keys[id]; !exists {
+		return repository.ErrAPIKeyNotFound
+	}
+	delete(r.keys, id)
+	return nil
+}
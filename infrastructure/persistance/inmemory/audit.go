@@ -0,0 +1,38 @@
+package inmemory
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+)
+
+type auditRepo struct {
+	mu sync.RWMutex
+	// events is kept ordered by ID.
+	events []entity.AuditEvent
+}
+
+func NewAuditRepo() repository.AuditRepository {
+	return &auditRepo{}
+}
+
+func (r *auditRepo) AppendAuditEvent(event entity.AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := sort.Search(len(r.events), func(i int) bool { return r.events[i].ID >= event.ID })
+	if i < len(r.events) && r.events[i].ID == event.ID {
+		return repository.ErrAuditEventExists
+	}
+	r.events = append(r.events, entity.AuditEvent{})
+	copy(r.events[i+1:], r.events[i:])
+	r.events[i] = event
+	return nil
+}
+
+func (r *auditRepo) GetAuditEvents() ([]entity.AuditEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]entity.AuditEvent(nil), r.events...), nil
+}
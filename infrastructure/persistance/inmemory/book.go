@@ -1,12 +1,17 @@
 package inmemory
 
 import (
-	"errors"
+	"sort"
+	"sync"
+	"time"
+
 	"github.com/biswasurmi/book-cli/domain/entity"
 	"github.com/biswasurmi/book-cli/domain/repository"
 )
 
 type bookRepo struct {
+	mu sync.RWMutex
+	// books holds every book, including those in the trash.
 	books map[string]entity.Book
 }
 
@@ -17,38 +22,106 @@ func NewBookRepo() repository.BookRepository {
 }
 
 func (b *bookRepo) GetAllBooks() ([]entity.Book, error) {
-	var result []entity.Book
-	for _, book := range b.books {
-		result = append(result, book)
-	}
-	return result, nil
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.list(false), nil
 }
 
 func (b *bookRepo) CreateBook(book entity.Book) (entity.Book, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.books[book.UUID] = book
 	return book, nil
 }
 
 func (b *bookRepo) GetBook(uuid string) (entity.Book, error) {
-	book, exists := b.books[uuid]
-	if !exists {
-		return entity.Book{}, errors.New("book not found")
-	}
-	return book, nil
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.find(uuid)
 }
 
 func (b *bookRepo) UpdateBook(book entity.Book) (entity.Book, error) {
-	if _, exists := b.books[book.UUID]; !exists {
-		return entity.Book{}, errors.New("book not found")
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, err := b.find(book.UUID); err != nil {
+		return entity.Book{}, err
 	}
+	book.DeletedAt = nil
 	b.books[book.UUID] = book
 	return book, nil
 }
 
 func (b *bookRepo) DeleteBook(uuid string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	book, err := b.find(uuid)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	book.DeletedAt = &now
+	b.books[uuid] = book
+	return nil
+}
+
+func (b *bookRepo) GetDeletedBooks() ([]entity.Book, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.list(true), nil
+}
+
+func (b *bookRepo) RestoreBook(uuid string) (entity.Book, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	book, exists := b.books[uuid]
+	if !exists || book.DeletedAt == nil {
+		return entity.Book{}, repository.ErrBookNotFound
+	}
+	book.DeletedAt = nil
+	b.books[uuid] = book
+	return book, nil
+}
+
+func (b *bookRepo) PurgeBook(uuid string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	if _, exists := b.books[uuid]; !exists {
-		return errors.New("book not found")
+		return repository.ErrBookNotFound
 	}
 	delete(b.books, uuid)
 	return nil
-}
\ No newline at end of file
+}
+
+func (b *bookRepo) PurgeDeletedBook(uuid string, deletedBefore time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	book, exists := b.books[uuid]
+	if !exists || book.DeletedAt == nil || book.DeletedAt.After(deletedBefore) {
+		return repository.ErrBookNotFound
+	}
+	delete(b.books, uuid)
+	return nil
+}
+
+// find returns the book unless it is unknown or in the trash. It must be
+// called with b.mu held.
+func (b *bookRepo) find(uuid string) (entity.Book, error) {
+	book, exists := b.books[uuid]
+	if !exists || book.DeletedAt != nil {
+		return entity.Book{}, repository.ErrBookNotFound
+	}
+	return book, nil
+}
+
+// list returns the books in the trash if deleted is set and the others
+// otherwise, ordered by UUID. It must be called with b.mu held.
+func (b *bookRepo) list(deleted bool) []entity.Book {
+	var result []entity.Book
+	for _, book := range b.books {
+		if (book.DeletedAt != nil) == deleted {
+			result = append(result, book)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].UUID < result[j].UUID })
+	return result
+}
@@ -0,0 +1,75 @@
+package inmemory
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+)
+
+type bookRevisionRepo struct {
+	mu sync.RWMutex
+	// revisions maps a book UUID to its revisions, ordered by number.
+	revisions map[string][]entity.BookRevision
+}
+
+func NewBookRevisionRepo() repository.BookRevisionRepository {
+	return &bookRevisionRepo{
+		revisions: make(map[string][]entity.BookRevision),
+	}
+}
+
+func (r *bookRevisionRepo) AddBookRevision(revision entity.BookRevision) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	revisions := r.revisions[revision.BookUUID]
+	i := sort.Search(len(revisions), func(i int) bool { return revisions[i].Number >= revision.Number })
+	if i < len(revisions) && revisions[i].Number == revision.Number {
+		return repository.ErrBookRevisionExists
+	}
+	revisions = append(revisions, entity.BookRevision{})
+	copy(revisions[i+1:], revisions[i:])
+	revisions[i] = revision
+	r.revisions[revision.BookUUID] = revisions
+	return nil
+}
+
+func (r *bookRevisionRepo) GetBookRevisions(bookUUID string) ([]entity.BookRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]entity.BookRevision{}, r.revisions[bookUUID]...), nil
+}
+
+func (r *bookRevisionRepo) GetBookRevision(bookUUID string, number int) (entity.BookRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, revision := range r.revisions[bookUUID] {
+		if revision.Number == number {
+			return revision, nil
+		}
+	}
+	return entity.BookRevision{}, repository.ErrBookRevisionNotFound
+}
+
+func (r *bookRevisionRepo) GetAllBookRevisions() ([]entity.BookRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	uuids := make([]string, 0, len(r.revisions))
+	for uuid := range r.revisions {
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+	var result []entity.BookRevision
+	for _, uuid := range uuids {
+		result = append(result, r.revisions[uuid]...)
+	}
+	return result, nil
+}
+
+func (r *bookRevisionRepo) DeleteBookRevisions(bookUUID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.revisions, bookUUID)
+	return nil
+}
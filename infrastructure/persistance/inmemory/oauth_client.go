@@ -0,0 +1,68 @@
+package inmemory
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+)
+
+type oauthClientRepo struct {
+	mu      sync.RWMutex
+	clients map[string]entity.OAuthClient
+}
+
+func NewOAuthClientRepo() repository.OAuthClientRepository {
+	return &oauthClientRepo{
+		clients: make(map[string]entity.OAuthClient),
+	}
+}
+
+func (r *oauthClientRepo) GetAllOAuthClients() ([]entity.OAuthClient, error) {
+	return r.list(func(entity.OAuthClient) bool { return true }), nil
+}
+
+func (r *oauthClientRepo) ListOAuthClients(ownerID int64) ([]entity.OAuthClient, error) {
+	return r.list(func(c entity.OAuthClient) bool { return c.OwnerID == ownerID }), nil
+}
+
+func (r *oauthClientRepo) list(match func(entity.OAuthClient) bool) []entity.OAuthClient {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var result []entity.OAuthClient
+	for _, client := range r.clients {
+		if match(client) {
+			result = append(result, client)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+func (r *oauthClientRepo) CreateOAuthClient(client entity.OAuthClient) (entity.OAuthClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clients[client.ID] = client
+	return client, nil
+}
+
+func (r *oauthClientRepo) GetOAuthClient(id string) (entity.OAuthClient, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	client, exists := r.clients[id]
+	if !exists {
+		return entity.OAuthClient{}, repository.ErrOAuthClientNotFound
+	}
+	return client, nil
+}
+
+func (r *oauthClientRepo) DeleteOAuthClient(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.clients[id]; !exists {
+		return repository.ErrOAuthClientNotFound
+	}
+	delete(r.clients, id)
+	return nil
+}
@@ -9,5 +9,11 @@ func GetRepositories() *repository.Repositories {
     return &repository.Repositories{
         BookRepository: NewBookRepo(),
         UserRepository: NewUserRepo(),
+        APIKeyRepository: NewAPIKeyRepo(),
+        OAuthClientRepository: NewOAuthClientRepo(),
+        AuditRepository: NewAuditRepo(),
+        BookRevisionRepository: NewBookRevisionRepo(),
+        WebhookRepository: NewWebhookRepo(),
+        WebhookDeliveryRepository: NewWebhookDeliveryRepo(),
     }
 }
\ No newline at end of file
@@ -1,7 +1,8 @@
 package inmemory
 
 import (
-	"errors"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/biswasurmi/book-cli/domain/entity"
@@ -10,63 +11,197 @@ import (
 )
 
 type userRepo struct {
+	mu sync.RWMutex
+	// users holds every user, including those in the trash.
 	users map[int64]entity.User
+	// emails and usernames index users by normalized email and username
+	// key, and enforce their uniqueness.
+	emails    map[string]int64
+	usernames map[string]int64
 }
 
 func NewUserRepo() repository.UserRepository {
 	return &userRepo{
-		users: make(map[int64]entity.User),
+		users:     make(map[int64]entity.User),
+		emails:    make(map[string]int64),
+		usernames: make(map[string]int64),
 	}
 }
 
+func (r *userRepo) GetAllUsers() ([]entity.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.list(false), nil
+}
+
 func (r *userRepo) CreateUser(user entity.User) (entity.User, error) {
-	r.users[user.ID] = user
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user.Email = entity.NormalizeEmail(user.Email)
+	if err := r.checkUnique(user); err != nil {
+		return entity.User{}, err
+	}
+	r.put(user)
 	return user, nil
 }
 
 func (r *userRepo) GetByID(id int64) (entity.User, error) {
-	user, exists := r.users[id]
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.find(id)
+}
+
+func (r *userRepo) GetByEmail(email string) (entity.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.findByEmail(email)
+}
+
+// findByEmail must be called with r.mu held.
+func (r *userRepo) findByEmail(email string) (entity.User, error) {
+	id, exists := r.emails[entity.NormalizeEmail(email)]
 	if !exists {
-		return entity.User{}, errors.New("user not found")
+		return entity.User{}, repository.ErrUserNotFound
 	}
-	return user, nil
+	return r.find(id)
 }
 
-func (r *userRepo) GetByEmail(email string) (entity.User, error) {
-	for _, user := range r.users {
-		if user.Email == email {
-			return user, nil
-		}
+// find returns the user unless they are unknown or in the trash. It must
+// be called with r.mu held.
+func (r *userRepo) find(id int64) (entity.User, error) {
+	user, exists := r.users[id]
+	if !exists || !user.DeletedAt.IsZero() {
+		return entity.User{}, repository.ErrUserNotFound
 	}
-	return entity.User{}, errors.New("user not found")
+	return user, nil
 }
 
 func (r *userRepo) Update(user entity.User) (entity.User, error) {
-	if _, exists := r.users[user.ID]; !exists {
-		return entity.User{}, errors.New("user not found")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.find(user.ID); err != nil {
+		return entity.User{}, err
+	}
+	user.Email = entity.NormalizeEmail(user.Email)
+	if err := r.checkUnique(user); err != nil {
+		return entity.User{}, err
 	}
 	user.UpdatedAt = time.Now()
-	r.users[user.ID] = user
+	user.DeletedAt = time.Time{}
+	r.put(user)
 	return user, nil
 }
 
 func (r *userRepo) Delete(id int64) error {
-	if _, exists := r.users[id]; !exists {
-		return errors.New("user not found")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, err := r.find(id)
+	if err != nil {
+		return err
 	}
-	delete(r.users, id)
+	user.DeletedAt = time.Now().UTC()
+	r.users[id] = user
 	return nil
 }
 
 func (r *userRepo) Authenticate(email, password string) (entity.User, error) {
-	
-	user, err := r.GetByEmail(email)
+	r.mu.RLock()
+	user, err := r.findByEmail(email)
+	r.mu.RUnlock()
 	if err != nil {
-		return entity.User{}, errors.New("invalid credentials")
+		return entity.User{}, repository.ErrInvalidCredentials
 	}
-	
+
+	// Compare outside the lock; bcrypt is deliberately slow
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return entity.User{}, errors.New("invalid credentials")
+		return entity.User{}, repository.ErrInvalidCredentials
 	}
 	return user, nil
-}
\ No newline at end of file
+}
+
+func (r *userRepo) GetDeletedUsers() ([]entity.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.list(true), nil
+}
+
+func (r *userRepo) RestoreUser(id int64) (entity.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, exists := r.users[id]
+	if !exists || user.DeletedAt.IsZero() {
+		return entity.User{}, repository.ErrUserNotFound
+	}
+	user.DeletedAt = time.Time{}
+	r.users[id] = user
+	return user, nil
+}
+
+func (r *userRepo) PurgeUser(id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.users[id]; !exists {
+		return repository.ErrUserNotFound
+	}
+	r.unindex(id)
+	delete(r.users, id)
+	return nil
+}
+
+func (r *userRepo) PurgeDeletedUser(id int64, deletedBefore time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, exists := r.users[id]
+	if !exists || user.DeletedAt.IsZero() || user.DeletedAt.After(deletedBefore) {
+		return repository.ErrUserNotFound
+	}
+	r.unindex(id)
+	delete(r.users, id)
+	return nil
+}
+
+// list returns the users in the trash if deleted is set and the others
+// otherwise, ordered by ID. It must be called with r.mu held.
+func (r *userRepo) list(deleted bool) []entity.User {
+	var result []entity.User
+	for _, user := range r.users {
+		if !user.DeletedAt.IsZero() == deleted {
+			result = append(result, user)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// checkUnique reports whether another user already has the email or
+// username of user. It must be called with r.mu held.
+func (r *userRepo) checkUnique(user entity.User) error {
+	if id, exists := r.emails[user.Email]; exists && id != user.ID {
+		return repository.ErrEmailTaken
+	}
+	if key := entity.UsernameKey(user.Username); key != "" {
+		if id, exists := r.usernames[key]; exists && id != user.ID {
+			return repository.ErrUsernameTaken
+		}
+	}
+	return nil
+}
+
+// put stores user and updates the indexes. It must be called with r.mu held.
+func (r *userRepo) put(user entity.User) {
+	r.unindex(user.ID)
+	r.users[user.ID] = user
+	r.emails[user.Email] = user.ID
+	if key := entity.UsernameKey(user.Username); key != "" {
+		r.usernames[key] = user.ID
+	}
+}
+
+func (r *userRepo) unindex(id int64) {
+	old, exists := r.users[id]
+	if !exists {
+		return
+	}
+	delete(r.emails, old.Email)
+	delete(r.usernames, entity.UsernameKey(old.Username))
+}
@@ -0,0 +1,68 @@
+package inmemory
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+)
+
+type webhookRepo struct {
+	mu       sync.RWMutex
+	webhooks map[string]entity.Webhook
+}
+
+func NewWebhookRepo() repository.WebhookRepository {
+	return &webhookRepo{
+		webhooks: make(map[string]entity.Webhook),
+	}
+}
+
+func (r *webhookRepo) GetAllWebhooks() ([]entity.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var result []entity.Webhook
+	for _, webhook := range r.webhooks {
+		result = append(result, webhook)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (r *webhookRepo) CreateWebhook(webhook entity.Webhook) (entity.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.webhooks[webhook.ID] = webhook
+	return webhook, nil
+}
+
+func (r *webhookRepo) GetWebhook(id string) (entity.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	webhook, exists := r.webhooks[id]
+	if !exists {
+		return entity.Webhook{}, repository.ErrWebhookNotFound
+	}
+	return webhook, nil
+}
+
+func (r *webhookRepo) UpdateWebhook(webhook entity.Webhook) (entity.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.webhooks[webhook.ID]; !exists {
+		return entity.Webhook{}, repository.ErrWebhookNotFound
+	}
+	r.webhooks[webhook.ID] = webhook
+	return webhook, nil
+}
+
+func (r *webhookRepo) DeleteWebhook(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.webhooks[id]; !exists {
+		return repository.ErrWebhookNotFound
+	}
+	delete(r.webhooks, id)
+	return nil
+}
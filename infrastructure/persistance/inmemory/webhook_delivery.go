@@ -0,0 +1,119 @@
+package inmemory
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+)
+
+type webhookDeliveryRepo struct {
+	mu sync.RWMutex
+	// deliveries maps webhook IDs to their deliveries in the order added,
+	// and webhookIDs maps delivery IDs to their webhook.
+	deliveries map[string][]entity.WebhookDelivery
+	webhookIDs map[string]string
+	pending    map[string]entity.PendingWebhookDelivery
+}
+
+func NewWebhookDeliveryRepo() repository.WebhookDeliveryRepository {
+	return &webhookDeliveryRepo{
+		deliveries: make(map[string][]entity.WebhookDelivery),
+		webhookIDs: make(map[string]string),
+		pending:    make(map[string]entity.PendingWebhookDelivery),
+	}
+}
+
+func (r *webhookDeliveryRepo) AddWebhookDelivery(delivery entity.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.webhookIDs[delivery.ID]; exists {
+		r.remove(delivery.ID)
+	}
+	r.deliveries[delivery.WebhookID] = append(r.deliveries[delivery.WebhookID], delivery)
+	r.webhookIDs[delivery.ID] = delivery.WebhookID
+	return nil
+}
+
+func (r *webhookDeliveryRepo) GetWebhookDeliveries(webhookID string) ([]entity.WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]entity.WebhookDelivery{}, r.deliveries[webhookID]...), nil
+}
+
+func (r *webhookDeliveryRepo) GetAllWebhookDeliveries() ([]entity.WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	webhookIDs := make([]string, 0, len(r.deliveries))
+	for id := range r.deliveries {
+		webhookIDs = append(webhookIDs, id)
+	}
+	sort.Strings(webhookIDs)
+	var result []entity.WebhookDelivery
+	for _, id := range webhookIDs {
+		result = append(result, r.deliveries[id]...)
+	}
+	return result, nil
+}
+
+func (r *webhookDeliveryRepo) DeleteWebhookDelivery(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.webhookIDs[id]; !exists {
+		return repository.ErrWebhookDeliveryNotFound
+	}
+	r.remove(id)
+	return nil
+}
+
+// remove deletes a logged delivery. It must be called with r.mu held.
+func (r *webhookDeliveryRepo) remove(id string) {
+	webhookID := r.webhookIDs[id]
+	delete(r.webhookIDs, id)
+	deliveries := r.deliveries[webhookID]
+	for i, delivery := range deliveries {
+		if delivery.ID == id {
+			deliveries = append(deliveries[:i:i], deliveries[i+1:]...)
+			break
+		}
+	}
+	if len(deliveries) == 0 {
+		delete(r.deliveries, webhookID)
+	} else {
+		r.deliveries[webhookID] = deliveries
+	}
+}
+
+func (r *webhookDeliveryRepo) SavePendingWebhookDelivery(pending entity.PendingWebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending[pending.ID] = pending
+	return nil
+}
+
+func (r *webhookDeliveryRepo) GetPendingWebhookDeliveries() ([]entity.PendingWebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var result []entity.PendingWebhookDelivery
+	for _, pending := range r.pending {
+		result = append(result, pending)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].DueAt.Equal(result[j].DueAt) {
+			return result[i].DueAt.Before(result[j].DueAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+func (r *webhookDeliveryRepo) DeletePendingWebhookDelivery(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.pending[id]; !exists {
+		return repository.ErrWebhookDeliveryNotFound
+	}
+	delete(r.pending, id)
+	return nil
+}
@@ -0,0 +1,34 @@
+// Package persistance opens the repository backend selected in the
+// configuration.
+package persistance
+
+import (
+	"fmt"
+
+	"github.com/biswasurmi/book-cli/config"
+	"github.com/biswasurmi/book-cli/domain/repository"
+	"github.com/biswasurmi/book-cli/infrastructure/persistance/filestore"
+	"github.com/biswasurmi/book-cli/infrastructure/persistance/inmemory"
+)
+
+// Open returns the configured repositories and a function that flushes and
+// releases them. The close function must be called before exiting.
+func Open(cfg config.Storage) (*repository.Repositories, func() error, error) {
+	switch cfg.Driver {
+	case config.StorageMemory:
+		return inmemory.GetRepositories(), func() error { return nil }, nil
+	case config.StorageFile:
+		store, err := filestore.Open(filestore.Options{
+			Dir:           cfg.Path,
+			Fsync:         cfg.Fsync,
+			FsyncInterval: cfg.FsyncInterval,
+			CompactEvery:  cfg.CompactEvery,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return store.Repositories(), store.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+}
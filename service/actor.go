@@ -0,0 +1,36 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+)
+
+// ErrNotOwner is returned when an actor changes a resource that belongs to
+// another user without an elevated role.
+var ErrNotOwner = errors.New("not the owner of this resource")
+
+// Actor is the user a service call is made for.
+type Actor struct {
+	UserID int64
+	// Role is the role the request may act with: the user's role, or
+	// RoleUser if the credentials lack users:admin or a second factor the
+	// role requires.
+	Role string
+
+	// RequestID and SourceIP identify the request in the audit log.
+	RequestID string
+	SourceIP  string
+}
+
+// Elevated reports whether the actor may change other users' resources.
+func (a Actor) Elevated() bool {
+	return a.Role == entity.RoleAdmin
+}
+
+// owns reports whether the actor may change a resource created by
+// ownerID. Resources from before ownership was recorded have no owner and
+// can only be changed by elevated actors.
+func (a Actor) owns(ownerID int64) bool {
+	return a.Elevated() || (ownerID != 0 && ownerID == a.UserID)
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+)
+
+var (
+	ErrInvalidAPIKey    = errors.New("invalid or expired api key")
+	ErrInvalidScope     = errors.New("invalid scope")
+	ErrScopeNotAllowed  = errors.New("scope not allowed for this user")
+	ErrInvalidKeyExpiry = errors.New("invalid api key expiry")
+)
+
+// APIKeyPrefix starts every API key, so leaked keys are easy to spot.
+const APIKeyPrefix = "bk_"
+
+// lastUsedInterval limits how often a key's LastUsedAt is written, so
+// busy keys do not turn every request into a store write.
+const lastUsedInterval = time.Minute
+
+// APIKeyService issues and checks API keys. A key has the form
+// bk_<id>.<secret>; only a hash of the secret is stored.
+type APIKeyService interface {
+	// Create issues a key for the user and returns it together with the
+	// full key, which cannot be shown again. A zero expiresAt picks the
+	// default lifetime.
+	Create(userID int64, name string, scopes []string, expiresAt time.Time) (entity.APIKey, string, error)
+	List(userID int64) ([]entity.APIKey, error)
+	// Revoke deletes one of the user's keys. Keys of other users are
+	// reported as not found.
+	Revoke(userID int64, id string) error
+	// Authenticate returns the key and its owner if key is valid.
+	Authenticate(key string) (entity.APIKey, entity.User, error)
+}
+
+type apiKeyService struct {
+	repo     repository.APIKeyRepository
+	userRepo repository.UserRepository
+	ids      IDGenerator
+	ttl      time.Duration
+	maxTTL   time.Duration
+
+	mu sync.Mutex // serialises LastUsedAt updates
+}
+
+func NewAPIKeyService(repo repository.APIKeyRepository, userRepo repository.UserRepository, ids IDGenerator, ttl, maxTTL time.Duration) APIKeyService {
+	return &apiKeyService{repo: repo, userRepo: userRepo, ids: ids, ttl: ttl, maxTTL: maxTTL}
+}
+
+func (s *apiKeyService) Create(userID int64, name string, scopes []string, expiresAt time.Time) (entity.APIKey, string, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return entity.APIKey{}, "", err
+	}
+	if len(scopes) == 0 {
+		return entity.APIKey{}, "", ErrInvalidScope
+	}
+	seen := map[string]bool{}
+	var granted []string
+	for _, scope := range scopes {
+		if !entity.ValidScope(scope) {
+			return entity.APIKey{}, "", fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+		if scope == entity.ScopeUsersAdmin && user.Role != entity.RoleAdmin {
+			return entity.APIKey{}, "", fmt.Errorf("%w: %q", ErrScopeNotAllowed, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			granted = append(granted, scope)
+		}
+	}
+
+	now := time.Now()
+	if expiresAt.IsZero() {
+		expiresAt = now.Add(s.ttl)
+	}
+	if !expiresAt.After(now) || expiresAt.After(now.Add(s.maxTTL)) {
+		return entity.APIKey{}, "", ErrInvalidKeyExpiry
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return entity.APIKey{}, "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+
+	key, err := s.repo.CreateAPIKey(entity.APIKey{
+		ID:        s.ids.NewUUID(),
+		UserID:    userID,
+		Name:      name,
+		Scopes:    granted,
+		Hash:      hashToken(encoded),
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return entity.APIKey{}, "", err
+	}
+	return key, APIKeyPrefix + key.ID + "." + encoded, nil
+}
+
+func (s *apiKeyService) List(userID int64) ([]entity.APIKey, error) {
+	return s.repo.ListAPIKeys(userID)
+}
+
+func (s *apiKeyService) Revoke(userID int64, id string) error {
+	key, err := s.repo.GetAPIKey(id)
+	if err != nil {
+		return err
+	}
+	if key.UserID != userID {
+		return repository.ErrAPIKeyNotFound
+	}
+	return s.repo.DeleteAPIKey(id)
+}
+
+func (s *apiKeyService) Authenticate(raw string) (entity.APIKey, entity.User, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(raw, APIKeyPrefix), ".")
+	if !ok || !strings.HasPrefix(raw, APIKeyPrefix) || id == "" || secret == "" {
+		return entity.APIKey{}, entity.User{}, ErrInvalidAPIKey
+	}
+	key, err := s.repo.GetAPIKey(id)
+	if errors.Is(err, repository.ErrAPIKeyNotFound) {
+		return entity.APIKey{}, entity.User{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return entity.APIKey{}, entity.User{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(key.Hash)) != 1 {
+		return entity.APIKey{}, entity.User{}, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if !now.Before(key.ExpiresAt) {
+		return entity.APIKey{}, entity.User{}, ErrInvalidAPIKey
+	}
+	user, err := s.userRepo.GetByID(key.UserID)
+	if err != nil {
+		return entity.APIKey{}, entity.User{}, ErrInvalidAPIKey
+	}
+	if user.Disabled {
+		return entity.APIKey{}, entity.User{}, ErrAccountDisabled
+	}
+	// Revoking a user's sessions, e.g. on password reset, revokes their
+	// keys as well
+	if key.CreatedAt.Before(user.SessionsRevokedAt) {
+		return entity.APIKey{}, entity.User{}, ErrInvalidAPIKey
+	}
+
+	if now.Sub(key.LastUsedAt) >= lastUsedInterval {
+		key = s.touch(key.ID, now)
+	}
+	return key, user, nil
+}
+
+// touch records that the key was used. Failing to do so does not fail the
+// request.
+func (s *apiKeyService) touch(id string, now time.Time) entity.APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, err := s.repo.GetAPIKey(id)
+	if err != nil {
+		return key
+	}
+	if now.Sub(key.LastUsedAt) < lastUsedInterval {
+		return key
+	}
+	key.LastUsedAt = now
+	if updated, err := s.repo.UpdateAPIKey(key); err == nil {
+		return updated
+	}
+	return key
+}
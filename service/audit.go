@@ -0,0 +1,236 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+)
+
+// AuditService writes and reads the audit log. Recording never fails the
+// change or login it describes: errors from the repository are logged.
+type AuditService interface {
+	// RecordChange logs a create, update or delete of a target. before is
+	// nil for creates and after is nil for deletes; only the fields that
+	// differ are kept.
+	RecordChange(actor Actor, action, targetType, targetID string, before, after interface{})
+	// RecordLogin logs a login attempt for userID, which is 0 if the
+	// account is unknown. A nil err records a success.
+	RecordLogin(actor Actor, userID int64, err error)
+	// List returns the events matching filter, oldest first.
+	List(filter entity.AuditFilter) ([]entity.AuditEvent, error)
+}
+
+// auditRedacted replaces the values of secret fields in recorded changes,
+// so the log shows that they changed but not what to.
+const auditRedacted = "[redacted]"
+
+// auditSecretFields are the JSON fields whose values are never recorded.
+var auditSecretFields = []string{"password", "totp_secret", "recovery_codes"}
+
+type auditService struct {
+	auditRepo repository.AuditRepository
+	ids       IDGenerator
+	now       func() time.Time
+}
+
+func NewAuditService(auditRepo repository.AuditRepository, ids IDGenerator) AuditService {
+	return &auditService{auditRepo: auditRepo, ids: ids, now: time.Now}
+}
+
+func (s *auditService) RecordChange(actor Actor, action, targetType, targetID string, before, after interface{}) {
+	event := s.newEvent(actor, action, targetType, targetID)
+	changes, err := diffFields(before, after)
+	if err != nil {
+		log.Printf("Recording %s of %s %s: %v", action, targetType, targetID, err)
+	}
+	event.Changes = changes
+	s.append(event)
+}
+
+func (s *auditService) RecordLogin(actor Actor, userID int64, err error) {
+	action := entity.AuditLoginSuccess
+	if err != nil {
+		action = entity.AuditLoginFailure
+	}
+	var target string
+	if userID != 0 {
+		target = userTarget(userID)
+	}
+	event := s.newEvent(actor, action, entity.AuditTargetUser, target)
+	if err == nil {
+		// Logins are made without credentials, so the user who logged in
+		// is the actor
+		event.ActorID = userID
+	} else {
+		event.Reason = loginFailureReason(err)
+	}
+	s.append(event)
+}
+
+func (s *auditService) newEvent(actor Actor, action, targetType, targetID string) entity.AuditEvent {
+	return entity.AuditEvent{
+		ID:         s.ids.NewUUID(),
+		Time:       s.now().UTC(),
+		ActorID:    actor.UserID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		RequestID:  actor.RequestID,
+		SourceIP:   actor.SourceIP,
+	}
+}
+
+func (s *auditService) append(event entity.AuditEvent) {
+	if err := s.auditRepo.AppendAuditEvent(event); err != nil {
+		log.Printf("Recording audit event %s of %s %s: %v", event.Action, event.TargetType, event.TargetID, err)
+	}
+}
+
+func (s *auditService) List(filter entity.AuditFilter) ([]entity.AuditEvent, error) {
+	events, err := s.auditRepo.GetAuditEvents()
+	if err != nil {
+		return nil, err
+	}
+	result := []entity.AuditEvent{}
+	for _, event := range events {
+		if matchesAuditFilter(event, filter) {
+			result = append(result, event)
+		}
+	}
+	return result, nil
+}
+
+func matchesAuditFilter(event entity.AuditEvent, filter entity.AuditFilter) bool {
+	switch {
+	case filter.ActorID != 0 && event.ActorID != filter.ActorID:
+		return false
+	case filter.Action != "" && event.Action != filter.Action:
+		return false
+	case filter.TargetType != "" && event.TargetType != filter.TargetType:
+		return false
+	case filter.TargetID != "" && event.TargetID != filter.TargetID:
+		return false
+	case !filter.Since.IsZero() && event.Time.Before(filter.Since):
+		return false
+	case !filter.Until.IsZero() && !event.Time.Before(filter.Until):
+		return false
+	}
+	return true
+}
+
+// loginFailureReason names why a login failed in a form fit for filtering.
+func loginFailureReason(err error) string {
+	var locked *LockedError
+	switch {
+	case errors.As(err, &locked):
+		return "locked"
+	case errors.Is(err, repository.ErrInvalidCredentials):
+		return "invalid_credentials"
+	case errors.Is(err, ErrAccountDisabled):
+		return "account_disabled"
+	case errors.Is(err, ErrEmailNotVerified):
+		return "email_not_verified"
+	case errors.Is(err, ErrInvalidTwoFactorCode):
+		return "invalid_two_factor_code"
+	case errors.Is(err, ErrInvalidChallenge):
+		return "invalid_challenge"
+	case errors.Is(err, ErrInvalidOIDCState):
+		return "invalid_oidc_state"
+	case errors.Is(err, ErrOIDCDomainNotAllowed):
+		return "oidc_domain_not_allowed"
+	case errors.Is(err, ErrOIDCNoAccount):
+		return "oidc_no_account"
+	case errors.Is(err, ErrOIDCPendingAccount):
+		return "oidc_pending_account"
+	default:
+		return err.Error()
+	}
+}
+
+// diffFields compares the JSON forms of before and after field by field,
+// redacting secrets. For creates and deletes, where one side is nil, fields
+// that are not set are left out.
+func diffFields(before, after interface{}) (map[string]entity.FieldChange, error) {
+	dropEmpty := before == nil || after == nil
+	old, err := jsonFields(before, dropEmpty)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := jsonFields(after, dropEmpty)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]entity.FieldChange)
+	for name, value := range old {
+		if other, ok := updated[name]; !ok || !reflect.DeepEqual(value, other) {
+			changes[name] = entity.FieldChange{Before: value, After: updated[name]}
+		}
+	}
+	for name, value := range updated {
+		if _, ok := old[name]; !ok {
+			changes[name] = entity.FieldChange{After: value}
+		}
+	}
+	for _, name := range auditSecretFields {
+		if change, ok := changes[name]; ok {
+			changes[name] = entity.FieldChange{Before: redact(change.Before), After: redact(change.After)}
+		}
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	return changes, nil
+}
+
+// jsonFields returns the top-level JSON fields of v, without empty ones
+// if dropEmpty is set.
+func jsonFields(v interface{}, dropEmpty bool) (map[string]interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range fields {
+		if dropEmpty && isEmptyJSON(value) {
+			delete(fields, name)
+		}
+	}
+	return fields, nil
+}
+
+func isEmptyJSON(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == "" || v == "0001-01-01T00:00:00Z"
+	case bool:
+		return !v
+	case float64:
+		return v == 0
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+func redact(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return auditRedacted
+}
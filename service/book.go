@@ -1,42 +1,241 @@
 package service
 
 import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/biswasurmi/book-cli/domain/entity"
 	"github.com/biswasurmi/book-cli/domain/repository"
 )
 
+// ErrInvalidRevision is returned for revision numbers below 1.
+var ErrInvalidRevision = errors.New("invalid revision number")
+
+// BookService manages books. DeleteBook moves a book to the trash, see
+// TrashService. Books belong to the user who created them:
+// UpdateBook, DeleteBook and RestoreRevision return ErrNotOwner unless the
+// actor is that user or has an elevated role.
+//
+// Every saved state of a book is kept as a numbered revision: creating a
+// book makes revision 1 and every update adds the next one. Books from
+// before revisions were kept get their current state as revision 1 on
+// their first update, so nothing is lost.
 type BookService interface {
-	ListBooks() ([]entity.Book, error)
-	CreateBook(book entity.Book) (entity.Book, error)
+	ListBooks(filter entity.BookFilter) ([]entity.Book, error)
+	CreateBook(actor Actor, book entity.Book) (entity.Book, error)
 	GetBook(uuid string) (entity.Book, error)
-	UpdateBook(book entity.Book) (entity.Book, error)
-	DeleteBook(uuid string) error
+	UpdateBook(actor Actor, book entity.Book) (entity.Book, error)
+	DeleteBook(actor Actor, uuid string) error
+	ListRevisions(uuid string) ([]entity.BookRevision, error)
+	GetRevision(uuid string, number int) (entity.BookRevision, error)
+	DiffRevisions(uuid string, from, to int) (entity.BookRevisionDiff, error)
+	// RestoreRevision saves the book as it was in revision number, which
+	// makes a new revision.
+	RestoreRevision(actor Actor, uuid string, number int) (entity.Book, error)
 }
 
 type bookService struct {
-	bookRepo repository.BookRepository
+	bookRepo     repository.BookRepository
+	revisionRepo repository.BookRevisionRepository
+	ids          IDGenerator
+	audit        AuditService
+	events       EventBus
+
+	// mu serialises changes so revisions are numbered, and events
+	// published, in the order the book was saved.
+	mu sync.Mutex
 }
 
-func NewBookService(bookRepo repository.BookRepository) BookService {
-	return &bookService{bookRepo: bookRepo}
+func NewBookService(bookRepo repository.BookRepository, revisionRepo repository.BookRevisionRepository, ids IDGenerator, audit AuditService, events EventBus) BookService {
+	return &bookService{bookRepo: bookRepo, revisionRepo: revisionRepo, ids: ids, audit: audit, events: events}
+}
+
+func (s *bookService) ListBooks(filter entity.BookFilter) ([]entity.Book, error) {
+	books, err := s.bookRepo.GetAllBooks()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []entity.Book{}
+	for _, book := range books {
+		if matchesFilter(book, filter) {
+			result = append(result, book)
+		}
+	}
+	return result, nil
 }
 
-func (s *bookService) ListBooks() ([]entity.Book, error) {
-	return s.bookRepo.GetAllBooks()
+func matchesFilter(book entity.Book, filter entity.BookFilter) bool {
+	if filter.Name != "" && !containsFold(book.Name, filter.Name) {
+		return false
+	}
+	if filter.ISBN != "" && book.ISBN != filter.ISBN {
+		return false
+	}
+	if filter.CreatedBy != 0 && book.CreatedBy != filter.CreatedBy {
+		return false
+	}
+	if filter.Author != "" {
+		for _, author := range book.AuthorList {
+			if containsFold(author, filter.Author) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
 }
 
-func (s *bookService) CreateBook(book entity.Book) (entity.Book, error) {
-	return s.bookRepo.CreateBook(book)
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// CreateBook stores a new book owned by the actor under a freshly
+// generated UUID.
+func (s *bookService) CreateBook(actor Actor, book entity.Book) (entity.Book, error) {
+	book.UUID = s.ids.NewUUID()
+	book.CreatedBy = actor.UserID
+	book.UpdatedBy = actor.UserID
+	book.DeletedAt = nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	created, err := s.bookRepo.CreateBook(book)
+	if err != nil {
+		return entity.Book{}, err
+	}
+	if err := s.addRevision(actor, created, 0); err != nil {
+		return entity.Book{}, err
+	}
+	s.audit.RecordChange(actor, entity.AuditBookCreate, entity.AuditTargetBook, created.UUID, nil, created)
+	s.events.Publish(entity.EventBookCreated, created)
+	return created, nil
 }
 
 func (s *bookService) GetBook(uuid string) (entity.Book, error) {
 	return s.bookRepo.GetBook(uuid)
 }
 
-func (s *bookService) UpdateBook(book entity.Book) (entity.Book, error) {
-	return s.bookRepo.UpdateBook(book)
+func (s *bookService) UpdateBook(actor Actor, book entity.Book) (entity.Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.update(actor, book, 0)
+}
+
+// update saves book as a new revision, recording that it restores
+// restoredFrom if that is not 0. The caller holds s.mu.
+func (s *bookService) update(actor Actor, book entity.Book, restoredFrom int) (entity.Book, error) {
+	existing, err := s.bookRepo.GetBook(book.UUID)
+	if err != nil {
+		return entity.Book{}, err
+	}
+	if !actor.owns(existing.CreatedBy) {
+		return entity.Book{}, ErrNotOwner
+	}
+	revisions, err := s.revisionRepo.GetBookRevisions(book.UUID)
+	if err != nil {
+		return entity.Book{}, err
+	}
+	if len(revisions) == 0 {
+		// Keep the state from before revisions were recorded
+		if err := s.addRevision(Actor{UserID: existing.UpdatedBy}, existing, 0); err != nil {
+			return entity.Book{}, err
+		}
+	}
+
+	book.CreatedBy = existing.CreatedBy
+	book.UpdatedBy = actor.UserID
+	updated, err := s.bookRepo.UpdateBook(book)
+	if err != nil {
+		return entity.Book{}, err
+	}
+	if err := s.addRevision(actor, updated, restoredFrom); err != nil {
+		return entity.Book{}, err
+	}
+	s.audit.RecordChange(actor, entity.AuditBookUpdate, entity.AuditTargetBook, updated.UUID, existing, updated)
+	s.events.Publish(entity.EventBookUpdated, updated)
+	return updated, nil
+}
+
+// addRevision stores book as its next revision. The caller holds s.mu.
+func (s *bookService) addRevision(actor Actor, book entity.Book, restoredFrom int) error {
+	revisions, err := s.revisionRepo.GetBookRevisions(book.UUID)
+	if err != nil {
+		return err
+	}
+	return s.revisionRepo.AddBookRevision(entity.BookRevision{
+		BookUUID:     book.UUID,
+		Number:       len(revisions) + 1,
+		Book:         book,
+		CreatedAt:    time.Now().UTC(),
+		CreatedBy:    actor.UserID,
+		RestoredFrom: restoredFrom,
+	})
+}
+
+func (s *bookService) DeleteBook(actor Actor, uuid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, err := s.bookRepo.GetBook(uuid)
+	if err != nil {
+		return err
+	}
+	if !actor.owns(existing.CreatedBy) {
+		return ErrNotOwner
+	}
+	if err := s.bookRepo.DeleteBook(uuid); err != nil {
+		return err
+	}
+	s.audit.RecordChange(actor, entity.AuditBookDelete, entity.AuditTargetBook, uuid, existing, nil)
+	s.events.Publish(entity.EventBookDeleted, existing)
+	return nil
+}
+
+// ListRevisions returns the revisions of a book, oldest first. A book
+// that was never changed since revisions were kept has none.
+func (s *bookService) ListRevisions(uuid string) ([]entity.BookRevision, error) {
+	if _, err := s.bookRepo.GetBook(uuid); err != nil {
+		return nil, err
+	}
+	return s.revisionRepo.GetBookRevisions(uuid)
 }
 
-func (s *bookService) DeleteBook(uuid string) error {
-	return s.bookRepo.DeleteBook(uuid)
-}
\ No newline at end of file
+func (s *bookService) GetRevision(uuid string, number int) (entity.BookRevision, error) {
+	if number < 1 {
+		return entity.BookRevision{}, ErrInvalidRevision
+	}
+	if _, err := s.bookRepo.GetBook(uuid); err != nil {
+		return entity.BookRevision{}, err
+	}
+	return s.revisionRepo.GetBookRevision(uuid, number)
+}
+
+func (s *bookService) DiffRevisions(uuid string, from, to int) (entity.BookRevisionDiff, error) {
+	old, err := s.GetRevision(uuid, from)
+	if err != nil {
+		return entity.BookRevisionDiff{}, err
+	}
+	updated, err := s.GetRevision(uuid, to)
+	if err != nil {
+		return entity.BookRevisionDiff{}, err
+	}
+	changes, err := diffFields(old.Book, updated.Book)
+	if err != nil {
+		return entity.BookRevisionDiff{}, err
+	}
+	if changes == nil {
+		changes = map[string]entity.FieldChange{}
+	}
+	return entity.BookRevisionDiff{From: from, To: to, Changes: changes}, nil
+}
+
+func (s *bookService) RestoreRevision(actor Actor, uuid string, number int) (entity.Book, error) {
+	revision, err := s.GetRevision(uuid, number)
+	if err != nil {
+		return entity.Book{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.update(actor, revision.Book, number)
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+	"github.com/biswasurmi/book-cli/infrastructure/mail"
+)
+
+var (
+	ErrEmailNotVerified         = errors.New("email address not verified")
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+)
+
+// EmailVerificationService confirms that self-registered users own their
+// email address. Links are signed rather than stored: a token is
+// "<user ID>.<email>.<expiry>" and an HMAC of it, so it stops working when
+// the email changes.
+type EmailVerificationService interface {
+	// Send emails a verification link to a pending user.
+	Send(user entity.User) error
+	// Verify marks the token's user as verified.
+	Verify(token string) (entity.User, error)
+	// Resend sends a new link to a pending user, at most once per resend
+	// interval. Like password reset requests it reports nothing about
+	// whether the account exists.
+	Resend(email string) error
+}
+
+type emailVerificationService struct {
+	userRepo       repository.UserRepository
+	mailer         mail.Mailer
+	key            []byte // nil without a secret
+	ttl            time.Duration
+	resendInterval time.Duration
+	publicURL      string
+}
+
+func NewEmailVerificationService(userRepo repository.UserRepository, mailer mail.Mailer, secret string, ttl, resendInterval time.Duration, publicURL string) EmailVerificationService {
+	var key []byte
+	if secret != "" {
+		// Derive a separate key so a verification token can never be
+		// mistaken for anything else signed with the JWT secret
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte("email-verification"))
+		key = mac.Sum(nil)
+	}
+	return &emailVerificationService{
+		userRepo:       userRepo,
+		mailer:         mailer,
+		key:            key,
+		ttl:            ttl,
+		resendInterval: resendInterval,
+		publicURL:      strings.TrimSuffix(publicURL, "/"),
+	}
+}
+
+func (s *emailVerificationService) Send(user entity.User) error {
+	if !user.VerificationPending {
+		return nil
+	}
+	if s.key == nil {
+		return ErrMissingSecret
+	}
+	user.VerificationSentAt = time.Now()
+	if _, err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	token := s.sign(user, user.VerificationSentAt.Add(s.ttl))
+	var body strings.Builder
+	body.WriteString("Welcome to the Book API! Please confirm your email address.\n\n")
+	if s.publicURL != "" {
+		fmt.Fprintf(&body, "Open this link:\n\n%s/api/v1/verify-email?token=%s\n\n", s.publicURL, url.QueryEscape(token))
+	} else {
+		fmt.Fprintf(&body, "Send this token to GET /api/v1/verify-email?token=:\n\n%s\n\n", token)
+	}
+	fmt.Fprintf(&body, "The link is valid for %s.\n", s.ttl)
+
+	sendInBackground(s.mailer, mail.Message{To: user.Email, Subject: "Confirm your email address", Body: body.String()})
+	return nil
+}
+
+func (s *emailVerificationService) Verify(token string) (entity.User, error) {
+	userID, email, err := s.verify(token)
+	if err != nil {
+		return entity.User{}, err
+	}
+	user, err := s.userRepo.GetByID(userID)
+	if errors.Is(err, repository.ErrUserNotFound) || (err == nil && user.Email != email) {
+		return entity.User{}, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return entity.User{}, err
+	}
+	if !user.VerificationPending {
+		return user, nil
+	}
+	user.VerificationPending = false
+	return s.userRepo.Update(user)
+}
+
+func (s *emailVerificationService) Resend(email string) error {
+	user, err := s.userRepo.GetByEmail(email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !user.VerificationPending || time.Since(user.VerificationSentAt) < s.resendInterval {
+		return nil
+	}
+	return s.Send(user)
+}
+
+func (s *emailVerificationService) sign(user entity.User, expires time.Time) string {
+	payload := strconv.FormatInt(user.ID, 10) + "." + user.Email + "." + strconv.FormatInt(expires.Unix(), 10)
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded))
+}
+
+func (s *emailVerificationService) verify(token string) (int64, string, error) {
+	if s.key == nil {
+		return 0, "", ErrMissingSecret
+	}
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, "", ErrInvalidVerificationToken
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, s.mac(encoded)) {
+		return 0, "", ErrInvalidVerificationToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return 0, "", ErrInvalidVerificationToken
+	}
+
+	// The email may contain dots, so take the ID and expiry from the ends
+	fields := string(payload)
+	first, last := strings.Index(fields, "."), strings.LastIndex(fields, ".")
+	if first < 0 || first == last {
+		return 0, "", ErrInvalidVerificationToken
+	}
+	userID, err1 := strconv.ParseInt(fields[:first], 10, 64)
+	expires, err2 := strconv.ParseInt(fields[last+1:], 10, 64)
+	if err1 != nil || err2 != nil || time.Now().Unix() > expires {
+		return 0, "", ErrInvalidVerificationToken
+	}
+	return userID, fields[first+1 : last], nil
+}
+
+func (s *emailVerificationService) mac(data string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// sendInBackground delivers msg without making the caller wait, so response
+// times do not reveal whether an account exists.
+func sendInBackground(mailer mail.Mailer, msg mail.Message) {
+	go func() {
+		if err := mailer.Send(msg); err != nil {
+			log.Printf("Sending %q email to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
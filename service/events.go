@@ -0,0 +1,150 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+)
+
+// EventBus passes change events from the services to subscribers in the
+// same process. It keeps the most recent events so that a subscriber that
+// reconnects can resume after the last one it saw.
+type EventBus interface {
+	// Publish sends an event of eventType to every subscriber. data is
+	// marshalled to JSON right away, so later changes to it are not seen.
+	Publish(eventType string, data interface{})
+	// Subscribe starts a subscription that first has the kept events
+	// after lastID, then every new one. A lastID of 0 starts with new
+	// events only.
+	Subscribe(lastID int64) *EventSubscription
+	// Unsubscribe ends a subscription and closes its channel.
+	Unsubscribe(sub *EventSubscription)
+	// Close ends every subscription, for shutting down. Later
+	// subscriptions are closed right away.
+	Close()
+}
+
+// EventSubscription is one subscriber's view of the bus.
+type EventSubscription struct {
+	// Backlog holds the kept events after the requested ID, oldest first.
+	Backlog []entity.Event
+	// Missed is set when the requested ID is no longer kept, so events
+	// may have been lost and the subscriber should reload its state.
+	Missed bool
+	// Events delivers the events published after Subscribe. Publish never
+	// waits for a subscriber: one that falls a full buffer behind is
+	// dropped and its channel closed, and it has to subscribe again from
+	// the last ID it handled.
+	Events <-chan entity.Event
+
+	events chan entity.Event
+}
+
+type eventBus struct {
+	ids          IDGenerator
+	historySize  int
+	clientBuffer int
+	now          func() time.Time
+
+	mu          sync.Mutex
+	history     []entity.Event
+	subscribers map[*EventSubscription]struct{}
+	closed      bool
+}
+
+// NewEventBus returns a bus that keeps the last historySize events and
+// buffers up to clientBuffer events for each subscriber.
+func NewEventBus(ids IDGenerator, historySize, clientBuffer int) EventBus {
+	return &eventBus{
+		ids:          ids,
+		historySize:  historySize,
+		clientBuffer: clientBuffer,
+		now:          time.Now,
+		subscribers:  make(map[*EventSubscription]struct{}),
+	}
+}
+
+func (b *eventBus) Publish(eventType string, data interface{}) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Publishing %s: %v", eventType, err)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// IDs are taken under the lock so they increase in publishing order
+	event := entity.Event{ID: b.ids.NewID(), Type: eventType, Time: b.now().UTC(), Data: raw}
+	if b.historySize > 0 {
+		if len(b.history) == b.historySize {
+			b.history = append(b.history[:0], b.history[1:]...)
+		}
+		b.history = append(b.history, event)
+	}
+	for sub := range b.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+func (b *eventBus) Subscribe(lastID int64) *EventSubscription {
+	events := make(chan entity.Event, b.clientBuffer)
+	sub := &EventSubscription{Events: events, events: events}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if lastID != 0 {
+		sub.Backlog, sub.Missed = b.since(lastID)
+	}
+	if b.closed {
+		close(events)
+		return sub
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// since returns the kept events after lastID, or all of them and true if
+// lastID is not kept. The caller holds b.mu.
+func (b *eventBus) since(lastID int64) ([]entity.Event, bool) {
+	for i, event := range b.history {
+		if event.ID == lastID {
+			return append([]entity.Event{}, b.history[i+1:]...), false
+		}
+	}
+	return append([]entity.Event{}, b.history...), true
+}
+
+func (b *eventBus) Unsubscribe(sub *EventSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+func (b *eventBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// publicUser is the form of a user in events, without the password hash
+// and secrets.
+func publicUser(user entity.User) entity.User {
+	user = user.WithoutSecrets()
+	user.Password = ""
+	return user
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/repository"
+	"github.com/google/uuid"
+)
+
+// IDGenerator hands out identifiers for new entities. Numeric IDs (users)
+// are snowflake IDs and string IDs (books) are UUIDv7; both sort by
+// creation time and cannot collide between concurrent requests.
+type IDGenerator interface {
+	NewID() int64
+	NewUUID() string
+}
+
+// A snowflake ID packs, from the most significant bit,
+//
+//	1 bit unused (always 0) | 41 bits milliseconds since idEpoch | 10 bits node | 12 bits sequence
+//
+// so one node can issue 4096 IDs per millisecond for about 69 years.
+const (
+	nodeBits     = 10
+	sequenceBits = 12
+	maxNodeID    = 1<<nodeBits - 1
+	maxSequence  = 1<<sequenceBits - 1
+)
+
+var idEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type idGenerator struct {
+	mu       sync.Mutex
+	node     int64
+	lastTime int64
+	sequence int64
+	now      func() time.Time
+}
+
+// NewIDGenerator returns a generator for the given node, which must be
+// between 0 and config.MaxNodeID. Every server process writing to the same store
+// needs its own node ID.
+func NewIDGenerator(node int) IDGenerator {
+	return &idGenerator{node: int64(node) & maxNodeID, now: time.Now}
+}
+
+func (g *idGenerator) NewID() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := g.now().Sub(idEpoch).Milliseconds()
+	// If the clock went backwards keep counting from the last timestamp
+	// rather than reissuing IDs
+	if ms < g.lastTime {
+		ms = g.lastTime
+	}
+	if ms == g.lastTime {
+		g.sequence = (g.sequence + 1) & maxSequence
+		if g.sequence == 0 {
+			// Sequence exhausted for this millisecond; borrow the next one
+			ms++
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastTime = ms
+
+	return ms<<(nodeBits+sequenceBits) | g.node<<sequenceBits | g.sequence
+}
+
+func (g *idGenerator) NewUUID() string {
+	id, err := uuid.NewV7()
+	if err != nil {
+		// Only fails if the system random source does
+		return uuid.NewString()
+	}
+	return id.String()
+}
+
+// NewUserID returns an ID no stored user has. Users created before IDs were
+// generated here have nanosecond timestamps as IDs, which a snowflake ID
+// could in principle equal, and CreateUser replaces a user with the same
+// ID, so the ID is checked before use.
+func NewUserID(repo repository.UserRepository, ids IDGenerator) (int64, error) {
+	for {
+		id := ids.NewID()
+		_, err := repo.GetByID(id)
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return id, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
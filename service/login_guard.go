@@ -0,0 +1,192 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+)
+
+// LoginGuardConfig controls how repeated authentication failures for an
+// account are slowed down and eventually locked out.
+type LoginGuardConfig struct {
+	// FreeAttempts is the number of failures allowed before delays start.
+	FreeAttempts int
+	// BaseDelay is the delay after the first delayed failure; it doubles
+	// with every further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutThreshold is the number of failures that locks the account
+	// for LockoutDuration. Zero disables lockout.
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// ResetAfter forgets failures once an account has been quiet this long.
+	ResetAfter time.Duration
+}
+
+// LockedError is returned while an account must wait before it may try to
+// authenticate again.
+type LockedError struct {
+	Account    string
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LockedError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("account %s is temporarily locked", e.Account)
+	}
+	return fmt.Sprintf("too many failed attempts for %s", e.Account)
+}
+
+// LoginGuard tracks authentication failures per account.
+type LoginGuard interface {
+	// Allow returns a *LockedError if the account may not try yet.
+	Allow(account string) error
+	Fail(account string)
+	Succeed(account string)
+	Lockouts() []entity.Lockout
+	Unlock(account string) bool
+}
+
+type loginAttempts struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+	locked       bool
+}
+
+type loginGuard struct {
+	mu        sync.Mutex
+	cfg       LoginGuardConfig
+	accounts  map[string]*loginAttempts
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewLoginGuard(cfg LoginGuardConfig) LoginGuard {
+	return &loginGuard{
+		cfg:      cfg,
+		accounts: make(map[string]*loginAttempts),
+		now:      time.Now,
+	}
+}
+
+func accountKey(account string) string {
+	return strings.ToLower(strings.TrimSpace(account))
+}
+
+func (g *loginGuard) Allow(account string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := accountKey(account)
+	a, ok := g.accounts[key]
+	if !ok {
+		return nil
+	}
+	now := g.now()
+	if now.Before(a.blockedUntil) {
+		return &LockedError{Account: key, RetryAfter: a.blockedUntil.Sub(now), Locked: a.locked}
+	}
+	if g.expired(a, now) {
+		delete(g.accounts, key)
+	}
+	return nil
+}
+
+func (g *loginGuard) Fail(account string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	g.sweep(now)
+
+	key := accountKey(account)
+	a, ok := g.accounts[key]
+	if !ok || g.expired(a, now) {
+		a = &loginAttempts{}
+		g.accounts[key] = a
+	}
+	a.failures++
+	a.lastFailure = now
+
+	switch {
+	case g.cfg.LockoutThreshold > 0 && a.failures >= g.cfg.LockoutThreshold:
+		a.locked = true
+		a.blockedUntil = now.Add(g.cfg.LockoutDuration)
+	case a.failures >= g.cfg.FreeAttempts && g.cfg.BaseDelay > 0:
+		delay := g.cfg.BaseDelay
+		for i := g.cfg.FreeAttempts; i < a.failures && delay < g.cfg.MaxDelay; i++ {
+			delay *= 2
+		}
+		if g.cfg.MaxDelay > 0 && delay > g.cfg.MaxDelay {
+			delay = g.cfg.MaxDelay
+		}
+		a.blockedUntil = now.Add(delay)
+	}
+}
+
+func (g *loginGuard) Succeed(account string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.accounts, accountKey(account))
+}
+
+func (g *loginGuard) Lockouts() []entity.Lockout {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	result := []entity.Lockout{}
+	for key, a := range g.accounts {
+		if g.expired(a, now) {
+			continue
+		}
+		result = append(result, entity.Lockout{
+			Account:      key,
+			Failures:     a.failures,
+			LastFailure:  a.lastFailure,
+			BlockedUntil: a.blockedUntil,
+			Locked:       a.locked && now.Before(a.blockedUntil),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Account < result[j].Account })
+	return result
+}
+
+func (g *loginGuard) Unlock(account string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := accountKey(account)
+	if _, ok := g.accounts[key]; !ok {
+		return false
+	}
+	delete(g.accounts, key)
+	return true
+}
+
+// expired reports whether the failures recorded for an account are old
+// enough to be forgotten.
+func (g *loginGuard) expired(a *loginAttempts, now time.Time) bool {
+	if now.Before(a.blockedUntil) || g.cfg.ResetAfter <= 0 {
+		return false
+	}
+	return now.Sub(a.lastFailure) > g.cfg.ResetAfter
+}
+
+func (g *loginGuard) sweep(now time.Time) {
+	if g.cfg.ResetAfter <= 0 || now.Sub(g.lastSweep) < g.cfg.ResetAfter {
+		return
+	}
+	g.lastSweep = now
+	for key, a := range g.accounts {
+		if g.expired(a, now) {
+			delete(g.accounts, key)
+		}
+	}
+}
@@ -0,0 +1,509 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+	"github.com/golang-jwt/jwt"
+)
+
+// OAuthError is an error response defined by RFC 6749. Code is one of the
+// registered error codes, such as "invalid_grant".
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(code, description string) error {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// PKCEMethodS256 is the only code challenge method accepted (RFC 7636);
+// "plain" offers no protection if the request is observed.
+const PKCEMethodS256 = "S256"
+
+// pkcePattern matches code verifiers and S256 challenges: 43 to 128
+// characters of the unreserved URL set.
+var pkcePattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// OAuthClientRegistration describes a client to register.
+type OAuthClientRegistration struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"`
+	Scopes       []string `json:"scopes"`
+	// Public clients, such as browser or mobile apps, get no secret.
+	Public bool `json:"public"`
+}
+
+// AuthorizationRequest holds the parameters of a request to
+// /oauth/authorize.
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// TokenResponse is the successful response of the token endpoint.
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+// Introspection is the response of the introspection endpoint (RFC 7662).
+// Inactive tokens only report Active.
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	ID        string `json:"jti,omitempty"`
+}
+
+// OAuthService is a small OAuth2 authorization server. It issues the same
+// JWTs as the login endpoints, carrying the granted scopes and the client
+// ID. Client credentials tokens act on behalf of the client's owner.
+type OAuthService interface {
+	// RegisterClient registers a client for the owner and returns it with
+	// its secret, which cannot be shown again. Public clients get no
+	// secret.
+	RegisterClient(ownerID int64, reg OAuthClientRegistration) (entity.OAuthClient, string, error)
+	ListClients(ownerID int64) ([]entity.OAuthClient, error)
+	// DeleteClient deletes one of the owner's clients. Clients of other
+	// users are reported as not found.
+	DeleteClient(ownerID int64, id string) error
+	// AuthenticateClient checks a client's credentials. Public clients
+	// authenticate with their ID alone.
+	AuthenticateClient(id, secret string) (entity.OAuthClient, error)
+
+	// CheckRedirect returns the client and redirect URI of an
+	// authorization request. Errors mean the user must not be redirected.
+	CheckRedirect(req AuthorizationRequest) (entity.OAuthClient, string, error)
+	// CheckAuthorization validates the remaining parameters; its errors
+	// are reported to the client through the redirect.
+	CheckAuthorization(req AuthorizationRequest) error
+	// Authorize issues an authorization code for a user who logged in
+	// with methods.
+	Authorize(req AuthorizationRequest, user entity.User, methods []string) (string, error)
+
+	ClientCredentials(client entity.OAuthClient, scope string) (TokenResponse, error)
+	ExchangeCode(client entity.OAuthClient, code, redirectURI, verifier string) (TokenResponse, error)
+	Introspect(token string) Introspection
+	// Revoke revokes a token issued to client. Invalid tokens are ignored
+	// (RFC 7009).
+	Revoke(client entity.OAuthClient, token string) error
+}
+
+type authorizationCode struct {
+	clientID      string
+	userID        int64
+	redirectURI   string
+	scopes        []string
+	methods       []string
+	codeChallenge string
+	expiresAt     time.Time
+}
+
+type oauthService struct {
+	clients  repository.OAuthClientRepository
+	userRepo repository.UserRepository
+	tokens   TokenService
+	ids      IDGenerator
+	tokenTTL time.Duration
+	codeTTL  time.Duration
+
+	mu sync.Mutex
+	// codes maps the hash of each outstanding authorization code to it.
+	codes map[string]authorizationCode
+}
+
+func NewOAuthService(clients repository.OAuthClientRepository, userRepo repository.UserRepository, tokens TokenService, ids IDGenerator, tokenTTL, codeTTL time.Duration) OAuthService {
+	return &oauthService{
+		clients:  clients,
+		userRepo: userRepo,
+		tokens:   tokens,
+		ids:      ids,
+		tokenTTL: tokenTTL,
+		codeTTL:  codeTTL,
+		codes:    make(map[string]authorizationCode),
+	}
+}
+
+func (s *oauthService) RegisterClient(ownerID int64, reg OAuthClientRegistration) (entity.OAuthClient, string, error) {
+	owner, err := s.userRepo.GetByID(ownerID)
+	if err != nil {
+		return entity.OAuthClient{}, "", err
+	}
+	if strings.TrimSpace(reg.Name) == "" {
+		return entity.OAuthClient{}, "", oauthError("invalid_client_metadata", "name is required")
+	}
+	if len(reg.GrantTypes) == 0 {
+		return entity.OAuthClient{}, "", oauthError("invalid_client_metadata", "grant_types is required")
+	}
+	for _, grant := range reg.GrantTypes {
+		switch grant {
+		case entity.GrantAuthorizationCode:
+		case entity.GrantClientCredentials:
+			if reg.Public {
+				return entity.OAuthClient{}, "", oauthError("invalid_client_metadata", "public clients cannot use client_credentials")
+			}
+		default:
+			return entity.OAuthClient{}, "", oauthError("invalid_client_metadata", "unsupported grant type "+grant)
+		}
+	}
+	for _, uri := range reg.RedirectURIs {
+		if !validRedirectURI(uri) {
+			return entity.OAuthClient{}, "", oauthError("invalid_redirect_uri", uri+" must be an absolute https URL, or http on a loopback address, without a fragment")
+		}
+	}
+	if len(reg.RedirectURIs) == 0 && contains(reg.GrantTypes, entity.GrantAuthorizationCode) {
+		return entity.OAuthClient{}, "", oauthError("invalid_redirect_uri", "authorization_code clients need a redirect URI")
+	}
+	if len(reg.Scopes) == 0 {
+		return entity.OAuthClient{}, "", oauthError("invalid_client_metadata", "scopes is required")
+	}
+	for _, scope := range reg.Scopes {
+		if !entity.ValidScope(scope) {
+			return entity.OAuthClient{}, "", oauthError("invalid_client_metadata", "unknown scope "+scope)
+		}
+		if scope == entity.ScopeUsersAdmin && owner.Role != entity.RoleAdmin {
+			return entity.OAuthClient{}, "", ErrScopeNotAllowed
+		}
+	}
+
+	client := entity.OAuthClient{
+		ID:           s.ids.NewUUID(),
+		Name:         strings.TrimSpace(reg.Name),
+		OwnerID:      ownerID,
+		RedirectURIs: reg.RedirectURIs,
+		GrantTypes:   reg.GrantTypes,
+		Scopes:       reg.Scopes,
+		CreatedAt:    time.Now(),
+	}
+	var secret string
+	if !reg.Public {
+		if secret, err = randomToken(); err != nil {
+			return entity.OAuthClient{}, "", err
+		}
+		client.SecretHash = hashToken(secret)
+	}
+	client, err = s.clients.CreateOAuthClient(client)
+	if err != nil {
+		return entity.OAuthClient{}, "", err
+	}
+	return client, secret, nil
+}
+
+// validRedirectURI follows RFC 8252: redirect URIs are https, except for
+// native apps listening on a loopback address.
+func validRedirectURI(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+	return false
+}
+
+func (s *oauthService) ListClients(ownerID int64) ([]entity.OAuthClient, error) {
+	return s.clients.ListOAuthClients(ownerID)
+}
+
+func (s *oauthService) DeleteClient(ownerID int64, id string) error {
+	client, err := s.clients.GetOAuthClient(id)
+	if err != nil {
+		return err
+	}
+	if client.OwnerID != ownerID {
+		return repository.ErrOAuthClientNotFound
+	}
+	return s.clients.DeleteOAuthClient(id)
+}
+
+func (s *oauthService) AuthenticateClient(id, secret string) (entity.OAuthClient, error) {
+	client, err := s.clients.GetOAuthClient(id)
+	if errors.Is(err, repository.ErrOAuthClientNotFound) {
+		return entity.OAuthClient{}, oauthError("invalid_client", "unknown client")
+	}
+	if err != nil {
+		return entity.OAuthClient{}, err
+	}
+	if client.Public() {
+		if secret != "" {
+			return entity.OAuthClient{}, oauthError("invalid_client", "public clients have no secret")
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return entity.OAuthClient{}, oauthError("invalid_client", "invalid client credentials")
+	}
+	return client, nil
+}
+
+func (s *oauthService) CheckRedirect(req AuthorizationRequest) (entity.OAuthClient, string, error) {
+	client, err := s.clients.GetOAuthClient(req.ClientID)
+	if err != nil {
+		return entity.OAuthClient{}, "", oauthError("invalid_client", "unknown client")
+	}
+	redirectURI := req.RedirectURI
+	// The redirect URI may be left out if only one is registered
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !client.AllowsRedirect(redirectURI) {
+		return entity.OAuthClient{}, "", oauthError("invalid_request", "redirect_uri is not registered for this client")
+	}
+	return client, redirectURI, nil
+}
+
+func (s *oauthService) CheckAuthorization(req AuthorizationRequest) error {
+	client, _, err := s.CheckRedirect(req)
+	if err != nil {
+		return err
+	}
+	if req.ResponseType != "code" {
+		return oauthError("unsupported_response_type", "only response_type=code is supported")
+	}
+	if !client.AllowsGrant(entity.GrantAuthorizationCode) {
+		return oauthError("unauthorized_client", "client may not use the authorization code grant")
+	}
+	if req.CodeChallengeMethod != PKCEMethodS256 || !pkcePattern.MatchString(req.CodeChallenge) {
+		return oauthError("invalid_request", "a code_challenge with code_challenge_method=S256 is required")
+	}
+	if _, err := requestedScopes(client, req.Scope); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *oauthService) Authorize(req AuthorizationRequest, user entity.User, methods []string) (string, error) {
+	if err := s.CheckAuthorization(req); err != nil {
+		return "", err
+	}
+	client, redirectURI, _ := s.CheckRedirect(req)
+	scopes, _ := requestedScopes(client, req.Scope)
+	scopes = scopesForUser(scopes, user)
+	if len(scopes) == 0 {
+		return "", oauthError("invalid_scope", "none of the requested scopes can be granted to this user")
+	}
+
+	code, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, c := range s.codes {
+		if now.After(c.expiresAt) {
+			delete(s.codes, hash)
+		}
+	}
+	s.codes[hashToken(code)] = authorizationCode{
+		clientID:      client.ID,
+		userID:        user.ID,
+		redirectURI:   redirectURI,
+		scopes:        scopes,
+		methods:       methods,
+		codeChallenge: req.CodeChallenge,
+		expiresAt:     now.Add(s.codeTTL),
+	}
+	return code, nil
+}
+
+func (s *oauthService) ClientCredentials(client entity.OAuthClient, scope string) (TokenResponse, error) {
+	if client.Public() || !client.AllowsGrant(entity.GrantClientCredentials) {
+		return TokenResponse{}, oauthError("unauthorized_client", "client may not use the client_credentials grant")
+	}
+	scopes, err := requestedScopes(client, scope)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	owner, err := s.userRepo.GetByID(client.OwnerID)
+	if err != nil || owner.Disabled {
+		return TokenResponse{}, oauthError("invalid_client", "the client's owner is not active")
+	}
+	scopes = scopesForUser(scopes, owner)
+	if len(scopes) == 0 {
+		return TokenResponse{}, oauthError("invalid_scope", "none of the requested scopes can be granted to the client's owner")
+	}
+	return s.issue(owner, client, scopes, nil)
+}
+
+func (s *oauthService) ExchangeCode(client entity.OAuthClient, code, redirectURI, verifier string) (TokenResponse, error) {
+	if !client.AllowsGrant(entity.GrantAuthorizationCode) {
+		return TokenResponse{}, oauthError("unauthorized_client", "client may not use the authorization code grant")
+	}
+	s.mu.Lock()
+	hash := hashToken(code)
+	c, ok := s.codes[hash]
+	// Codes work once, whether or not the exchange succeeds
+	delete(s.codes, hash)
+	s.mu.Unlock()
+
+	if !ok || time.Now().After(c.expiresAt) || c.clientID != client.ID {
+		return TokenResponse{}, oauthError("invalid_grant", "invalid or expired authorization code")
+	}
+	if redirectURI != c.redirectURI {
+		return TokenResponse{}, oauthError("invalid_grant", "redirect_uri does not match the authorization request")
+	}
+	if !pkcePattern.MatchString(verifier) {
+		return TokenResponse{}, oauthError("invalid_grant", "invalid code_verifier")
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(c.codeChallenge)) != 1 {
+		return TokenResponse{}, oauthError("invalid_grant", "code_verifier does not match the code_challenge")
+	}
+
+	user, err := s.userRepo.GetByID(c.userID)
+	if err != nil || user.Disabled {
+		return TokenResponse{}, oauthError("invalid_grant", "the user is not active")
+	}
+	return s.issue(user, client, c.scopes, c.methods)
+}
+
+func (s *oauthService) issue(user entity.User, client entity.OAuthClient, scopes, methods []string) (TokenResponse, error) {
+	issued, err := s.tokens.Issue(user, TokenOptions{
+		Methods:  methods,
+		Scopes:   scopes,
+		ClientID: client.ID,
+		TTL:      s.tokenTTL,
+	})
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	return TokenResponse{
+		AccessToken: issued.Token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(time.Until(issued.ExpiresAt).Round(time.Second).Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+func (s *oauthService) Introspect(token string) Introspection {
+	claims, err := s.tokens.Parse(token)
+	if err != nil {
+		return Introspection{}
+	}
+	info := Introspection{Active: true, TokenType: "Bearer"}
+	info.Scope, _ = claims["scope"].(string)
+	info.ClientID, _ = claims["client_id"].(string)
+	info.Username, _ = claims["email"].(string)
+	info.ID, _ = claims["jti"].(string)
+	if userID, err := UserIDFromClaims(claims); err == nil {
+		info.Subject = strconv.FormatInt(userID, 10)
+	}
+	info.IssuedAt = claimInt(claims, "iat")
+	info.ExpiresAt = claimInt(claims, "exp")
+	return info
+}
+
+func (s *oauthService) Revoke(client entity.OAuthClient, token string) error {
+	claims, err := s.tokens.Parse(token)
+	if err != nil {
+		return nil
+	}
+	if clientID, _ := claims["client_id"].(string); clientID != client.ID {
+		return oauthError("unauthorized_client", "the token was not issued to this client")
+	}
+	s.tokens.Revoke(claims)
+	return nil
+}
+
+// requestedScopes returns the scopes of a space separated request,
+// defaulting to all of the client's scopes. Asking for a scope the client
+// was not registered with is an error.
+func requestedScopes(client entity.OAuthClient, scope string) ([]string, error) {
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		return client.Scopes, nil
+	}
+	var scopes []string
+	for _, s := range requested {
+		if !contains(client.Scopes, s) {
+			return nil, oauthError("invalid_scope", "scope "+s+" is not available to this client")
+		}
+		if !contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, nil
+}
+
+// scopesForUser drops users:admin unless user is an admin. The response
+// tells the client which scopes were granted (RFC 6749 section 3.3).
+func scopesForUser(scopes []string, user entity.User) []string {
+	var granted []string
+	for _, s := range scopes {
+		if s == entity.ScopeUsersAdmin && user.Role != entity.RoleAdmin {
+			continue
+		}
+		granted = append(granted, s)
+	}
+	return granted
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func claimInt(claims jwt.MapClaims, name string) int64 {
+	switch v := claims[name].(type) {
+	case json.Number:
+		n, _ := v.Int64()
+		return n
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	}
+	return 0
+}
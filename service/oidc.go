@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+	"github.com/biswasurmi/book-cli/infrastructure/oidc"
+)
+
+var (
+	ErrInvalidOIDCState     = errors.New("invalid or expired login state")
+	ErrOIDCDomainNotAllowed = errors.New("email domain not allowed")
+	ErrOIDCNoAccount        = errors.New("no account for this identity")
+	ErrOIDCPendingAccount   = errors.New("account awaits email verification")
+)
+
+// AuthMethodExternal is recorded in the amr claim of tokens for logins at
+// an external OpenID Connect provider.
+const AuthMethodExternal = "ext"
+
+// oidcStateTTL bounds how long a user may take at the provider.
+const oidcStateTTL = 10 * time.Minute
+
+// OIDCConfig configures the matching of provider identities to users.
+type OIDCConfig struct {
+	// AllowedDomains, if set, limits logins to these email domains.
+	AllowedDomains []string
+	// CreateUsers creates a user on the first login of an unknown identity.
+	CreateUsers bool
+}
+
+// OIDCService logs users in through an external OpenID Connect provider.
+// Each login starts with AuthURL, which remembers a state, nonce and PKCE
+// verifier, and ends with Callback once the provider redirects back.
+type OIDCService interface {
+	// AuthURL returns the provider URL to send the user to.
+	AuthURL(ctx context.Context) (string, error)
+	// Callback completes a login and returns the user together with the
+	// authentication methods to record in their token. The login is
+	// recorded in the audit log.
+	Callback(ctx context.Context, actor Actor, code, state string) (entity.User, []string, error)
+}
+
+type oidcLogin struct {
+	nonce     string
+	verifier  string
+	expiresAt time.Time
+}
+
+type oidcService struct {
+	provider *oidc.Provider
+	userRepo repository.UserRepository
+	ids      IDGenerator
+	audit    AuditService
+	cfg      OIDCConfig
+
+	mu sync.Mutex
+	// logins maps the state of each login in progress to it.
+	logins map[string]oidcLogin
+}
+
+func NewOIDCService(provider *oidc.Provider, userRepo repository.UserRepository, ids IDGenerator, audit AuditService, cfg OIDCConfig) OIDCService {
+	return &oidcService{
+		provider: provider,
+		userRepo: userRepo,
+		ids:      ids,
+		audit:    audit,
+		cfg:      cfg,
+		logins:   make(map[string]oidcLogin),
+	}
+}
+
+func (s *oidcService) AuthURL(ctx context.Context) (string, error) {
+	var state, nonce, verifier string
+	for _, v := range []*string{&state, &nonce, &verifier} {
+		token, err := randomToken()
+		if err != nil {
+			return "", err
+		}
+		*v = token
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	authURL, err := s.provider.AuthCodeURL(ctx, state, nonce, base64.RawURLEncoding.EncodeToString(sum[:]))
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, login := range s.logins {
+		if now.After(login.expiresAt) {
+			delete(s.logins, key)
+		}
+	}
+	s.logins[state] = oidcLogin{nonce: nonce, verifier: verifier, expiresAt: now.Add(oidcStateTTL)}
+	return authURL, nil
+}
+
+func (s *oidcService) Callback(ctx context.Context, actor Actor, code, state string) (entity.User, []string, error) {
+	user, methods, err := s.callback(ctx, code, state)
+	if err != nil {
+		s.audit.RecordLogin(actor, user.ID, err)
+		return entity.User{}, nil, err
+	}
+	// Users with two-factor authentication whose provider did not ask for a
+	// second factor are logged in once they pass ours
+	if !user.TOTPEnabled || contains(methods, AuthMethodOTP) {
+		s.audit.RecordLogin(actor, user.ID, nil)
+	}
+	return user, methods, nil
+}
+
+// callback does the work of Callback. On failure it returns the user as far
+// as it is known, for the audit log.
+func (s *oidcService) callback(ctx context.Context, code, state string) (entity.User, []string, error) {
+	// A state works once, whether or not the login succeeds
+	s.mu.Lock()
+	login, ok := s.logins[state]
+	delete(s.logins, state)
+	s.mu.Unlock()
+	if !ok || state == "" || time.Now().After(login.expiresAt) {
+		return entity.User{}, nil, ErrInvalidOIDCState
+	}
+
+	rawIDToken, err := s.provider.Exchange(ctx, code, login.verifier)
+	if err != nil {
+		return entity.User{}, nil, err
+	}
+	claims, err := s.provider.Verify(ctx, rawIDToken, login.nonce)
+	if err != nil {
+		return entity.User{}, nil, err
+	}
+
+	user, err := s.user(claims)
+	if err != nil {
+		return entity.User{}, nil, err
+	}
+	if user.Disabled {
+		return user, nil, ErrAccountDisabled
+	}
+
+	methods := []string{AuthMethodExternal}
+	if contains(claims.AMR, AuthMethodOTP) || contains(claims.AMR, "mfa") {
+		methods = append(methods, AuthMethodOTP)
+	}
+	return user, methods, nil
+}
+
+// user finds the user for a provider identity: first by subject, then by
+// verified email, linking the identity to that user. Unknown identities get
+// a new user if CreateUsers is set. Users still awaiting email verification
+// are never linked, since anyone could have registered them with a password
+// of their own.
+func (s *oidcService) user(claims oidc.Claims) (entity.User, error) {
+	users, err := s.userRepo.GetAllUsers()
+	if err != nil {
+		return entity.User{}, err
+	}
+	for _, u := range users {
+		if u.ExternalIssuer == claims.Issuer && u.ExternalSubject == claims.Subject {
+			return u, nil
+		}
+	}
+
+	email := entity.NormalizeEmail(claims.Email)
+	if !claims.EmailVerified || !strings.Contains(email, "@") {
+		return entity.User{}, ErrEmailNotVerified
+	}
+	if len(s.cfg.AllowedDomains) > 0 {
+		domain := email[strings.LastIndex(email, "@")+1:]
+		allowed := false
+		for _, d := range s.cfg.AllowedDomains {
+			allowed = allowed || strings.EqualFold(strings.TrimSpace(d), domain)
+		}
+		if !allowed {
+			return entity.User{}, ErrOIDCDomainNotAllowed
+		}
+	}
+
+	user, err := s.userRepo.GetByEmail(email)
+	if err == nil {
+		// Users who already linked another identity keep it
+		if user.ExternalSubject != "" {
+			return entity.User{}, ErrOIDCNoAccount
+		}
+		if user.VerificationPending {
+			return entity.User{}, ErrOIDCPendingAccount
+		}
+		user.ExternalIssuer = claims.Issuer
+		user.ExternalSubject = claims.Subject
+		// The provider vouches for the address
+		user.VerificationPending = false
+		return s.userRepo.Update(user)
+	}
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		return entity.User{}, err
+	}
+
+	if !s.cfg.CreateUsers {
+		return entity.User{}, ErrOIDCNoAccount
+	}
+	id, err := NewUserID(s.userRepo, s.ids)
+	if err != nil {
+		return entity.User{}, err
+	}
+	// Without a password hash the user can only log in through the
+	// provider, until they set one with a password reset
+	return s.userRepo.CreateUser(entity.User{
+		ID:              id,
+		Email:           email,
+		Role:            entity.RoleUser,
+		CreatedAt:       time.Now(),
+		ExternalIssuer:  claims.Issuer,
+		ExternalSubject: claims.Subject,
+	})
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/biswasurmi/book-cli/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is enforced wherever a user picks a password.
+const MinPasswordLength = 8
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// PasswordHasher hashes passwords for storage. Argon2id hashes use the PHC
+// string format, $argon2id$v=19$m=<KiB>,t=<iterations>,p=<threads>$<salt>$<hash>;
+// bcrypt hashes use their usual $2a$ form. Both can always be verified,
+// whichever algorithm is configured for new hashes.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches hash and, if it does,
+	// whether hash should be replaced because it was made with another
+	// algorithm or other parameters than the configured ones.
+	Verify(hash, password string) (ok, rehash bool, err error)
+}
+
+type passwordHasher struct {
+	cfg config.Passwords
+}
+
+func NewPasswordHasher(cfg config.Passwords) PasswordHasher {
+	return &passwordHasher{cfg: cfg}
+}
+
+func (h *passwordHasher) Hash(password string) (string, error) {
+	if h.cfg.Algorithm == config.HashBcrypt {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.cfg.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hashed), nil
+	}
+
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	params := argon2Params{
+		memory:      uint32(h.cfg.Argon2Memory),
+		iterations:  uint32(h.cfg.Argon2Iterations),
+		parallelism: uint8(h.cfg.Argon2Parallelism),
+	}
+	key := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		params.memory, params.iterations, params.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *passwordHasher) Verify(hash, password string) (bool, bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := parseArgon2(hash)
+		if err != nil {
+			return false, false, err
+		}
+		got := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(got, key) != 1 {
+			return false, false, nil
+		}
+		rehash := h.cfg.Algorithm != config.HashArgon2id ||
+			params.memory != uint32(h.cfg.Argon2Memory) ||
+			params.iterations != uint32(h.cfg.Argon2Iterations) ||
+			params.parallelism != uint8(h.cfg.Argon2Parallelism) ||
+			len(key) != argon2KeyLength
+		return true, rehash, nil
+
+	case strings.HasPrefix(hash, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		rehash := err != nil || h.cfg.Algorithm != config.HashBcrypt || cost != h.cfg.BcryptCost
+		return true, rehash, nil
+	}
+	return false, false, ErrUnknownHashFormat
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+func parseArgon2(hash string) (argon2Params, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	fields := strings.Split(hash, "$")
+	if len(fields) != 6 {
+		return argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+	var version int
+	if _, err := fmt.Sscanf(fields[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+	var params argon2Params
+	if _, err := fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil ||
+		params.iterations < 1 || params.parallelism < 1 {
+		return argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(fields[4])
+	if err != nil {
+		return argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(fields[5])
+	if err != nil || len(key) == 0 {
+		return argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+	return params, salt, key, nil
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+	"github.com/biswasurmi/book-cli/infrastructure/mail"
+)
+
+var (
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+	ErrPasswordTooShort  = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+)
+
+// PasswordResetService lets users who forgot their password set a new one
+// through a single-use link sent by email.
+type PasswordResetService interface {
+	// RequestReset emails a reset link if a user with the email exists.
+	// It reports nothing about whether one does.
+	RequestReset(email string) error
+	// ResetPassword sets a new password for the token's user, consumes the
+	// token and revokes the user's existing sessions.
+	ResetPassword(token, password string) error
+}
+
+type resetToken struct {
+	userID    int64
+	expiresAt time.Time
+}
+
+// Reset tokens are kept in memory, like login failures: a restart only
+// means the user has to ask for a new link. Only a SHA-256 hash of each
+// token is stored, so a dump of the map cannot be used to reset passwords.
+type passwordResetService struct {
+	userRepo  repository.UserRepository
+	guard     LoginGuard
+	passwords PasswordHasher
+	mailer    mail.Mailer
+	ttl       time.Duration
+	publicURL string
+
+	mu     sync.Mutex
+	tokens map[string]resetToken // by token hash
+}
+
+func NewPasswordResetService(userRepo repository.UserRepository, guard LoginGuard, passwords PasswordHasher, mailer mail.Mailer, ttl time.Duration, publicURL string) PasswordResetService {
+	return &passwordResetService{
+		userRepo:  userRepo,
+		guard:     guard,
+		passwords: passwords,
+		mailer:    mailer,
+		ttl:       ttl,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		tokens:    make(map[string]resetToken),
+	}
+}
+
+func (s *passwordResetService) RequestReset(email string) error {
+	user, err := s.userRepo.GetByEmail(email)
+	if errors.Is(err, repository.ErrUserNotFound) || (err == nil && user.Disabled) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, hash, err := newResetToken()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	for h, t := range s.tokens {
+		// Only the latest link of a user stays valid
+		if t.userID == user.ID || now.After(t.expiresAt) {
+			delete(s.tokens, h)
+		}
+	}
+	s.tokens[hash] = resetToken{userID: user.ID, expiresAt: now.Add(s.ttl)}
+	s.mu.Unlock()
+
+	sendInBackground(s.mailer, mail.Message{To: user.Email, Subject: "Reset your password", Body: s.resetBody(token)})
+	return nil
+}
+
+func (s *passwordResetService) resetBody(token string) string {
+	var b strings.Builder
+	b.WriteString("Someone asked to reset the password of your Book API account.\n\n")
+	if s.publicURL != "" {
+		fmt.Fprintf(&b, "Open this link to choose a new password:\n\n%s/reset-password?token=%s\n\n", s.publicURL, url.QueryEscape(token))
+	}
+	fmt.Fprintf(&b, "Or send this token to POST /api/v1/password/reset:\n\n%s\n\n", token)
+	fmt.Fprintf(&b, "The token is valid for %s and can be used once. If you did not ask for this, ignore this email.\n", s.ttl)
+	return b.String()
+}
+
+func (s *passwordResetService) ResetPassword(token, password string) error {
+	if len(password) < MinPasswordLength {
+		return ErrPasswordTooShort
+	}
+
+	// Consume the token before doing anything else so it cannot be used
+	// twice, even by concurrent requests
+	hash := hashToken(token)
+	s.mu.Lock()
+	t, ok := s.tokens[hash]
+	delete(s.tokens, hash)
+	s.mu.Unlock()
+	if !ok || time.Now().After(t.expiresAt) {
+		return ErrInvalidResetToken
+	}
+
+	user, err := s.userRepo.GetByID(t.userID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+
+	hashed, err := s.passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+	user.Password = hashed
+	user.SessionsRevokedAt = time.Now()
+	if _, err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	// Proving control of the mailbox is as good as knowing the password
+	s.guard.Unlock(entity.NormalizeEmail(user.Email))
+	return nil
+}
+
+func newResetToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// hashToken returns the form in which single-use tokens are kept, so a
+// leaked copy of the server's state does not reveal usable tokens.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
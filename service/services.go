@@ -1,15 +1,78 @@
 package service
 
-import "github.com/biswasurmi/book-cli/domain/repository"
+import (
+	"github.com/biswasurmi/book-cli/config"
+	"github.com/biswasurmi/book-cli/domain/repository"
+	"github.com/biswasurmi/book-cli/infrastructure/mail"
+	"github.com/biswasurmi/book-cli/infrastructure/oidc"
+)
 
 type Services struct {
-	BookService BookService
-	UserService UserService
+	BookService   BookService
+	UserService   UserService
+	LoginGuard    LoginGuard
+	TokenService  TokenService
+	IDs           IDGenerator
+	PasswordReset PasswordResetService
+	Verification  EmailVerificationService
+	Passwords     PasswordHasher
+	TwoFactor     TwoFactorService
+	APIKeys       APIKeyService
+	OAuth         OAuthService
+	Audit         AuditService
+	Trash         TrashService
+	Events        EventBus
+	Webhooks      WebhookService
+	// OIDC is nil unless login through an OpenID Connect provider is
+	// enabled.
+	OIDC OIDCService
 }
 
-func GetServices(repos *repository.Repositories) *Services {
-	return &Services{
-		BookService: NewBookService(repos.BookRepository),
-		UserService: NewUserService(repos.UserRepository),
+func GetServices(repos *repository.Repositories, cfg *config.Config) *Services {
+	guard := NewLoginGuard(LoginGuardConfig{
+		FreeAttempts:     cfg.Lockout.FreeAttempts,
+		BaseDelay:        cfg.Lockout.BaseDelay,
+		MaxDelay:         cfg.Lockout.MaxDelay,
+		LockoutThreshold: cfg.Lockout.Threshold,
+		LockoutDuration:  cfg.Lockout.Duration,
+		ResetAfter:       cfg.Lockout.ResetAfter,
+	})
+	ids := NewIDGenerator(cfg.Server.NodeID)
+	mailer := mail.New(cfg.Mail)
+	passwords := NewPasswordHasher(cfg.Passwords)
+	tokens := NewTokenService(cfg.Auth.JWTSecret, cfg.Auth.TokenTTL, repos.UserRepository)
+	audit := NewAuditService(repos.AuditRepository, ids)
+	events := NewEventBus(ids, cfg.Events.History, cfg.Events.ClientBuffer)
+	services := &Services{
+		BookService:   NewBookService(repos.BookRepository, repos.BookRevisionRepository, ids, audit, events),
+		UserService:   NewUserService(repos.UserRepository, guard, ids, passwords, audit, events, cfg.Auth.RequireVerifiedEmail),
+		LoginGuard:    guard,
+		TokenService:  tokens,
+		IDs:           ids,
+		PasswordReset: NewPasswordResetService(repos.UserRepository, guard, passwords, mailer, cfg.Auth.ResetTokenTTL, cfg.Server.PublicURL),
+		Passwords:     passwords,
+		Verification: NewEmailVerificationService(repos.UserRepository, mailer, cfg.Auth.JWTSecret,
+			cfg.Auth.VerificationTTL, cfg.Auth.VerificationResendInterval, cfg.Server.PublicURL),
+		TwoFactor: NewTwoFactorService(repos.UserRepository, guard, audit, cfg.Auth.TOTPIssuer),
+		APIKeys:   NewAPIKeyService(repos.APIKeyRepository, repos.UserRepository, ids, cfg.Auth.APIKeyTTL, cfg.Auth.APIKeyMaxTTL),
+		OAuth:     NewOAuthService(repos.OAuthClientRepository, repos.UserRepository, tokens, ids, cfg.Auth.OAuthTokenTTL, cfg.Auth.OAuthCodeTTL),
+		Audit:     audit,
+		Trash:     NewTrashService(repos.BookRepository, repos.BookRevisionRepository, repos.UserRepository, audit, events, cfg.Trash.Retention),
+		Events:    events,
+		Webhooks:  NewWebhookService(repos.WebhookRepository, repos.WebhookDeliveryRepository, events, ids, audit, cfg.Webhooks),
 	}
-}
\ No newline at end of file
+	if cfg.OIDC.Enabled {
+		provider := oidc.New(oidc.Config{
+			IssuerURL:    cfg.OIDC.IssuerURL,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.CallbackURL(cfg.Server.PublicURL),
+			Scopes:       cfg.OIDC.Scopes,
+		})
+		services.OIDC = NewOIDCService(provider, repos.UserRepository, ids, audit, OIDCConfig{
+			AllowedDomains: cfg.OIDC.AllowedDomains,
+			CreateUsers:    cfg.OIDC.CreateUsers,
+		})
+	}
+	return services
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+	"github.com/golang-jwt/jwt"
+)
+
+var (
+	ErrMissingSecret = errors.New("jwt secret is not configured")
+	// ErrNoScopes is returned when a token for an OAuth2 client would have
+	// no scopes, which would leave it without a scope claim.
+	ErrNoScopes = errors.New("delegated token has no scopes")
+)
+
+// TokenService issues and verifies the HS256 JWTs handed out by the login,
+// token and OAuth2 endpoints.
+type TokenService interface {
+	// Generate issues a login token for user with every scope of their
+	// role. methods are recorded in the amr claim, e.g. AuthMethodPassword
+	// and AuthMethodOTP.
+	Generate(user entity.User, methods ...string) (string, error)
+	// Issue issues a token for user with the given options.
+	Issue(user entity.User, opts TokenOptions) (IssuedToken, error)
+	Parse(tokenString string) (jwt.MapClaims, error)
+	// Revoke makes Parse reject the token with these claims until it
+	// expires. Revocations are kept in memory only.
+	Revoke(claims jwt.MapClaims)
+}
+
+// TokenOptions are the optional claims of a token.
+type TokenOptions struct {
+	// Methods are recorded in the amr claim.
+	Methods []string
+	// Scopes restrict what the token may be used for and are recorded,
+	// space separated, in the scope claim. A token for an OAuth2 client
+	// must have at least one.
+	Scopes []string
+	// ClientID is recorded in the client_id claim of tokens issued to an
+	// OAuth2 client.
+	ClientID string
+	// TTL replaces the service's token lifetime if positive.
+	TTL time.Duration
+}
+
+// IssuedToken is a signed token and the claims a caller may need to report.
+type IssuedToken struct {
+	Token     string
+	ID        string
+	ExpiresAt time.Time
+}
+
+type tokenService struct {
+	secret []byte
+	ttl    time.Duration
+	users  repository.UserRepository
+
+	mu sync.Mutex
+	// revokedIDs maps the jti of revoked tokens to their expiry.
+	revokedIDs map[string]time.Time
+}
+
+// NewTokenService returns a token service. Tokens of a user in users are
+// rejected if they were issued before the user's SessionsRevokedAt.
+func NewTokenService(secret string, ttl time.Duration, users repository.UserRepository) TokenService {
+	return &tokenService{secret: []byte(secret), ttl: ttl, users: users, revokedIDs: make(map[string]time.Time)}
+}
+
+func (s *tokenService) Generate(user entity.User, methods ...string) (string, error) {
+	issued, err := s.Issue(user, TokenOptions{Methods: methods, Scopes: entity.RoleScopes(user.Role)})
+	return issued.Token, err
+}
+
+// LoginScopes returns the scopes of a login token for user. requested is a
+// space separated list of scopes as in OAuth2; if it is empty the token
+// gets every scope of the user's role. Scopes the role does not have are
+// refused with ErrScopeNotAllowed rather than silently dropped, so clients
+// notice at login instead of on a later 403.
+func LoginScopes(user entity.User, requested string) ([]string, error) {
+	allowed := entity.RoleScopes(user.Role)
+	fields := strings.Fields(requested)
+	if len(fields) == 0 {
+		return allowed, nil
+	}
+	var scopes []string
+	for _, scope := range fields {
+		if !entity.ValidScope(scope) && scope != entity.ScopeAccount {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+		if !contains(allowed, scope) {
+			return nil, fmt.Errorf("%w: %s", ErrScopeNotAllowed, scope)
+		}
+		if !contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+func (s *tokenService) Issue(user entity.User, opts TokenOptions) (IssuedToken, error) {
+	if len(s.secret) == 0 {
+		return IssuedToken{}, ErrMissingSecret
+	}
+	if opts.ClientID != "" && len(opts.Scopes) == 0 {
+		return IssuedToken{}, ErrNoScopes
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return IssuedToken{}, err
+	}
+	ttl := s.ttl
+	if opts.TTL > 0 {
+		ttl = opts.TTL
+	}
+
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+	// sub carries the ID as a string so clients that decode JSON numbers as
+	// doubles do not lose precision. user_id is kept for tokens consumers
+	// that have not switched to sub yet.
+	claims["sub"] = strconv.FormatInt(user.ID, 10)
+	claims["user_id"] = user.ID
+	claims["email"] = user.Email
+	claims["jti"] = hex.EncodeToString(id)
+	if len(opts.Methods) > 0 {
+		claims["amr"] = opts.Methods
+	}
+	if len(opts.Scopes) > 0 {
+		claims["scope"] = strings.Join(opts.Scopes, " ")
+	}
+	if opts.ClientID != "" {
+		claims["client_id"] = opts.ClientID
+	}
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims["iat"] = now.Unix()
+	claims["exp"] = expiresAt.Unix()
+
+	signed, err := token.SignedString(s.secret)
+	if err != nil {
+		return IssuedToken{}, err
+	}
+	return IssuedToken{Token: signed, ID: claims["jti"].(string), ExpiresAt: time.Unix(expiresAt.Unix(), 0)}, nil
+}
+
+func (s *tokenService) Parse(tokenString string) (jwt.MapClaims, error) {
+	if len(s.secret) == 0 {
+		return nil, ErrMissingSecret
+	}
+
+	// Decode numbers as json.Number so large user IDs survive intact
+	parser := &jwt.Parser{UseJSONNumber: true}
+	token, err := parser.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return s.secret, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	if s.revoked(claims) || s.revokedID(claims) {
+		return nil, errors.New("token revoked")
+	}
+	if _, ok := claims["scope"]; !ok {
+		claims["scope"] = s.legacyScope(claims)
+	}
+	return claims, nil
+}
+
+// legacyScope is the scope claim of a token issued before tokens carried
+// scopes. Only login tokens were issued then, so it gets the scopes of the
+// user's current role, or none if the user is unknown.
+func (s *tokenService) legacyScope(claims jwt.MapClaims) string {
+	if s.users == nil {
+		return ""
+	}
+	userID, err := UserIDFromClaims(claims)
+	if err != nil {
+		return ""
+	}
+	user, err := s.users.GetByID(userID)
+	if err != nil {
+		return ""
+	}
+	return strings.Join(entity.RoleScopes(user.Role), " ")
+}
+
+func (s *tokenService) Revoke(claims jwt.MapClaims) {
+	id, _ := claims["jti"].(string)
+	if id == "" {
+		return
+	}
+	// Without an expiry keep the revocation for as long as a token can live
+	expiresAt := time.Now().Add(s.ttl)
+	if exp, ok := claims["exp"].(json.Number); ok {
+		if unix, err := exp.Int64(); err == nil {
+			expiresAt = time.Unix(unix, 0)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for jti, exp := range s.revokedIDs {
+		if now.After(exp) {
+			delete(s.revokedIDs, jti)
+		}
+	}
+	s.revokedIDs[id] = expiresAt
+}
+
+func (s *tokenService) revokedID(claims jwt.MapClaims) bool {
+	id, _ := claims["jti"].(string)
+	if id == "" {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.revokedIDs[id]
+	return ok
+}
+
+// revoked reports whether the token's user has revoked its sessions since
+// the token was issued. Tokens without iat predate revocation support and
+// count as issued at the epoch.
+func (s *tokenService) revoked(claims jwt.MapClaims) bool {
+	if s.users == nil {
+		return false
+	}
+	userID, err := UserIDFromClaims(claims)
+	if err != nil {
+		return false
+	}
+	user, err := s.users.GetByID(userID)
+	if err != nil || user.SessionsRevokedAt.IsZero() {
+		return false
+	}
+	var issuedAt int64
+	if iat, ok := claims["iat"].(json.Number); ok {
+		issuedAt, _ = iat.Int64()
+	}
+	return issuedAt < user.SessionsRevokedAt.Unix()
+}
+
+// UserIDFromClaims returns the ID of the user a token was issued for. It
+// reads the sub claim and falls back to user_id for tokens issued before
+// sub was added.
+func UserIDFromClaims(claims jwt.MapClaims) (int64, error) {
+	if sub, ok := claims["sub"].(string); ok {
+		return strconv.ParseInt(sub, 10, 64)
+	}
+	switch id := claims["user_id"].(type) {
+	case json.Number:
+		return id.Int64()
+	case int64:
+		return id, nil
+	case float64:
+		return int64(id), nil
+	}
+	return 0, errors.New("token has no user ID")
+}
+
+// HasAuthMethod reports whether the amr claim of a token lists method.
+func HasAuthMethod(claims jwt.MapClaims, method string) bool {
+	switch amr := claims["amr"].(type) {
+	case []interface{}:
+		for _, m := range amr {
+			if m == method {
+				return true
+			}
+		}
+	case []string:
+		for _, m := range amr {
+			if m == method {
+				return true
+			}
+		}
+	}
+	return false
+}
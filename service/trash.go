@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+)
+
+// TrashService manages deleted books and users. Deleting only moves them
+// to the trash, where admins can list and restore them until they are
+// purged for good after the retention period.
+type TrashService interface {
+	List() (entity.Trash, error)
+	RestoreBook(actor Actor, uuid string) (entity.Book, error)
+	RestoreUser(actor Actor, id int64) (entity.User, error)
+	// Purge removes the books and users deleted more than the retention
+	// period before now, with the revisions of the books, and returns how
+	// many it removed. A retention period of 0 keeps them forever.
+	Purge(now time.Time) (int, error)
+	// Run purges every interval until ctx is cancelled.
+	Run(ctx context.Context, interval time.Duration)
+}
+
+type trashService struct {
+	bookRepo     repository.BookRepository
+	revisionRepo repository.BookRevisionRepository
+	userRepo     repository.UserRepository
+	audit        AuditService
+	events       EventBus
+	retention    time.Duration
+}
+
+func NewTrashService(bookRepo repository.BookRepository, revisionRepo repository.BookRevisionRepository, userRepo repository.UserRepository, audit AuditService, events EventBus, retention time.Duration) TrashService {
+	return &trashService{bookRepo: bookRepo, revisionRepo: revisionRepo, userRepo: userRepo, audit: audit, events: events, retention: retention}
+}
+
+func (s *trashService) List() (entity.Trash, error) {
+	books, err := s.bookRepo.GetDeletedBooks()
+	if err != nil {
+		return entity.Trash{}, err
+	}
+	users, err := s.userRepo.GetDeletedUsers()
+	if err != nil {
+		return entity.Trash{}, err
+	}
+	trash := entity.Trash{Books: []entity.Book{}, Users: []entity.User{}}
+	trash.Books = append(trash.Books, books...)
+	trash.Users = append(trash.Users, users...)
+	return trash, nil
+}
+
+func (s *trashService) RestoreBook(actor Actor, uuid string) (entity.Book, error) {
+	before := s.deletedBook(uuid)
+	restored, err := s.bookRepo.RestoreBook(uuid)
+	if err != nil {
+		return entity.Book{}, err
+	}
+	s.audit.RecordChange(actor, entity.AuditBookRestore, entity.AuditTargetBook, uuid, before, restored)
+	s.events.Publish(entity.EventBookRestored, restored)
+	return restored, nil
+}
+
+func (s *trashService) RestoreUser(actor Actor, id int64) (entity.User, error) {
+	before := s.deletedUser(id)
+	restored, err := s.userRepo.RestoreUser(id)
+	if err != nil {
+		return entity.User{}, err
+	}
+	s.audit.RecordChange(actor, entity.AuditUserRestore, entity.AuditTargetUser, userTarget(id), before, restored)
+	s.events.Publish(entity.EventUserRestored, publicUser(restored))
+	return restored, nil
+}
+
+func (s *trashService) Purge(now time.Time) (int, error) {
+	if s.retention <= 0 {
+		return 0, nil
+	}
+	cutoff := now.Add(-s.retention)
+	purged := 0
+
+	books, err := s.bookRepo.GetDeletedBooks()
+	if err != nil {
+		return purged, err
+	}
+	for _, book := range books {
+		if book.DeletedAt.After(cutoff) {
+			continue
+		}
+		err := s.bookRepo.PurgeDeletedBook(book.UUID, cutoff)
+		if errors.Is(err, repository.ErrBookNotFound) {
+			// Restored or purged since it was listed
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+		if err := s.revisionRepo.DeleteBookRevisions(book.UUID); err != nil {
+			return purged, err
+		}
+		s.audit.RecordChange(Actor{}, entity.AuditBookPurge, entity.AuditTargetBook, book.UUID, book, nil)
+		purged++
+	}
+
+	users, err := s.userRepo.GetDeletedUsers()
+	if err != nil {
+		return purged, err
+	}
+	for _, user := range users {
+		if user.DeletedAt.After(cutoff) {
+			continue
+		}
+		err := s.userRepo.PurgeDeletedUser(user.ID, cutoff)
+		if errors.Is(err, repository.ErrUserNotFound) {
+			// Restored or purged since it was listed
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+		s.audit.RecordChange(Actor{}, entity.AuditUserPurge, entity.AuditTargetUser, userTarget(user.ID), user, nil)
+		purged++
+	}
+	return purged, nil
+}
+
+func (s *trashService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			purged, err := s.Purge(now)
+			if err != nil {
+				log.Printf("Trash purge: %v", err)
+			}
+			if purged > 0 {
+				log.Printf("Purged %d items from the trash", purged)
+			}
+		}
+	}
+}
+
+// deletedBook returns the book from the trash for the audit log, or nil
+// if it is not there.
+func (s *trashService) deletedBook(uuid string) interface{} {
+	books, _ := s.bookRepo.GetDeletedBooks()
+	for _, book := range books {
+		if book.UUID == uuid {
+			return book
+		}
+	}
+	return nil
+}
+
+// deletedUser returns the user from the trash for the audit log, or nil
+// if they are not there.
+func (s *trashService) deletedUser(id int64) interface{} {
+	users, _ := s.userRepo.GetDeletedUsers()
+	for _, user := range users {
+		if user.ID == id {
+			return user
+		}
+	}
+	return nil
+}
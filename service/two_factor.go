@@ -0,0 +1,433 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+)
+
+var (
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication is not enrolled")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	ErrInvalidChallenge     = errors.New("invalid or expired two-factor challenge")
+)
+
+// Authentication methods recorded in the amr claim of a token (RFC 8176)
+const (
+	AuthMethodPassword = "pwd"
+	AuthMethodOTP      = "otp"
+)
+
+const (
+	totpPeriod = 30 // seconds
+	totpDigits = 6
+	// totpSkew is the number of steps a code may be early or late, to
+	// allow for clock drift between the server and the authenticator.
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+	challengeTTL      = 5 * time.Minute
+	// challengeAttempts is how many codes may be tried against a single
+	// challenge. The login guard limits attempts across challenges.
+	challengeAttempts = 5
+)
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTPEnrollment is what an authenticator app needs to generate codes.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// TwoFactorService manages TOTP (RFC 6238) enrollment and the second step of
+// logins for users who enabled it. Codes may be replaced by one of the
+// recovery codes handed out on confirmation, each of which works once.
+type TwoFactorService interface {
+	// Enroll gives the user a new secret. It is not required at login
+	// until Confirm succeeds.
+	Enroll(userID int64) (TOTPEnrollment, error)
+	// Confirm enables two-factor authentication if code matches the
+	// enrolled secret and returns the recovery codes. They are not stored
+	// in plain text and cannot be shown again.
+	Confirm(userID int64, code string) ([]string, error)
+	// Disable turns two-factor authentication off after checking a code.
+	Disable(userID int64, code string) error
+	// RegenerateRecoveryCodes replaces the recovery codes after checking a
+	// code.
+	RegenerateRecoveryCodes(userID int64, code string) ([]string, error)
+	// Check verifies a code for a user who passed the password check and
+	// records the login in the audit log.
+	Check(actor Actor, user entity.User, code string) error
+	// Challenge starts the second login step for a password-verified user
+	// and returns a short-lived token identifying it.
+	Challenge(user entity.User) (string, error)
+	// Complete finishes a login started by Challenge and records it in the
+	// audit log.
+	Complete(actor Actor, challenge, code string) (entity.User, error)
+}
+
+type loginChallenge struct {
+	userID    int64
+	expiresAt time.Time
+	attempts  int
+}
+
+type twoFactorService struct {
+	userRepo repository.UserRepository
+	guard    LoginGuard
+	audit    AuditService
+	issuer   string
+
+	// mu serialises code checks so a code cannot be accepted twice by
+	// concurrent requests, and guards challenges.
+	mu         sync.Mutex
+	challenges map[string]loginChallenge // keyed by SHA-256 of the token
+}
+
+// NewTwoFactorService returns a two-factor service. issuer names the
+// service in authenticator apps. Wrong codes count as failed logins in
+// guard.
+func NewTwoFactorService(userRepo repository.UserRepository, guard LoginGuard, audit AuditService, issuer string) TwoFactorService {
+	return &twoFactorService{
+		userRepo:   userRepo,
+		guard:      guard,
+		audit:      audit,
+		issuer:     issuer,
+		challenges: make(map[string]loginChallenge),
+	}
+}
+
+func (s *twoFactorService) Enroll(userID int64) (TOTPEnrollment, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	if user.TOTPEnabled {
+		return TOTPEnrollment{}, ErrTwoFactorEnabled
+	}
+
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return TOTPEnrollment{}, err
+	}
+	user.TOTPSecret = base32NoPadding.EncodeToString(secret)
+	user.TOTPLastStep = 0
+	if _, err := s.userRepo.Update(user); err != nil {
+		return TOTPEnrollment{}, err
+	}
+	return TOTPEnrollment{Secret: user.TOTPSecret, URI: s.uri(user)}, nil
+}
+
+func (s *twoFactorService) uri(user entity.User) string {
+	query := url.Values{}
+	query.Set("secret", user.TOTPSecret)
+	query.Set("issuer", s.issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(s.issuer + ":" + user.Email)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+func (s *twoFactorService) Confirm(userID int64, code string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	step, ok := matchTOTP(user, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	user.RecoveryCodes = hashes
+	if _, err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *twoFactorService) Disable(userID int64, code string) error {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnrolled
+	}
+	if err := s.check(user, code); err != nil {
+		return err
+	}
+
+	// Reload so the code just consumed is not written back
+	user, err = s.userRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPLastStep = 0
+	user.RecoveryCodes = nil
+	_, err = s.userRepo.Update(user)
+	return err
+}
+
+func (s *twoFactorService) RegenerateRecoveryCodes(userID int64, code string) ([]string, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if err := s.check(user, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	user, err = s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	user.RecoveryCodes = hashes
+	if _, err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *twoFactorService) Check(actor Actor, user entity.User, code string) error {
+	err := s.check(user, code)
+	s.audit.RecordLogin(actor, user.ID, err)
+	return err
+}
+
+// check verifies code against the guard like a password: while the account
+// is locked out it returns a *LockedError, and wrong codes count as
+// failures.
+func (s *twoFactorService) check(user entity.User, code string) error {
+	if err := s.guard.Allow(user.Email); err != nil {
+		return err
+	}
+	if err := s.consume(user.ID, code); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			s.guard.Fail(user.Email)
+		}
+		return err
+	}
+	s.guard.Succeed(user.Email)
+	return nil
+}
+
+// consume accepts a TOTP code for a step after the last accepted one, or an
+// unused recovery code, and records that it has been used.
+func (s *twoFactorService) consume(userID int64, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Load the stored user rather than trusting the caller's copy, which
+	// may predate a code accepted concurrently
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnrolled
+	}
+
+	if step, ok := matchTOTP(user, code, time.Now()); ok {
+		user.TOTPLastStep = step
+	} else if i := matchRecoveryCode(user, code); i >= 0 {
+		remaining := make([]string, 0, len(user.RecoveryCodes)-1)
+		remaining = append(remaining, user.RecoveryCodes[:i]...)
+		user.RecoveryCodes = append(remaining, user.RecoveryCodes[i+1:]...)
+	} else {
+		return ErrInvalidTwoFactorCode
+	}
+	_, err = s.userRepo.Update(user)
+	return err
+}
+
+func (s *twoFactorService) Challenge(user entity.User) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, c := range s.challenges {
+		if now.After(c.expiresAt) {
+			delete(s.challenges, hash)
+		}
+	}
+	s.challenges[hashToken(token)] = loginChallenge{userID: user.ID, expiresAt: now.Add(challengeTTL)}
+	return token, nil
+}
+
+func (s *twoFactorService) Complete(actor Actor, challenge, code string) (entity.User, error) {
+	user, err := s.complete(challenge, code)
+	s.audit.RecordLogin(actor, user.ID, err)
+	if err != nil {
+		return entity.User{}, err
+	}
+	return user, nil
+}
+
+// complete does the work of Complete. On failure it returns the user as far
+// as it is known, for the audit log.
+func (s *twoFactorService) complete(challenge, code string) (entity.User, error) {
+	hash := hashToken(challenge)
+	s.mu.Lock()
+	c, ok := s.challenges[hash]
+	if ok && time.Now().After(c.expiresAt) {
+		delete(s.challenges, hash)
+		ok = false
+	}
+	s.mu.Unlock()
+	if !ok {
+		return entity.User{}, ErrInvalidChallenge
+	}
+
+	user, err := s.userRepo.GetByID(c.userID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return entity.User{}, ErrInvalidChallenge
+	}
+	if err != nil {
+		return entity.User{}, err
+	}
+	if user.Disabled {
+		return user, ErrAccountDisabled
+	}
+
+	if err := s.check(user, code); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			s.mu.Lock()
+			if c, ok := s.challenges[hash]; ok {
+				c.attempts++
+				if c.attempts >= challengeAttempts {
+					delete(s.challenges, hash)
+				} else {
+					s.challenges[hash] = c
+				}
+			}
+			s.mu.Unlock()
+		}
+		return user, err
+	}
+
+	s.mu.Lock()
+	delete(s.challenges, hash)
+	s.mu.Unlock()
+	return user, nil
+}
+
+// matchTOTP reports whether code is valid for the user's secret at t and
+// newer than the last accepted code, and returns its time step.
+func matchTOTP(user entity.User, code string, t time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := t.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= user.TOTPLastStep {
+			continue
+		}
+		expected, err := totpAt(user.TOTPSecret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// GenerateTOTP returns the code for a base32 secret at t, as an
+// authenticator app would show it.
+func GenerateTOTP(secret string, t time.Time) (string, error) {
+	return totpAt(secret, t.Unix()/totpPeriod)
+}
+
+func totpAt(secret string, step int64) (string, error) {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// newRecoveryCodes returns codes like "k3j9-x2mq" and their hashes.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(base32NoPadding.EncodeToString(raw))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+func matchRecoveryCode(user entity.User, code string) int {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if code == "" {
+		return -1
+	}
+	hash := hashToken(code)
+	for i, stored := range user.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			return i
+		}
+	}
+	return -1
+}
@@ -1,29 +1,60 @@
 package service
 
 import (
+    "errors"
+    "log"
+    "strconv"
+    "sync"
+    "time"
+
     "github.com/biswasurmi/book-cli/domain/entity"
     "github.com/biswasurmi/book-cli/domain/repository"
 )
 
+var ErrAccountDisabled = errors.New("account disabled")
+
 type UserService interface {
-    CreateUser(user entity.User) (entity.User, error)
+    CreateUser(actor Actor, user entity.User) (entity.User, error)
     GetByID(id int64) (entity.User, error)
     GetByEmail(email string) (entity.User, error)
-    Update(user entity.User) (entity.User, error)
-    Delete(user entity.User) error
-    Authenticate(email, password string) (entity.User, error)
+    Update(actor Actor, user entity.User) (entity.User, error)
+    Delete(actor Actor, user entity.User) error
+    Authenticate(actor Actor, email, password string) (entity.User, error)
 }
 
 type userService struct {
-    userRepo repository.UserRepository
+    userRepo  repository.UserRepository
+    guard     LoginGuard
+    ids       IDGenerator
+    passwords PasswordHasher
+    audit     AuditService
+    events    EventBus
+    // requireVerified refuses users whose email is not verified yet
+    requireVerified bool
+
+    dummyOnce sync.Once
+    dummy     string
 }
 
-func NewUserService(userRepo repository.UserRepository) UserService {
-    return &userService{userRepo: userRepo}
+func NewUserService(userRepo repository.UserRepository, guard LoginGuard, ids IDGenerator, passwords PasswordHasher, audit AuditService, events EventBus, requireVerified bool) UserService {
+    return &userService{userRepo: userRepo, guard: guard, ids: ids, passwords: passwords, audit: audit, events: events, requireVerified: requireVerified}
 }
 
-func (s *userService) CreateUser(user entity.User) (entity.User, error) {
-    return s.userRepo.CreateUser(user)
+// CreateUser stores a new user under a freshly generated ID.
+func (s *userService) CreateUser(actor Actor, user entity.User) (entity.User, error) {
+    id, err := NewUserID(s.userRepo, s.ids)
+    if err != nil {
+        return entity.User{}, err
+    }
+    user.ID = id
+    user.DeletedAt = time.Time{}
+    created, err := s.userRepo.CreateUser(user)
+    if err != nil {
+        return entity.User{}, err
+    }
+    s.audit.RecordChange(actor, entity.AuditUserCreate, entity.AuditTargetUser, userTarget(created.ID), nil, created)
+    s.events.Publish(entity.EventUserCreated, publicUser(created))
+    return created, nil
 }
 
 func (s *userService) GetByID(id int64) (entity.User, error) {
@@ -34,14 +65,128 @@ func (s *userService) GetByEmail(email string) (entity.User, error) {
     return s.userRepo.GetByEmail(email)
 }
 
-func (s *userService) Update(user entity.User) (entity.User, error) {
-    return s.userRepo.Update(user)
+func (s *userService) Update(actor Actor, user entity.User) (entity.User, error) {
+    existing, err := s.userRepo.GetByID(user.ID)
+    if err != nil {
+        return entity.User{}, err
+    }
+    updated, err := s.userRepo.Update(user)
+    if err != nil {
+        return entity.User{}, err
+    }
+    s.audit.RecordChange(actor, entity.AuditUserUpdate, entity.AuditTargetUser, userTarget(updated.ID), existing, updated)
+    s.events.Publish(entity.EventUserUpdated, publicUser(updated))
+    return updated, nil
 }
 
-func (s *userService) Delete(user entity.User) error {
-    return s.userRepo.Delete(user.ID)
+func (s *userService) Delete(actor Actor, user entity.User) error {
+    if existing, err := s.userRepo.GetByID(user.ID); err == nil {
+        user = existing
+    }
+    if err := s.userRepo.Delete(user.ID); err != nil {
+        return err
+    }
+    s.audit.RecordChange(actor, entity.AuditUserDelete, entity.AuditTargetUser, userTarget(user.ID), user, nil)
+    s.events.Publish(entity.EventUserDeleted, publicUser(user))
+    return nil
 }
 
-func (s *userService) Authenticate(email, password string) (entity.User, error) {
-    return s.userRepo.Authenticate(email, password)
-}
\ No newline at end of file
+// Authenticate verifies the credentials and records the outcome with the
+// login guard, returning a *LockedError while the account has to wait.
+// Failures are written to the audit log, and so are successes unless the
+// user still has to pass the second factor.
+func (s *userService) Authenticate(actor Actor, email, password string) (entity.User, error) {
+    user, err := s.authenticate(email, password)
+    if err != nil {
+        s.audit.RecordLogin(actor, user.ID, err)
+        return entity.User{}, err
+    }
+    if !user.TOTPEnabled {
+        s.audit.RecordLogin(actor, user.ID, nil)
+    }
+    return user, nil
+}
+
+// authenticate does the work of Authenticate. On failure it returns the
+// user as far as it is known, for the audit log.
+func (s *userService) authenticate(email, password string) (entity.User, error) {
+    // Key the guard on the canonical email so changing its case does not
+    // earn an attacker a fresh set of attempts
+    email = entity.NormalizeEmail(email)
+    if err := s.guard.Allow(email); err != nil {
+        user, _ := s.userRepo.GetByEmail(email)
+        return user, err
+    }
+    user, err := s.checkPassword(email, password)
+    if err != nil {
+        s.guard.Fail(email)
+        known, _ := s.userRepo.GetByEmail(email)
+        return known, err
+    }
+    // With two-factor authentication the login only succeeds once the code
+    // is checked, otherwise the password would reset the count of wrong codes
+    if !user.TOTPEnabled {
+        s.guard.Succeed(email)
+    }
+    if user.Disabled {
+        return user, ErrAccountDisabled
+    }
+    if s.requireVerified && user.VerificationPending {
+        return user, ErrEmailNotVerified
+    }
+    return user, nil
+}
+
+// userTarget is the audit log target ID of a user.
+func userTarget(id int64) string {
+    return strconv.FormatInt(id, 10)
+}
+
+// checkPassword returns the user with the email if password matches, and
+// replaces a hash made with outdated settings while the plain text password
+// is at hand.
+func (s *userService) checkPassword(email, password string) (entity.User, error) {
+    user, err := s.userRepo.GetByEmail(email)
+    if errors.Is(err, repository.ErrUserNotFound) {
+        // Spend the same time as for a wrong password so the response
+        // does not reveal whether the account exists
+        s.passwords.Verify(s.dummyHash(), password)
+        return entity.User{}, repository.ErrInvalidCredentials
+    }
+    if err != nil {
+        return entity.User{}, err
+    }
+
+    ok, rehash, err := s.passwords.Verify(user.Password, password)
+    if err != nil || !ok {
+        return entity.User{}, repository.ErrInvalidCredentials
+    }
+    if rehash {
+        if hashed, err := s.passwords.Hash(password); err != nil {
+            log.Printf("Rehashing password of user %d: %v", user.ID, err)
+        } else if updated, err := s.updatePassword(user.ID, hashed); err != nil {
+            log.Printf("Rehashing password of user %d: %v", user.ID, err)
+        } else {
+            user = updated
+        }
+    }
+    return user, nil
+}
+
+// updatePassword reloads the user before storing the new hash so changes
+// made since the lookup are kept.
+func (s *userService) updatePassword(id int64, hashed string) (entity.User, error) {
+    user, err := s.userRepo.GetByID(id)
+    if err != nil {
+        return entity.User{}, err
+    }
+    user.Password = hashed
+    return s.userRepo.Update(user)
+}
+
+func (s *userService) dummyHash() string {
+    s.dummyOnce.Do(func() {
+        s.dummy, _ = s.passwords.Hash("not a real password")
+    })
+    return s.dummy
+}
@@ -0,0 +1,529 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/biswasurmi/book-cli/config"
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+)
+
+var (
+	ErrInvalidWebhookURL   = errors.New("webhook url must be an absolute http or https url")
+	ErrInvalidWebhookEvent = errors.New("unknown event type")
+)
+
+// Headers sent with every webhook delivery. The signature is
+// "sha256=" followed by the hex HMAC-SHA256 of the timestamp, a dot and
+// the body, keyed with the webhook's secret.
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookEventIDHeader   = "X-Webhook-ID"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// WebhookUpdate changes a webhook. Fields left nil are kept. Setting
+// Active re-enables a webhook that was disabled after failing.
+type WebhookUpdate struct {
+	URL    *string   `json:"url"`
+	Events *[]string `json:"events"`
+	Active *bool     `json:"active"`
+}
+
+// WebhookService manages webhooks and delivers change events to them.
+type WebhookService interface {
+	// Create adds a webhook for the given event types, all of them if
+	// events is empty, with a new secret.
+	Create(actor Actor, url string, events []string) (entity.Webhook, error)
+	List() ([]entity.Webhook, error)
+	Get(id string) (entity.Webhook, error)
+	Update(actor Actor, id string, update WebhookUpdate) (entity.Webhook, error)
+	Delete(actor Actor, id string) error
+	// Deliveries returns the latest delivery attempts of a webhook, newest
+	// first.
+	Deliveries(id string) ([]entity.WebhookDelivery, error)
+	// Run delivers the events published after the service was created
+	// until ctx is cancelled. Deliveries still pending are stored, so the
+	// next Run carries on with them, and an attempt cut short by the
+	// cancellation is made again then.
+	Run(ctx context.Context)
+}
+
+// SignWebhook returns the signature of a delivery of body sent at
+// timestamp, as sent in the X-Webhook-Signature header.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type webhookService struct {
+	repo       repository.WebhookRepository
+	deliveries repository.WebhookDeliveryRepository
+	events     EventBus
+	ids        IDGenerator
+	audit      AuditService
+	cfg        config.Webhooks
+	client     *http.Client
+	now        func() time.Time
+
+	// mu serialises changes to webhooks, which workers make too
+	mu  sync.Mutex
+	sub *EventSubscription
+
+	// logMu serialises trimming the delivery log
+	logMu sync.Mutex
+}
+
+func NewWebhookService(repo repository.WebhookRepository, deliveries repository.WebhookDeliveryRepository, events EventBus, ids IDGenerator, audit AuditService, cfg config.Webhooks) WebhookService {
+	return &webhookService{
+		repo:       repo,
+		deliveries: deliveries,
+		events:     events,
+		ids:        ids,
+		audit:      audit,
+		cfg:        cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// A redirect counts as a failure rather than sending the
+			// payload somewhere else
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		now: time.Now,
+		// Subscribe right away so events published before Run starts
+		// are not missed
+		sub: events.Subscribe(0),
+	}
+}
+
+func (s *webhookService) Create(actor Actor, rawURL string, events []string) (entity.Webhook, error) {
+	if err := validateWebhook(rawURL, events); err != nil {
+		return entity.Webhook{}, err
+	}
+	secret, err := randomToken()
+	if err != nil {
+		return entity.Webhook{}, err
+	}
+	webhook := entity.Webhook{
+		ID:        s.ids.NewUUID(),
+		URL:       rawURL,
+		Events:    append([]string{}, events...),
+		Secret:    "whsec_" + secret,
+		Active:    true,
+		CreatedBy: actor.UserID,
+		CreatedAt: s.now().UTC(),
+	}
+	created, err := s.repo.CreateWebhook(webhook)
+	if err != nil {
+		return entity.Webhook{}, err
+	}
+	s.audit.RecordChange(actor, entity.AuditWebhookCreate, entity.AuditTargetWebhook, created.ID, nil, created.WithoutSecret())
+	return created, nil
+}
+
+func (s *webhookService) List() ([]entity.Webhook, error) {
+	return s.repo.GetAllWebhooks()
+}
+
+func (s *webhookService) Get(id string) (entity.Webhook, error) {
+	return s.repo.GetWebhook(id)
+}
+
+func (s *webhookService) Update(actor Actor, id string, update WebhookUpdate) (entity.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, err := s.repo.GetWebhook(id)
+	if err != nil {
+		return entity.Webhook{}, err
+	}
+	webhook := existing
+	if update.URL != nil {
+		webhook.URL = *update.URL
+	}
+	if update.Events != nil {
+		webhook.Events = append([]string{}, *update.Events...)
+	}
+	if err := validateWebhook(webhook.URL, webhook.Events); err != nil {
+		return entity.Webhook{}, err
+	}
+	if update.Active != nil {
+		if *update.Active && !existing.Active {
+			webhook.Failures = 0
+			webhook.DisabledAt = time.Time{}
+		}
+		webhook.Active = *update.Active
+	}
+	updated, err := s.repo.UpdateWebhook(webhook)
+	if err != nil {
+		return entity.Webhook{}, err
+	}
+	s.audit.RecordChange(actor, entity.AuditWebhookUpdate, entity.AuditTargetWebhook, id, existing.WithoutSecret(), updated.WithoutSecret())
+	return updated, nil
+}
+
+func (s *webhookService) Delete(actor Actor, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, err := s.repo.GetWebhook(id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteWebhook(id); err != nil {
+		return err
+	}
+	s.forget(id)
+	s.audit.RecordChange(actor, entity.AuditWebhookDelete, entity.AuditTargetWebhook, id, existing.WithoutSecret(), nil)
+	return nil
+}
+
+func (s *webhookService) Deliveries(id string) ([]entity.WebhookDelivery, error) {
+	if _, err := s.repo.GetWebhook(id); err != nil {
+		return nil, err
+	}
+	logged, err := s.deliveries.GetWebhookDeliveries(id)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]entity.WebhookDelivery, 0, len(logged))
+	for i := len(logged) - 1; i >= 0; i-- {
+		result = append(result, logged[i])
+	}
+	return result, nil
+}
+
+func validateWebhook(rawURL string, events []string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidWebhookURL
+	}
+	for _, eventType := range events {
+		if !contains(entity.EventTypes, eventType) {
+			return fmt.Errorf("%w %q", ErrInvalidWebhookEvent, eventType)
+		}
+	}
+	return nil
+}
+
+func (s *webhookService) Run(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	// Stop the workers and pending retries, then wait for the workers
+	defer wg.Wait()
+	defer cancel()
+
+	jobs := make(chan entity.PendingWebhookDelivery)
+	for i := 0; i < s.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-jobs:
+					s.attempt(ctx, jobs, job)
+				}
+			}
+		}()
+	}
+
+	// Carry on with the deliveries an earlier Run left pending
+	pending, err := s.deliveries.GetPendingWebhookDeliveries()
+	if err != nil {
+		log.Printf("Loading pending webhook deliveries: %v", err)
+	}
+	for _, job := range pending {
+		s.schedule(ctx, jobs, job)
+	}
+
+	sub := s.sub
+	var lastID int64
+	for {
+		received := 0
+	events:
+		for {
+			select {
+			case <-ctx.Done():
+				s.events.Unsubscribe(sub)
+				return
+			case event, ok := <-sub.Events:
+				if !ok {
+					break events
+				}
+				received++
+				lastID = event.ID
+				s.dispatch(ctx, jobs, event)
+			}
+		}
+		if received == 0 {
+			// A subscriber is only dropped after filling its buffer, so a
+			// subscription that ends empty means the bus was closed
+			return
+		}
+		// Dropped for falling behind, so pick up after the last event
+		sub = s.events.Subscribe(lastID)
+		if sub.Missed {
+			log.Printf("Webhooks fell behind the event history; some events were not delivered")
+		}
+		for _, event := range sub.Backlog {
+			lastID = event.ID
+			s.dispatch(ctx, jobs, event)
+		}
+	}
+}
+
+// dispatch stores the first delivery of event to every active webhook
+// that wants it as pending and queues it.
+func (s *webhookService) dispatch(ctx context.Context, jobs chan<- entity.PendingWebhookDelivery, event entity.Event) {
+	webhooks, err := s.repo.GetAllWebhooks()
+	if err != nil {
+		log.Printf("Loading webhooks for event %d: %v", event.ID, err)
+		return
+	}
+	for _, webhook := range webhooks {
+		if !webhook.Active || !webhook.Wants(event.Type) {
+			continue
+		}
+		job := entity.PendingWebhookDelivery{
+			ID:        s.ids.NewUUID(),
+			WebhookID: webhook.ID,
+			Event:     event,
+			Attempt:   1,
+			DueAt:     s.now().UTC(),
+		}
+		if err := s.deliveries.SavePendingWebhookDelivery(job); err != nil {
+			// Deliver it anyway; only a restart would lose it
+			log.Printf("Storing delivery of event %d to webhook %s: %v", event.ID, webhook.ID, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case jobs <- job:
+		}
+	}
+}
+
+// schedule queues job once it is due.
+func (s *webhookService) schedule(ctx context.Context, jobs chan<- entity.PendingWebhookDelivery, job entity.PendingWebhookDelivery) {
+	time.AfterFunc(job.DueAt.Sub(s.now()), func() {
+		select {
+		case <-ctx.Done():
+		case jobs <- job:
+		}
+	})
+}
+
+// attempt makes one delivery attempt, records it and schedules a retry
+// if it failed. The pending delivery is removed once it succeeds or is
+// given up.
+func (s *webhookService) attempt(ctx context.Context, jobs chan<- entity.PendingWebhookDelivery, job entity.PendingWebhookDelivery) {
+	webhook, err := s.repo.GetWebhook(job.WebhookID)
+	if err != nil || !webhook.Active {
+		// Deleted or disabled since the job was queued
+		s.done(job)
+		return
+	}
+	delivery := s.deliver(ctx, webhook, job)
+	if ctx.Err() != nil {
+		// Shutting down; the attempt did not get a fair chance, so the
+		// next Run makes it again
+		return
+	}
+	s.record(delivery)
+
+	retry, err := s.recordResult(webhook.ID, delivery)
+	if err != nil {
+		log.Printf("Updating webhook %s: %v", webhook.ID, err)
+		return
+	}
+	if !retry || job.Attempt >= s.cfg.MaxAttempts {
+		s.done(job)
+		return
+	}
+	job.Attempt++
+	job.DueAt = s.now().Add(s.backoff(job.Attempt - 1)).UTC()
+	if err := s.deliveries.SavePendingWebhookDelivery(job); err != nil {
+		log.Printf("Storing retry of event %d to webhook %s: %v", job.Event.ID, job.WebhookID, err)
+	}
+	s.schedule(ctx, jobs, job)
+}
+
+// done removes a pending delivery that needs no further attempts.
+func (s *webhookService) done(job entity.PendingWebhookDelivery) {
+	err := s.deliveries.DeletePendingWebhookDelivery(job.ID)
+	if err != nil && !errors.Is(err, repository.ErrWebhookDeliveryNotFound) {
+		log.Printf("Removing delivery of event %d to webhook %s: %v", job.Event.ID, job.WebhookID, err)
+	}
+}
+
+// deliver POSTs the event to the webhook.
+func (s *webhookService) deliver(ctx context.Context, webhook entity.Webhook, job entity.PendingWebhookDelivery) entity.WebhookDelivery {
+	start := s.now()
+	delivery := entity.WebhookDelivery{
+		ID:        s.ids.NewUUID(),
+		WebhookID: webhook.ID,
+		EventID:   job.Event.ID,
+		EventType: job.Event.Type,
+		Attempt:   job.Attempt,
+		Time:      start.UTC(),
+	}
+
+	body, err := json.Marshal(job.Event)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(webhook.Secret, timestamp, body))
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookEventHeader, job.Event.Type)
+	req.Header.Set(WebhookEventIDHeader, strconv.FormatInt(job.Event.ID, 10))
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID)
+
+	response, err := s.client.Do(req)
+	delivery.Duration = s.now().Sub(start).Milliseconds()
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	// Drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	response.Body.Close()
+	delivery.StatusCode = response.StatusCode
+	delivery.Success = response.StatusCode >= 200 && response.StatusCode < 300
+	if !delivery.Success {
+		delivery.Error = response.Status
+	}
+	return delivery
+}
+
+// record adds delivery to its webhook's log, dropping the oldest entries
+// beyond the configured size.
+func (s *webhookService) record(delivery entity.WebhookDelivery) {
+	if s.cfg.DeliveryLog == 0 {
+		return
+	}
+	s.logMu.Lock()
+	defer s.logMu.Unlock()
+	if err := s.deliveries.AddWebhookDelivery(delivery); err != nil {
+		log.Printf("Logging delivery to webhook %s: %v", delivery.WebhookID, err)
+		return
+	}
+	logged, err := s.deliveries.GetWebhookDeliveries(delivery.WebhookID)
+	if err != nil {
+		log.Printf("Trimming delivery log of webhook %s: %v", delivery.WebhookID, err)
+		return
+	}
+	for i := 0; i < len(logged)-s.cfg.DeliveryLog; i++ {
+		if err := s.deliveries.DeleteWebhookDelivery(logged[i].ID); err != nil {
+			log.Printf("Trimming delivery log of webhook %s: %v", delivery.WebhookID, err)
+			return
+		}
+	}
+}
+
+// forget removes the delivery log and pending deliveries of a deleted
+// webhook.
+func (s *webhookService) forget(id string) {
+	s.logMu.Lock()
+	defer s.logMu.Unlock()
+	logged, err := s.deliveries.GetWebhookDeliveries(id)
+	if err == nil {
+		for _, delivery := range logged {
+			if err = s.deliveries.DeleteWebhookDelivery(delivery.ID); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("Removing delivery log of webhook %s: %v", id, err)
+	}
+	pending, err := s.deliveries.GetPendingWebhookDeliveries()
+	if err != nil {
+		log.Printf("Removing pending deliveries of webhook %s: %v", id, err)
+		return
+	}
+	for _, job := range pending {
+		if job.WebhookID == id {
+			s.done(job)
+		}
+	}
+}
+
+// recordResult updates the webhook's failure count after a delivery,
+// disabling it after too many failures in a row, and reports whether the
+// delivery should be retried.
+func (s *webhookService) recordResult(id string, delivery entity.WebhookDelivery) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	webhook, err := s.repo.GetWebhook(id)
+	if errors.Is(err, repository.ErrWebhookNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	before := webhook
+
+	webhook.LastDeliveryAt = delivery.Time
+	if delivery.Success {
+		webhook.Failures = 0
+	} else {
+		webhook.Failures++
+	}
+	disable := !delivery.Success && webhook.Active && s.cfg.DisableAfter > 0 && webhook.Failures >= s.cfg.DisableAfter
+	if disable {
+		webhook.Active = false
+		webhook.DisabledAt = s.now().UTC()
+	}
+	if _, err := s.repo.UpdateWebhook(webhook); err != nil {
+		return false, err
+	}
+	if disable {
+		log.Printf("Disabled webhook %s after %d failed deliveries", id, webhook.Failures)
+		s.audit.RecordChange(Actor{}, entity.AuditWebhookDisable, entity.AuditTargetWebhook, id, before.WithoutSecret(), webhook.WithoutSecret())
+	}
+	return !delivery.Success && webhook.Active, nil
+}
+
+// backoff returns how long to wait after the given number of failed
+// attempts before trying again.
+func (s *webhookService) backoff(failed int) time.Duration {
+	delay := s.cfg.RetryBase
+	for i := 1; i < failed; i++ {
+		delay *= 2
+		if delay >= s.cfg.RetryMax {
+			return s.cfg.RetryMax
+		}
+	}
+	if delay > s.cfg.RetryMax {
+		return s.cfg.RetryMax
+	}
+	return delay
+}
@@ -0,0 +1,118 @@
+package test_file
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/biswasurmi/book-cli/api/handler"
+	"github.com/biswasurmi/book-cli/domain/entity"
+)
+
+// createAPIKey creates a key with the token's user and returns the full key
+// and its ID.
+func createAPIKey(t *testing.T, s *handler.Server, token, body string) (string, string) {
+	t.Helper()
+	response := sendJSON(s, "POST", "/api/v1/users/me/api-keys", token, body)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	var created struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	json.NewDecoder(response.Body).Decode(&created)
+	return created.Key, created.ID
+}
+
+func withAPIKey(s *handler.Server, method, url, key, body string) int {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Authorization", "ApiKey "+key)
+	return executeRequest(req, s).Code
+}
+
+func Test_API_Keys(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "test@example.com", Password: hashedPassword123})
+	token := loginToken(t, s, `{"email":"test@example.com","password":"password123"}`)
+
+	key, id := createAPIKey(t, s, token, `{"name":"ci","scopes":["books:read"]}`)
+	if !strings.HasPrefix(key, "bk_"+id+".") {
+		t.Fatalf("Unexpected key %q for ID %q", key, id)
+	}
+
+	checkResponseCode(t, http.StatusOK, withAPIKey(s, "GET", "/api/v1/books", key, ""))
+	checkResponseCode(t, http.StatusForbidden, withAPIKey(s, "POST", "/api/v1/books", key, `{"title":"Dune"}`))
+	checkResponseCode(t, http.StatusUnauthorized, withAPIKey(s, "GET", "/api/v1/books", key+"x", ""))
+	// Keys cannot manage credentials
+	checkResponseCode(t, http.StatusForbidden, withAPIKey(s, "GET", "/api/v1/users/me/api-keys", key, ""))
+
+	// The list shows when the key was used but never its secret
+	response := sendJSON(s, "GET", "/api/v1/users/me/api-keys", token, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	body := response.Body.String()
+	var keys []entity.APIKey
+	json.Unmarshal([]byte(body), &keys)
+	if len(keys) != 1 || keys[0].Name != "ci" || keys[0].LastUsedAt.IsZero() || strings.Contains(body, `"hash"`) {
+		t.Errorf("Unexpected keys %s", body)
+	}
+	stored, _ := repos.APIKeyRepository.GetAPIKey(id)
+	if stored.Hash == "" || strings.Contains(key, stored.Hash) {
+		t.Errorf("Expected only a hash of the key to be stored, got %q", stored.Hash)
+	}
+
+	response = sendJSON(s, "DELETE", "/api/v1/users/me/api-keys/"+id, token, "")
+	checkResponseCode(t, http.StatusNoContent, response.Code)
+	checkResponseCode(t, http.StatusUnauthorized, withAPIKey(s, "GET", "/api/v1/books", key, ""))
+	response = sendJSON(s, "DELETE", "/api/v1/users/me/api-keys/"+id, token, "")
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+}
+
+func Test_API_Keys_Validation(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "test@example.com", Password: hashedPassword123})
+	repos.UserRepository.CreateUser(entity.User{ID: 2, Email: "other@example.com", Password: hashedPassword123})
+	token := loginToken(t, s, `{"email":"test@example.com","password":"password123"}`)
+
+	for _, body := range []string{
+		`{"name":"","scopes":["books:read"]}`,
+		`{"name":"ci","scopes":[]}`,
+		`{"name":"ci","scopes":["books:delete"]}`,
+		`{"name":"ci","scopes":["books:read"],"expires_at":"2000-01-01T00:00:00Z"}`,
+		`{"name":"ci","scopes":["books:read"],"expires_at":"` + time.Now().AddDate(5, 0, 0).Format(time.RFC3339) + `"}`,
+	} {
+		response := sendJSON(s, "POST", "/api/v1/users/me/api-keys", token, body)
+		checkResponseCode(t, http.StatusBadRequest, response.Code)
+	}
+	// Only admins may hand out admin rights
+	response := sendJSON(s, "POST", "/api/v1/users/me/api-keys", token, `{"name":"ci","scopes":["users:admin"]}`)
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+
+	// Other users' keys cannot be revoked
+	other := loginToken(t, s, `{"email":"other@example.com","password":"password123"}`)
+	_, id := createAPIKey(t, s, other, `{"name":"ci","scopes":["books:read"]}`)
+	response = sendJSON(s, "DELETE", "/api/v1/users/me/api-keys/"+id, token, "")
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+}
+
+func Test_API_Keys_Expiry_And_Revocation(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "test@example.com", Password: hashedPassword123, Role: entity.RoleAdmin})
+	token := loginToken(t, s, `{"email":"test@example.com","password":"password123"}`)
+
+	key, id := createAPIKey(t, s, token, `{"name":"ops","scopes":["users:admin"]}`)
+	checkResponseCode(t, http.StatusOK, withAPIKey(s, "GET", "/api/v1/admin/lockouts", key, ""))
+	checkResponseCode(t, http.StatusForbidden, withAPIKey(s, "GET", "/api/v1/books", key, ""))
+
+	stored, _ := repos.APIKeyRepository.GetAPIKey(id)
+	stored.ExpiresAt = time.Now().Add(-time.Second)
+	repos.APIKeyRepository.UpdateAPIKey(stored)
+	checkResponseCode(t, http.StatusUnauthorized, withAPIKey(s, "GET", "/api/v1/admin/lockouts", key, ""))
+
+	// Revoking the user's sessions revokes their keys too
+	key, _ = createAPIKey(t, s, token, `{"name":"ops","scopes":["users:admin"]}`)
+	user, _ := repos.UserRepository.GetByID(1)
+	user.SessionsRevokedAt = time.Now().Add(time.Second)
+	repos.UserRepository.Update(user)
+	checkResponseCode(t, http.StatusUnauthorized, withAPIKey(s, "GET", "/api/v1/admin/lockouts", key, ""))
+}
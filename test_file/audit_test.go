@@ -0,0 +1,217 @@
+package test_file
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/biswasurmi/book-cli/api/handler"
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/service"
+)
+
+// auditEvents fetches the audit log with the given query as an admin.
+func auditEvents(t *testing.T, s *handler.Server, admin, query string) []entity.AuditEvent {
+	t.Helper()
+	response := sendJSON(s, "GET", "/api/v1/audit?"+query, admin, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var events []entity.AuditEvent
+	json.NewDecoder(response.Body).Decode(&events)
+	return events
+}
+
+func Test_Audit_Log(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "admin@example.com", Password: hashedPassword123, Role: entity.RoleAdmin})
+	repos.UserRepository.CreateUser(entity.User{ID: 2, Email: "user@example.com", Password: hashedPassword123, Role: entity.RoleUser})
+	admin := loginToken(t, s, `{"email":"admin@example.com","password":"password123"}`)
+	user := loginToken(t, s, `{"email":"user@example.com","password":"password123"}`)
+
+	// Changes to books record the request ID, the client's address and
+	// the fields that changed
+	req, _ := http.NewRequest("POST", "/api/v1/books", strings.NewReader(`{"name":"Learn API","isbn":"123"}`))
+	req.Header.Set("Authorization", "Bearer "+user)
+	req.Header.Set("X-Request-ID", "req-create")
+	req.RemoteAddr = "192.0.2.7:4321"
+	response := executeRequest(req, s)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	if id := response.Header().Get("X-Request-ID"); id != "req-create" {
+		t.Errorf("Expected the request ID to be echoed, got %q", id)
+	}
+	var book entity.Book
+	json.NewDecoder(response.Body).Decode(&book)
+
+	response = sendJSON(s, "PUT", "/api/v1/books/"+book.UUID, user, `{"name":"Learn Go","isbn":"123"}`)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	generated := response.Header().Get("X-Request-ID")
+	if generated == "" {
+		t.Error("Expected a request ID to be generated")
+	}
+	response = sendJSON(s, "DELETE", "/api/v1/books/"+book.UUID, user, "")
+	checkResponseCode(t, http.StatusNoContent, response.Code)
+
+	events := auditEvents(t, s, admin, "target_type=book")
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 book events, got %+v", events)
+	}
+	created, updated, deleted := events[0], events[1], events[2]
+	if created.Action != entity.AuditBookCreate || created.ActorID != 2 || created.TargetID != book.UUID ||
+		created.RequestID != "req-create" || created.SourceIP != "192.0.2.7" {
+		t.Errorf("Unexpected create event %+v", created)
+	}
+	if change := created.Changes["name"]; change.Before != nil || change.After != "Learn API" {
+		t.Errorf("Expected the created name to be recorded, got %+v", created.Changes)
+	}
+	if updated.Action != entity.AuditBookUpdate || updated.RequestID != generated || len(updated.Changes) != 1 {
+		t.Errorf("Unexpected update event %+v", updated)
+	}
+	if change := updated.Changes["name"]; change.Before != "Learn API" || change.After != "Learn Go" {
+		t.Errorf("Expected the name change to be recorded, got %+v", updated.Changes)
+	}
+	if deleted.Action != entity.AuditBookDelete || deleted.Changes["name"].Before != "Learn Go" || deleted.Changes["name"].After != nil {
+		t.Errorf("Unexpected delete event %+v", deleted)
+	}
+
+	// Secrets are redacted from user changes
+	response = sendJSON(s, "PUT", "/api/v1/users/2", user, `{"email":"user@example.com","username":"user","password":"new-password"}`)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	events = auditEvents(t, s, admin, "action=user.update&target_id=2")
+	if len(events) != 1 {
+		t.Fatalf("Expected one user update, got %+v", events)
+	}
+	if change := events[0].Changes["password"]; change.Before != "[redacted]" || change.After != "[redacted]" {
+		t.Errorf("Expected a redacted password change, got %+v", change)
+	}
+	if change := events[0].Changes["username"]; change.Before != nil && change.Before != "" || change.After != "user" {
+		t.Errorf("Expected the username change, got %+v", change)
+	}
+	if strings.Contains(auditBody(t, s, admin), "$2a$") {
+		t.Error("Password hashes must not appear in the audit log")
+	}
+
+	response = sendJSON(s, "DELETE", "/api/v1/users/2", admin, "")
+	checkResponseCode(t, http.StatusNoContent, response.Code)
+	events = auditEvents(t, s, admin, "action=user.delete")
+	if len(events) != 1 || events[0].ActorID != 1 || events[0].Changes["email"].Before != "user@example.com" {
+		t.Errorf("Unexpected user delete events %+v", events)
+	}
+
+	// Only admins see the log
+	response = sendJSON(s, "GET", "/api/v1/audit", loginToken(t, s, `{"email":"admin@example.com","password":"password123","scope":"books:read"}`), "")
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+}
+
+func auditBody(t *testing.T, s *handler.Server, admin string) string {
+	t.Helper()
+	response := sendJSON(s, "GET", "/api/v1/audit", admin, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	return response.Body.String()
+}
+
+func Test_Audit_Logins(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "admin@example.com", Password: hashedPassword123, Role: entity.RoleAdmin})
+	repos.UserRepository.CreateUser(entity.User{ID: 2, Email: "user@example.com", Password: hashedPassword123, Role: entity.RoleUser})
+
+	response := postJSON(s, "/api/v1/register", `{"email":"new@example.com","password":"password123"}`)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	response = postJSON(s, "/api/v1/login", `{"email":"user@example.com","password":"wrong-password"}`)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+	response = postJSON(s, "/api/v1/login", `{"email":"nobody@example.com","password":"password123"}`)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+	req, _ := http.NewRequest("GET", "/api/v1/get-token", nil)
+	req.Header.Set("Authorization", BasicAuthHeader("user@example.com", "password123"))
+	checkResponseCode(t, http.StatusOK, executeRequest(req, s).Code)
+
+	// The code step of a two-factor login is recorded too
+	token := loginToken(t, s, `{"email":"user@example.com","password":"password123"}`)
+	secret, _ := enableTwoFactor(t, s, token)
+	response = postJSON(s, "/api/v1/login", `{"email":"user@example.com","password":"password123","code":"000000"}`)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+	code, _ := service.GenerateTOTP(secret, time.Now().Add(30*time.Second))
+	loginToken(t, s, `{"email":"user@example.com","password":"password123","code":"`+code+`"}`)
+
+	admin := loginToken(t, s, `{"email":"admin@example.com","password":"password123"}`)
+	if events := auditEvents(t, s, admin, "action=user.create"); len(events) != 1 || events[0].ActorID != 0 ||
+		events[0].Changes["email"].After != "new@example.com" {
+		t.Errorf("Expected the registration to be recorded, got %+v", events)
+	}
+
+	failures := auditEvents(t, s, admin, "action=login.failure")
+	if len(failures) != 3 {
+		t.Fatalf("Expected 3 failed logins, got %+v", failures)
+	}
+	for i, want := range []struct{ target, reason string }{
+		{"2", "invalid_credentials"},
+		{"", "invalid_credentials"},
+		{"2", "invalid_two_factor_code"},
+	} {
+		if failures[i].TargetID != want.target || failures[i].Reason != want.reason || failures[i].ActorID != 0 {
+			t.Errorf("Failure %d: expected target %q and reason %q, got %+v", i, want.target, want.reason, failures[i])
+		}
+	}
+
+	// get-token, the login before enabling two-factor and the login with
+	// a code are successes; the password step alone is not
+	if successes := auditEvents(t, s, admin, "action=login.success&actor=2"); len(successes) != 3 {
+		t.Errorf("Expected 3 successful logins of user 2, got %+v", successes)
+	}
+}
+
+func Test_Audit_Filters_And_Export(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "admin@example.com", Password: hashedPassword123, Role: entity.RoleAdmin})
+	admin := loginToken(t, s, `{"email":"admin@example.com","password":"password123"}`)
+	start := time.Now().UTC().Add(-time.Second).Format(time.RFC3339)
+
+	for _, name := range []string{"Learn API", "Learn Go"} {
+		response := sendJSON(s, "POST", "/api/v1/books", admin, `{"name":"`+name+`"}`)
+		checkResponseCode(t, http.StatusCreated, response.Code)
+	}
+
+	if events := auditEvents(t, s, admin, "action=book.create&since="+url.QueryEscape(start)); len(events) != 2 {
+		t.Errorf("Expected 2 events since the start, got %+v", events)
+	}
+	if events := auditEvents(t, s, admin, "action=book.create&until="+url.QueryEscape(start)); len(events) != 0 {
+		t.Errorf("Expected no events before the start, got %+v", events)
+	}
+	if events := auditEvents(t, s, admin, "actor=2"); len(events) != 0 {
+		t.Errorf("Expected no events of user 2, got %+v", events)
+	}
+
+	for _, query := range []string{"actor=abc", "since=yesterday", "until=2024-01-01"} {
+		response := sendJSON(s, "GET", "/api/v1/audit?"+query, admin, "")
+		checkResponseCode(t, http.StatusBadRequest, response.Code)
+	}
+
+	// NDJSON has one event per line, by query parameter or Accept header
+	response := sendJSON(s, "GET", "/api/v1/audit?format=ndjson&target_type=book", admin, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	if ct := response.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Expected NDJSON, got %q", ct)
+	}
+	var names []interface{}
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		var event entity.AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Invalid NDJSON line %q: %v", scanner.Text(), err)
+		}
+		names = append(names, event.Changes["name"].After)
+	}
+	if len(names) != 2 || names[0] != "Learn API" || names[1] != "Learn Go" {
+		t.Errorf("Unexpected exported events %v", names)
+	}
+
+	req, _ := http.NewRequest("GET", "/api/v1/audit?target_type=book", nil)
+	req.Header.Set("Authorization", "Bearer "+admin)
+	req.Header.Set("Accept", "application/x-ndjson")
+	response = executeRequest(req, s)
+	if lines := strings.Count(response.Body.String(), "\n"); lines != 2 || response.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Errorf("Expected 2 NDJSON lines, got %q", response.Body.String())
+	}
+}
@@ -0,0 +1,106 @@
+package test_file
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/infrastructure/backup"
+	"github.com/biswasurmi/book-cli/infrastructure/persistance/inmemory"
+)
+
+func Test_Backup_Restore(t *testing.T) {
+	source := inmemory.GetRepositories()
+	source.BookRepository.CreateBook(entity.Book{UUID: "b-1", Name: "Learn API", AuthorList: []string{"Urmi"}})
+	source.BookRepository.CreateBook(entity.Book{UUID: "b-2", Name: "Learn Go"})
+	source.BookRepository.DeleteBook("b-2")
+	source.UserRepository.CreateUser(entity.User{ID: 1, Email: "test@example.com", Password: "hash", Role: entity.RoleAdmin})
+	source.APIKeyRepository.CreateAPIKey(entity.APIKey{ID: "k-1", UserID: 1, Name: "ci", Hash: "key-hash"})
+	source.OAuthClientRepository.CreateOAuthClient(entity.OAuthClient{ID: "c-1", OwnerID: 1, Name: "app", SecretHash: "secret-hash"})
+	source.AuditRepository.AppendAuditEvent(entity.AuditEvent{ID: "e-1", ActorID: 1, Action: entity.AuditBookCreate, TargetType: entity.AuditTargetBook, TargetID: "b-1"})
+	source.BookRevisionRepository.AddBookRevision(entity.BookRevision{BookUUID: "b-1", Number: 1, Book: entity.Book{UUID: "b-1", Name: "Learn API"}})
+	source.WebhookRepository.CreateWebhook(entity.Webhook{ID: "w-1", URL: "https://example.com/hook", Secret: "whsec_1", Active: true})
+
+	var buf bytes.Buffer
+	manifest, err := backup.Write(&buf, source)
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if manifest.Collections["books"].Count != 2 || manifest.Collections["users"].Count != 1 {
+		t.Errorf("Unexpected manifest: %+v", manifest)
+	}
+
+	archive, err := backup.Read(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	target := inmemory.GetRepositories()
+	restored, err := backup.Restore(target, archive, backup.RestoreOptions{})
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if restored["books"] != 2 || restored["users"] != 1 || restored["api_keys"] != 1 || restored["oauth_clients"] != 1 || restored["audit"] != 1 || restored["book_revisions"] != 1 || restored["webhooks"] != 1 {
+		t.Errorf("Unexpected restore counts: %v", restored)
+	}
+
+	book, err := target.BookRepository.GetBook("b-1")
+	if err != nil || book.Name != "Learn API" || len(book.AuthorList) != 1 {
+		t.Errorf("Book not restored: %+v, %v", book, err)
+	}
+	if deleted, _ := target.BookRepository.GetDeletedBooks(); len(deleted) != 1 || deleted[0].UUID != "b-2" {
+		t.Errorf("Expected the deleted book to be restored into the trash, got %+v", deleted)
+	}
+	user, err := target.UserRepository.GetByEmail("test@example.com")
+	if err != nil || user.Password != "hash" || user.Role != entity.RoleAdmin {
+		t.Errorf("User not restored: %+v, %v", user, err)
+	}
+	if key, err := target.APIKeyRepository.GetAPIKey("k-1"); err != nil || key.Hash != "key-hash" {
+		t.Errorf("API key not restored: %+v, %v", key, err)
+	}
+	if client, err := target.OAuthClientRepository.GetOAuthClient("c-1"); err != nil || client.SecretHash != "secret-hash" {
+		t.Errorf("OAuth client not restored: %+v, %v", client, err)
+	}
+	if events, err := target.AuditRepository.GetAuditEvents(); err != nil || len(events) != 1 || events[0].Action != entity.AuditBookCreate {
+		t.Errorf("Audit log not restored: %+v, %v", events, err)
+	}
+	if revision, err := target.BookRevisionRepository.GetBookRevision("b-1", 1); err != nil || revision.Book.Name != "Learn API" {
+		t.Errorf("Book revision not restored: %+v, %v", revision, err)
+	}
+	if webhook, err := target.WebhookRepository.GetWebhook("w-1"); err != nil || webhook.Secret != "whsec_1" || !webhook.Active {
+		t.Errorf("Webhook not restored: %+v, %v", webhook, err)
+	}
+
+	// Restoring into a store with data needs overwrite
+	if _, err := backup.Restore(target, archive, backup.RestoreOptions{}); err == nil {
+		t.Error("Expected restore into non-empty store to fail")
+	}
+	if _, err := backup.Restore(target, archive, backup.RestoreOptions{Overwrite: true}); err != nil {
+		t.Errorf("Restore with overwrite: %v", err)
+	}
+	if events, _ := target.AuditRepository.GetAuditEvents(); len(events) != 1 {
+		t.Errorf("Expected audit events to be merged, got %+v", events)
+	}
+}
+
+func Test_Backup_Corrupt_Archive(t *testing.T) {
+	source := inmemory.GetRepositories()
+	source.BookRepository.CreateBook(entity.Book{UUID: "b-1", Name: "Learn API"})
+
+	var buf bytes.Buffer
+	if _, err := backup.Write(&buf, source); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	// Flip a byte in the middle of the compressed stream
+	data := buf.Bytes()
+	data[len(data)/2] ^= 0xff
+	if _, err := backup.Read(bytes.NewReader(data)); err == nil {
+		t.Error("Expected corrupt archive to be rejected")
+	}
+
+	if _, err := backup.Read(strings.NewReader("not an archive")); err == nil {
+		t.Error("Expected garbage input to be rejected")
+	}
+}
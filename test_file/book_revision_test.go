@@ -0,0 +1,151 @@
+package test_file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/biswasurmi/book-cli/client"
+	"github.com/biswasurmi/book-cli/domain/entity"
+)
+
+func Test_Book_Revisions(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "owner@example.com", Password: hashedPassword123, Role: entity.RoleUser})
+	repos.UserRepository.CreateUser(entity.User{ID: 2, Email: "other@example.com", Password: hashedPassword123, Role: entity.RoleUser})
+	owner := loginToken(t, s, `{"email":"owner@example.com","password":"password123"}`)
+	other := loginToken(t, s, `{"email":"other@example.com","password":"password123"}`)
+
+	response := sendJSON(s, "POST", "/api/v1/books", owner, `{"name":"Learn API","isbn":"123"}`)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	var book entity.Book
+	json.NewDecoder(response.Body).Decode(&book)
+	for _, body := range []string{`{"name":"Learn API 2","isbn":"123"}`, `{"name":"Learn Go","isbn":"456"}`} {
+		response = sendJSON(s, "PUT", "/api/v1/books/"+book.UUID, owner, body)
+		checkResponseCode(t, http.StatusOK, response.Code)
+	}
+
+	response = sendJSON(s, "GET", "/api/v1/books/"+book.UUID+"/revisions", other, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var revisions []entity.BookRevision
+	json.NewDecoder(response.Body).Decode(&revisions)
+	if len(revisions) != 3 {
+		t.Fatalf("Expected 3 revisions, got %+v", revisions)
+	}
+	for i, want := range []string{"Learn API", "Learn API 2", "Learn Go"} {
+		if revisions[i].Number != i+1 || revisions[i].Book.Name != want || revisions[i].CreatedBy != 1 || revisions[i].CreatedAt.IsZero() {
+			t.Errorf("Revision %d: expected %q, got %+v", i+1, want, revisions[i])
+		}
+	}
+
+	response = sendJSON(s, "GET", "/api/v1/books/"+book.UUID+"/revisions/2", other, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var revision entity.BookRevision
+	json.NewDecoder(response.Body).Decode(&revision)
+	if revision.Number != 2 || revision.Book.Name != "Learn API 2" {
+		t.Errorf("Unexpected revision 2: %+v", revision)
+	}
+
+	response = sendJSON(s, "GET", "/api/v1/books/"+book.UUID+"/revisions/diff?from=1&to=3", other, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var diff entity.BookRevisionDiff
+	json.NewDecoder(response.Body).Decode(&diff)
+	if diff.From != 1 || diff.To != 3 || len(diff.Changes) != 2 ||
+		diff.Changes["name"].Before != "Learn API" || diff.Changes["name"].After != "Learn Go" ||
+		diff.Changes["isbn"].Before != "123" || diff.Changes["isbn"].After != "456" {
+		t.Errorf("Unexpected diff %+v", diff)
+	}
+
+	// Only the owner may roll the book back
+	response = sendJSON(s, "POST", "/api/v1/books/"+book.UUID+"/revisions/1/restore", other, "")
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+	reader := loginToken(t, s, `{"email":"owner@example.com","password":"password123","scope":"books:read"}`)
+	response = sendJSON(s, "POST", "/api/v1/books/"+book.UUID+"/revisions/1/restore", reader, "")
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+
+	response = sendJSON(s, "POST", "/api/v1/books/"+book.UUID+"/revisions/1/restore", owner, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	json.NewDecoder(response.Body).Decode(&book)
+	if book.Name != "Learn API" || book.ISBN != "123" || book.CreatedBy != 1 {
+		t.Errorf("Expected the first revision to be restored, got %+v", book)
+	}
+
+	// Restoring adds a revision rather than rewriting history
+	response = sendJSON(s, "GET", "/api/v1/books/"+book.UUID+"/revisions", owner, "")
+	json.NewDecoder(response.Body).Decode(&revisions)
+	if len(revisions) != 4 || revisions[3].RestoredFrom != 1 || revisions[3].Book.Name != "Learn API" || revisions[2].Book.Name != "Learn Go" {
+		t.Errorf("Unexpected revisions after restore: %+v", revisions)
+	}
+
+	for url, code := range map[string]int{
+		"/api/v1/books/" + book.UUID + "/revisions/0":                http.StatusBadRequest,
+		"/api/v1/books/" + book.UUID + "/revisions/abc":              http.StatusBadRequest,
+		"/api/v1/books/" + book.UUID + "/revisions/9":                http.StatusNotFound,
+		"/api/v1/books/" + book.UUID + "/revisions/diff?from=1":      http.StatusBadRequest,
+		"/api/v1/books/" + book.UUID + "/revisions/diff?from=1&to=9": http.StatusNotFound,
+		"/api/v1/books/missing/revisions":                            http.StatusNotFound,
+	} {
+		response = sendJSON(s, "GET", url, owner, "")
+		if response.Code != code {
+			t.Errorf("GET %s: expected %d, got %d", url, code, response.Code)
+		}
+	}
+	response = sendJSON(s, "POST", "/api/v1/books/"+book.UUID+"/revisions/9/restore", owner, "")
+	checkResponseCode(t, http.StatusNotFound, response.Code)
+}
+
+func Test_Book_Revisions_Existing_Books(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "owner@example.com", Password: hashedPassword123, Role: entity.RoleUser})
+	owner := loginToken(t, s, `{"email":"owner@example.com","password":"password123"}`)
+	// A book saved before revisions were kept has none
+	repos.BookRepository.CreateBook(entity.Book{UUID: "b-1", Name: "Learn API", CreatedBy: 1, UpdatedBy: 1})
+
+	response := sendJSON(s, "GET", "/api/v1/books/b-1/revisions", owner, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	if body := response.Body.String(); body != "[]\n" {
+		t.Errorf("Expected no revisions, got %s", body)
+	}
+
+	// The first update keeps the old state as revision 1
+	response = sendJSON(s, "PUT", "/api/v1/books/b-1", owner, `{"name":"Learn Go"}`)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	revisions, _ := repos.BookRevisionRepository.GetBookRevisions("b-1")
+	if len(revisions) != 2 || revisions[0].Book.Name != "Learn API" || revisions[1].Book.Name != "Learn Go" {
+		t.Errorf("Unexpected revisions %+v", revisions)
+	}
+}
+
+func Test_Client_Book_Revisions(t *testing.T) {
+	s, _ := setupServer(t)
+	ctx := context.Background()
+	c := newTestClient(t, s.Router, client.Config{Email: "writer@example.com", Password: "password123"})
+	c.Register(ctx, entity.User{Email: "writer@example.com", Password: "password123"})
+
+	book, err := c.CreateBook(ctx, entity.Book{Name: "Learn API"})
+	if err != nil {
+		t.Fatalf("CreateBook: %v", err)
+	}
+	book.Name = "Learn Go"
+	if _, err := c.UpdateBook(ctx, book); err != nil {
+		t.Fatalf("UpdateBook: %v", err)
+	}
+
+	revisions, err := c.BookRevisions(ctx, book.UUID)
+	if err != nil || len(revisions) != 2 {
+		t.Fatalf("BookRevisions: got %+v, %v", revisions, err)
+	}
+	diff, err := c.DiffBookRevisions(ctx, book.UUID, 1, 2)
+	if err != nil || diff.Changes["name"].After != "Learn Go" {
+		t.Errorf("DiffBookRevisions: got %+v, %v", diff, err)
+	}
+	restored, err := c.RestoreBookRevision(ctx, book.UUID, 1)
+	if err != nil || restored.Name != "Learn API" {
+		t.Errorf("RestoreBookRevision: got %+v, %v", restored, err)
+	}
+	if _, err := c.RestoreBookRevision(ctx, book.UUID, 7); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package test_file
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/biswasurmi/book-cli/client"
+	"github.com/biswasurmi/book-cli/domain/entity"
+)
+
+func newTestClient(t *testing.T, handler http.Handler, cfg client.Config) *client.Client {
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	cfg.BaseURL = ts.URL
+	return client.New(cfg)
+}
+
+func Test_Client_Books(t *testing.T) {
+	s, _ := setupServer(t)
+	ctx := context.Background()
+
+	c := newTestClient(t, s.Router, client.Config{Email: "reader@example.com", Password: "password123"})
+	if _, err := c.Register(ctx, entity.User{Email: "reader@example.com", Password: "password123"}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	created, err := c.CreateBook(ctx, entity.Book{Name: "Learn API", AuthorList: []string{"Urmi"}, ISBN: "0999-0555-5914"})
+	if err != nil {
+		t.Fatalf("CreateBook: %v", err)
+	}
+	c.CreateBook(ctx, entity.Book{Name: "Other Book", AuthorList: []string{"Biswas"}})
+
+	books, err := c.ListBooks(ctx, entity.BookFilter{Author: "urmi"})
+	if err != nil || len(books) != 1 || books[0].UUID != created.UUID {
+		t.Errorf("ListBooks with filter: got %+v, %v", books, err)
+	}
+
+	created.Name = "Updated API"
+	if updated, err := c.UpdateBook(ctx, created); err != nil || updated.Name != "Updated API" {
+		t.Errorf("UpdateBook: got %+v, %v", updated, err)
+	}
+	if book, err := c.GetBook(ctx, created.UUID); err != nil || book.Name != "Updated API" {
+		t.Errorf("GetBook: got %+v, %v", book, err)
+	}
+	if err := c.DeleteBook(ctx, created.UUID); err != nil {
+		t.Errorf("DeleteBook: %v", err)
+	}
+
+	_, err = c.GetBook(ctx, created.UUID)
+	var apiErr *client.APIError
+	if !errors.Is(err, client.ErrNotFound) || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func Test_Client_Users(t *testing.T) {
+	s, repos := setupServer(t)
+	ctx := context.Background()
+
+	user := entity.User{
+		ID:       1,
+		Email:    "writer@example.com",
+		Password: "$2a$10$bxCN.KcstTAU5I1zkZNe/OYrwD5gUc93lNl5pTit40/ZugB9YwuT6", // Hashed "password123"
+		Username: "writer",
+	}
+	repos.UserRepository.CreateUser(user)
+
+	c := newTestClient(t, s.Router, client.Config{})
+
+	if _, err := c.Me(ctx); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized before login, got %v", err)
+	}
+	if _, err := c.Login(ctx, "writer@example.com", "wrong-password"); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized for bad password, got %v", err)
+	}
+	if _, err := c.Login(ctx, "writer@example.com", "password123"); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	me, err := c.Me(ctx)
+	if err != nil || me.ID != user.ID {
+		t.Errorf("Me: got %+v, %v", me, err)
+	}
+	if _, err := c.GetUser(ctx, user.ID); err != nil {
+		t.Errorf("GetUser: %v", err)
+	}
+
+	me.Username = "renamed"
+	if updated, err := c.UpdateUser(ctx, me); err != nil || updated.Username != "renamed" {
+		t.Errorf("UpdateUser: got %+v, %v", updated, err)
+	}
+	if _, err := c.Register(ctx, entity.User{Email: "new@example.com", Password: "password123"}); err != nil {
+		t.Errorf("Register: %v", err)
+	}
+	if _, err := c.Register(ctx, entity.User{Email: "invalid", Password: "x"}); !errors.Is(err, client.ErrBadRequest) {
+		t.Errorf("Expected ErrBadRequest, got %v", err)
+	}
+	if err := c.DeleteUser(ctx, user.ID); err != nil {
+		t.Errorf("DeleteUser: %v", err)
+	}
+}
+
+func Test_Client_API_Keys(t *testing.T) {
+	s, _ := setupServer(t)
+	ctx := context.Background()
+
+	c := newTestClient(t, s.Router, client.Config{Email: "reader@example.com", Password: "password123"})
+	if _, err := c.Register(ctx, entity.User{Email: "reader@example.com", Password: "password123"}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	key, raw, err := c.CreateAPIKey(ctx, "ci", []string{entity.ScopeBooksRead}, time.Time{})
+	if err != nil || raw == "" || key.Hash != "" {
+		t.Fatalf("CreateAPIKey: got %+v, %q, %v", key, raw, err)
+	}
+
+	withKey := newTestClient(t, s.Router, client.Config{APIKey: raw})
+	if _, err := withKey.ListBooks(ctx, entity.BookFilter{}); err != nil {
+		t.Errorf("ListBooks with API key: %v", err)
+	}
+	if _, err := withKey.CreateBook(ctx, entity.Book{Name: "Learn API"}); !errors.Is(err, client.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden without books:write, got %v", err)
+	}
+
+	if keys, err := c.ListAPIKeys(ctx); err != nil || len(keys) != 1 || keys[0].ID != key.ID {
+		t.Errorf("ListAPIKeys: got %+v, %v", keys, err)
+	}
+	if err := c.RevokeAPIKey(ctx, key.ID); err != nil {
+		t.Errorf("RevokeAPIKey: %v", err)
+	}
+	if _, err := withKey.ListBooks(ctx, entity.BookFilter{}); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized after revoking, got %v", err)
+	}
+
+	reader := newTestClient(t, s.Router, client.Config{Email: "reader@example.com", Password: "password123", Scopes: []string{entity.ScopeBooksRead}})
+	if _, err := reader.ListBooks(ctx, entity.BookFilter{}); err != nil {
+		t.Errorf("ListBooks with books:read login: %v", err)
+	}
+	if _, err := reader.CreateBook(ctx, entity.Book{Name: "Learn API"}); !errors.Is(err, client.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden without books:write, got %v", err)
+	}
+}
+
+func Test_Client_Retries_And_Token_Refresh(t *testing.T) {
+	s, repos := setupServer(t)
+	ctx := context.Background()
+
+	// Fail the first book listing with 503 and reject the first token once
+	var listCalls, rejected int32
+	flaky := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/books" && atomic.AddInt32(&listCalls, 1) == 1 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/api/v1/users/me" && atomic.CompareAndSwapInt32(&rejected, 0, 1) {
+			http.Error(w, "expired", http.StatusUnauthorized)
+			return
+		}
+		s.Router.ServeHTTP(w, r)
+	})
+
+	c := newTestClient(t, flaky, client.Config{
+		Email:        "retry@example.com",
+		Password:     "password123",
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	})
+	repos.UserRepository.CreateUser(entity.User{
+		ID:       1,
+		Email:    "retry@example.com",
+		Password: "$2a$10$bxCN.KcstTAU5I1zkZNe/OYrwD5gUc93lNl5pTit40/ZugB9YwuT6",
+	})
+
+	if _, err := c.ListBooks(ctx, entity.BookFilter{}); err != nil {
+		t.Errorf("Expected ListBooks to succeed after retry, got %v", err)
+	}
+	if listCalls != 2 {
+		t.Errorf("Expected 2 list attempts, got %d", listCalls)
+	}
+
+	if _, err := c.Me(ctx); err != nil {
+		t.Errorf("Expected Me to succeed after token refresh, got %v", err)
+	}
+}
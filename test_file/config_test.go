@@ -0,0 +1,136 @@
+package test_file
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/biswasurmi/book-cli/config"
+)
+
+func Test_Config_Precedence(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "book.yaml")
+	os.WriteFile(path, []byte("server:\n  port: \"9090\"\nauth:\n  tokenTTL: 2h\nlockout:\n  threshold: 4\n"), 0o600)
+
+	t.Setenv("BOOK_PORT", "7070")
+	t.Setenv("JWT_SECRET", "from-env")
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	// Environment wins over the file, the file over the defaults
+	if cfg.Server.Port != "7070" {
+		t.Errorf("Expected port from env, got %q", cfg.Server.Port)
+	}
+	if cfg.Auth.TokenTTL != 2*time.Hour || cfg.Lockout.Threshold != 4 {
+		t.Errorf("Expected values from file, got %+v", cfg)
+	}
+	if cfg.RateLimit.IPBurst != config.Default().RateLimit.IPBurst {
+		t.Errorf("Expected default rate limit, got %+v", cfg.RateLimit)
+	}
+}
+
+func Test_Config_TOML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "book.toml")
+	os.WriteFile(path, []byte("[server]\nport = \"9191\"\n[lockout]\nduration = \"5m\"\n"), 0o600)
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Server.Port != "9191" || cfg.Lockout.Duration != 5*time.Minute {
+		t.Errorf("Unexpected config from TOML: %+v", cfg)
+	}
+}
+
+func Test_Config_Validate(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.Port = "not-a-port"
+	cfg.Auth.JWTSecret = ""
+	cfg.Auth.APIKeyTTL = 2 * cfg.Auth.APIKeyMaxTTL
+	cfg.Auth.OAuthCodeTTL = time.Hour
+	cfg.OIDC.Enabled = true
+	cfg.OIDC.IssuerURL = "accounts.example.com"
+	cfg.OIDC.Scopes = []string{"email"}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation error")
+	}
+	for _, want := range []string{"server.port", "auth.jwtSecret", "auth.apiKeyTTL", "auth.oauthCodeTTL",
+		"oidc.issuerURL", "oidc.clientID", "oidc.redirectURL", "oidc.scopes"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in error, got %v", want, err)
+		}
+	}
+
+	cfg.Auth.Enabled = false
+	cfg.Server.Port = "8080"
+	cfg.Auth.APIKeyTTL = cfg.Auth.APIKeyMaxTTL
+	cfg.Auth.OAuthCodeTTL = time.Minute
+	cfg.OIDC.Enabled = false
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid config without auth, got %v", err)
+	}
+}
+
+func Test_Config_Storage(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.Enabled = false
+	cfg.Storage.Driver = config.StorageFile
+	cfg.Storage.Fsync = "sometimes"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation error")
+	}
+	for _, want := range []string{"storage.path", "storage.fsync"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in error, got %v", want, err)
+		}
+	}
+
+	cfg.Storage.Path = t.TempDir()
+	cfg.Storage.Fsync = "interval"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid file storage config, got %v", err)
+	}
+}
+
+func Test_Config_Passwords(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.Enabled = false
+	cfg.Passwords.Algorithm = "md5"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "passwords.algorithm") {
+		t.Errorf("Expected passwords.algorithm error, got %v", err)
+	}
+
+	cfg.Passwords.Algorithm = config.HashArgon2id
+	cfg.Passwords.Argon2Parallelism = 0
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "passwords.argon2Parallelism") {
+		t.Errorf("Expected passwords.argon2Parallelism error, got %v", err)
+	}
+
+	cfg.Passwords.Algorithm = config.HashBcrypt
+	cfg.Passwords.BcryptCost = 12
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid bcrypt config, got %v", err)
+	}
+}
+
+func Test_Config_Redacted(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.JWTSecret = "super-secret"
+
+	if got := cfg.Redacted().Auth.JWTSecret; got == "super-secret" || got == "" {
+		t.Errorf("Expected secret to be masked, got %q", got)
+	}
+	if cfg.Auth.JWTSecret != "super-secret" {
+		t.Errorf("Redacted must not modify the original config")
+	}
+}
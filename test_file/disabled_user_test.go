@@ -0,0 +1,54 @@
+package test_file
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+)
+
+func Test_Disabled_User(t *testing.T) {
+	s, repos := setupServer(t)
+
+	repos.UserRepository.CreateUser(entity.User{
+		ID:       1,
+		Email:    "test@example.com",
+		Password: "$2a$10$bxCN.KcstTAU5I1zkZNe/OYrwD5gUc93lNl5pTit40/ZugB9YwuT6",
+		Role:     entity.RoleAdmin,
+		Disabled: true,
+	})
+
+	req, _ := http.NewRequest("POST", "/api/v1/login", bytes.NewReader([]byte(`{"email":"test@example.com","password":"password123"}`)))
+	checkResponseCode(t, http.StatusForbidden, executeRequest(req, s).Code)
+
+	req, _ = http.NewRequest("GET", "/api/v1/get-token", nil)
+	req.Header.Set("Authorization", BasicAuthHeader("test@example.com", "password123"))
+	checkResponseCode(t, http.StatusForbidden, executeRequest(req, s).Code)
+
+	// A disabled admin loses admin access even with a token issued earlier
+	req, _ = http.NewRequest("GET", "/api/v1/admin/lockouts", nil)
+	req.Header.Set("Authorization", GenerateJWTToken(1))
+	checkResponseCode(t, http.StatusForbidden, executeRequest(req, s).Code)
+}
+
+func Test_Disabled_User_Earlier_Credentials(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "test@example.com", Password: hashedPassword123, Role: entity.RoleUser})
+	token := loginToken(t, s, `{"email":"test@example.com","password":"password123"}`)
+	key, _ := createAPIKey(t, s, token, `{"name":"ci","scopes":["books:read","books:write"]}`)
+	checkResponseCode(t, http.StatusCreated, sendJSON(s, "POST", "/api/v1/books", token, `{"name":"Learn API"}`).Code)
+
+	user, _ := repos.UserRepository.GetByID(1)
+	user.Disabled = true
+	repos.UserRepository.Update(user)
+
+	// Neither the token nor the key issued before still works
+	checkResponseCode(t, http.StatusForbidden, sendJSON(s, "POST", "/api/v1/books", token, `{"name":"Learn Go"}`).Code)
+	checkResponseCode(t, http.StatusForbidden, sendJSON(s, "GET", "/api/v1/users/me", token, "").Code)
+	checkResponseCode(t, http.StatusForbidden, sendJSON(s, "POST", "/api/v1/users/me/api-keys", token, `{"name":"more"}`).Code)
+	checkResponseCode(t, http.StatusForbidden, withAPIKey(s, "POST", "/api/v1/books", key, `{"name":"Learn Go"}`))
+	if books, _ := repos.BookRepository.GetAllBooks(); len(books) != 1 {
+		t.Errorf("Expected only the book created before, got %+v", books)
+	}
+}
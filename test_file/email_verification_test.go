@@ -0,0 +1,111 @@
+package test_file
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/biswasurmi/book-cli/config"
+	"github.com/biswasurmi/book-cli/domain/entity"
+)
+
+var verifyLinkPattern = regexp.MustCompile(`/api/v1/verify-email\?token=(\S+)`)
+
+func Test_Email_Verification(t *testing.T) {
+	outbox := t.TempDir()
+	cfg := testConfig()
+	cfg.Auth.RequireVerifiedEmail = true
+	cfg.Mail.Driver = config.MailFile
+	cfg.Mail.Dir = outbox
+	cfg.Server.PublicURL = "https://books.example.com"
+	s, repos := setupServerWithConfig(t, cfg)
+
+	response := postJSON(s, "/api/v1/register", `{"email":"New@Example.com","password":"password123"}`)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	seen := map[string]bool{}
+	message := waitForMail(t, outbox, seen)
+	match := verifyLinkPattern.FindStringSubmatch(message)
+	if !strings.Contains(message, "To: new@example.com") || match == nil {
+		t.Fatalf("Unexpected email:\n%s", message)
+	}
+	link := match[0]
+
+	login := `{"email":"new@example.com","password":"password123"}`
+	response = postJSON(s, "/api/v1/login", login)
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+
+	// Resending right away is throttled
+	response = postJSON(s, "/api/v1/verify-email/resend", `{"email":"new@example.com"}`)
+	checkResponseCode(t, http.StatusAccepted, response.Code)
+	// Unknown emails get the same answer
+	response = postJSON(s, "/api/v1/verify-email/resend", `{"email":"nobody@example.com"}`)
+	checkResponseCode(t, http.StatusAccepted, response.Code)
+
+	user, _ := repos.UserRepository.GetByEmail("new@example.com")
+	user.VerificationSentAt = time.Now().Add(-time.Hour)
+	repos.UserRepository.Update(user)
+	response = postJSON(s, "/api/v1/verify-email/resend", `{"email":"new@example.com"}`)
+	checkResponseCode(t, http.StatusAccepted, response.Code)
+	if resent := waitForMail(t, outbox, seen); !verifyLinkPattern.MatchString(resent) {
+		t.Errorf("Unexpected email:\n%s", resent)
+	}
+
+	// A tampered token is rejected
+	req, _ := http.NewRequest("GET", strings.Replace(link, "token=", "token=x", 1), nil)
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req, s).Code)
+
+	req, _ = http.NewRequest("GET", link, nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req, s).Code)
+
+	response = postJSON(s, "/api/v1/login", login)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var tokens map[string]string
+	json.NewDecoder(response.Body).Decode(&tokens)
+
+	req, _ = http.NewRequest("GET", "/api/v1/users/me", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens["token"])
+	response = executeRequest(req, s)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var me entity.User
+	json.NewDecoder(response.Body).Decode(&me)
+	if me.VerificationPending {
+		t.Errorf("Expected a verified user, got %+v", me)
+	}
+}
+
+func Test_Email_Verification_Changed_Email(t *testing.T) {
+	cfg := testConfig()
+	cfg.Auth.RequireVerifiedEmail = true
+	cfg.Mail.Driver = config.MailFile
+	cfg.Mail.Dir = t.TempDir()
+	cfg.Server.PublicURL = "https://books.example.com"
+	s, repos := setupServerWithConfig(t, cfg)
+
+	postJSON(s, "/api/v1/register", `{"email":"old@example.com","password":"password123"}`)
+	message := waitForMail(t, cfg.Mail.Dir, map[string]bool{})
+	link := verifyLinkPattern.FindStringSubmatch(message)[0]
+	req, _ := http.NewRequest("GET", link, nil)
+
+	// A link for the previous address stops working after the email changes
+	user, _ := repos.UserRepository.GetByEmail("old@example.com")
+	user.Email = "changed@example.com"
+	repos.UserRepository.Update(user)
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req, s).Code)
+
+	user.Email = "old@example.com"
+	repos.UserRepository.Update(user)
+	checkResponseCode(t, http.StatusOK, executeRequest(req, s).Code)
+}
+
+func Test_Email_Verification_Not_Required(t *testing.T) {
+	s, _ := setupServer(t)
+
+	response := postJSON(s, "/api/v1/register", `{"email":"new@example.com","password":"password123"}`)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	response = postJSON(s, "/api/v1/login", `{"email":"new@example.com","password":"password123"}`)
+	checkResponseCode(t, http.StatusOK, response.Code)
+}
@@ -0,0 +1,221 @@
+package test_file
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/biswasurmi/book-cli/api/handler"
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/service"
+)
+
+// sseEvent is one event read from a Server-Sent Events stream.
+type sseEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// openEvents connects to the event stream of server with token and the
+// given query and headers.
+func openEvents(t *testing.T, server *httptest.Server, token, query string, header http.Header) *bufio.Reader {
+	t.Helper()
+	req, _ := http.NewRequest("GET", server.URL+"/api/v1/events"+query, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	response, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("GET /api/v1/events: %v", err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	checkResponseCode(t, http.StatusOK, response.StatusCode)
+	if ct := response.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %q", ct)
+	}
+	return bufio.NewReader(response.Body)
+}
+
+// nextEvent reads the next event, skipping comments.
+func nextEvent(t *testing.T, stream *bufio.Reader) sseEvent {
+	t.Helper()
+	var event sseEvent
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Reading event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if event.Event != "" {
+				return event
+			}
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "id: "):
+			event.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.Event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.Data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func eventsServer(t *testing.T) (*handler.Server, *httptest.Server, string, string) {
+	t.Helper()
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "admin@example.com", Password: hashedPassword123, Role: entity.RoleAdmin})
+	repos.UserRepository.CreateUser(entity.User{ID: 2, Email: "user@example.com", Password: hashedPassword123, Role: entity.RoleUser})
+	admin := loginToken(t, s, `{"email":"admin@example.com","password":"password123"}`)
+	user := loginToken(t, s, `{"email":"user@example.com","password":"password123"}`)
+	server := httptest.NewServer(s.Router)
+	t.Cleanup(server.Close)
+	return s, server, admin, user
+}
+
+func Test_Events_Stream(t *testing.T) {
+	s, server, admin, user := eventsServer(t)
+	userStream := openEvents(t, server, user, "", nil)
+	adminStream := openEvents(t, server, admin, "", nil)
+
+	response := sendJSON(s, "POST", "/api/v1/books", user, `{"name":"Learn API"}`)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	var book entity.Book
+	json.NewDecoder(response.Body).Decode(&book)
+	response = postJSON(s, "/api/v1/register", `{"email":"new@example.com","password":"password123"}`)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	sendJSON(s, "PUT", "/api/v1/books/"+book.UUID, user, `{"name":"Learn Go"}`)
+	sendJSON(s, "DELETE", "/api/v1/books/"+book.UUID, user, "")
+
+	// Users only see book events
+	var ids []int64
+	for _, want := range []string{entity.EventBookCreated, entity.EventBookUpdated, entity.EventBookDeleted} {
+		got := nextEvent(t, userStream)
+		var event entity.Event
+		if err := json.Unmarshal([]byte(got.Data), &event); err != nil {
+			t.Fatalf("Invalid event data %q: %v", got.Data, err)
+		}
+		var changed entity.Book
+		json.Unmarshal(event.Data, &changed)
+		if got.Event != want || event.Type != want || strconv.FormatInt(event.ID, 10) != got.ID || changed.UUID != book.UUID {
+			t.Errorf("Expected %s of the book, got %+v", want, got)
+		}
+		ids = append(ids, event.ID)
+	}
+	if !(ids[0] < ids[1] && ids[1] < ids[2]) {
+		t.Errorf("Expected increasing event IDs, got %v", ids)
+	}
+
+	// Admins see user events too, without the password
+	if got := nextEvent(t, adminStream); got.Event != entity.EventBookCreated {
+		t.Errorf("Expected book.created first, got %+v", got)
+	}
+	got := nextEvent(t, adminStream)
+	if got.Event != entity.EventUserCreated || !strings.Contains(got.Data, "new@example.com") {
+		t.Errorf("Expected user.created, got %+v", got)
+	}
+	if strings.Contains(got.Data, "$argon2") || strings.Contains(got.Data, "$2a$") {
+		t.Errorf("Password hash leaked into event %s", got.Data)
+	}
+
+	// Without books:read there is no stream
+	response = sendJSON(s, "GET", "/api/v1/events", loginToken(t, s, `{"email":"user@example.com","password":"password123","scope":"account"}`), "")
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+}
+
+func Test_Events_Resume(t *testing.T) {
+	s, server, _, user := eventsServer(t)
+	for _, name := range []string{"Learn API", "Learn Go", "Learn SQL"} {
+		response := sendJSON(s, "POST", "/api/v1/books", user, `{"name":"`+name+`"}`)
+		checkResponseCode(t, http.StatusCreated, response.Code)
+	}
+	stream := openEvents(t, server, user, "", nil)
+	sendJSON(s, "POST", "/api/v1/books", user, `{"name":"Learn Rust"}`)
+	first := nextEvent(t, stream)
+
+	// Reconnecting after an event replays the ones that followed it
+	stream = openEvents(t, server, user, "", http.Header{"Last-Event-Id": {first.ID}})
+	sendJSON(s, "POST", "/api/v1/books", user, `{"name":"Learn C"}`)
+	if got := nextEvent(t, stream); !strings.Contains(got.Data, "Learn C") {
+		t.Errorf("Expected only the new event, got %+v", got)
+	}
+
+	// The query parameter works for clients that cannot set headers
+	stream = openEvents(t, server, user, "?last_event_id="+first.ID, nil)
+	if got := nextEvent(t, stream); !strings.Contains(got.Data, "Learn C") {
+		t.Errorf("Expected the event after %s, got %+v", first.ID, got)
+	}
+
+	// An ID that is no longer kept asks the client to resync first
+	stream = openEvents(t, server, user, "", http.Header{"Last-Event-Id": {"12345"}})
+	if got := nextEvent(t, stream); got.Event != "resync" {
+		t.Errorf("Expected a resync event, got %+v", got)
+	}
+	if got := nextEvent(t, stream); !strings.Contains(got.Data, "Learn API") {
+		t.Errorf("Expected the kept events after the resync, got %+v", got)
+	}
+
+	for _, query := range []string{"?last_event_id=abc", "?types=book.renamed"} {
+		response := sendJSON(s, "GET", "/api/v1/events"+query, user, "")
+		checkResponseCode(t, http.StatusBadRequest, response.Code)
+	}
+
+	// types limits the stream
+	stream = openEvents(t, server, user, "?types=book.deleted", nil)
+	response := sendJSON(s, "POST", "/api/v1/books", user, `{"name":"Learn Zig"}`)
+	var book entity.Book
+	json.NewDecoder(response.Body).Decode(&book)
+	sendJSON(s, "DELETE", "/api/v1/books/"+book.UUID, user, "")
+	if got := nextEvent(t, stream); got.Event != entity.EventBookDeleted {
+		t.Errorf("Expected only book.deleted, got %+v", got)
+	}
+}
+
+func Test_Event_Bus_Backpressure(t *testing.T) {
+	bus := service.NewEventBus(service.NewIDGenerator(0), 3, 2)
+	slow := bus.Subscribe(0)
+	fast := bus.Subscribe(0)
+	defer bus.Unsubscribe(fast)
+
+	var ids []int64
+	for i := 0; i < 4; i++ {
+		bus.Publish(entity.EventBookCreated, entity.Book{Name: "Book " + strconv.Itoa(i)})
+		event := <-fast.Events
+		ids = append(ids, event.ID)
+	}
+
+	// The slow subscriber got a full buffer, then was dropped
+	for i := 0; i < 2; i++ {
+		if event, ok := <-slow.Events; !ok || event.ID != ids[i] {
+			t.Errorf("Expected event %d, got %+v, %v", ids[i], event, ok)
+		}
+	}
+	if _, ok := <-slow.Events; ok {
+		t.Error("Expected the slow subscriber to be dropped")
+	}
+	bus.Unsubscribe(slow)
+
+	// It resumes from the last event it handled; only the last 3 are kept
+	resumed := bus.Subscribe(ids[1])
+	defer bus.Unsubscribe(resumed)
+	if resumed.Missed || len(resumed.Backlog) != 2 || resumed.Backlog[0].ID != ids[2] {
+		t.Errorf("Unexpected backlog %+v, missed %v", resumed.Backlog, resumed.Missed)
+	}
+	if lost := bus.Subscribe(ids[0]); !lost.Missed || len(lost.Backlog) != 3 {
+		t.Errorf("Expected an evicted ID to be reported as missed, got %+v", lost)
+	}
+
+	bus.Close()
+	if _, ok := <-resumed.Events; ok {
+		t.Error("Expected Close to end the subscription")
+	}
+}
@@ -0,0 +1,286 @@
+package test_file
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+	"github.com/biswasurmi/book-cli/infrastructure/persistance/filestore"
+)
+
+func openStore(t *testing.T, opts filestore.Options) *filestore.Store {
+	t.Helper()
+	store, err := filestore.Open(opts)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return store
+}
+
+func Test_FileStore_Replay(t *testing.T) {
+	opts := filestore.Options{Dir: t.TempDir()}
+
+	store := openStore(t, opts)
+	repos := store.Repositories()
+	repos.BookRepository.CreateBook(entity.Book{UUID: "b-1", Name: "Learn API"})
+	repos.BookRepository.CreateBook(entity.Book{UUID: "b-2", Name: "Learn Go"})
+	repos.BookRepository.UpdateBook(entity.Book{UUID: "b-1", Name: "Learn API, 2nd edition"})
+	repos.BookRepository.DeleteBook("b-2")
+	repos.BookRepository.CreateBook(entity.Book{UUID: "b-3", Name: "Learn SQL"})
+	repos.BookRevisionRepository.AddBookRevision(entity.BookRevision{BookUUID: "b-3", Number: 1})
+	repos.BookRepository.DeleteBook("b-3")
+	repos.BookRepository.PurgeBook("b-3")
+	repos.BookRevisionRepository.DeleteBookRevisions("b-3")
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "test@example.com", Role: entity.RoleAdmin})
+	repos.UserRepository.CreateUser(entity.User{ID: 2, Email: "gone@example.com", Role: entity.RoleUser})
+	repos.UserRepository.Delete(2)
+	repos.WebhookDeliveryRepository.AddWebhookDelivery(entity.WebhookDelivery{ID: "d-1", WebhookID: "w-1", Attempt: 1})
+	repos.WebhookDeliveryRepository.AddWebhookDelivery(entity.WebhookDelivery{ID: "d-2", WebhookID: "w-1", Attempt: 2, Success: true})
+	repos.WebhookDeliveryRepository.DeleteWebhookDelivery("d-1")
+	repos.WebhookDeliveryRepository.SavePendingWebhookDelivery(entity.PendingWebhookDelivery{ID: "p-1", WebhookID: "w-1", Event: entity.Event{ID: 7, Type: entity.EventBookCreated}, Attempt: 1})
+	repos.WebhookDeliveryRepository.SavePendingWebhookDelivery(entity.PendingWebhookDelivery{ID: "p-1", WebhookID: "w-1", Event: entity.Event{ID: 7, Type: entity.EventBookCreated}, Attempt: 2})
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	store = openStore(t, opts)
+	defer store.Close()
+	repos = store.Repositories()
+
+	if book, err := repos.BookRepository.GetBook("b-1"); err != nil || book.Name != "Learn API, 2nd edition" {
+		t.Errorf("Expected updated book, got %+v, %v", book, err)
+	}
+	if _, err := repos.BookRepository.GetBook("b-2"); err == nil {
+		t.Error("Expected deleted book to stay deleted")
+	}
+	if deleted, _ := repos.BookRepository.GetDeletedBooks(); len(deleted) != 1 || deleted[0].UUID != "b-2" || deleted[0].DeletedAt == nil {
+		t.Errorf("Expected only b-2 in the trash, got %+v", deleted)
+	}
+	if revisions, _ := repos.BookRevisionRepository.GetBookRevisions("b-3"); len(revisions) != 0 {
+		t.Errorf("Expected the purged book's revisions to stay deleted, got %+v", revisions)
+	}
+	if deleted, _ := repos.UserRepository.GetDeletedUsers(); len(deleted) != 1 || deleted[0].ID != 2 {
+		t.Errorf("Expected user 2 in the trash, got %+v", deleted)
+	}
+	if user, err := repos.UserRepository.GetByEmail("test@example.com"); err != nil || user.Role != entity.RoleAdmin {
+		t.Errorf("Expected user to be replayed, got %+v, %v", user, err)
+	}
+	if deliveries, _ := repos.WebhookDeliveryRepository.GetWebhookDeliveries("w-1"); len(deliveries) != 1 || deliveries[0].ID != "d-2" || !deliveries[0].Success {
+		t.Errorf("Expected only delivery d-2 to be replayed, got %+v", deliveries)
+	}
+	if pending, _ := repos.WebhookDeliveryRepository.GetPendingWebhookDeliveries(); len(pending) != 1 || pending[0].Attempt != 2 || pending[0].Event.ID != 7 {
+		t.Errorf("Expected the pending delivery's latest state to be replayed, got %+v", pending)
+	}
+}
+
+func Test_FileStore_Torn_Record(t *testing.T) {
+	opts := filestore.Options{Dir: t.TempDir()}
+	walPath := filepath.Join(opts.Dir, "wal.log")
+
+	store := openStore(t, opts)
+	repos := store.Repositories()
+	repos.BookRepository.CreateBook(entity.Book{UUID: "b-1", Name: "Learn API"})
+	info, _ := os.Stat(walPath)
+	intact := info.Size()
+	repos.BookRepository.CreateBook(entity.Book{UUID: "b-2", Name: "Learn Go"})
+	store.Close()
+
+	// Simulate a crash in the middle of writing the second record
+	info, _ = os.Stat(walPath)
+	if err := os.Truncate(walPath, intact+(info.Size()-intact)/2); err != nil {
+		t.Fatal(err)
+	}
+
+	store = openStore(t, opts)
+	repos = store.Repositories()
+	if _, err := repos.BookRepository.GetBook("b-1"); err != nil {
+		t.Errorf("Expected intact record to survive, got %v", err)
+	}
+	if _, err := repos.BookRepository.GetBook("b-2"); err == nil {
+		t.Error("Expected torn record to be discarded")
+	}
+	if info, _ := os.Stat(walPath); info.Size() != intact {
+		t.Errorf("Expected log truncated to %d bytes, got %d", intact, info.Size())
+	}
+
+	// New writes go after the last intact record
+	repos.BookRepository.CreateBook(entity.Book{UUID: "b-3", Name: "Learn Testing"})
+	store.Close()
+
+	store = openStore(t, opts)
+	defer store.Close()
+	repos = store.Repositories()
+	books, _ := repos.BookRepository.GetAllBooks()
+	if len(books) != 2 {
+		t.Errorf("Expected 2 books after recovery, got %+v", books)
+	}
+}
+
+func Test_FileStore_Corrupt_Record(t *testing.T) {
+	opts := filestore.Options{Dir: t.TempDir()}
+	walPath := filepath.Join(opts.Dir, "wal.log")
+
+	store := openStore(t, opts)
+	repos := store.Repositories()
+	repos.BookRepository.CreateBook(entity.Book{UUID: "b-1", Name: "Learn API"})
+	info, _ := os.Stat(walPath)
+	intact := info.Size()
+	repos.BookRepository.CreateBook(entity.Book{UUID: "b-2", Name: "Learn Go"})
+	repos.BookRepository.CreateBook(entity.Book{UUID: "b-3", Name: "Learn SQL"})
+	store.Close()
+
+	// Flip a payload byte of the second record, which is followed by a third
+	data, err := os.ReadFile(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[intact+10] ^= 0xff
+	if err := os.WriteFile(walPath, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = filestore.Open(opts)
+	if err == nil {
+		store.Close()
+		t.Fatal("Expected Open to fail on a corrupt record in the middle of the log")
+	}
+	if !strings.Contains(err.Error(), fmt.Sprintf("offset %d", intact)) {
+		t.Errorf("Expected error to name offset %d, got %v", intact, err)
+	}
+	if info, _ := os.Stat(walPath); info.Size() != int64(len(data)) {
+		t.Errorf("Expected log left untouched at %d bytes, got %d", len(data), info.Size())
+	}
+}
+
+func Test_FileStore_Failed_Write(t *testing.T) {
+	// A closed log stands in for a failing disk
+	failing := func(t *testing.T) *repository.Repositories {
+		store := openStore(t, filestore.Options{Dir: t.TempDir()})
+		repos := store.Repositories()
+		repos.BookRepository.CreateBook(entity.Book{UUID: "b-1", Name: "Learn API"})
+		repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "test@example.com", Role: entity.RoleUser})
+		store.Close()
+		return repos
+	}
+
+	t.Run("create", func(t *testing.T) {
+		repos := failing(t)
+		if _, err := repos.BookRepository.CreateBook(entity.Book{UUID: "b-2", Name: "Learn Go"}); err == nil {
+			t.Fatal("Expected the create to fail")
+		}
+		if _, err := repos.BookRepository.GetBook("b-2"); err == nil {
+			t.Error("Expected the unlogged book not to be visible")
+		}
+	})
+	t.Run("update", func(t *testing.T) {
+		repos := failing(t)
+		if _, err := repos.BookRepository.UpdateBook(entity.Book{UUID: "b-1", Name: "Changed"}); err == nil {
+			t.Fatal("Expected the update to fail")
+		}
+		if book, err := repos.BookRepository.GetBook("b-1"); err != nil || book.Name != "Learn API" {
+			t.Errorf("Expected the book unchanged, got %+v, %v", book, err)
+		}
+	})
+	t.Run("delete", func(t *testing.T) {
+		repos := failing(t)
+		if err := repos.UserRepository.Delete(1); err == nil {
+			t.Fatal("Expected the delete to fail")
+		}
+		if user, err := repos.UserRepository.GetByID(1); err != nil || !user.DeletedAt.IsZero() {
+			t.Errorf("Expected the user still live, got %+v, %v", user, err)
+		}
+	})
+	t.Run("audit", func(t *testing.T) {
+		repos := failing(t)
+		if err := repos.AuditRepository.AppendAuditEvent(entity.AuditEvent{ID: "e-1"}); err == nil {
+			t.Fatal("Expected the append to fail")
+		}
+		if events, _ := repos.AuditRepository.GetAuditEvents(); len(events) != 0 {
+			t.Errorf("Expected no events, got %+v", events)
+		}
+	})
+}
+
+func Test_FileStore_Compaction(t *testing.T) {
+	opts := filestore.Options{Dir: t.TempDir(), CompactEvery: 3}
+	walPath := filepath.Join(opts.Dir, "wal.log")
+
+	store := openStore(t, opts)
+	repos := store.Repositories()
+	for _, id := range []string{"b-1", "b-2", "b-3", "b-4"} {
+		repos.BookRepository.CreateBook(entity.Book{UUID: id, Name: "Book " + id})
+	}
+	if _, err := os.Stat(filepath.Join(opts.Dir, "snapshot.json")); err != nil {
+		t.Fatalf("Expected a snapshot after compaction, got %v", err)
+	}
+
+	// Keep a copy of the log as it was before the next compaction, to
+	// simulate a crash after the snapshot was written but before the log
+	// was emptied
+	if err := store.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	repos.BookRepository.DeleteBook("b-1")
+	stale, _ := os.ReadFile(walPath)
+	store.Compact()
+	store.Close()
+	if err := os.WriteFile(walPath, stale, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	store = openStore(t, opts)
+	defer store.Close()
+	repos = store.Repositories()
+	books, _ := repos.BookRepository.GetAllBooks()
+	if len(books) != 3 {
+		t.Errorf("Expected 3 books, got %+v", books)
+	}
+	if _, err := repos.BookRepository.GetBook("b-1"); err == nil {
+		t.Error("Expected deleted book to stay deleted")
+	}
+}
+
+func Test_FileStore_Single_Process(t *testing.T) {
+	opts := filestore.Options{Dir: t.TempDir()}
+	store := openStore(t, opts)
+	defer store.Close()
+
+	if _, err := filestore.Open(opts); err == nil {
+		t.Error("Expected second open of the same directory to fail")
+	}
+}
+
+func Test_FileStore_Fsync_Policy(t *testing.T) {
+	type Test struct {
+		opts      filestore.Options
+		expectErr bool
+	}
+
+	tests := []Test{
+		{opts: filestore.Options{Fsync: filestore.FsyncAlways}},
+		{opts: filestore.Options{Fsync: filestore.FsyncNever}},
+		{opts: filestore.Options{Fsync: filestore.FsyncInterval, FsyncInterval: time.Millisecond}},
+		{opts: filestore.Options{Fsync: filestore.FsyncInterval, FsyncInterval: 0}, expectErr: true},
+		{opts: filestore.Options{Fsync: "sometimes"}, expectErr: true},
+	}
+
+	for _, test := range tests {
+		test.opts.Dir = t.TempDir()
+		store, err := filestore.Open(test.opts)
+		if (err != nil) != test.expectErr {
+			t.Errorf("Fsync %q: expected error %v, got %v", test.opts.Fsync, test.expectErr, err)
+		}
+		if err != nil {
+			continue
+		}
+		if _, err := store.Repositories().BookRepository.CreateBook(entity.Book{UUID: "b-1"}); err != nil {
+			t.Errorf("Fsync %q: CreateBook: %v", test.opts.Fsync, err)
+		}
+		store.Close()
+	}
+}
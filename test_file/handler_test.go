@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/biswasurmi/book-cli/api/handler"
+	"github.com/biswasurmi/book-cli/config"
 	"github.com/biswasurmi/book-cli/domain/entity"
 	"github.com/biswasurmi/book-cli/domain/repository"
 	"github.com/biswasurmi/book-cli/infrastructure/persistance/inmemory"
@@ -54,13 +55,26 @@ func GenerateJWTToken(userID int64) string {
 }
 
 func setupServer(t *testing.T) (*handler.Server, *repository.Repositories) {
+	return setupServerWithConfig(t, testConfig())
+}
+
+func testConfig() *config.Config {
+	cfg := config.Default()
+	cfg.Auth.JWTSecret = os.Getenv("JWT_SECRET")
+	// Most tests log in right after registering; verification has its own tests
+	cfg.Auth.RequireVerifiedEmail = false
+	// Cheap hashing keeps the suite fast; the parameters are not under test
+	cfg.Passwords.Argon2Memory = 1024
+	cfg.Passwords.Argon2Iterations = 1
+	cfg.Passwords.Argon2Parallelism = 1
+	return cfg
+}
+
+func setupServerWithConfig(t *testing.T, cfg *config.Config) (*handler.Server, *repository.Repositories) {
 	repos := inmemory.GetRepositories()
-	services := service.GetServices(repos)
-	handlers := &handler.Handler{
-		UserHandler: handler.NewUserHandler(services.UserService),
-		BookHandler: handler.NewBookHandler(services.BookService),
-	}
-	s := handler.CreateNewServer(handlers, services, true)
+	services := service.GetServices(repos, cfg)
+	handlers := handler.GetHandlers(services)
+	s := handler.CreateNewServer(handlers, services, cfg)
 	s.MountRoutes()
 	return s, repos
 }
@@ -84,6 +98,27 @@ func Test_Register(t *testing.T) {
 			token:              "",
 			expectedStatusCode: http.StatusCreated,
 		},
+		{
+			method:             "POST",
+			url:                "/api/v1/register",
+			body:               bytes.NewReader([]byte(`{"email":" Test@Example.COM ","password":"password123"}`)),
+			token:              "",
+			expectedStatusCode: http.StatusConflict,
+		},
+		{
+			method:             "POST",
+			url:                "/api/v1/register",
+			body:               bytes.NewReader([]byte(`{"email":"reader@example.com","username":"reader","password":"password123"}`)),
+			token:              "",
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			method:             "POST",
+			url:                "/api/v1/register",
+			body:               bytes.NewReader([]byte(`{"email":"other@example.com","username":"Reader","password":"password123"}`)),
+			token:              "",
+			expectedStatusCode: http.StatusConflict,
+		},
 		{
 			method:             "POST",
 			url:                "/api/v1/register",
@@ -146,6 +181,13 @@ func Test_Login(t *testing.T) {
 			token:              "",
 			expectedStatusCode: http.StatusOK,
 		},
+		{
+			method:             "POST",
+			url:                "/api/v1/login",
+			body:               bytes.NewReader([]byte(`{"email":"Test@EXAMPLE.com ","password":"password123"}`)),
+			token:              "",
+			expectedStatusCode: http.StatusOK,
+		},
 		{
 			method:             "POST",
 			url:                "/api/v1/login",
@@ -182,10 +224,11 @@ func Test_Login(t *testing.T) {
 func Test_Get_User(t *testing.T) {
 	s, repos := setupServer(t)
 
-	// Pre-create a user
+	// Pre-create an admin, who may act on other users' records
 	user := entity.User{
 		ID:        1,
 		Email:     "test@example.com",
+		Role:      entity.RoleAdmin,
 		Password:  "$2a$10$bxCN.KcstTAU5I1zkZNe/OYrwD5gUc93lNl5pTit40/ZugB9YwuT6",
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -282,7 +325,7 @@ func Test_Get_Me(t *testing.T) {
 			url:                "/api/v1/users/me",
 			body:               nil,
 			token:              GenerateJWTToken(999), // Non-existent user
-			expectedStatusCode: http.StatusNotFound,
+			expectedStatusCode: http.StatusUnauthorized,
 		},
 		{
 			method:             "GET",
@@ -313,10 +356,11 @@ func Test_Get_Me(t *testing.T) {
 func Test_Update_User(t *testing.T) {
 	s, repos := setupServer(t)
 
-	// Pre-create a user
+	// Pre-create an admin, who may act on other users' records
 	user := entity.User{
 		ID:        1,
 		Email:     "test@example.com",
+		Role:      entity.RoleAdmin,
 		Password:  "$2a$10$bxCN.KcstTAU5I1zkZNe/OYrwD5gUc93lNl5pTit40/ZugB9YwuT6",
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -396,10 +440,11 @@ func Test_Update_User(t *testing.T) {
 func Test_Delete_User(t *testing.T) {
 	s, repos := setupServer(t)
 
-	// Pre-create a user
+	// Pre-create an admin, who may act on other users' records
 	user := entity.User{
 		ID:        1,
 		Email:     "test@example.com",
+		Role:      entity.RoleAdmin,
 		Password:  "$2a$10$bxCN.KcstTAU5I1zkZNe/OYrwD5gUc93lNl5pTit40/ZugB9YwuT6",
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -414,27 +459,29 @@ func Test_Delete_User(t *testing.T) {
 		expectedStatusCode int
 	}
 
+	// The admin deletes their own account last, as only admins may act on
+	// other users' records
 	tests := []Test{
 		{
 			method:             "DELETE",
-			url:                "/api/v1/users/1",
+			url:                "/api/v1/users/999",
 			body:               nil,
 			token:              GenerateJWTToken(1),
-			expectedStatusCode: http.StatusNoContent,
+			expectedStatusCode: http.StatusNotFound,
 		},
 		{
 			method:             "DELETE",
-			url:                "/api/v1/users/999",
+			url:                "/api/v1/users/invalid",
 			body:               nil,
 			token:              GenerateJWTToken(1),
-			expectedStatusCode: http.StatusNotFound,
+			expectedStatusCode: http.StatusBadRequest,
 		},
 		{
 			method:             "DELETE",
-			url:                "/api/v1/users/invalid",
+			url:                "/api/v1/users/1",
 			body:               nil,
 			token:              GenerateJWTToken(1),
-			expectedStatusCode: http.StatusBadRequest,
+			expectedStatusCode: http.StatusNoContent,
 		},
 		{
 			method:             "DELETE",
@@ -592,13 +639,14 @@ func Test_Get_Book_With_id(t *testing.T) {
 	}
 	repos.UserRepository.CreateUser(user)
 
-	// Pre-create a book
+	// Pre-create a book owned by the user
 	book := entity.Book{
 		UUID:        "123e4567-e89b-12d3-a456-426614174001",
 		Name:        "Learn API",
 		AuthorList:  []string{"Urmi"},
 		PublishDate: "2022-01-02",
 		ISBN:        "0999-0555-5914",
+		CreatedBy:   1,
 	}
 	repos.BookRepository.CreateBook(book)
 
@@ -671,13 +719,14 @@ func Test_Update_Book(t *testing.T) {
 	}
 	repos.UserRepository.CreateUser(user)
 
-	// Pre-create a book
+	// Pre-create a book owned by the user
 	book := entity.Book{
 		UUID:        "123e4567-e89b-12d3-a456-426614174001",
 		Name:        "Learn API",
 		AuthorList:  []string{"Urmi"},
 		PublishDate: "2022-01-02",
 		ISBN:        "0999-0555-5914",
+		CreatedBy:   1,
 	}
 	repos.BookRepository.CreateBook(book)
 
@@ -757,13 +806,14 @@ func Test_Delete_Book(t *testing.T) {
 	}
 	repos.UserRepository.CreateUser(user)
 
-	// Pre-create a book
+	// Pre-create a book owned by the user
 	book := entity.Book{
 		UUID:        "123e4567-e89b-12d3-a456-426614174001",
 		Name:        "Learn API",
 		AuthorList:  []string{"Urmi"},
 		PublishDate: "2022-01-02",
 		ISBN:        "0999-0555-5914",
+		CreatedBy:   1,
 	}
 	repos.BookRepository.CreateBook(book)
 
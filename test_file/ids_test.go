@@ -0,0 +1,120 @@
+package test_file
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/service"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+)
+
+func Test_IDGenerator_Unique(t *testing.T) {
+	ids := service.NewIDGenerator(1)
+
+	const workers, perWorker = 20, 500
+	results := make([][]int64, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				results[w] = append(results[w], ids.NewID())
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	seen := make(map[int64]bool)
+	for _, batch := range results {
+		for i, id := range batch {
+			if id <= 0 {
+				t.Fatalf("Expected positive ID, got %d", id)
+			}
+			if seen[id] {
+				t.Fatalf("Duplicate ID %d", id)
+			}
+			seen[id] = true
+			if i > 0 && id <= batch[i-1] {
+				t.Fatalf("IDs from one caller must increase: %d after %d", id, batch[i-1])
+			}
+		}
+	}
+
+	// Different nodes never collide, even in the same millisecond
+	other := service.NewIDGenerator(2)
+	for i := 0; i < 1000; i++ {
+		if seen[other.NewID()] {
+			t.Fatal("IDs of different nodes collided")
+		}
+	}
+}
+
+func Test_IDGenerator_UUID(t *testing.T) {
+	ids := service.NewIDGenerator(0)
+	first, second := ids.NewUUID(), ids.NewUUID()
+	parsed, err := uuid.Parse(first)
+	if err != nil || parsed.Version() != 7 {
+		t.Errorf("Expected a UUIDv7, got %q, %v", first, err)
+	}
+	if first == second {
+		t.Error("Expected distinct UUIDs")
+	}
+}
+
+func Test_UserIDFromClaims(t *testing.T) {
+	type Test struct {
+		claims     jwt.MapClaims
+		expectedID int64
+		expectErr  bool
+	}
+
+	tests := []Test{
+		{claims: jwt.MapClaims{"sub": "1792380433898000969"}, expectedID: 1792380433898000969},
+		{claims: jwt.MapClaims{"user_id": json.Number("1792380433898000969")}, expectedID: 1792380433898000969},
+		{claims: jwt.MapClaims{"user_id": float64(42)}, expectedID: 42},
+		{claims: jwt.MapClaims{"sub": "not-a-number"}, expectErr: true},
+		{claims: jwt.MapClaims{}, expectErr: true},
+	}
+
+	for _, test := range tests {
+		id, err := service.UserIDFromClaims(test.claims)
+		if (err != nil) != test.expectErr || id != test.expectedID {
+			t.Errorf("%v: got %d, %v", test.claims, id, err)
+		}
+	}
+}
+
+// Generated IDs do not fit in a float64, which used to break /users/me for
+// every user created through the API.
+func Test_Register_Login_Me(t *testing.T) {
+	s, _ := setupServer(t)
+	body := []byte(`{"email":"fresh@example.com","password":"password123"}`)
+
+	req, _ := http.NewRequest("POST", "/api/v1/register", bytes.NewReader(body))
+	response := executeRequest(req, s)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	var created entity.User
+	json.NewDecoder(response.Body).Decode(&created)
+
+	req, _ = http.NewRequest("POST", "/api/v1/login", bytes.NewReader(body))
+	response = executeRequest(req, s)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var login map[string]string
+	json.NewDecoder(response.Body).Decode(&login)
+
+	req, _ = http.NewRequest("GET", "/api/v1/users/me", nil)
+	req.Header.Set("Authorization", "Bearer "+login["token"])
+	response = executeRequest(req, s)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var me entity.User
+	json.NewDecoder(response.Body).Decode(&me)
+	if me.ID != created.ID {
+		t.Errorf("Expected user %d, got %d", created.ID, me.ID)
+	}
+}
@@ -0,0 +1,322 @@
+package test_file
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/biswasurmi/book-cli/api/handler"
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/service"
+)
+
+const (
+	testRedirectURI  = "https://app.example.com/callback"
+	testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+func postForm(s *handler.Server, url string, form url.Values, clientID, secret string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", url, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		req.SetBasicAuth(clientID, secret)
+	}
+	return executeRequest(req, s)
+}
+
+// registerClient registers an OAuth2 client and returns its ID and secret.
+func registerClient(t *testing.T, s *handler.Server, token, body string) (string, string) {
+	t.Helper()
+	response := sendJSON(s, "POST", "/api/v1/oauth/clients", token, body)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	var client struct {
+		ID     string `json:"client_id"`
+		Secret string `json:"client_secret"`
+	}
+	json.NewDecoder(response.Body).Decode(&client)
+	return client.ID, client.Secret
+}
+
+func oauthErrorCode(response *httptest.ResponseRecorder) string {
+	var body struct {
+		Error string `json:"error"`
+	}
+	json.NewDecoder(response.Body).Decode(&body)
+	return body.Error
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func Test_OAuth_Client_Registration(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "test@example.com", Password: hashedPassword123})
+	token := loginToken(t, s, `{"email":"test@example.com","password":"password123"}`)
+
+	for _, body := range []string{
+		`{"name":"app","grant_types":["password"],"scopes":["books:read"]}`,
+		`{"name":"app","grant_types":["authorization_code"],"scopes":["books:read"]}`,
+		`{"name":"app","grant_types":["authorization_code"],"redirect_uris":["http://app.example.com/cb"],"scopes":["books:read"]}`,
+		`{"name":"app","grant_types":["client_credentials"],"scopes":["books:read"],"public":true}`,
+		`{"name":"app","grant_types":["client_credentials"],"scopes":[]}`,
+	} {
+		response := sendJSON(s, "POST", "/api/v1/oauth/clients", token, body)
+		checkResponseCode(t, http.StatusBadRequest, response.Code)
+	}
+	response := sendJSON(s, "POST", "/api/v1/oauth/clients", token, `{"name":"app","grant_types":["client_credentials"],"scopes":["users:admin"]}`)
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+
+	id, secret := registerClient(t, s, token, `{"name":"app","grant_types":["client_credentials"],"scopes":["books:read"]}`)
+	if id == "" || secret == "" {
+		t.Fatalf("Expected a client ID and secret, got %q, %q", id, secret)
+	}
+	publicID, publicSecret := registerClient(t, s, token, `{"name":"spa","grant_types":["authorization_code"],"redirect_uris":["http://localhost:3000/cb"],"scopes":["books:read"],"public":true}`)
+	if publicSecret != "" {
+		t.Errorf("Expected no secret for a public client, got %q", publicSecret)
+	}
+
+	response = sendJSON(s, "GET", "/api/v1/oauth/clients", token, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	if body := response.Body.String(); !strings.Contains(body, id) || !strings.Contains(body, publicID) || strings.Contains(body, "secret") {
+		t.Errorf("Unexpected clients %s", body)
+	}
+
+	response = sendJSON(s, "DELETE", "/api/v1/oauth/clients/"+id, token, "")
+	checkResponseCode(t, http.StatusNoContent, response.Code)
+	response = postForm(s, "/oauth/token", url.Values{"grant_type": {"client_credentials"}}, id, secret)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+}
+
+func Test_OAuth_Client_Credentials(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "test@example.com", Password: hashedPassword123})
+	token := loginToken(t, s, `{"email":"test@example.com","password":"password123"}`)
+	id, secret := registerClient(t, s, token, `{"name":"ci","grant_types":["client_credentials"],"scopes":["books:read","books:write"]}`)
+
+	response := postForm(s, "/oauth/token", url.Values{"grant_type": {"client_credentials"}}, id, "wrong")
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+	if code := oauthErrorCode(response); code != "invalid_client" || response.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("Expected invalid_client with a challenge, got %q", code)
+	}
+	response = postForm(s, "/oauth/token", url.Values{"grant_type": {"client_credentials"}, "scope": {"users:admin"}}, id, secret)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+	if code := oauthErrorCode(response); code != "invalid_scope" {
+		t.Errorf("Expected invalid_scope, got %q", code)
+	}
+	response = postForm(s, "/oauth/token", url.Values{"grant_type": {"password"}}, id, secret)
+	if code := oauthErrorCode(response); code != "unsupported_grant_type" {
+		t.Errorf("Expected unsupported_grant_type, got %q", code)
+	}
+
+	// Credentials may also be sent in the form
+	response = postForm(s, "/oauth/token", url.Values{"grant_type": {"client_credentials"}, "scope": {"books:read"}, "client_id": {id}, "client_secret": {secret}}, "", "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	if response.Header().Get("Cache-Control") != "no-store" {
+		t.Error("Expected token responses not to be cached")
+	}
+	var tokens service.TokenResponse
+	json.NewDecoder(response.Body).Decode(&tokens)
+	if tokens.TokenType != "Bearer" || tokens.Scope != "books:read" || tokens.ExpiresIn <= 0 {
+		t.Fatalf("Unexpected token response %+v", tokens)
+	}
+
+	checkResponseCode(t, http.StatusOK, sendJSON(s, "GET", "/api/v1/books", tokens.AccessToken, "").Code)
+	checkResponseCode(t, http.StatusForbidden, sendJSON(s, "POST", "/api/v1/books", tokens.AccessToken, `{"name":"Dune"}`).Code)
+	// Scoped tokens cannot mint other credentials
+	checkResponseCode(t, http.StatusForbidden, sendJSON(s, "POST", "/api/v1/users/me/api-keys", tokens.AccessToken, `{"name":"x","scopes":["books:write"]}`).Code)
+
+	response = postForm(s, "/oauth/introspect", url.Values{"token": {tokens.AccessToken}}, id, secret)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var info service.Introspection
+	json.NewDecoder(response.Body).Decode(&info)
+	if !info.Active || info.ClientID != id || info.Scope != "books:read" || info.Subject != "1" || info.Username != "test@example.com" || info.ExpiresAt == 0 {
+		t.Errorf("Unexpected introspection %+v", info)
+	}
+
+	response = postForm(s, "/oauth/revoke", url.Values{"token": {tokens.AccessToken}}, id, secret)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	checkResponseCode(t, http.StatusUnauthorized, sendJSON(s, "GET", "/api/v1/books", tokens.AccessToken, "").Code)
+	response = postForm(s, "/oauth/introspect", url.Values{"token": {tokens.AccessToken}}, id, secret)
+	if body := strings.TrimSpace(response.Body.String()); body != `{"active":false}` {
+		t.Errorf("Expected an inactive token, got %s", body)
+	}
+	// Unknown tokens are not an error
+	response = postForm(s, "/oauth/revoke", url.Values{"token": {"garbage"}}, id, secret)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	// Tokens from a password login belong to no client and cannot be
+	// revoked by one
+	response = postForm(s, "/oauth/revoke", url.Values{"token": {token}}, id, secret)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+}
+
+func Test_OAuth_Client_Credentials_Demoted_Owner(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "admin@example.com", Password: hashedPassword123, Role: entity.RoleAdmin})
+	repos.UserRepository.CreateUser(entity.User{ID: 2, Email: "other@example.com", Password: hashedPassword123, Role: entity.RoleUser})
+	token := loginToken(t, s, `{"email":"admin@example.com","password":"password123"}`)
+	id, secret := registerClient(t, s, token, `{"name":"ops","grant_types":["client_credentials"],"scopes":["users:admin"]}`)
+
+	// Once the owner is no longer an admin, no scope is left to grant
+	owner, _ := repos.UserRepository.GetByID(1)
+	owner.Role = entity.RoleUser
+	repos.UserRepository.Update(owner)
+	response := postForm(s, "/oauth/token", url.Values{"grant_type": {"client_credentials"}}, id, secret)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+	if code := oauthErrorCode(response); code != "invalid_scope" {
+		t.Errorf("Expected invalid_scope, got %q", code)
+	}
+	if _, err := repos.UserRepository.GetByID(2); err != nil {
+		t.Errorf("Expected the other user to be kept, got %v", err)
+	}
+
+	// No other path issues a client token without a scope claim
+	if _, err := s.Services.TokenService.Issue(owner, service.TokenOptions{ClientID: id}); !errors.Is(err, service.ErrNoScopes) {
+		t.Errorf("Expected ErrNoScopes, got %v", err)
+	}
+}
+
+func Test_OAuth_Authorization_Code(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "test@example.com", Password: hashedPassword123})
+	repos.UserRepository.CreateUser(entity.User{ID: 2, Email: "admin@example.com", Password: hashedPassword123, Role: entity.RoleAdmin})
+	token := loginToken(t, s, `{"email":"admin@example.com","password":"password123"}`)
+	id, secret := registerClient(t, s, token, `{"name":"Reading App","grant_types":["authorization_code"],"redirect_uris":["`+testRedirectURI+`"],"scopes":["books:read","books:write","users:admin"]}`)
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {id},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {"books:read users:admin"},
+		"state":                 {"xyz"},
+		"code_challenge":        {codeChallenge(testCodeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	req, _ := http.NewRequest("GET", "/oauth/authorize?"+params.Encode(), nil)
+	response := executeRequest(req, s)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	if body := response.Body.String(); !strings.Contains(body, "Reading App") || !strings.Contains(body, `name="password"`) {
+		t.Errorf("Expected a login form, got %s", body)
+	}
+
+	login := func(password string) *httptest.ResponseRecorder {
+		form := url.Values{}
+		for k, v := range params {
+			form[k] = v
+		}
+		form.Set("email", "test@example.com")
+		form.Set("password", password)
+		return postForm(s, "/oauth/authorize", form, "", "")
+	}
+	checkResponseCode(t, http.StatusUnauthorized, login("wrong").Code)
+
+	authorize := func() string {
+		t.Helper()
+		response := login("password123")
+		checkResponseCode(t, http.StatusFound, response.Code)
+		location, _ := url.Parse(response.Header().Get("Location"))
+		if !strings.HasPrefix(location.String(), testRedirectURI+"?") || location.Query().Get("state") != "xyz" || location.Query().Get("code") == "" {
+			t.Fatalf("Unexpected redirect %s", location)
+		}
+		return location.Query().Get("code")
+	}
+	exchange := func(code, verifier string) *httptest.ResponseRecorder {
+		return postForm(s, "/oauth/token", url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"redirect_uri":  {testRedirectURI},
+			"code_verifier": {verifier},
+		}, id, secret)
+	}
+
+	// A wrong verifier fails and uses up the code
+	code := authorize()
+	response = exchange(code, strings.Repeat("a", 43))
+	if c := oauthErrorCode(response); c != "invalid_grant" {
+		t.Errorf("Expected invalid_grant for a wrong verifier, got %q", c)
+	}
+	response = exchange(code, testCodeVerifier)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+
+	code = authorize()
+	response = exchange(code, testCodeVerifier)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var tokens service.TokenResponse
+	json.NewDecoder(response.Body).Decode(&tokens)
+	// users:admin is dropped for a user who is not an admin
+	if tokens.Scope != "books:read" {
+		t.Errorf("Expected scope books:read, got %q", tokens.Scope)
+	}
+	claims, err := service.NewTokenService(testConfig().Auth.JWTSecret, 0, nil).Parse(tokens.AccessToken)
+	if err != nil || claims["sub"] != "1" || claims["client_id"] != id || !service.HasAuthMethod(claims, service.AuthMethodPassword) {
+		t.Errorf("Unexpected claims %v, %v", claims, err)
+	}
+	if c := oauthErrorCode(exchange(code, testCodeVerifier)); c != "invalid_grant" {
+		t.Errorf("Expected a code to work once, got %q", c)
+	}
+}
+
+func Test_OAuth_Authorization_Errors(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "test@example.com", Password: hashedPassword123})
+	token := loginToken(t, s, `{"email":"test@example.com","password":"password123"}`)
+	id, _ := registerClient(t, s, token, `{"name":"spa","grant_types":["authorization_code"],"redirect_uris":["http://localhost:3000/cb"],"scopes":["books:read"],"public":true}`)
+	authorize := func(params url.Values) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/oauth/authorize?"+params.Encode(), nil)
+		return executeRequest(req, s)
+	}
+
+	// Never redirect to an unregistered URI
+	response := authorize(url.Values{"response_type": {"code"}, "client_id": {id}, "redirect_uri": {"https://evil.example.com/"}})
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+	response = authorize(url.Values{"response_type": {"code"}, "client_id": {"unknown"}})
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+
+	// Other errors go back to the client
+	response = authorize(url.Values{"response_type": {"code"}, "client_id": {id}, "state": {"s1"}})
+	checkResponseCode(t, http.StatusFound, response.Code)
+	location, _ := url.Parse(response.Header().Get("Location"))
+	if location.Query().Get("error") != "invalid_request" || location.Query().Get("state") != "s1" {
+		t.Errorf("Expected invalid_request for a missing code challenge, got %s", location)
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {id},
+		"code_challenge":        {codeChallenge(testCodeVerifier)},
+		"code_challenge_method": {"S256"},
+		"deny":                  {"1"},
+	}
+	response = postForm(s, "/oauth/authorize", params, "", "")
+	checkResponseCode(t, http.StatusFound, response.Code)
+	if location := response.Header().Get("Location"); location != "http://localhost:3000/cb?error=access_denied" {
+		t.Errorf("Expected access_denied, got %s", location)
+	}
+
+	// Public clients exchange codes without a secret but cannot introspect
+	params.Del("deny")
+	params.Set("email", "test@example.com")
+	params.Set("password", "password123")
+	response = postForm(s, "/oauth/authorize", params, "", "")
+	location, _ = url.Parse(response.Header().Get("Location"))
+	response = postForm(s, "/oauth/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {id},
+		"code":          {location.Query().Get("code")},
+		"redirect_uri":  {"http://localhost:3000/cb"},
+		"code_verifier": {testCodeVerifier},
+	}, "", "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var tokens service.TokenResponse
+	json.NewDecoder(response.Body).Decode(&tokens)
+	response = postForm(s, "/oauth/introspect", url.Values{"token": {tokens.AccessToken}, "client_id": {id}}, "", "")
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+}
@@ -0,0 +1,338 @@
+package test_file
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/biswasurmi/book-cli/api/handler"
+	"github.com/biswasurmi/book-cli/config"
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/service"
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	testOIDCClientID     = "book-api"
+	testOIDCClientSecret = "provider-secret"
+)
+
+// testProvider is a stand-in OpenID Connect provider. Tests choose the
+// claims of the next ID token with authorize instead of logging in.
+type testProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]testGrant
+}
+
+type testGrant struct {
+	claims    jwt.MapClaims
+	challenge string
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProvider{key: key, codes: make(map[string]testGrant)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != testOIDCClientID || secret != testOIDCClientSecret {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		p.mu.Lock()
+		grant, ok := p.codes[r.PostFormValue("code")]
+		delete(p.codes, r.PostFormValue("code"))
+		p.mu.Unlock()
+		if !ok || codeChallenge(r.PostFormValue("code_verifier")) != grant.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, grant.claims)
+		token.Header["kid"] = "test-key"
+		idToken, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "unused", "token_type": "Bearer", "id_token": idToken})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// authorize plays the provider's login page for the authorization URL the
+// server redirected to. It returns the callback URL the provider would send
+// the user back to, with an ID token made of claims on top of the standard
+// ones. Claims set to nil are left out.
+func (p *testProvider) authorize(t *testing.T, location string, claims jwt.MapClaims) string {
+	t.Helper()
+	u, err := url.Parse(location)
+	if err != nil || u.Host != p.Listener.Addr().String() || u.Path != "/authorize" {
+		t.Fatalf("Unexpected authorization URL %q", location)
+	}
+	query := u.Query()
+	if query.Get("client_id") != testOIDCClientID || query.Get("code_challenge_method") != "S256" || query.Get("scope") != "openid email profile" {
+		t.Fatalf("Unexpected authorization request %q", location)
+	}
+
+	all := jwt.MapClaims{
+		"iss":   p.URL,
+		"aud":   testOIDCClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for k, v := range claims {
+		if v == nil {
+			delete(all, k)
+		} else {
+			all[k] = v
+		}
+	}
+	code := base64.RawURLEncoding.EncodeToString([]byte(time.Now().String()))
+	p.mu.Lock()
+	p.codes[code] = testGrant{claims: all, challenge: query.Get("code_challenge")}
+	p.mu.Unlock()
+
+	callback, _ := url.Parse(query.Get("redirect_uri"))
+	callback.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	return callback.String()
+}
+
+func setupOIDCServer(t *testing.T, configure func(*config.Config)) (*handler.Server, *testProvider) {
+	provider := newTestProvider(t)
+	cfg := testConfig()
+	cfg.Server.PublicURL = "https://books.example.com"
+	cfg.OIDC.Enabled = true
+	cfg.OIDC.IssuerURL = provider.URL
+	cfg.OIDC.ClientID = testOIDCClientID
+	cfg.OIDC.ClientSecret = testOIDCClientSecret
+	if configure != nil {
+		configure(cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	s, _ := setupServerWithConfig(t, cfg)
+	return s, provider
+}
+
+// oidcLogin starts a login, lets the provider issue an ID token with
+// claims and returns the server's response to the callback.
+func oidcLogin(t *testing.T, s *handler.Server, p *testProvider, claims jwt.MapClaims) *httptest.ResponseRecorder {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "/api/v1/login/oidc", nil)
+	response := executeRequest(req, s)
+	checkResponseCode(t, http.StatusFound, response.Code)
+	callback := p.authorize(t, response.Header().Get("Location"), claims)
+
+	u, _ := url.Parse(callback)
+	if u.Path != config.OIDCCallbackPath || u.Host != "books.example.com" {
+		t.Fatalf("Unexpected callback URL %q", callback)
+	}
+	req, _ = http.NewRequest("GET", u.RequestURI(), nil)
+	return executeRequest(req, s)
+}
+
+func currentUser(t *testing.T, s *handler.Server, response *httptest.ResponseRecorder) entity.User {
+	t.Helper()
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var login map[string]string
+	json.NewDecoder(response.Body).Decode(&login)
+	me := sendJSON(s, "GET", "/api/v1/users/me", login["token"], "")
+	checkResponseCode(t, http.StatusOK, me.Code)
+	var user entity.User
+	json.NewDecoder(me.Body).Decode(&user)
+	return user
+}
+
+func Test_OIDC_Login(t *testing.T) {
+	s, p := setupOIDCServer(t, nil)
+	s.Services.UserService.CreateUser(service.Actor{}, entity.User{Email: "existing@example.com", Password: hashedPassword123, Role: entity.RoleUser})
+
+	// First login creates the user
+	created := currentUser(t, s, oidcLogin(t, s, p, jwt.MapClaims{"sub": "alice", "email": "Alice@Example.com", "email_verified": true}))
+	if created.Email != "alice@example.com" || created.Role != entity.RoleUser || created.ExternalSubject != "alice" || created.ExternalIssuer != p.URL {
+		t.Errorf("Unexpected user created: %+v", created)
+	}
+
+	// Later logins find the user by subject even if the email changed
+	again := currentUser(t, s, oidcLogin(t, s, p, jwt.MapClaims{"sub": "alice", "email": "alice@other.example.com", "email_verified": true}))
+	if again.ID != created.ID {
+		t.Errorf("Expected user %d, got %d", created.ID, again.ID)
+	}
+
+	// A verified email links the identity to an existing user, whose
+	// password keeps working
+	linked := currentUser(t, s, oidcLogin(t, s, p, jwt.MapClaims{"sub": "bob", "email": "existing@example.com", "email_verified": "true"}))
+	if linked.Email != "existing@example.com" || linked.ExternalSubject != "bob" {
+		t.Errorf("Expected the existing user to be linked, got %+v", linked)
+	}
+	loginToken(t, s, `{"email":"existing@example.com","password":"password123"}`)
+
+	// Unverified emails are neither linked nor used for new users
+	response := oidcLogin(t, s, p, jwt.MapClaims{"sub": "mallory", "email": "victim@example.com", "email_verified": false})
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+
+	// Provider users have no password to log in with
+	response = postJSON(s, "/api/v1/login", `{"email":"alice@example.com","password":""}`)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+}
+
+func Test_OIDC_Pending_Account(t *testing.T) {
+	s, p := setupOIDCServer(t, nil)
+
+	// Anyone can register someone else's address and leave it unverified
+	response := postJSON(s, "/api/v1/register", `{"email":"victim@example.com","password":"attacker-password"}`)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	response = oidcLogin(t, s, p, jwt.MapClaims{"sub": "victim", "email": "victim@example.com", "email_verified": true})
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+
+	user, err := s.Services.UserService.GetByEmail("victim@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ExternalSubject != "" || user.ExternalIssuer != "" || !user.VerificationPending {
+		t.Errorf("Expected the pending account to stay unlinked and unverified, got %+v", user)
+	}
+}
+
+func Test_OIDC_Link_Not_Settable(t *testing.T) {
+	s, p := setupOIDCServer(t, nil)
+
+	// Registering cannot claim someone's provider identity
+	response := postJSON(s, "/api/v1/register", fmt.Sprintf(`{"email":"mallory@example.com","password":"password123","external_issuer":%q,"external_subject":"alice"}`, p.URL))
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	alice := currentUser(t, s, oidcLogin(t, s, p, jwt.MapClaims{"sub": "alice", "email": "alice@example.com", "email_verified": true}))
+	if alice.Email != "alice@example.com" {
+		t.Errorf("Expected alice's own account, got %+v", alice)
+	}
+
+	// Updating a profile keeps the link
+	response = oidcLogin(t, s, p, jwt.MapClaims{"sub": "alice"})
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var login map[string]string
+	json.NewDecoder(response.Body).Decode(&login)
+	response = sendJSON(s, "PUT", fmt.Sprintf("/api/v1/users/%d", alice.ID), login["token"], `{"email":"alice@example.com","username":"alice","external_subject":"bob"}`)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	updated, _ := s.Services.UserService.GetByID(alice.ID)
+	if updated.ExternalIssuer != p.URL || updated.ExternalSubject != "alice" {
+		t.Errorf("Expected the provider link to be kept, got %q %q", updated.ExternalIssuer, updated.ExternalSubject)
+	}
+	if mallory, _ := s.Services.UserService.GetByEmail("mallory@example.com"); mallory.ExternalIssuer != "" || mallory.ExternalSubject != "" {
+		t.Errorf("Expected the registered user to have no provider link, got %+v", mallory)
+	}
+}
+
+func Test_OIDC_Rejected_Logins(t *testing.T) {
+	s, p := setupOIDCServer(t, func(cfg *config.Config) {
+		cfg.OIDC.AllowedDomains = []string{"example.com"}
+	})
+	claims := func(extra jwt.MapClaims) jwt.MapClaims {
+		all := jwt.MapClaims{"sub": "alice", "email": "alice@example.com", "email_verified": true}
+		for k, v := range extra {
+			all[k] = v
+		}
+		return all
+	}
+
+	for name, extra := range map[string]jwt.MapClaims{
+		"wrong nonce":    {"nonce": "forged"},
+		"no nonce":       {"nonce": nil},
+		"wrong audience": {"aud": "someone-else"},
+		"wrong issuer":   {"iss": "https://evil.example.com"},
+		"expired":        {"exp": time.Now().Add(-time.Minute).Unix()},
+		"no subject":     {"sub": ""},
+	} {
+		response := oidcLogin(t, s, p, claims(extra))
+		if response.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, response.Code)
+		}
+	}
+
+	response := oidcLogin(t, s, p, claims(jwt.MapClaims{"email": "alice@elsewhere.com"}))
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+
+	// An audience list must contain the client
+	currentUser(t, s, oidcLogin(t, s, p, claims(jwt.MapClaims{"aud": []string{"other", testOIDCClientID}})))
+
+	// A state works once
+	req, _ := http.NewRequest("GET", "/api/v1/login/oidc", nil)
+	callback, _ := url.Parse(p.authorize(t, executeRequest(req, s).Header().Get("Location"), claims(nil)))
+	req, _ = http.NewRequest("GET", callback.RequestURI(), nil)
+	checkResponseCode(t, http.StatusOK, executeRequest(req, s).Code)
+	req, _ = http.NewRequest("GET", callback.RequestURI(), nil)
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req, s).Code)
+	req, _ = http.NewRequest("GET", config.OIDCCallbackPath+"?code=x&state=unknown", nil)
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req, s).Code)
+
+	// Errors from the provider are passed on
+	req, _ = http.NewRequest("GET", config.OIDCCallbackPath+"?error=access_denied", nil)
+	checkResponseCode(t, http.StatusUnauthorized, executeRequest(req, s).Code)
+}
+
+func Test_OIDC_Account_Rules(t *testing.T) {
+	s, p := setupOIDCServer(t, func(cfg *config.Config) {
+		cfg.OIDC.CreateUsers = false
+	})
+
+	// Without just-in-time creation only existing users may log in
+	response := oidcLogin(t, s, p, jwt.MapClaims{"sub": "alice", "email": "alice@example.com", "email_verified": true})
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+
+	user, _ := s.Services.UserService.CreateUser(service.Actor{}, entity.User{Email: "alice@example.com", Password: hashedPassword123, Role: entity.RoleUser})
+	currentUser(t, s, oidcLogin(t, s, p, jwt.MapClaims{"sub": "alice", "email": "alice@example.com", "email_verified": true}))
+
+	// Local two-factor authentication still applies, unless the provider
+	// checked a second factor itself
+	token := loginToken(t, s, `{"email":"alice@example.com","password":"password123"}`)
+	enableTwoFactor(t, s, token)
+	response = oidcLogin(t, s, p, jwt.MapClaims{"sub": "alice"})
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+	var challenge map[string]interface{}
+	json.NewDecoder(response.Body).Decode(&challenge)
+	if challenge["mfa_required"] != true {
+		t.Errorf("Expected a two-factor challenge, got %v", challenge)
+	}
+	currentUser(t, s, oidcLogin(t, s, p, jwt.MapClaims{"sub": "alice", "amr": []string{"pwd", "mfa"}}))
+
+	user, _ = s.Services.UserService.GetByID(user.ID)
+	user.Disabled = true
+	s.Services.UserService.Update(service.Actor{}, user)
+	response = oidcLogin(t, s, p, jwt.MapClaims{"sub": "alice"})
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+}
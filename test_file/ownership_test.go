@@ -0,0 +1,115 @@
+package test_file
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/biswasurmi/book-cli/client"
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/service"
+)
+
+func Test_Book_Ownership(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "owner@example.com", Password: hashedPassword123, Role: entity.RoleUser})
+	repos.UserRepository.CreateUser(entity.User{ID: 2, Email: "other@example.com", Password: hashedPassword123, Role: entity.RoleUser})
+	repos.UserRepository.CreateUser(entity.User{ID: 3, Email: "admin@example.com", Password: hashedPassword123, Role: entity.RoleAdmin})
+	owner := loginToken(t, s, `{"email":"owner@example.com","password":"password123"}`)
+	other := loginToken(t, s, `{"email":"other@example.com","password":"password123"}`)
+	admin := loginToken(t, s, `{"email":"admin@example.com","password":"password123"}`)
+
+	// The creator comes from the token, not the body
+	response := sendJSON(s, "POST", "/api/v1/books", owner, `{"name":"Learn API","createdBy":2}`)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	var book entity.Book
+	json.NewDecoder(response.Body).Decode(&book)
+	if book.CreatedBy != 1 || book.UpdatedBy != 1 {
+		t.Errorf("Expected the book to be created by user 1, got %+v", book)
+	}
+
+	response = sendJSON(s, "PUT", "/api/v1/books/"+book.UUID, other, `{"name":"Stolen"}`)
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+	response = sendJSON(s, "DELETE", "/api/v1/books/"+book.UUID, other, "")
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+
+	response = sendJSON(s, "PUT", "/api/v1/books/"+book.UUID, owner, `{"name":"Learn API 2","createdBy":2}`)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	json.NewDecoder(response.Body).Decode(&book)
+	if book.Name != "Learn API 2" || book.CreatedBy != 1 || book.UpdatedBy != 1 {
+		t.Errorf("Unexpected book after update by owner: %+v", book)
+	}
+
+	// Admins may change any book, but only with users:admin in scope
+	limited := loginToken(t, s, `{"email":"admin@example.com","password":"password123","scope":"books:read books:write"}`)
+	response = sendJSON(s, "PUT", "/api/v1/books/"+book.UUID, limited, `{"name":"Moderated"}`)
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+	response = sendJSON(s, "PUT", "/api/v1/books/"+book.UUID, admin, `{"name":"Moderated"}`)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	json.NewDecoder(response.Body).Decode(&book)
+	if book.CreatedBy != 1 || book.UpdatedBy != 3 {
+		t.Errorf("Expected the owner to stay and the admin to be the last editor, got %+v", book)
+	}
+
+	// Books from before ownership was recorded belong to no one
+	repos.BookRepository.CreateBook(entity.Book{UUID: "legacy", Name: "Old Book"})
+	response = sendJSON(s, "DELETE", "/api/v1/books/legacy", owner, "")
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+
+	response = sendJSON(s, "DELETE", "/api/v1/books/legacy", admin, "")
+	checkResponseCode(t, http.StatusNoContent, response.Code)
+
+	response = sendJSON(s, "DELETE", "/api/v1/books/"+book.UUID, owner, "")
+	checkResponseCode(t, http.StatusNoContent, response.Code)
+}
+
+func Test_Book_Ownership_Admin_Two_Factor(t *testing.T) {
+	cfg := testConfig()
+	cfg.Auth.TwoFactorRoles = []string{entity.RoleAdmin}
+	s, repos := setupServerWithConfig(t, cfg)
+	repos.UserRepository.CreateUser(entity.User{ID: 3, Email: "admin@example.com", Password: hashedPassword123, Role: entity.RoleAdmin})
+	repos.BookRepository.CreateBook(entity.Book{UUID: "b-1", Name: "Learn API", CreatedBy: 1})
+
+	// Without a code the admin acts as a regular user
+	admin := loginToken(t, s, `{"email":"admin@example.com","password":"password123"}`)
+	response := sendJSON(s, "DELETE", "/api/v1/books/b-1", admin, "")
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+
+	secret, _ := enableTwoFactor(t, s, admin)
+	code, _ := service.GenerateTOTP(secret, time.Now().Add(30*time.Second))
+	admin = loginToken(t, s, `{"email":"admin@example.com","password":"password123","code":"`+code+`"}`)
+	response = sendJSON(s, "DELETE", "/api/v1/books/b-1", admin, "")
+	checkResponseCode(t, http.StatusNoContent, response.Code)
+}
+
+func Test_My_Books(t *testing.T) {
+	s, _ := setupServer(t)
+	ctx := context.Background()
+
+	writer := newTestClient(t, s.Router, client.Config{Email: "writer@example.com", Password: "password123"})
+	reader := newTestClient(t, s.Router, client.Config{Email: "reader@example.com", Password: "password123"})
+	writer.Register(ctx, entity.User{Email: "writer@example.com", Password: "password123"})
+	reader.Register(ctx, entity.User{Email: "reader@example.com", Password: "password123"})
+
+	writer.CreateBook(ctx, entity.Book{Name: "Learn API"})
+	writer.CreateBook(ctx, entity.Book{Name: "Learn Go"})
+	reader.CreateBook(ctx, entity.Book{Name: "Learn Rust"})
+
+	books, err := writer.MyBooks(ctx, entity.BookFilter{})
+	if err != nil || len(books) != 2 {
+		t.Fatalf("MyBooks: got %+v, %v", books, err)
+	}
+	books, err = writer.MyBooks(ctx, entity.BookFilter{Name: "go"})
+	if err != nil || len(books) != 1 || books[0].Name != "Learn Go" {
+		t.Errorf("MyBooks filtered by name: got %+v, %v", books, err)
+	}
+	books, err = reader.MyBooks(ctx, entity.BookFilter{})
+	if err != nil || len(books) != 1 || books[0].Name != "Learn Rust" {
+		t.Errorf("MyBooks of another user: got %+v, %v", books, err)
+	}
+	if books, err = writer.ListBooks(ctx, entity.BookFilter{}); err != nil || len(books) != 3 {
+		t.Errorf("ListBooks still lists every book, got %+v, %v", books, err)
+	}
+}
@@ -0,0 +1,88 @@
+package test_file
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/biswasurmi/book-cli/config"
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/service"
+)
+
+func Test_Password_Hasher(t *testing.T) {
+	cfg := testConfig().Passwords
+	hasher := service.NewPasswordHasher(cfg)
+
+	hash, err := hasher.Hash("password123")
+	if err != nil || !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("Expected a PHC argon2id hash, got %q, %v", hash, err)
+	}
+	if other, _ := hasher.Hash("password123"); other == hash {
+		t.Error("Hashes of the same password must use different salts")
+	}
+
+	type Test struct {
+		name     string
+		cfg      config.Passwords
+		hash     string
+		password string
+		ok       bool
+		rehash   bool
+	}
+	stronger := cfg
+	stronger.Argon2Iterations = 2
+	bcryptCfg := cfg
+	bcryptCfg.Algorithm = config.HashBcrypt
+
+	tests := []Test{
+		{"Match", cfg, hash, "password123", true, false},
+		{"Mismatch", cfg, hash, "wrong-password", false, false},
+		{"Outdated parameters", stronger, hash, "password123", true, true},
+		{"Other algorithm", bcryptCfg, hash, "password123", true, true},
+		{"Bcrypt hash", cfg, hashedPassword123, "password123", true, true},
+		{"Bcrypt configured", bcryptCfg, hashedPassword123, "password123", true, false},
+		{"Bcrypt mismatch", cfg, hashedPassword123, "wrong-password", false, false},
+	}
+	for _, test := range tests {
+		ok, rehash, err := service.NewPasswordHasher(test.cfg).Verify(test.hash, test.password)
+		if err != nil || ok != test.ok || rehash != test.rehash {
+			t.Errorf("%s: got ok=%v rehash=%v err=%v", test.name, ok, rehash, err)
+		}
+	}
+
+	if _, _, err := hasher.Verify("plain-text", "plain-text"); !errors.Is(err, service.ErrUnknownHashFormat) {
+		t.Errorf("Expected ErrUnknownHashFormat, got %v", err)
+	}
+	if bcryptHash, _ := service.NewPasswordHasher(bcryptCfg).Hash("password123"); !strings.HasPrefix(bcryptHash, "$2a$10$") {
+		t.Errorf("Expected a bcrypt hash, got %q", bcryptHash)
+	}
+}
+
+func Test_Password_Rehash_On_Login(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "test@example.com", Password: hashedPassword123})
+
+	response := postJSON(s, "/api/v1/login", `{"email":"test@example.com","password":"wrong-password"}`)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+	if user, _ := repos.UserRepository.GetByID(1); user.Password != hashedPassword123 {
+		t.Errorf("A failed login must not change the hash, got %q", user.Password)
+	}
+
+	loginToken(t, s, `{"email":"test@example.com","password":"password123"}`)
+	user, _ := repos.UserRepository.GetByID(1)
+	if !strings.HasPrefix(user.Password, "$argon2id$") {
+		t.Fatalf("Expected the bcrypt hash to be upgraded, got %q", user.Password)
+	}
+	loginToken(t, s, `{"email":"test@example.com","password":"password123"}`)
+	if again, _ := repos.UserRepository.GetByID(1); again.Password != user.Password {
+		t.Error("An up to date hash must not be replaced")
+	}
+
+	response = postJSON(s, "/api/v1/register", `{"email":"new@example.com","password":"password123"}`)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	if created, _ := repos.UserRepository.GetByEmail("new@example.com"); !strings.HasPrefix(created.Password, "$argon2id$") {
+		t.Errorf("Expected new users to get argon2id hashes, got %q", created.Password)
+	}
+}
@@ -0,0 +1,199 @@
+package test_file
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/biswasurmi/book-cli/api/handler"
+	"github.com/biswasurmi/book-cli/config"
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/infrastructure/mail"
+)
+
+var resetTokenPattern = regexp.MustCompile(`(?m)^([A-Za-z0-9_-]{43})$`)
+
+// waitForMail returns the contents of the next .eml file in dir that is not
+// in seen.
+func waitForMail(t *testing.T, dir string, seen map[string]bool) string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		for _, file := range files {
+			if !seen[file] {
+				seen[file] = true
+				data, _ := os.ReadFile(file)
+				return string(data)
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("No email was sent")
+	return ""
+}
+
+func postJSON(s *handler.Server, url, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", url, strings.NewReader(body))
+	return executeRequest(req, s)
+}
+
+func Test_Password_Reset(t *testing.T) {
+	outbox := t.TempDir()
+	cfg := testConfig()
+	cfg.Mail.Driver = config.MailFile
+	cfg.Mail.Dir = outbox
+	cfg.Server.PublicURL = "https://books.example.com"
+	s, repos := setupServerWithConfig(t, cfg)
+
+	repos.UserRepository.CreateUser(entity.User{
+		ID:       1,
+		Email:    "test@example.com",
+		Password: "$2a$10$bxCN.KcstTAU5I1zkZNe/OYrwD5gUc93lNl5pTit40/ZugB9YwuT6", // Hashed "password123"
+	})
+
+	// An existing session, issued before the reset
+	response := postJSON(s, "/api/v1/login", `{"email":"test@example.com","password":"password123"}`)
+	var login map[string]string
+	json.NewDecoder(response.Body).Decode(&login)
+	oldToken := "Bearer " + login["token"]
+
+	// Unknown emails get the same answer and no mail
+	response = postJSON(s, "/api/v1/password/forgot", `{"email":"nobody@example.com"}`)
+	checkResponseCode(t, http.StatusAccepted, response.Code)
+
+	seen := map[string]bool{}
+	response = postJSON(s, "/api/v1/password/forgot", `{"email":"Test@Example.com"}`)
+	checkResponseCode(t, http.StatusAccepted, response.Code)
+	message := waitForMail(t, outbox, seen)
+	if !strings.Contains(message, "To: test@example.com") || !strings.Contains(message, "https://books.example.com/reset-password?token=") {
+		t.Errorf("Unexpected email:\n%s", message)
+	}
+	if files, _ := filepath.Glob(filepath.Join(outbox, "*.eml")); len(files) != 1 {
+		t.Errorf("Expected exactly one email, got %d", len(files))
+	}
+	token := resetTokenPattern.FindString(message)
+	if token == "" {
+		t.Fatalf("No token in email:\n%s", message)
+	}
+
+	// Requesting again invalidates the first link
+	postJSON(s, "/api/v1/password/forgot", `{"email":"test@example.com"}`)
+	latest := resetTokenPattern.FindString(waitForMail(t, outbox, seen))
+
+	type Test struct {
+		body               string
+		expectedStatusCode int
+	}
+
+	// Stay in a later second than the login so its token counts as older
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	tests := []Test{
+		{body: `{"token":"` + token + `","password":"new-password"}`, expectedStatusCode: http.StatusBadRequest},
+		{body: `{"token":"` + latest + `","password":"short"}`, expectedStatusCode: http.StatusBadRequest},
+		{body: `{"token":"` + latest + `","password":"new-password"}`, expectedStatusCode: http.StatusNoContent},
+		// Tokens are single-use
+		{body: `{"token":"` + latest + `","password":"another-password"}`, expectedStatusCode: http.StatusBadRequest},
+		{body: `not a json`, expectedStatusCode: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		response := postJSON(s, "/api/v1/password/reset", test.body)
+		checkResponseCode(t, test.expectedStatusCode, response.Code)
+	}
+
+	// The old password and the old session no longer work
+	response = postJSON(s, "/api/v1/login", `{"email":"test@example.com","password":"password123"}`)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+	req, _ := http.NewRequest("GET", "/api/v1/users/me", nil)
+	req.Header.Set("Authorization", oldToken)
+	checkResponseCode(t, http.StatusUnauthorized, executeRequest(req, s).Code)
+
+	response = postJSON(s, "/api/v1/login", `{"email":"test@example.com","password":"new-password"}`)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	json.NewDecoder(response.Body).Decode(&login)
+	req, _ = http.NewRequest("GET", "/api/v1/users/me", nil)
+	req.Header.Set("Authorization", "Bearer "+login["token"])
+	checkResponseCode(t, http.StatusOK, executeRequest(req, s).Code)
+}
+
+// Test_SMTP_Mailer talks to a minimal SMTP server that records the message.
+func Test_SMTP_Mailer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost ESMTP")
+		var data bytes.Buffer
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					received <- data.String()
+					reply("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case cmd == "DATA":
+				inData = true
+				reply("354 Go ahead")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	cfg := config.Default().Mail
+	cfg.Driver = config.MailSMTP
+	cfg.SMTPHost = host
+	cfg.SMTPPort, _ = net.LookupPort("tcp", port)
+
+	err = mail.New(cfg).Send(mail.Message{To: "test@example.com", Subject: "Hello", Body: "Hi there\n"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	select {
+	case message := <-received:
+		if !strings.Contains(message, "To: test@example.com") || !strings.Contains(message, "Subject: Hello") || !strings.Contains(message, "Hi there") {
+			t.Errorf("Unexpected message:\n%s", message)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("SMTP server received nothing")
+	}
+}
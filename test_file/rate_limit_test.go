@@ -0,0 +1,93 @@
+package test_file
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+)
+
+func Test_Login_Lockout(t *testing.T) {
+	s, repos := setupServer(t)
+
+	user := entity.User{
+		ID:        1,
+		Email:     "test@example.com",
+		Password:  "$2a$10$bxCN.KcstTAU5I1zkZNe/OYrwD5gUc93lNl5pTit40/ZugB9YwuT6",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	repos.UserRepository.CreateUser(user)
+
+	// The first failures are answered normally, then the account has to wait
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("POST", "/api/v1/login", bytes.NewReader([]byte(`{"email":"test@example.com","password":"wrong"}`)))
+		response := executeRequest(req, s)
+		checkResponseCode(t, http.StatusUnauthorized, response.Code)
+	}
+
+	req, _ := http.NewRequest("POST", "/api/v1/login", bytes.NewReader([]byte(`{"email":"test@example.com","password":"password123"}`)))
+	response := executeRequest(req, s)
+	checkResponseCode(t, http.StatusTooManyRequests, response.Code)
+	if response.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected Retry-After header on 429 response")
+	}
+
+	// Basic Auth shares the same lockout state
+	req, _ = http.NewRequest("GET", "/api/v1/get-token", nil)
+	req.Header.Set("Authorization", BasicAuthHeader("test@example.com", "password123"))
+	response = executeRequest(req, s)
+	checkResponseCode(t, http.StatusTooManyRequests, response.Code)
+}
+
+func Test_Login_RateLimit_Per_IP(t *testing.T) {
+	s, _ := setupServer(t)
+
+	var response int
+	for i := 0; i < 20; i++ {
+		req, _ := http.NewRequest("POST", "/api/v1/login", bytes.NewReader([]byte(`{"email":"nobody@example.com","password":"password123"}`)))
+		req.RemoteAddr = "192.0.2.1:1234"
+		response = executeRequest(req, s).Code
+		if response == http.StatusTooManyRequests {
+			break
+		}
+	}
+	checkResponseCode(t, http.StatusTooManyRequests, response)
+
+	// Other clients are not affected
+	req, _ := http.NewRequest("POST", "/api/v1/login", bytes.NewReader([]byte(`{"email":"other@example.com","password":"password123"}`)))
+	req.RemoteAddr = "192.0.2.2:1234"
+	checkResponseCode(t, http.StatusUnauthorized, executeRequest(req, s).Code)
+}
+
+func Test_Admin_Lockouts(t *testing.T) {
+	s, repos := setupServer(t)
+
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "admin@example.com", Role: entity.RoleAdmin})
+	repos.UserRepository.CreateUser(entity.User{ID: 2, Email: "user@example.com", Role: entity.RoleUser})
+
+	req, _ := http.NewRequest("POST", "/api/v1/login", bytes.NewReader([]byte(`{"email":"victim@example.com","password":"wrong"}`)))
+	executeRequest(req, s)
+
+	req, _ = http.NewRequest("GET", "/api/v1/admin/lockouts", nil)
+	req.Header.Set("Authorization", GenerateJWTToken(2))
+	checkResponseCode(t, http.StatusForbidden, executeRequest(req, s).Code)
+
+	req, _ = http.NewRequest("GET", "/api/v1/admin/lockouts", nil)
+	req.Header.Set("Authorization", GenerateJWTToken(1))
+	response := executeRequest(req, s)
+	checkResponseCode(t, http.StatusOK, response.Code)
+
+	var lockouts []entity.Lockout
+	json.NewDecoder(response.Body).Decode(&lockouts)
+	if len(lockouts) != 1 || lockouts[0].Account != "victim@example.com" || lockouts[0].Failures != 1 {
+		t.Errorf("Unexpected lockouts: %+v", lockouts)
+	}
+
+	req, _ = http.NewRequest("DELETE", "/api/v1/admin/lockouts/victim@example.com", nil)
+	req.Header.Set("Authorization", GenerateJWTToken(1))
+	checkResponseCode(t, http.StatusNoContent, executeRequest(req, s).Code)
+}
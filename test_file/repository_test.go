@@ -0,0 +1,112 @@
+package test_file
+
+import (
+	"testing"
+
+	"github.com/biswasurmi/book-cli/domain/repository"
+	"github.com/biswasurmi/book-cli/domain/repository/repositorytest"
+	"github.com/biswasurmi/book-cli/infrastructure/persistance/filestore"
+	"github.com/biswasurmi/book-cli/infrastructure/persistance/inmemory"
+)
+
+func newFileRepositories(t *testing.T) *repository.Repositories {
+	store := openStore(t, filestore.Options{Dir: t.TempDir(), Fsync: filestore.FsyncNever})
+	t.Cleanup(func() { store.Close() })
+	return store.Repositories()
+}
+
+func Test_InMemory_BookRepository(t *testing.T) {
+	repositorytest.RunBookRepository(t, func(t *testing.T) repository.BookRepository {
+		return inmemory.NewBookRepo()
+	})
+}
+
+func Test_InMemory_UserRepository(t *testing.T) {
+	repositorytest.RunUserRepository(t, func(t *testing.T) repository.UserRepository {
+		return inmemory.NewUserRepo()
+	})
+}
+
+func Test_FileStore_BookRepository(t *testing.T) {
+	repositorytest.RunBookRepository(t, func(t *testing.T) repository.BookRepository {
+		return newFileRepositories(t).BookRepository
+	})
+}
+
+func Test_FileStore_UserRepository(t *testing.T) {
+	repositorytest.RunUserRepository(t, func(t *testing.T) repository.UserRepository {
+		return newFileRepositories(t).UserRepository
+	})
+}
+
+func Test_InMemory_APIKeyRepository(t *testing.T) {
+	repositorytest.RunAPIKeyRepository(t, func(t *testing.T) repository.APIKeyRepository {
+		return inmemory.NewAPIKeyRepo()
+	})
+}
+
+func Test_FileStore_APIKeyRepository(t *testing.T) {
+	repositorytest.RunAPIKeyRepository(t, func(t *testing.T) repository.APIKeyRepository {
+		return newFileRepositories(t).APIKeyRepository
+	})
+}
+
+func Test_InMemory_OAuthClientRepository(t *testing.T) {
+	repositorytest.RunOAuthClientRepository(t, func(t *testing.T) repository.OAuthClientRepository {
+		return inmemory.NewOAuthClientRepo()
+	})
+}
+
+func Test_FileStore_OAuthClientRepository(t *testing.T) {
+	repositorytest.RunOAuthClientRepository(t, func(t *testing.T) repository.OAuthClientRepository {
+		return newFileRepositories(t).OAuthClientRepository
+	})
+}
+
+func Test_InMemory_AuditRepository(t *testing.T) {
+	repositorytest.RunAuditRepository(t, func(t *testing.T) repository.AuditRepository {
+		return inmemory.NewAuditRepo()
+	})
+}
+
+func Test_FileStore_AuditRepository(t *testing.T) {
+	repositorytest.RunAuditRepository(t, func(t *testing.T) repository.AuditRepository {
+		return newFileRepositories(t).AuditRepository
+	})
+}
+
+func Test_InMemory_BookRevisionRepository(t *testing.T) {
+	repositorytest.RunBookRevisionRepository(t, func(t *testing.T) repository.BookRevisionRepository {
+		return inmemory.NewBookRevisionRepo()
+	})
+}
+
+func Test_FileStore_BookRevisionRepository(t *testing.T) {
+	repositorytest.RunBookRevisionRepository(t, func(t *testing.T) repository.BookRevisionRepository {
+		return newFileRepositories(t).BookRevisionRepository
+	})
+}
+
+func Test_InMemory_WebhookRepository(t *testing.T) {
+	repositorytest.RunWebhookRepository(t, func(t *testing.T) repository.WebhookRepository {
+		return inmemory.NewWebhookRepo()
+	})
+}
+
+func Test_FileStore_WebhookRepository(t *testing.T) {
+	repositorytest.RunWebhookRepository(t, func(t *testing.T) repository.WebhookRepository {
+		return newFileRepositories(t).WebhookRepository
+	})
+}
+
+func Test_InMemory_WebhookDeliveryRepository(t *testing.T) {
+	repositorytest.RunWebhookDeliveryRepository(t, func(t *testing.T) repository.WebhookDeliveryRepository {
+		return inmemory.NewWebhookDeliveryRepo()
+	})
+}
+
+func Test_FileStore_WebhookDeliveryRepository(t *testing.T) {
+	repositorytest.RunWebhookDeliveryRepository(t, func(t *testing.T) repository.WebhookDeliveryRepository {
+		return newFileRepositories(t).WebhookDeliveryRepository
+	})
+}
@@ -0,0 +1,118 @@
+package test_file
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/service"
+)
+
+func Test_Login_Scopes(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "user@example.com", Password: hashedPassword123, Role: entity.RoleUser})
+	repos.UserRepository.CreateUser(entity.User{ID: 2, Email: "admin@example.com", Password: hashedPassword123, Role: entity.RoleAdmin})
+
+	for email, want := range map[string]string{
+		"user@example.com":  "books:read books:write account",
+		"admin@example.com": "books:read books:write account users:admin",
+	} {
+		response := postJSON(s, "/api/v1/login", `{"email":"`+email+`","password":"password123"}`)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		var login map[string]string
+		json.NewDecoder(response.Body).Decode(&login)
+		if login["scope"] != want {
+			t.Errorf("%s: expected scope %q, got %q", email, want, login["scope"])
+		}
+		claims, err := s.Services.TokenService.Parse(login["token"])
+		if err != nil || claims["scope"] != want {
+			t.Errorf("%s: expected scope claim %q, got %v, %v", email, want, claims["scope"], err)
+		}
+	}
+
+	// Scopes outside the role are refused rather than dropped
+	response := postJSON(s, "/api/v1/login", `{"email":"user@example.com","password":"password123","scope":"books:read users:admin"}`)
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+	response = postJSON(s, "/api/v1/login", `{"email":"user@example.com","password":"password123","scope":"books:delete"}`)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+
+	req, _ := http.NewRequest("GET", "/api/v1/get-token?scope=books:read", nil)
+	req.Header.Set("Authorization", BasicAuthHeader("admin@example.com", "password123"))
+	response = executeRequest(req, s)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var login map[string]string
+	json.NewDecoder(response.Body).Decode(&login)
+	if login["scope"] != entity.ScopeBooksRead {
+		t.Errorf("Expected a books:read token, got %q", login["scope"])
+	}
+}
+
+func Test_Scope_Enforcement(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "user@example.com", Password: hashedPassword123, Role: entity.RoleUser})
+	repos.UserRepository.CreateUser(entity.User{ID: 2, Email: "other@example.com", Password: hashedPassword123, Role: entity.RoleUser})
+	full := loginToken(t, s, `{"email":"user@example.com","password":"password123"}`)
+	reader := loginToken(t, s, `{"email":"user@example.com","password":"password123","scope":"books:read"}`)
+
+	response := sendJSON(s, "GET", "/api/v1/books", reader, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	response = sendJSON(s, "POST", "/api/v1/books", reader, `{"name":"Learn API"}`)
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+	challenge := response.Header().Get("WWW-Authenticate")
+	if !strings.HasPrefix(challenge, "Bearer ") || !strings.Contains(challenge, `error="insufficient_scope"`) || !strings.Contains(challenge, `scope="books:write"`) {
+		t.Errorf("Unexpected WWW-Authenticate header %q", challenge)
+	}
+	response = sendJSON(s, "POST", "/api/v1/books", full, `{"name":"Learn API"}`)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+
+	// Users reach their own record with the account scope, but need
+	// users:admin for anyone else's
+	response = sendJSON(s, "GET", "/api/v1/users/1", full, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	response = sendJSON(s, "GET", "/api/v1/users/1", reader, "")
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+	response = sendJSON(s, "GET", "/api/v1/users/2", full, "")
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+
+	// Managing credentials needs the account scope
+	response = sendJSON(s, "POST", "/api/v1/users/me/api-keys", reader, `{"name":"ci","scopes":["books:read"]}`)
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+	createAPIKey(t, s, full, `{"name":"ci","scopes":["books:read"]}`)
+	response = sendJSON(s, "POST", "/api/v1/users/me/api-keys", full, `{"name":"ci","scopes":["account"]}`)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+
+	// Tokens from before scopes were added get the scopes of the user's
+	// role, not unrestricted access
+	legacy := strings.TrimPrefix(GenerateJWTToken(1), "Bearer ")
+	response = sendJSON(s, "POST", "/api/v1/books", legacy, `{"name":"Old Token"}`)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	response = sendJSON(s, "GET", "/api/v1/users/2", legacy, "")
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+	response = sendJSON(s, "GET", "/api/v1/audit", legacy, "")
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+}
+
+func Test_Scope_With_Two_Factor(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "user@example.com", Password: hashedPassword123, Role: entity.RoleUser})
+	secret, _ := enableTwoFactor(t, s, loginToken(t, s, `{"email":"user@example.com","password":"password123"}`))
+
+	response := postJSON(s, "/api/v1/login", `{"email":"user@example.com","password":"password123","scope":"books:read"}`)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+	var challenge map[string]interface{}
+	json.NewDecoder(response.Body).Decode(&challenge)
+
+	code, _ := service.GenerateTOTP(secret, time.Now().Add(30*time.Second))
+	response = postJSON(s, "/api/v1/login/2fa", `{"mfa_token":"`+challenge["mfa_token"].(string)+`","code":"`+code+`","scope":"books:read"}`)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var login map[string]string
+	json.NewDecoder(response.Body).Decode(&login)
+	if login["scope"] != entity.ScopeBooksRead {
+		t.Errorf("Expected a books:read token, got %q", login["scope"])
+	}
+	response = sendJSON(s, "DELETE", "/api/v1/users/1", login["token"], "")
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+}
@@ -0,0 +1,206 @@
+package test_file
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/biswasurmi/book-cli/api/handler"
+	"github.com/biswasurmi/book-cli/config"
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/infrastructure/certs"
+	"github.com/biswasurmi/book-cli/infrastructure/persistance/inmemory"
+	"github.com/biswasurmi/book-cli/service"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating CA: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (ca *testCA) issueClient(t *testing.T, commonName string) tls.Certificate {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("issuing client certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func Test_MutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caFile, ca.pem, 0o600)
+
+	cfg := config.Default()
+	cfg.Auth.JWTSecret = os.Getenv("JWT_SECRET")
+	cfg.TLS.SelfSigned = true
+	cfg.TLS.ClientAuth = config.ClientAuthOptional
+	cfg.TLS.ClientCAFile = caFile
+	cfg.TLS.SubjectUsers = map[string]string{"ci-runner": "ci@example.com"}
+
+	repos := inmemory.GetRepositories()
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "alice@example.com", Role: entity.RoleUser})
+	repos.UserRepository.CreateUser(entity.User{ID: 2, Email: "ci@example.com", Role: entity.RoleAdmin})
+	services := service.GetServices(repos, cfg)
+	s := handler.CreateNewServer(handler.GetHandlers(services), services, cfg)
+	s.MountRoutes()
+
+	tlsConfig, err := certs.ServerConfig(context.Background(), cfg.TLS)
+	if err != nil {
+		t.Fatalf("ServerConfig: %v", err)
+	}
+	ts := httptest.NewUnstartedServer(s.Router)
+	ts.TLS = tlsConfig
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	clientFor := func(cert *tls.Certificate) *http.Client {
+		clientTLS := &tls.Config{InsecureSkipVerify: true}
+		if cert != nil {
+			clientTLS.Certificates = []tls.Certificate{*cert}
+		}
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS, ForceAttemptHTTP2: true}}
+	}
+
+	type Test struct {
+		cert               *tls.Certificate
+		expectedStatusCode int
+	}
+
+	alice := ca.issueClient(t, "alice@example.com")
+	runner := ca.issueClient(t, "ci-runner")
+	unknown := ca.issueClient(t, "mallory@example.com")
+
+	tests := []Test{
+		{cert: &alice, expectedStatusCode: http.StatusOK},
+		{cert: &runner, expectedStatusCode: http.StatusOK},
+		{cert: &unknown, expectedStatusCode: http.StatusUnauthorized},
+		{cert: nil, expectedStatusCode: http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		response, err := clientFor(test.cert).Get(ts.URL + "/api/v1/users/me")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		response.Body.Close()
+		checkResponseCode(t, test.expectedStatusCode, response.StatusCode)
+		if response.ProtoMajor != 2 {
+			t.Errorf("Expected HTTP/2, got %s", response.Proto)
+		}
+	}
+
+	// A certificate gets the scopes of the user's role, so only admins act
+	// on other users' records
+	send := func(cert *tls.Certificate, method, path, body string) int {
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		response, err := clientFor(cert).Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+	checkResponseCode(t, http.StatusForbidden, send(&alice, "PUT", "/api/v1/users/2", `{"email":"mallory@example.com"}`))
+	checkResponseCode(t, http.StatusForbidden, send(&alice, "DELETE", "/api/v1/users/2", ""))
+	checkResponseCode(t, http.StatusForbidden, send(&alice, "GET", "/api/v1/audit", ""))
+	checkResponseCode(t, http.StatusOK, send(&alice, "GET", "/api/v1/users/1", ""))
+	checkResponseCode(t, http.StatusOK, send(&runner, "GET", "/api/v1/users/1", ""))
+	checkResponseCode(t, http.StatusOK, send(&runner, "GET", "/api/v1/audit", ""))
+	if user, err := repos.UserRepository.GetByID(2); err != nil || user.Email != "ci@example.com" {
+		t.Errorf("Expected the admin to be unchanged, got %+v, %v", user, err)
+	}
+}
+
+func Test_Certificate_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+
+	writePair := func(host string) {
+		cert, err := certs.SelfSigned([]string{host}, time.Hour)
+		if err != nil {
+			t.Fatalf("SelfSigned: %v", err)
+		}
+		key, _ := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+		os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600)
+		os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600)
+	}
+
+	currentHost := func(r *certs.Reloader) string {
+		cert, _ := r.GetCertificate(nil)
+		leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+		return leaf.DNSNames[0]
+	}
+
+	writePair("first.example.com")
+	reloader, err := certs.NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+	if got := currentHost(reloader); got != "first.example.com" {
+		t.Fatalf("Expected first certificate, got %s", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Watch(ctx, 10*time.Millisecond)
+
+	writePair("second.example.com")
+	later := time.Now().Add(time.Second)
+	os.Chtimes(certFile, later, later)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for currentHost(reloader) != "second.example.com" {
+		if time.Now().After(deadline) {
+			t.Fatal("Certificate was not reloaded after the files changed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,183 @@
+package test_file
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/biswasurmi/book-cli/config"
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/domain/repository"
+	"github.com/biswasurmi/book-cli/service"
+)
+
+func Test_Trash(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "admin@example.com", Password: hashedPassword123, Role: entity.RoleAdmin})
+	repos.UserRepository.CreateUser(entity.User{ID: 2, Email: "user@example.com", Username: "user", Password: hashedPassword123, Role: entity.RoleUser})
+	admin := loginToken(t, s, `{"email":"admin@example.com","password":"password123"}`)
+	user := loginToken(t, s, `{"email":"user@example.com","password":"password123"}`)
+
+	response := sendJSON(s, "POST", "/api/v1/books", user, `{"name":"Learn API"}`)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	var book entity.Book
+	json.NewDecoder(response.Body).Decode(&book)
+	response = sendJSON(s, "DELETE", "/api/v1/books/"+book.UUID, user, "")
+	checkResponseCode(t, http.StatusNoContent, response.Code)
+
+	// Deleted books are gone from normal reads
+	checkResponseCode(t, http.StatusNotFound, sendJSON(s, "GET", "/api/v1/books/"+book.UUID, user, "").Code)
+	checkResponseCode(t, http.StatusNotFound, sendJSON(s, "PUT", "/api/v1/books/"+book.UUID, user, `{"name":"Learn Go"}`).Code)
+	response = sendJSON(s, "GET", "/api/v1/books", user, "")
+	if body := response.Body.String(); body != "[]\n" {
+		t.Errorf("Expected no books, got %s", body)
+	}
+
+	response = sendJSON(s, "DELETE", "/api/v1/users/2", admin, "")
+	checkResponseCode(t, http.StatusNoContent, response.Code)
+	response = postJSON(s, "/api/v1/login", `{"email":"user@example.com","password":"password123"}`)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+	// Tokens issued before the user was trashed stop working
+	checkResponseCode(t, http.StatusUnauthorized, sendJSON(s, "GET", "/api/v1/users/me", user, "").Code)
+	checkResponseCode(t, http.StatusUnauthorized, sendJSON(s, "POST", "/api/v1/books", user, `{"name":"Learn Go"}`).Code)
+	// The email stays taken while the user is in the trash
+	response = postJSON(s, "/api/v1/register", `{"email":"user@example.com","password":"password123"}`)
+	checkResponseCode(t, http.StatusConflict, response.Code)
+
+	response = sendJSON(s, "GET", "/api/v1/trash", admin, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var trash entity.Trash
+	json.NewDecoder(response.Body).Decode(&trash)
+	if len(trash.Books) != 1 || trash.Books[0].UUID != book.UUID || trash.Books[0].DeletedAt == nil {
+		t.Errorf("Expected the book in the trash, got %+v", trash.Books)
+	}
+	if len(trash.Users) != 1 || trash.Users[0].ID != 2 || trash.Users[0].DeletedAt.IsZero() {
+		t.Errorf("Expected the user in the trash, got %+v", trash.Users)
+	}
+
+	// Only admins see and restore the trash
+	reader := loginToken(t, s, `{"email":"admin@example.com","password":"password123","scope":"books:read"}`)
+	checkResponseCode(t, http.StatusForbidden, sendJSON(s, "GET", "/api/v1/trash", reader, "").Code)
+	checkResponseCode(t, http.StatusForbidden, sendJSON(s, "POST", "/api/v1/trash/books/"+book.UUID+"/restore", reader, "").Code)
+
+	response = sendJSON(s, "POST", "/api/v1/trash/books/"+book.UUID+"/restore", admin, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var restored entity.Book
+	json.NewDecoder(response.Body).Decode(&restored)
+	if restored.Name != "Learn API" || restored.CreatedBy != 2 || restored.DeletedAt != nil {
+		t.Errorf("Unexpected restored book %+v", restored)
+	}
+	checkResponseCode(t, http.StatusOK, sendJSON(s, "GET", "/api/v1/books/"+book.UUID, admin, "").Code)
+	checkResponseCode(t, http.StatusNotFound, sendJSON(s, "POST", "/api/v1/trash/books/"+book.UUID+"/restore", admin, "").Code)
+
+	response = sendJSON(s, "POST", "/api/v1/trash/users/2/restore", admin, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	loginToken(t, s, `{"email":"user@example.com","password":"password123"}`)
+	checkResponseCode(t, http.StatusNotFound, sendJSON(s, "POST", "/api/v1/trash/users/2/restore", admin, "").Code)
+	checkResponseCode(t, http.StatusBadRequest, sendJSON(s, "POST", "/api/v1/trash/users/abc/restore", admin, "").Code)
+
+	if events := auditEvents(t, s, admin, "action=book.restore"); len(events) != 1 || events[0].ActorID != 1 || events[0].TargetID != book.UUID {
+		t.Errorf("Expected the book restore to be audited, got %+v", events)
+	}
+	if events := auditEvents(t, s, admin, "action=user.restore&target_id=2"); len(events) != 1 {
+		t.Errorf("Expected the user restore to be audited, got %+v", events)
+	}
+}
+
+func Test_Trash_Purge(t *testing.T) {
+	cfg := testConfig()
+	cfg.Trash.Retention = 24 * time.Hour
+	s, repos := setupServerWithConfig(t, cfg)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "admin@example.com", Password: hashedPassword123, Role: entity.RoleAdmin})
+	repos.UserRepository.CreateUser(entity.User{ID: 2, Email: "user@example.com", Password: hashedPassword123, Role: entity.RoleUser})
+	admin := loginToken(t, s, `{"email":"admin@example.com","password":"password123"}`)
+
+	var uuids []string
+	for _, name := range []string{"Learn API", "Learn Go"} {
+		response := sendJSON(s, "POST", "/api/v1/books", admin, `{"name":"`+name+`"}`)
+		var book entity.Book
+		json.NewDecoder(response.Body).Decode(&book)
+		uuids = append(uuids, book.UUID)
+	}
+	sendJSON(s, "PUT", "/api/v1/books/"+uuids[0], admin, `{"name":"Learn API 2"}`)
+	checkResponseCode(t, http.StatusNoContent, sendJSON(s, "DELETE", "/api/v1/books/"+uuids[0], admin, "").Code)
+	checkResponseCode(t, http.StatusNoContent, sendJSON(s, "DELETE", "/api/v1/users/2", admin, "").Code)
+
+	// Nothing is old enough yet
+	if purged, err := s.Services.Trash.Purge(time.Now()); err != nil || purged != 0 {
+		t.Errorf("Expected nothing to be purged, got %d, %v", purged, err)
+	}
+
+	purged, err := s.Services.Trash.Purge(time.Now().Add(25 * time.Hour))
+	if err != nil || purged != 2 {
+		t.Fatalf("Expected 2 items to be purged, got %d, %v", purged, err)
+	}
+	trash, _ := s.Services.Trash.List()
+	if len(trash.Books) != 0 || len(trash.Users) != 0 {
+		t.Errorf("Expected an empty trash, got %+v", trash)
+	}
+	if revisions, _ := repos.BookRevisionRepository.GetBookRevisions(uuids[0]); len(revisions) != 0 {
+		t.Errorf("Expected the purged book's revisions to be removed, got %+v", revisions)
+	}
+	if _, err := repos.BookRepository.GetBook(uuids[1]); err != nil {
+		t.Errorf("Expected the other book to be kept, got %v", err)
+	}
+	if events := auditEvents(t, s, admin, "action=book.purge"); len(events) != 1 || events[0].ActorID != 0 || events[0].TargetID != uuids[0] {
+		t.Errorf("Expected the purge to be audited, got %+v", events)
+	}
+
+	// A purged user's email can be registered again
+	response := postJSON(s, "/api/v1/register", `{"email":"user@example.com","password":"password123"}`)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+}
+
+func Test_Trash_Config(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.JWTSecret = "secret"
+	if cfg.Trash.Retention != 30*24*time.Hour || cfg.Trash.PurgeInterval != time.Hour {
+		t.Errorf("Unexpected trash defaults %+v", cfg.Trash)
+	}
+	cfg.Trash.Retention = -time.Hour
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected a negative retention to be rejected")
+	}
+	cfg.Trash.Retention = time.Hour
+	cfg.Trash.PurgeInterval = 0
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected a purge interval of 0 to be rejected")
+	}
+	cfg.Trash.Retention = 0
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected a retention of 0 to disable the purge, got %v", err)
+	}
+}
+
+// restoringBooks restores every book in the trash right after listing it,
+// as an admin restoring a book during a purge would.
+type restoringBooks struct {
+	repository.BookRepository
+}
+
+func (r restoringBooks) GetDeletedBooks() ([]entity.Book, error) {
+	books, err := r.BookRepository.GetDeletedBooks()
+	for _, book := range books {
+		r.BookRepository.RestoreBook(book.UUID)
+	}
+	return books, err
+}
+
+func Test_Trash_Purge_Restored_Meanwhile(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.BookRepository.CreateBook(entity.Book{UUID: "b-1", Name: "Learn API"})
+	repos.BookRepository.DeleteBook("b-1")
+
+	trash := service.NewTrashService(restoringBooks{repos.BookRepository}, repos.BookRevisionRepository, repos.UserRepository, s.Services.Audit, s.Services.Events, time.Hour)
+	purged, err := trash.Purge(time.Now().Add(2 * time.Hour))
+	if err != nil || purged != 0 {
+		t.Errorf("Expected nothing to be purged, got %d, %v", purged, err)
+	}
+	if _, err := repos.BookRepository.GetBook("b-1"); err != nil {
+		t.Errorf("Expected the restored book to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package test_file
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/biswasurmi/book-cli/api/handler"
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/service"
+)
+
+const hashedPassword123 = "$2a$10$bxCN.KcstTAU5I1zkZNe/OYrwD5gUc93lNl5pTit40/ZugB9YwuT6"
+
+func sendJSON(s *handler.Server, method, url, token, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return executeRequest(req, s)
+}
+
+// loginToken logs in and returns the token, failing the test otherwise.
+func loginToken(t *testing.T, s *handler.Server, body string) string {
+	t.Helper()
+	response := postJSON(s, "/api/v1/login", body)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var login map[string]string
+	json.NewDecoder(response.Body).Decode(&login)
+	return login["token"]
+}
+
+// enableTwoFactor enrolls the token's user and returns the secret and
+// recovery codes.
+func enableTwoFactor(t *testing.T, s *handler.Server, token string) (string, []string) {
+	t.Helper()
+	response := sendJSON(s, "POST", "/api/v1/users/me/2fa", token, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var enrollment service.TOTPEnrollment
+	json.NewDecoder(response.Body).Decode(&enrollment)
+
+	code, _ := service.GenerateTOTP(enrollment.Secret, time.Now())
+	response = sendJSON(s, "POST", "/api/v1/users/me/2fa/confirm", token, `{"code":"`+code+`"}`)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	json.NewDecoder(response.Body).Decode(&confirmed)
+	return enrollment.Secret, confirmed.RecoveryCodes
+}
+
+func Test_Two_Factor_Enrollment(t *testing.T) {
+	s, repos := setupServer(t)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "test@example.com", Password: hashedPassword123})
+	login := `{"email":"test@example.com","password":"password123"}`
+	token := loginToken(t, s, login)
+
+	response := sendJSON(s, "POST", "/api/v1/users/me/2fa", token, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var enrollment service.TOTPEnrollment
+	json.NewDecoder(response.Body).Decode(&enrollment)
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/Book%20API:test@example.com?") || !strings.Contains(enrollment.URI, "secret="+enrollment.Secret) {
+		t.Errorf("Unexpected otpauth URI %q", enrollment.URI)
+	}
+
+	// Not required at login until confirmed
+	loginToken(t, s, login)
+
+	response = sendJSON(s, "POST", "/api/v1/users/me/2fa/confirm", token, `{"code":"000000"}`)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+
+	code, _ := service.GenerateTOTP(enrollment.Secret, time.Now())
+	response = sendJSON(s, "POST", "/api/v1/users/me/2fa/confirm", token, `{"code":"`+code+`"}`)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	json.NewDecoder(response.Body).Decode(&confirmed)
+	if len(confirmed.RecoveryCodes) != 10 {
+		t.Errorf("Expected 10 recovery codes, got %v", confirmed.RecoveryCodes)
+	}
+
+	response = sendJSON(s, "POST", "/api/v1/users/me/2fa", token, "")
+	checkResponseCode(t, http.StatusConflict, response.Code)
+
+	// The secret and recovery codes are never shown again
+	response = sendJSON(s, "GET", "/api/v1/users/me", token, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	body := response.Body.String()
+	if !strings.Contains(body, `"totp_enabled":true`) || strings.Contains(body, enrollment.Secret) || strings.Contains(body, "recovery_codes") {
+		t.Errorf("Unexpected user %s", body)
+	}
+}
+
+func Test_Two_Factor_Login(t *testing.T) {
+	cfg := testConfig()
+	// This test logs in more often than the limits allow
+	cfg.RateLimit.AccountPerMinute = 0
+	cfg.Lockout.FreeAttempts = 10
+	s, repos := setupServerWithConfig(t, cfg)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "test@example.com", Password: hashedPassword123})
+	login := `{"email":"test@example.com","password":"password123"}`
+	secret, recoveryCodes := enableTwoFactor(t, s, loginToken(t, s, login))
+
+	// A correct password alone only yields a challenge
+	response := postJSON(s, "/api/v1/login", login)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+	var challenge struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+	json.NewDecoder(response.Body).Decode(&challenge)
+	if !challenge.MFARequired || challenge.MFAToken == "" {
+		t.Fatalf("Expected a challenge, got %+v", challenge)
+	}
+
+	// The code used for confirmation cannot be replayed
+	used, _ := service.GenerateTOTP(secret, time.Now())
+	response = postJSON(s, "/api/v1/login/2fa", `{"mfa_token":"`+challenge.MFAToken+`","code":"`+used+`"}`)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+
+	next, _ := service.GenerateTOTP(secret, time.Now().Add(30*time.Second))
+	response = postJSON(s, "/api/v1/login/2fa", `{"mfa_token":"`+challenge.MFAToken+`","code":"`+next+`"}`)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var tokens map[string]string
+	json.NewDecoder(response.Body).Decode(&tokens)
+	claims, err := service.NewTokenService(testConfig().Auth.JWTSecret, time.Hour, nil).Parse(tokens["token"])
+	if err != nil || !service.HasAuthMethod(claims, service.AuthMethodOTP) {
+		t.Errorf("Expected a token with amr otp, got %v, %v", claims, err)
+	}
+
+	// A challenge works once
+	response = postJSON(s, "/api/v1/login/2fa", `{"mfa_token":"`+challenge.MFAToken+`","code":"`+recoveryCodes[0]+`"}`)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+
+	// Recovery codes work in place of a TOTP code, once each
+	loginToken(t, s, `{"email":"test@example.com","password":"password123","code":"`+recoveryCodes[0]+`"}`)
+	response = postJSON(s, "/api/v1/login", `{"email":"test@example.com","password":"password123","code":"`+recoveryCodes[0]+`"}`)
+	checkResponseCode(t, http.StatusUnauthorized, response.Code)
+
+	req, _ := http.NewRequest("GET", "/api/v1/get-token", nil)
+	req.Header.Set("Authorization", BasicAuthHeader("test@example.com", "password123"))
+	checkResponseCode(t, http.StatusUnauthorized, executeRequest(req, s).Code)
+	req.Header.Set("X-TOTP-Code", recoveryCodes[1])
+	checkResponseCode(t, http.StatusOK, executeRequest(req, s).Code)
+
+	// Disabling requires a code and removes the second step
+	token := loginToken(t, s, `{"email":"test@example.com","password":"password123","code":"`+recoveryCodes[2]+`"}`)
+	response = sendJSON(s, "DELETE", "/api/v1/users/me/2fa", token, `{"code":"000000"}`)
+	checkResponseCode(t, http.StatusBadRequest, response.Code)
+	response = sendJSON(s, "DELETE", "/api/v1/users/me/2fa", token, `{"code":"`+recoveryCodes[3]+`"}`)
+	checkResponseCode(t, http.StatusNoContent, response.Code)
+	loginToken(t, s, login)
+}
+
+func Test_Two_Factor_Required_For_Role(t *testing.T) {
+	cfg := testConfig()
+	cfg.Auth.TwoFactorRoles = []string{entity.RoleAdmin}
+	s, repos := setupServerWithConfig(t, cfg)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "admin@example.com", Password: hashedPassword123, Role: entity.RoleAdmin})
+	login := `{"email":"admin@example.com","password":"password123"}`
+
+	token := loginToken(t, s, login)
+	response := sendJSON(s, "GET", "/api/v1/admin/lockouts", token, "")
+	checkResponseCode(t, http.StatusForbidden, response.Code)
+
+	_, recoveryCodes := enableTwoFactor(t, s, token)
+	token = loginToken(t, s, `{"email":"admin@example.com","password":"password123","code":"`+recoveryCodes[0]+`"}`)
+	response = sendJSON(s, "GET", "/api/v1/admin/lockouts", token, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+}
+
+func Test_Two_Factor_Lockout(t *testing.T) {
+	cfg := testConfig()
+	cfg.Lockout.Threshold = 3
+	cfg.Lockout.FreeAttempts = 10
+	s, repos := setupServerWithConfig(t, cfg)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "test@example.com", Password: hashedPassword123})
+	login := `{"email":"test@example.com","password":"password123"}`
+	enableTwoFactor(t, s, loginToken(t, s, login))
+
+	// Wrong codes count against the account like wrong passwords
+	for i := 0; i < 3; i++ {
+		response := postJSON(s, "/api/v1/login", `{"email":"test@example.com","password":"password123","code":"000000"}`)
+		checkResponseCode(t, http.StatusUnauthorized, response.Code)
+	}
+	response := postJSON(s, "/api/v1/login", login)
+	checkResponseCode(t, http.StatusTooManyRequests, response.Code)
+}
@@ -0,0 +1,415 @@
+package test_file
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/biswasurmi/book-cli/api/handler"
+	"github.com/biswasurmi/book-cli/config"
+	"github.com/biswasurmi/book-cli/domain/entity"
+	"github.com/biswasurmi/book-cli/service"
+)
+
+// receivedWebhook is one request made to a webhook receiver.
+type receivedWebhook struct {
+	Header http.Header
+	Body   []byte
+}
+
+// webhookReceiver starts a receiver that answers its nth request (from 1)
+// with status(n) and passes every request on.
+func webhookReceiver(t *testing.T, status func(n int) int) (*httptest.Server, <-chan receivedWebhook) {
+	t.Helper()
+	received := make(chan receivedWebhook, 100)
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- receivedWebhook{Header: r.Header.Clone(), Body: body}
+		w.WriteHeader(status(int(atomic.AddInt32(&count, 1))))
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+func nextWebhook(t *testing.T, received <-chan receivedWebhook) receivedWebhook {
+	t.Helper()
+	select {
+	case request := <-received:
+		return request
+	case <-time.After(5 * time.Second):
+		t.Fatal("No webhook was delivered")
+		return receivedWebhook{}
+	}
+}
+
+// webhookServer starts a server with its webhook worker running and
+// returns it with an admin and a user token.
+func webhookServer(t *testing.T, configure func(*config.Webhooks)) (*handler.Server, string, string) {
+	t.Helper()
+	cfg := testConfig()
+	cfg.Webhooks.RetryBase = 10 * time.Millisecond
+	cfg.Webhooks.RetryMax = 40 * time.Millisecond
+	if configure != nil {
+		configure(&cfg.Webhooks)
+	}
+	s, repos := setupServerWithConfig(t, cfg)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "admin@example.com", Password: hashedPassword123, Role: entity.RoleAdmin})
+	repos.UserRepository.CreateUser(entity.User{ID: 2, Email: "user@example.com", Password: hashedPassword123, Role: entity.RoleUser})
+	admin := loginToken(t, s, `{"email":"admin@example.com","password":"password123"}`)
+	user := loginToken(t, s, `{"email":"user@example.com","password":"password123"}`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Services.Webhooks.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return s, admin, user
+}
+
+func createWebhook(t *testing.T, s *handler.Server, admin, body string) entity.Webhook {
+	t.Helper()
+	response := sendJSON(s, "POST", "/api/v1/webhooks", admin, body)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	var webhook entity.Webhook
+	json.NewDecoder(response.Body).Decode(&webhook)
+	return webhook
+}
+
+func webhookDeliveries(t *testing.T, s *handler.Server, admin, id string) []entity.WebhookDelivery {
+	t.Helper()
+	response := sendJSON(s, "GET", "/api/v1/webhooks/"+id+"/deliveries", admin, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var deliveries []entity.WebhookDelivery
+	json.NewDecoder(response.Body).Decode(&deliveries)
+	return deliveries
+}
+
+// waitForDeliveries waits until n deliveries to the webhook are logged
+// and returns them.
+func waitForDeliveries(t *testing.T, s *handler.Server, admin, id string, n int) []entity.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries := webhookDeliveries(t, s, admin, id)
+		if len(deliveries) >= n || time.Now().After(deadline) {
+			return deliveries
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForWebhook polls the webhook until done returns true.
+func waitForWebhook(t *testing.T, s *handler.Server, id string, done func(entity.Webhook) bool) entity.Webhook {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		webhook, err := s.Services.Webhooks.Get(id)
+		if err == nil && done(webhook) {
+			return webhook
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Webhook did not reach the expected state: %+v, %v", webhook, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_Webhooks(t *testing.T) {
+	s, admin, user := webhookServer(t, nil)
+	receiver, received := webhookReceiver(t, func(int) int { return http.StatusNoContent })
+
+	for _, body := range []string{
+		`{"url":"ftp://example.com/hook"}`,
+		`{"url":"/hook"}`,
+		`{"url":"` + receiver.URL + `","events":["book.renamed"]}`,
+		`not json`,
+	} {
+		response := sendJSON(s, "POST", "/api/v1/webhooks", admin, body)
+		checkResponseCode(t, http.StatusBadRequest, response.Code)
+	}
+	// Only admins manage webhooks
+	checkResponseCode(t, http.StatusForbidden, sendJSON(s, "POST", "/api/v1/webhooks", user, `{"url":"`+receiver.URL+`"}`).Code)
+	checkResponseCode(t, http.StatusForbidden, sendJSON(s, "GET", "/api/v1/webhooks", user, "").Code)
+
+	webhook := createWebhook(t, s, admin, `{"url":"`+receiver.URL+`","events":["book.created","book.deleted"]}`)
+	if webhook.ID == "" || len(webhook.Secret) < 40 || !webhook.Active || webhook.CreatedBy != 1 {
+		t.Fatalf("Unexpected webhook %+v", webhook)
+	}
+
+	// The secret is only shown once
+	response := sendJSON(s, "GET", "/api/v1/webhooks", admin, "")
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var listed []entity.Webhook
+	json.NewDecoder(response.Body).Decode(&listed)
+	if len(listed) != 1 || listed[0].ID != webhook.ID || listed[0].Secret != "" {
+		t.Errorf("Expected the webhook without its secret, got %+v", listed)
+	}
+
+	response = sendJSON(s, "POST", "/api/v1/books", user, `{"name":"Learn API"}`)
+	checkResponseCode(t, http.StatusCreated, response.Code)
+	var book entity.Book
+	json.NewDecoder(response.Body).Decode(&book)
+	sendJSON(s, "PUT", "/api/v1/books/"+book.UUID, user, `{"name":"Learn Go"}`)
+	sendJSON(s, "DELETE", "/api/v1/books/"+book.UUID, user, "")
+
+	// Only the subscribed events arrive, signed with the secret. Workers
+	// deliver in parallel, so the order is not fixed
+	got := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		request := nextWebhook(t, received)
+		var event entity.Event
+		if err := json.Unmarshal(request.Body, &event); err != nil {
+			t.Fatalf("Invalid webhook body %q: %v", request.Body, err)
+		}
+		timestamp := request.Header.Get(service.WebhookTimestampHeader)
+		if sent, err := strconv.ParseInt(timestamp, 10, 64); err != nil || time.Since(time.Unix(sent, 0)) > time.Minute {
+			t.Errorf("Expected a current timestamp, got %q", timestamp)
+		}
+		signature := service.SignWebhook(webhook.Secret, timestamp, request.Body)
+		if request.Header.Get(service.WebhookSignatureHeader) != signature {
+			t.Errorf("Signature %q does not match %q", request.Header.Get(service.WebhookSignatureHeader), signature)
+		}
+		if request.Header.Get(service.WebhookEventHeader) != event.Type ||
+			request.Header.Get(service.WebhookEventIDHeader) != strconv.FormatInt(event.ID, 10) {
+			t.Errorf("Headers %v do not match %s", request.Header, request.Body)
+		}
+		got[event.Type] = true
+	}
+	if !got[entity.EventBookCreated] || !got[entity.EventBookDeleted] {
+		t.Errorf("Expected book.created and book.deleted, got %v", got)
+	}
+
+	deliveries := waitForDeliveries(t, s, admin, webhook.ID, 2)
+	if len(deliveries) != 2 {
+		t.Fatalf("Expected two deliveries, got %+v", deliveries)
+	}
+	for _, delivery := range deliveries {
+		if !delivery.Success || delivery.StatusCode != http.StatusNoContent || delivery.Attempt != 1 || delivery.WebhookID != webhook.ID {
+			t.Errorf("Expected a successful first attempt, got %+v", delivery)
+		}
+	}
+
+	// Updating the events changes what is delivered
+	response = sendJSON(s, "PUT", "/api/v1/webhooks/"+webhook.ID, admin, `{"events":["book.updated"]}`)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var updated entity.Webhook
+	json.NewDecoder(response.Body).Decode(&updated)
+	if len(updated.Events) != 1 || updated.URL != receiver.URL || updated.Secret != "" {
+		t.Errorf("Unexpected updated webhook %+v", updated)
+	}
+	checkResponseCode(t, http.StatusBadRequest, sendJSON(s, "PUT", "/api/v1/webhooks/"+webhook.ID, admin, `{"url":"example.com"}`).Code)
+	response = sendJSON(s, "POST", "/api/v1/books", user, `{"name":"Learn SQL"}`)
+	json.NewDecoder(response.Body).Decode(&book)
+	sendJSON(s, "PUT", "/api/v1/books/"+book.UUID, user, `{"name":"Learn Rust"}`)
+	if request := nextWebhook(t, received); request.Header.Get(service.WebhookEventHeader) != entity.EventBookUpdated {
+		t.Errorf("Expected only book.updated, got %s", request.Body)
+	}
+
+	if events := auditEvents(t, s, admin, "target_type=webhook"); len(events) != 2 {
+		t.Errorf("Expected the create and update to be audited, got %+v", events)
+	}
+
+	checkResponseCode(t, http.StatusNoContent, sendJSON(s, "DELETE", "/api/v1/webhooks/"+webhook.ID, admin, "").Code)
+	for _, path := range []string{"", "/deliveries"} {
+		checkResponseCode(t, http.StatusNotFound, sendJSON(s, "GET", "/api/v1/webhooks/"+webhook.ID+path, admin, "").Code)
+	}
+	checkResponseCode(t, http.StatusNotFound, sendJSON(s, "DELETE", "/api/v1/webhooks/"+webhook.ID, admin, "").Code)
+}
+
+func Test_Webhooks_Retry(t *testing.T) {
+	s, admin, user := webhookServer(t, nil)
+	// Fail twice, then succeed
+	receiver, received := webhookReceiver(t, func(n int) int {
+		if n <= 2 {
+			return http.StatusInternalServerError
+		}
+		return http.StatusOK
+	})
+	webhook := createWebhook(t, s, admin, `{"url":"`+receiver.URL+`"}`)
+
+	sendJSON(s, "POST", "/api/v1/books", user, `{"name":"Learn API"}`)
+	var deliveryIDs []string
+	for i := 0; i < 3; i++ {
+		request := nextWebhook(t, received)
+		if request.Header.Get(service.WebhookEventHeader) != entity.EventBookCreated {
+			t.Errorf("Expected book.created to be retried, got %s", request.Body)
+		}
+		deliveryIDs = append(deliveryIDs, request.Header.Get(service.WebhookDeliveryHeader))
+	}
+	if deliveryIDs[0] == deliveryIDs[1] || deliveryIDs[1] == deliveryIDs[2] {
+		t.Errorf("Expected each attempt to have its own delivery ID, got %v", deliveryIDs)
+	}
+
+	waitForWebhook(t, s, webhook.ID, func(w entity.Webhook) bool { return w.Failures == 0 && !w.LastDeliveryAt.IsZero() })
+	deliveries := webhookDeliveries(t, s, admin, webhook.ID)
+	if len(deliveries) != 3 {
+		t.Fatalf("Expected 3 attempts, got %+v", deliveries)
+	}
+	for i, want := range []struct {
+		attempt int
+		status  int
+		success bool
+	}{{3, http.StatusOK, true}, {2, http.StatusInternalServerError, false}, {1, http.StatusInternalServerError, false}} {
+		got := deliveries[i]
+		if got.Attempt != want.attempt || got.StatusCode != want.status || got.Success != want.success {
+			t.Errorf("Delivery %d: expected attempt %d with %d, got %+v", i, want.attempt, want.status, got)
+		}
+	}
+	if deliveries[1].Error == "" {
+		t.Errorf("Expected the failure to be logged with an error, got %+v", deliveries[1])
+	}
+	select {
+	case request := <-received:
+		t.Errorf("Unexpected delivery after success: %s", request.Body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func Test_Webhooks_Disable(t *testing.T) {
+	s, admin, user := webhookServer(t, func(cfg *config.Webhooks) {
+		cfg.MaxAttempts = 10
+		cfg.DisableAfter = 3
+	})
+	var failing atomic.Bool
+	failing.Store(true)
+	receiver, received := webhookReceiver(t, func(int) int {
+		if failing.Load() {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+	webhook := createWebhook(t, s, admin, `{"url":"`+receiver.URL+`"}`)
+
+	sendJSON(s, "POST", "/api/v1/books", user, `{"name":"Learn API"}`)
+	disabled := waitForWebhook(t, s, webhook.ID, func(w entity.Webhook) bool { return !w.Active })
+	if disabled.Failures != 3 || disabled.DisabledAt.IsZero() {
+		t.Errorf("Expected the webhook to be disabled after 3 failures, got %+v", disabled)
+	}
+	// The remaining retries are dropped
+	time.Sleep(100 * time.Millisecond)
+	if deliveries := webhookDeliveries(t, s, admin, webhook.ID); len(deliveries) != 3 {
+		t.Errorf("Expected 3 attempts before disabling, got %+v", deliveries)
+	}
+	if events := auditEvents(t, s, admin, "action=webhook.disable"); len(events) != 1 || events[0].ActorID != 0 || events[0].TargetID != webhook.ID {
+		t.Errorf("Expected the disabling to be audited, got %+v", events)
+	}
+
+	// Disabled webhooks get nothing
+	for len(received) > 0 {
+		<-received
+	}
+	sendJSON(s, "POST", "/api/v1/books", user, `{"name":"Learn Go"}`)
+	select {
+	case request := <-received:
+		t.Errorf("Unexpected delivery to a disabled webhook: %s", request.Body)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Re-enabling resets the failures
+	failing.Store(false)
+	response := sendJSON(s, "PUT", "/api/v1/webhooks/"+webhook.ID, admin, `{"active":true}`)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var enabled entity.Webhook
+	json.NewDecoder(response.Body).Decode(&enabled)
+	if !enabled.Active || enabled.Failures != 0 || !enabled.DisabledAt.IsZero() {
+		t.Errorf("Expected the webhook to be enabled again, got %+v", enabled)
+	}
+	sendJSON(s, "POST", "/api/v1/books", user, `{"name":"Learn SQL"}`)
+	nextWebhook(t, received)
+}
+
+func Test_Webhooks_Restart(t *testing.T) {
+	cfg := testConfig()
+	cfg.Webhooks.RetryBase = 300 * time.Millisecond
+	s, repos := setupServerWithConfig(t, cfg)
+	repos.UserRepository.CreateUser(entity.User{ID: 1, Email: "admin@example.com", Password: hashedPassword123, Role: entity.RoleAdmin})
+	admin := loginToken(t, s, `{"email":"admin@example.com","password":"password123"}`)
+	receiver, received := webhookReceiver(t, func(n int) int {
+		if n == 1 {
+			return http.StatusInternalServerError
+		}
+		return http.StatusOK
+	})
+	webhook := createWebhook(t, s, admin, `{"url":"`+receiver.URL+`"}`)
+
+	// run starts a worker as a freshly started server would, sharing the
+	// repositories, and returns a function that stops it
+	run := func(webhooks service.WebhookService) func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			webhooks.Run(ctx)
+			close(done)
+		}()
+		return func() {
+			cancel()
+			<-done
+		}
+	}
+
+	stop := run(s.Services.Webhooks)
+	sendJSON(s, "POST", "/api/v1/books", admin, `{"name":"Learn API"}`)
+	first := nextWebhook(t, received)
+	waitForDeliveries(t, s, admin, webhook.ID, 1)
+	stop()
+
+	pending, _ := repos.WebhookDeliveryRepository.GetPendingWebhookDeliveries()
+	if len(pending) != 1 || pending[0].Attempt != 2 || pending[0].WebhookID != webhook.ID {
+		t.Fatalf("Expected the retry to be stored, got %+v", pending)
+	}
+
+	restarted := service.NewWebhookService(repos.WebhookRepository, repos.WebhookDeliveryRepository, s.Services.Events, s.Services.IDs, s.Services.Audit, cfg.Webhooks)
+	stop = run(restarted)
+	defer stop()
+	second := nextWebhook(t, received)
+	if second.Header.Get(service.WebhookEventIDHeader) != first.Header.Get(service.WebhookEventIDHeader) {
+		t.Errorf("Expected the same event to be retried, got %s after %s", second.Body, first.Body)
+	}
+	deliveries := waitForDeliveries(t, s, admin, webhook.ID, 2)
+	if len(deliveries) != 2 || deliveries[0].Attempt != 2 || !deliveries[0].Success || deliveries[1].Success {
+		t.Errorf("Expected the log to survive with the retry on top, got %+v", deliveries)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pending, _ := repos.WebhookDeliveryRepository.GetPendingWebhookDeliveries()
+		if len(pending) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected nothing pending after the retry succeeded, got %+v", pending)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_Webhooks_Config(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.JWTSecret = "secret"
+	if cfg.Webhooks.MaxAttempts != 5 || cfg.Webhooks.DisableAfter != 20 || cfg.Webhooks.RetryBase != 5*time.Second {
+		t.Errorf("Unexpected webhook defaults %+v", cfg.Webhooks)
+	}
+	for _, configure := range []func(*config.Webhooks){
+		func(c *config.Webhooks) { c.Workers = 0 },
+		func(c *config.Webhooks) { c.MaxAttempts = 0 },
+		func(c *config.Webhooks) { c.RetryMax = time.Second },
+		func(c *config.Webhooks) { c.DisableAfter = -1 },
+	} {
+		cfg := *cfg
+		configure(&cfg.Webhooks)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg.Webhooks)
+		}
+	}
+}